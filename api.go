@@ -0,0 +1,701 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"my-websocket/services/websocket"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// tracer REST handler 的 span；全域 TracerProvider 未設定時為 noop
+var tracer = otel.Tracer("my-websocket")
+
+// 單次 REST 廣播最多可指定的房間數
+const maxBroadcastRooms = 100
+
+// 批次廣播單次最多的訊息數
+const maxBroadcastBatch = 1000
+
+// 房間歷史與訊息紀錄每頁的預設與最多訊息數
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+type broadcastReq struct {
+	Message string   `json:"message" binding:"required"`
+	Rooms   []string `json:"rooms"` // 只用於 POST /api/broadcast；空白表示全域
+	Tags    string   `json:"tags"`  // 只用於 POST /api/broadcast：標籤條件（例如 "beta && mobile"），只送到本 instance
+}
+
+// bindMessage 解析 {"message":"..."}；body 超過 MaxBodySize 回 413，格式錯誤回 400
+func bindMessage(c *gin.Context, req *broadcastReq) bool {
+	err := c.ShouldBindJSON(req)
+	switch {
+	case err == nil:
+		return true
+	case websocket.IsBodyTooLarge(err):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+	}
+	return false
+}
+
+// tooLarge 編碼後超過 hub 的 MaxMessageSize 時回 413，避免把大 frame 推進每個 client 的佇列
+func tooLarge(c *gin.Context, h *websocket.Hub, payload []byte) bool {
+	if len(payload) <= h.MaxMessageSize() {
+		return false
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": websocket.ErrMessageTooLarge.Error()})
+	return true
+}
+
+func broadcastAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 延續呼叫端 header 的 traceparent，讓 trace 從 HTTP POST 一路接到 client 寫出
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, "POST /api/broadcast")
+		defer span.End()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			if websocket.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			broadcastBatch(c, h, trimmed)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var req broadcastReq
+		if !bindMessage(c, &req) {
+			return
+		}
+		if req.Tags != "" {
+			broadcastTags(c, h, req)
+			return
+		}
+		if len(req.Rooms) > 0 {
+			broadcastRooms(c, h, req)
+			return
+		}
+		msg := gin.H{
+			"type":    "server_broadcast",
+			"message": req.Message,
+			"time":    time.Now().Format(time.RFC3339),
+		}
+		if c.Query("wait") == "true" {
+			broadcastSync(ctx, c, h, msg)
+			return
+		}
+		err = h.BroadcastJSONContext(ctx, msg)
+		if !broadcastFailed(c, err) {
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		}
+	}
+}
+
+// broadcastSync ?wait=true：等各 shard 投遞完，回報本 instance 送出與丟棄的連線數
+func broadcastSync(ctx context.Context, c *gin.Context, h *websocket.Hub, msg gin.H) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tooLarge(c, h, payload) {
+		return
+	}
+	res, err := h.BroadcastSync(ctx, payload)
+	if !broadcastFailed(c, err) {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "result": res})
+	}
+}
+
+// roomBroadcastAPI 只對單一房間廣播
+func roomBroadcastAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req broadcastReq
+		if !bindMessage(c, &req) {
+			return
+		}
+		req.Rooms = []string{c.Param("room")}
+		broadcastRooms(c, h, req)
+	}
+}
+
+// roomMember GET /rooms/:room/members 的一筆（不含 Claims）
+type roomMember struct {
+	ID       string   `json:"id"`
+	UserID   string   `json:"userId,omitempty"`
+	ReadOnly bool     `json:"readOnly,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// roomMembersAPI 房間在本 instance 的成員與人數（依上線時間排序）
+func roomMembersAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		room := c.Param("room")
+		infos := h.RoomMembers(room)
+		members := make([]roomMember, len(infos))
+		for i, info := range infos {
+			members[i] = roomMember{ID: info.ID, UserID: info.UserID, ReadOnly: info.ReadOnly, Tags: info.Tags}
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room, "count": len(members), "members": members})
+	}
+}
+
+type historyItem struct {
+	ID     uint64          `json:"id"`
+	Time   time.Time       `json:"time"`
+	Binary bool            `json:"binary,omitempty"`
+	Data   json.RawMessage `json:"data"` // 見 payloadJSON
+}
+
+// roomHistoryAPI 分頁查詢房間歷史：GET /rooms/:room/history?limit=50&before=<上一頁的 next_before>；
+// 每頁由舊到新，還有更早的訊息時回傳 next_before
+func roomHistoryAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := pageLimit(c)
+		if !ok {
+			return
+		}
+		var before uint64
+		if s := c.Query("before"); s != "" {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil || n == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before"})
+				return
+			}
+			before = n
+		}
+		room := c.Param("room")
+		msgs, err := h.RoomHistory(c.Request.Context(), room, before, limit)
+		switch {
+		case errors.Is(err, websocket.ErrHistoryDisabled):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items := make([]historyItem, len(msgs))
+		for i, m := range msgs {
+			items[i] = historyItem{ID: m.ID, Time: m.Time, Binary: m.Binary, Data: payloadJSON(m.Binary, m.Data)}
+		}
+		resp := gin.H{"room": room, "messages": items}
+		if len(msgs) == limit {
+			resp["next_before"] = msgs[0].ID
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// pageLimit 解析 ?limit=（預設 defaultHistoryLimit）；不合法時回 400
+func pageLimit(c *gin.Context) (int, bool) {
+	s := c.Query("limit")
+	if s == "" {
+		return defaultHistoryLimit, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxHistoryLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxHistoryLimit)})
+		return 0, false
+	}
+	return n, true
+}
+
+// payloadJSON JSON 訊息原樣放入，其他文字為字串，binary 為 base64
+func payloadJSON(binary bool, data []byte) json.RawMessage {
+	if !binary && json.Valid(data) {
+		return data
+	}
+	if binary {
+		b, _ := json.Marshal(data)
+		return b
+	}
+	b, _ := json.Marshal(string(data))
+	return b
+}
+
+type storedItem struct {
+	ID       string          `json:"id"`
+	Instance string          `json:"instance"`
+	Room     string          `json:"room,omitempty"`
+	Topic    string          `json:"topic,omitempty"`
+	Time     time.Time       `json:"time"`
+	Binary   bool            `json:"binary,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// messagesAPI 查詢 MessageStore 的稽核紀錄：GET /admin/messages?room=&topic=&since=&until=&limit=&after=；
+// since / until 為 RFC 3339，每頁由舊到新，還有更多時回傳 next_after
+func messagesAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := pageLimit(c)
+		if !ok {
+			return
+		}
+		q := websocket.MessageQuery{Room: c.Query("room"), Topic: c.Query("topic"), After: c.Query("after"), Limit: limit}
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &q.Since}, {"until", &q.Until}} {
+			if s := c.Query(p.name); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name + " (RFC 3339)"})
+					return
+				}
+				*p.dst = t
+			}
+		}
+		msgs, err := h.Messages(c.Request.Context(), q)
+		switch {
+		case errors.Is(err, websocket.ErrMessageStoreDisabled):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items := make([]storedItem, len(msgs))
+		for i, m := range msgs {
+			items[i] = storedItem{
+				ID: m.ID, Instance: m.Instance, Room: m.Room, Topic: m.Topic,
+				Time: m.Time, Binary: m.Binary, Data: payloadJSON(m.Binary, m.Data),
+			}
+		}
+		resp := gin.H{"messages": items}
+		if len(msgs) == limit {
+			resp["next_after"] = msgs[len(msgs)-1].ID
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// auditAPI 查詢稽核紀錄：?actor=apikey:default&action=POST /api/broadcast&room=&since=&until=&after=<next_after>
+func auditAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := pageLimit(c)
+		if !ok {
+			return
+		}
+		q := websocket.AuditQuery{
+			Actor: c.Query("actor"), Action: c.Query("action"), Room: c.Query("room"),
+			After: c.Query("after"), Limit: limit,
+		}
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &q.Since}, {"until", &q.Until}} {
+			if s := c.Query(p.name); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name + " (RFC 3339)"})
+					return
+				}
+				*p.dst = t
+			}
+		}
+		entries, err := h.AuditEntries(c.Request.Context(), q)
+		switch {
+		case errors.Is(err, websocket.ErrAuditLogDisabled):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if entries == nil {
+			entries = []websocket.AuditEntry{}
+		}
+		resp := gin.H{"entries": entries}
+		if len(entries) == limit {
+			resp["next_after"] = entries[len(entries)-1].ID
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// broadcastRooms 對每個房間各送一次（重複的房間只送一次）；訊息帶 room 欄位，
+// 同時在多個指定房間內的 client 會收到每個房間各一份
+func broadcastRooms(c *gin.Context, h *websocket.Hub, req broadcastReq) {
+	if len(req.Rooms) > maxBroadcastRooms {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many rooms"})
+		return
+	}
+	seen := make(map[string]bool, len(req.Rooms))
+	for _, room := range req.Rooms {
+		if room == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "room must not be empty"})
+			return
+		}
+		seen[room] = true
+	}
+	now := time.Now().Format(time.RFC3339)
+	for room := range seen {
+		err := h.BroadcastToRoomJSON(room, gin.H{
+			"type":    "server_broadcast",
+			"room":    room,
+			"message": req.Message,
+			"time":    now,
+		})
+		if broadcastFailed(c, err) {
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "rooms": len(seen)})
+}
+
+// broadcastTags 送給標籤符合條件的連線（見 Hub.BroadcastToTags），回傳送出的連線數
+func broadcastTags(c *gin.Context, h *websocket.Hub, req broadcastReq) {
+	if len(req.Rooms) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rooms and tags are mutually exclusive"})
+		return
+	}
+	payload, err := json.Marshal(gin.H{
+		"type":    "server_broadcast",
+		"message": req.Message,
+		"time":    time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tooLarge(c, h, payload) {
+		return
+	}
+	n, err := h.BroadcastToTags(req.Tags, payload)
+	switch {
+	case errors.Is(err, websocket.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"ok": true, "clients": n})
+	}
+}
+
+type batchItemReq struct {
+	Message string `json:"message"`
+	Room    string `json:"room"` // 與 user 擇一；都空白表示全域
+	User    string `json:"user"` // 送給該使用者的所有連線（server_direct）
+}
+
+type batchResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// broadcastBatch 處理 POST /api/broadcast 的陣列格式：整批在一次 hub 處理內投遞，
+// 回應與請求順序相同的逐則結果；個別訊息失敗不影響其他訊息
+func broadcastBatch(c *gin.Context, h *websocket.Hub, body []byte) {
+	var items []batchItemReq
+	if err := json.Unmarshal(body, &items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch"})
+		return
+	}
+	switch {
+	case len(items) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch is empty"})
+		return
+	case len(items) > maxBroadcastBatch:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many messages in batch"})
+		return
+	}
+
+	results := make([]batchResult, len(items))
+	msgs := make([]websocket.BatchMessage, 0, len(items))
+	index := make([]int, 0, len(items)) // msgs 對應的 items 位置
+	now := time.Now().Format(time.RFC3339)
+	for i, it := range items {
+		if it.Message == "" {
+			results[i].Error = "message is required"
+			continue
+		}
+		env := gin.H{"type": "server_broadcast", "message": it.Message, "time": now}
+		switch {
+		case it.Room != "" && it.User != "":
+			results[i].Error = websocket.ErrBatchTarget.Error()
+			continue
+		case it.Room != "":
+			env["room"] = it.Room
+		case it.User != "":
+			env["type"] = "server_direct"
+		}
+		payload, err := json.Marshal(env)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		msgs = append(msgs, websocket.BatchMessage{Room: it.Room, UserID: it.User, Data: payload})
+		index = append(index, i)
+	}
+	if len(msgs) > 0 {
+		errs := h.BroadcastBatch(msgs)
+		for j, err := range errs {
+			if errors.Is(err, websocket.ErrHubClosed) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				results[index[j]].Error = err.Error()
+			}
+		}
+	}
+	failed := 0
+	for i := range results {
+		if results[i].OK = results[i].Error == ""; !results[i].OK {
+			failed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "failed": failed, "results": results})
+}
+
+// broadcastFailed 廣播失敗時回應錯誤（編碼後過大回 413）並回傳 true
+func broadcastFailed(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, websocket.ErrMessageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+func publishAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req broadcastReq
+		if !bindMessage(c, &req) {
+			return
+		}
+		topic := c.Param("topic")
+		payload, err := json.Marshal(gin.H{
+			"type":    "server_publish",
+			"topic":   topic,
+			"message": req.Message,
+			"time":    time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if tooLarge(c, h, payload) {
+			return
+		}
+		if err := h.Publish(topic, payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+func sendAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req broadcastReq
+		if !bindMessage(c, &req) {
+			return
+		}
+		payload, err := json.Marshal(gin.H{
+			"type":    "server_direct",
+			"message": req.Message,
+			"time":    time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if tooLarge(c, h, payload) {
+			return
+		}
+		if err := h.SendTo(c.Param("clientID"), payload); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+func presenceAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"clients": h.Clients()})
+	}
+}
+
+func statsAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.Stats())
+	}
+}
+
+func adminClientsAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"clients": h.Clients()})
+	}
+}
+
+// clientDebugAPI 單一連線的除錯資訊（佇列深度、送出與丟棄數、房間、filter 等）；不在本 instance 時回 404
+func clientDebugAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, err := h.Inspect(c.Param("id"))
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, websocket.ErrHubClosed) {
+				status = http.StatusServiceUnavailable
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// kickAPI 強制斷線；可用 ?code=&reason= 指定 close frame（預設 1008 kicked by admin）
+func kickAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := websocket.ClosePolicyViolation
+		if s := c.Query("code"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid close code"})
+				return
+			}
+			code = n
+		}
+		reason := c.DefaultQuery("reason", "kicked by admin")
+		if err := h.Disconnect(c.Param("id"), code, reason); err != nil {
+			// 保留的 close code 或超過 123 bytes 的 reason
+			if errors.Is(err, websocket.ErrInvalidCloseFrame) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// drainAPI 停止接受新連線（滾動部署前），現有連線不受影響
+func drainAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.Drain())
+	}
+}
+
+// undrainAPI 恢復接受新連線
+func undrainAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.Undrain())
+	}
+}
+
+type banReq struct {
+	Kind     websocket.BanKind `json:"kind" binding:"required,oneof=ip user"`
+	Value    string            `json:"value" binding:"required"`
+	Duration string            `json:"duration"` // 例如 "1h"；空白表示永久
+	Reason   string            `json:"reason"`
+}
+
+func bansAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"bans": h.Bans()})
+	}
+}
+
+// banAPI 封鎖 IP 或使用者並斷開其現有連線
+func banAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req banReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if websocket.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind (ip|user) and value are required"})
+			return
+		}
+		var d time.Duration
+		if req.Duration != "" {
+			var err error
+			if d, err = time.ParseDuration(req.Duration); err != nil || d < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration"})
+				return
+			}
+		}
+		websocket.SetAuditTarget(c, string(req.Kind)+":"+req.Value)
+		if err := h.Ban(req.Kind, req.Value, d, req.Reason); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// unbanAPI 解除封鎖：DELETE /bans/:kind?value=...（IP/CIDR 含 "/"，所以放在 query）
+func unbanAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		websocket.SetAuditTarget(c, c.Param("kind")+":"+c.Query("value"))
+		if err := h.Unban(websocket.BanKind(c.Param("kind")), c.Query("value")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+type slowModeReq struct {
+	Interval string `json:"interval"` // 例如 "10s"；"0s" 或空白表示關閉
+}
+
+// slowModeAPI 查詢房間的 slow mode
+func slowModeAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		room := c.Param("room")
+		c.JSON(http.StatusOK, gin.H{"room": room, "interval": h.SlowMode(room).String()})
+	}
+}
+
+// setSlowModeAPI 設定房間的 slow mode：每個使用者每 interval 只能對房間發佈一則
+func setSlowModeAPI(h *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req slowModeReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if websocket.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+		var d time.Duration
+		if req.Interval != "" {
+			var err error
+			if d, err = time.ParseDuration(req.Interval); err != nil || d < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+				return
+			}
+		}
+		room := c.Param("room")
+		h.SetSlowMode(room, d)
+		c.JSON(http.StatusOK, gin.H{"room": room, "interval": d.String()})
+	}
+}
@@ -0,0 +1,444 @@
+// wsbench 對 hub 的 WebSocket 端點做壓力測試：開 N 條連線、以固定速率發佈，
+// 回報延遲百分位、丟失與重連次數，用來在上線前調整 SendCap 與 shard 數量。
+//
+//	go run ./cmd/wsbench -url ws://127.0.0.1:8080/ws -conns 1000 -rate 200 -duration 30s
+//
+// 前 -publishers 條連線送出 {"type":"wsbench","p":0,"n":1,"ts":...}，hub 預設廣播給其他連線
+// （-room 時所有連線加入房間，改以 {"type":"publish","room":...} 發佈）。每條連線依各發佈者 n 的跳號計算丟失，
+// 延遲為發佈到收到的時間（同一個 process 的時鐘）。
+// main.go 預設有 WithUpgradeRatePerIP，從單一機器連線時請調高限制或以 -ramp 放慢；被拒絕時依 Retry-After 重試
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+)
+
+// 重連等待的上下限
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+type config struct {
+	url        string
+	header     http.Header
+	conns      int
+	publishers int
+	rate       float64
+	size       int
+	room       string
+	duration   time.Duration
+	ramp       time.Duration
+	drain      time.Duration
+	interval   time.Duration
+	reconnect  bool
+}
+
+// benchMsg 發佈的訊息；Type 為 "publish" 時帶 Room
+type benchMsg struct {
+	Type string `json:"type"`
+	Room string `json:"room,omitempty"`
+	P    int    `json:"p"`
+	N    int64  `json:"n"`
+	TS   int64  `json:"ts"`
+	Pad  string `json:"pad,omitempty"`
+}
+
+type bench struct {
+	cfg config
+	pad string
+	seq []atomic.Int64 // 每個發佈者送出的最後一個 n（重連後接續）
+
+	dialFailed atomic.Int64
+	reconnects atomic.Int64
+	connected  atomic.Int64
+	sent       atomic.Int64
+	received   atomic.Int64
+	dropped    atomic.Int64
+
+	mu      sync.Mutex
+	closes  map[string]int
+	latency []time.Duration
+}
+
+func main() {
+	cfg := config{header: http.Header{}}
+	flag.StringVar(&cfg.url, "url", "ws://127.0.0.1:8080/ws", "WebSocket 端點")
+	flag.IntVar(&cfg.conns, "conns", 100, "同時連線數")
+	flag.IntVar(&cfg.publishers, "publishers", 1, "其中發佈訊息的連線數")
+	flag.Float64Var(&cfg.rate, "rate", 10, "所有發佈者合計每秒送出的訊息數")
+	flag.IntVar(&cfg.size, "size", 128, "每則訊息約略的大小（bytes）")
+	flag.StringVar(&cfg.room, "room", "", "加入這個房間並以房間發佈（空白時為全域廣播）")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "發佈多久")
+	flag.DurationVar(&cfg.ramp, "ramp", 0, "在這段時間內平均地建立連線（0 表示一次開完）")
+	flag.DurationVar(&cfg.drain, "drain", 2*time.Second, "停止發佈後等待剩餘訊息送達的時間")
+	flag.DurationVar(&cfg.interval, "interval", 5*time.Second, "進度輸出的間隔（0 表示不輸出）")
+	flag.BoolVar(&cfg.reconnect, "reconnect", true, "斷線後重連")
+	flag.Func("H", "額外的 HTTP header，例如 -H 'Authorization: Bearer xxx'（可重複）", func(s string) error {
+		k, v, ok := strings.Cut(s, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("header must be \"Name: value\", got %q", s)
+		}
+		cfg.header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		return nil
+	})
+	flag.Parse()
+	if cfg.conns < 1 || cfg.publishers < 0 || cfg.publishers > cfg.conns || cfg.rate < 0 || cfg.size < 0 {
+		log.Fatalf("wsbench: invalid -conns %d / -publishers %d / -rate %v / -size %d", cfg.conns, cfg.publishers, cfg.rate, cfg.size)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	b := newBench(cfg)
+	start := time.Now()
+	b.run(ctx)
+	b.report(os.Stdout, time.Since(start))
+}
+
+func newBench(cfg config) *bench {
+	// 扣掉其他欄位大約 70 bytes
+	return &bench{
+		cfg:    cfg,
+		pad:    strings.Repeat("x", max(0, cfg.size-70)),
+		seq:    make([]atomic.Int64, cfg.publishers),
+		closes: make(map[string]int),
+	}
+}
+
+// run 建立連線並發佈 duration，等待 drain 後關閉所有連線；ctx 結束時提早停止
+func (b *bench) run(ctx context.Context) {
+	connCtx, closeConns := context.WithCancel(ctx)
+	defer closeConns()
+	pubCtx, stopPublishing := context.WithCancel(connCtx)
+	defer stopPublishing()
+
+	var wg sync.WaitGroup
+	for i := range b.cfg.conns {
+		publisher := -1
+		if i < b.cfg.publishers {
+			publisher = i
+		}
+		delay := time.Duration(0)
+		if b.cfg.ramp > 0 {
+			delay = b.cfg.ramp * time.Duration(i) / time.Duration(b.cfg.conns)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sleep(connCtx, delay) {
+				b.session(connCtx, pubCtx, publisher)
+			}
+		}()
+	}
+
+	if b.cfg.interval > 0 {
+		go b.progress(connCtx)
+	}
+	// 連線開完才開始計時
+	if sleep(ctx, b.cfg.ramp) && sleep(ctx, b.cfg.duration) {
+		stopPublishing()
+		sleep(ctx, b.cfg.drain)
+	}
+	closeConns()
+	wg.Wait()
+}
+
+// session 一條連線的生命週期：斷線後依 -reconnect 重連，直到 ctx 結束
+func (b *bench) session(ctx, pubCtx context.Context, publisher int) {
+	established := false
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		conn, wait, err := b.dial(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			b.dialFailed.Add(1)
+			b.recordClose("dial: " + err.Error())
+			if !b.cfg.reconnect || !sleep(ctx, backoff(attempt, wait)) {
+				return
+			}
+			continue
+		}
+		if established {
+			b.reconnects.Add(1)
+		}
+		established, attempt = true, 0
+		wait = b.serve(ctx, pubCtx, conn, publisher)
+		if !b.cfg.reconnect || !sleep(ctx, backoff(attempt, wait)) {
+			return
+		}
+	}
+}
+
+// dial 連線；被 429 / 503 拒絕時回傳 Retry-After 建議的等待
+func (b *bench) dial(ctx context.Context) (*gws.Conn, time.Duration, error) {
+	d := *gws.DefaultDialer
+	d.HandshakeTimeout = 10 * time.Second
+	conn, resp, err := d.DialContext(ctx, b.cfg.url, b.cfg.header)
+	if err == nil {
+		return conn, 0, nil
+	}
+	if resp == nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	wait := time.Duration(0)
+	if s, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+		wait = time.Duration(s) * time.Second
+	}
+	var hint struct {
+		RetryAfterMs int64 `json:"retryAfterMs"`
+	}
+	if body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10)); json.Unmarshal(body, &hint) == nil && hint.RetryAfterMs > 0 {
+		wait = time.Duration(hint.RetryAfterMs) * time.Millisecond
+	}
+	return nil, wait, fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// serve 讀取直到斷線或 ctx 結束，發佈者另外在 pubCtx 內依速率發佈；回傳 1013 close frame 建議的重連等待
+func (b *bench) serve(ctx, pubCtx context.Context, conn *gws.Conn, publisher int) time.Duration {
+	b.connected.Add(1)
+	defer b.connected.Add(-1)
+	defer conn.Close()
+
+	if b.cfg.room != "" {
+		join, _ := json.Marshal(map[string]string{"type": "join", "room": b.cfg.room})
+		if err := conn.WriteMessage(gws.TextMessage, join); err != nil {
+			b.recordClose("write: " + err.Error())
+			return 0
+		}
+	}
+	readDone := make(chan struct{})
+	defer close(readDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// 正常結束：送出 1000 後等 server 回覆，逾時才強制關閉
+			_ = conn.WriteControl(gws.CloseMessage, gws.FormatCloseMessage(gws.CloseNormalClosure, "bench finished"), time.Now().Add(time.Second))
+			t := time.NewTimer(2 * time.Second)
+			defer t.Stop()
+			select {
+			case <-readDone:
+			case <-t.C:
+				conn.Close()
+			}
+		case <-readDone:
+		}
+	}()
+	if publisher >= 0 && b.cfg.rate > 0 {
+		go b.publish(pubCtx, readDone, conn, publisher)
+	}
+
+	last := make(map[int]int64, b.cfg.publishers)
+	var samples []time.Duration
+	defer func() { b.addLatency(samples) }()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return b.closed(ctx, err)
+		}
+		now := time.Now().UnixNano()
+		eachMessage(data, func(m benchMsg) {
+			b.received.Add(1)
+			samples = append(samples, time.Duration(now-m.TS))
+			// 每條連線從收到的第一則開始計算跳號
+			if prev, ok := last[m.P]; ok && m.N > prev+1 {
+				b.dropped.Add(m.N - prev - 1)
+			}
+			if m.N > last[m.P] {
+				last[m.P] = m.N
+			}
+		})
+	}
+}
+
+// publish 依 rate / publishers 的速率送出訊息，直到 ctx 結束或連線斷開
+func (b *bench) publish(ctx context.Context, readDone <-chan struct{}, conn *gws.Conn, publisher int) {
+	interval := time.Duration(float64(time.Second) * float64(b.cfg.publishers) / b.cfg.rate)
+	ticker := time.NewTicker(max(interval, time.Microsecond))
+	defer ticker.Stop()
+	m := benchMsg{Type: "wsbench", P: publisher, Pad: b.pad}
+	if b.cfg.room != "" {
+		m.Type, m.Room = "publish", b.cfg.room
+	}
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-readDone:
+			return
+		}
+		m.N = b.seq[publisher].Add(1)
+		m.TS = time.Now().UnixNano()
+		data, _ := json.Marshal(m)
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteMessage(gws.TextMessage, data); err != nil {
+			return
+		}
+		b.sent.Add(1)
+	}
+}
+
+// eachMessage 從一個 frame 取出 wsbench 訊息；支援 WriteCoalescing 的 JSON 陣列與逐行格式，其他訊息略過
+func eachMessage(data []byte, fn func(benchMsg)) {
+	data = bytes.TrimSpace(data)
+	var frames []json.RawMessage
+	switch {
+	case len(data) > 0 && data[0] == '[':
+		if json.Unmarshal(data, &frames) != nil {
+			return
+		}
+	case bytes.IndexByte(data, '\n') >= 0:
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			frames = append(frames, line)
+		}
+	default:
+		frames = []json.RawMessage{data}
+	}
+	for _, f := range frames {
+		var m benchMsg
+		if json.Unmarshal(f, &m) == nil && m.TS > 0 && (m.Type == "wsbench" || m.Type == "publish") {
+			fn(m)
+		}
+	}
+}
+
+// closed 記錄斷線原因；回傳 1013 close frame 的 retryAfterMs
+func (b *bench) closed(ctx context.Context, err error) time.Duration {
+	var ce *gws.CloseError
+	switch {
+	case errors.As(err, &ce):
+		if ce.Code == gws.CloseNormalClosure && ctx.Err() != nil {
+			return 0
+		}
+		var hint struct {
+			Reason       string `json:"reason"`
+			RetryAfterMs int64  `json:"retryAfterMs"`
+		}
+		reason := ce.Text
+		if json.Unmarshal([]byte(ce.Text), &hint) == nil && hint.Reason != "" {
+			reason = hint.Reason
+		}
+		b.recordClose(fmt.Sprintf("%d %s", ce.Code, reason))
+		return time.Duration(hint.RetryAfterMs) * time.Millisecond
+	case ctx.Err() != nil:
+		return 0
+	}
+	b.recordClose("1006 " + err.Error())
+	return 0
+}
+
+func (b *bench) recordClose(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closes[reason]++
+}
+
+func (b *bench) addLatency(samples []time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latency = append(b.latency, samples...)
+}
+
+// progress 每 interval 輸出一行目前的狀態
+func (b *bench) progress(ctx context.Context) {
+	start := time.Now()
+	ticker := time.NewTicker(b.cfg.interval)
+	defer ticker.Stop()
+	var lastRecv int64
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		recv := b.received.Load()
+		fmt.Fprintf(os.Stderr, "t=%s conns=%d sent=%d recv=%d (%.0f/s) dropped=%d reconnects=%d\n",
+			time.Since(start).Round(time.Second), b.connected.Load(), b.sent.Load(), recv,
+			float64(recv-lastRecv)/b.cfg.interval.Seconds(), b.dropped.Load(), b.reconnects.Load())
+		lastRecv = recv
+	}
+}
+
+// report 輸出結果
+func (b *bench) report(w io.Writer, elapsed time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	recv, dropped := b.received.Load(), b.dropped.Load()
+	fmt.Fprintf(w, "duration     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "connections  %d (publishers %d, dial failures %d, reconnects %d)\n",
+		b.cfg.conns, b.cfg.publishers, b.dialFailed.Load(), b.reconnects.Load())
+	lossPct := 0.0
+	if recv+dropped > 0 {
+		lossPct = 100 * float64(dropped) / float64(recv+dropped)
+	}
+	fmt.Fprintf(w, "messages     sent %d, received %d (%.0f/s), dropped %d (%.3f%%)\n",
+		b.sent.Load(), recv, float64(recv)/elapsed.Seconds(), dropped, lossPct)
+	if len(b.latency) > 0 {
+		slices.Sort(b.latency)
+		fmt.Fprintf(w, "latency      p50 %s  p90 %s  p99 %s  p99.9 %s  max %s\n",
+			percentile(b.latency, 50), percentile(b.latency, 90), percentile(b.latency, 99),
+			percentile(b.latency, 99.9), b.latency[len(b.latency)-1])
+	}
+	if len(b.closes) > 0 {
+		reasons := make([]string, 0, len(b.closes))
+		for r := range b.closes {
+			reasons = append(reasons, r)
+		}
+		slices.SortFunc(reasons, func(x, y string) int { return b.closes[y] - b.closes[x] })
+		fmt.Fprintln(w, "disconnects")
+		for _, r := range reasons {
+			fmt.Fprintf(w, "  %6d  %s\n", b.closes[r], r)
+		}
+	}
+}
+
+// percentile sorted 需已排序
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i].Round(10 * time.Microsecond)
+}
+
+// backoff 指數退避加上抖動；server 有建議的等待時以它為準
+func backoff(attempt int, hint time.Duration) time.Duration {
+	if hint > 0 {
+		return hint
+	}
+	d := min(minBackoff<<min(attempt, 10), maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep 等待 d；ctx 先結束時回傳 false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -1,48 +1,126 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"my-websocket/services/websocket"
-	"net/http"
-	"time"
+	"net"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc"
 )
 
-type broadcastReq struct {
-	Message string `json:"message" binding:"required"`
-}
+// maxBodyBytes REST API 請求 body 的上限
+const maxBodyBytes = 64 << 10
+
+func main() {
+	addr := "127.0.0.1:8080"
+
+	// 其他 Option：WithCheckOrigin / WithAuthenticate / WithSubprotocolCodec / WithResume ...
+	hub, err := websocket.NewHub(
+		websocket.WithSendCap(256),
+		websocket.WithMaxMessageSize(8192),
+		websocket.WithCompression(),
+		websocket.WithPresenceEvents(),
+		// 部署後的重連潮或狂連 /ws 時回 429 + Retry-After，避免耗盡 file descriptor
+		websocket.WithUpgradeRate(200, 400),
+		websocket.WithUpgradeRatePerIP(5, 20),
+		// 預設只允許同一個 host 的頁面連線；前端在其他網域時：
+		// websocket.WithMaxConnections(10000, 50), // 額滿或關機中回 503 + Retry-After，WebSocket 收到 1013 與 retryAfterMs（WithRetryAfter 調整）
+		// websocket.WithAllowedOrigins("https://your.domain", "*.your.domain"),
+		// websocket.WithTrustedProxies("127.0.0.1", "10.0.0.0/8"), // 在 nginx 後面時採用 X-Forwarded-For
+		// websocket.WithAuthenticate(websocket.JWTAuth([]byte("your-secret"))), // Authorization: Bearer 或 ?token=
+		// websocket.WithAuthenticate(websocket.ContextAuth("identity", "JWT_PAYLOAD")), // 沿用掛在 /ws 前的 gin-jwt middleware 的驗證結果
+		// websocket.WithIDGenerator(func() string { return snowflakeNode.Generate().String() }), // 可排序的 client ID（ULID、snowflake）
+		// websocket.WithSubprotocolCodec("msgpack", websocket.MsgPackCodec{}), // Sec-WebSocket-Protocol: msgpack
+		// websocket.WithMQTT(websocket.MQTTConfig{}), // MQTT client 以 subprotocol "mqtt" 連到 /ws，訂閱與發佈 topic
+		// websocket.WithEncryption(websocket.EncryptionConfig{RoomKey: kms.RoomKey}), // 敏感房間的 data 以 AES-GCM 加密，hub 只看 type / room 路由
+		// websocket.WithDeadLetter(websocket.DeadLetterConfig{Handler: retryLater}), // 背壓丟棄的訊息改走推播或稍後重送
+		// websocket.WithGraphQL(websocket.GraphQLConfig{Resolve: resolveSubscription}), // GraphQL subscription 以 graphql-transport-ws 連到 /ws
+		// websocket.WithProtobufEnvelope(), // 原生 client 以 subprotocol "envelope.v1+protobuf" 收發 wspb.Envelope（schema 見 wspb/envelope.proto）
+		// websocket.WithMemberEvents(), // 房間成員收到 {"type":"member_joined"} / {"type":"member_left"}，可用 {"type":"members"} 取得清單
+		// websocket.WithHistory(50), // 新加入房間的 client 先收到最近 50 則，GET /api/rooms/:room/history 可往前翻頁
+		// websocket.WithHistoryStore(websocket.NewRedisHistoryStore(rdb, "")), // 歷史存在 Redis，多個 instance 共用
+		// websocket.WithMessageStore(websocket.NewRedisStreamMessageStore(rdb, ""), 30*24*time.Hour), // 所有廣播留存 30 天供稽核（SQL 見 NewSQLMessageStore）
+		// websocket.WithSessionStore(websocket.NewRedisSessionStore(rdb, "")), // 搭配 WithResume：重啟或換 instance 後仍可續接
+		// websocket.WithCanPublish(func(c *websocket.Client, room string) bool { return room != "dashboard" || c.GetString("role") == "admin" }), // 房間發佈權限；唯讀觀看者見 ClientInfo.ReadOnly
+		// websocket.WithSlowMode(func(room string) time.Duration { if strings.HasPrefix(room, "live:") { return 10 * time.Second }; return 0 }), // 大型聊天室預設 slow mode
+		// websocket.WithAuditLog(auditLog, 365*24*time.Hour), // REST 廣播、踢人與封鎖的稽核紀錄；auditLog 例如 websocket.NewSQLAuditLog(db, websocket.SQLSQLite, "")，db 以 SQLite driver 開啟 audit.db
+		// websocket.WithSlowClose(4001, "slow consumer"), // 背壓斷線的 close frame（預設 1008），送出後等 client 回覆 close（WithCloseGrace 調整）
+		// websocket.WithOnSlowClient(func(c *websocket.Client, dropped int) { c.AddTag("lowfi") }), // 一再丟訊息的 client 先降為低頻串流（逐筆更新用 BroadcastToTags("!lowfi")），而不是直接斷線
+		// websocket.WithControlWriteWait(2 * time.Second), websocket.WithWriteRetry(1), // ping / close 用較短的寫入期限；TCP window 暫時塞住時再等一次才斷線
+		// websocket.WithDedup(2 * time.Minute), // client 重送帶相同 id 的訊息（{"type":"chat","id":"c1-42",...}）只處理一次
+		// websocket.WithAsyncHandlers(64, 32, websocket.HandlerReject), // handler 會寫資料庫時：背景執行，不卡住 readPump
+		// websocket.WithWriteBufferPool(&sync.Pool{}), // 上萬條連線時共用寫入緩衝，大多閒置的連線不各自佔用
+		// websocket.WithAppHeartbeat(15 * time.Second), // JSON ping/pong 測量 RTT，見 /api/stats 的 latency 與 presence 的 latencyMs
+		// websocket.WithWriteCoalescing(32, websocket.CoalesceArray), // 高頻行情：佇列中的訊息併成一個 JSON 陣列 frame（client.js 設 coalesce: 'array'）
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go hub.Run(context.Background())
 
-func broadcastAPI(h *websocket.Hub) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var req broadcastReq
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
-			return
+	// 多 instance 部署：設定 REDIS_ADDR 或 NATS_URL 啟用 backplane
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+		if err := hub.SetBackplane(websocket.NewRedisBackplane(rdb, "")); err != nil {
+			log.Fatalf("redis backplane: %v", err)
+		}
+	} else if natsURL := os.Getenv("NATS_URL"); natsURL != "" {
+		nc, err := nats.Connect(natsURL)
+		if err != nil {
+			log.Fatalf("nats connect: %v", err)
+		}
+		if err := hub.SetBackplane(websocket.NewNATSBackplane(nc, "")); err != nil {
+			log.Fatalf("nats backplane: %v", err)
 		}
-		// 建議在這裡加大小限制，例如 >1MB 直接拒
-		payload, _ := json.Marshal(gin.H{
-			"type":    "server_broadcast",
-			"message": req.Message,
-			"time":    time.Now().Format(time.RFC3339),
-		})
-		h.Broadcast(payload)
-		c.JSON(http.StatusOK, gin.H{"ok": true})
 	}
-}
 
-func main() {
-	addr := "127.0.0.1:8080"
+	// 內部管理 hub：另建 admin hub（例如掛在 /admin/ws），只把公開 hub 的訂單房間轉過去
+	// admin, _ := websocket.NewHub(websocket.WithAuthenticate(staffOnly)); go admin.Run(context.Background())
+	// hub.Pipe(admin, func(m websocket.PipeMessage) bool { return strings.HasPrefix(m.Room, "orders:") })
+
+	// 狀態同步：client 以 ws.syncState('dashboard', ...) 取得 snapshot，之後只收帶版本號的 delta（JSON Merge Patch）
+	// dash, _ := hub.RegisterState("dashboard", websocket.StateConfig{Snapshot: func() (any, error) { return metrics, nil }})
+	// dash.Apply(func() (any, error) { metrics["orders"] = n; return map[string]any{"orders": n}, nil })
 
-	// 可選參數：SendCap / MaxMessageSize / EnableCompression / CheckOrigin
-	hub := websocket.NewHub(&websocket.Options{
-		SendCap:           256,
-		MaxMessageSize:    8192,
-		EnableCompression: true,
-		// CheckOrigin: func(r *http.Request) bool { return r.Host == "your.domain" },
-	})
-	go hub.Run()
+	// Kafka 匯入：設定 KAFKA_BROKERS 與 KAFKA_TOPIC 時將每筆 record 廣播出去（key 為房間名稱）
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: strings.Split(brokers, ","),
+			Topic:   os.Getenv("KAFKA_TOPIC"),
+			GroupID: "my-websocket",
+		})
+		bridge := websocket.NewKafkaBridge(hub, reader)
+		bridge.RoomFromKey = true
+		bridge.Rate, bridge.Burst = 500, 100
+		go func() {
+			defer reader.Close()
+			if err := bridge.Run(context.Background()); err != nil {
+				log.Printf("kafka bridge: %v", err)
+			}
+		}()
+	}
+
+	// Postgres LISTEN/NOTIFY：設定 DATABASE_URL 與 PG_CHANNELS（逗號分隔）時將 NOTIFY 廣播到同名房間
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		channels := strings.Split(os.Getenv("PG_CHANNELS"), ",")
+		src := websocket.NewPostgresSource(hub, dsn, channels...)
+		src.Rooms = make(map[string]string, len(channels))
+		for _, ch := range channels {
+			src.Rooms[ch] = ch
+		}
+		go func() {
+			if err := src.Run(context.Background()); err != nil {
+				log.Printf("postgres source: %v", err)
+			}
+		}()
+	}
 
 	r := gin.Default()
 
@@ -50,14 +128,128 @@ func main() {
 	r.Static("/public", "./public")
 	r.GET("/", func(c *gin.Context) { c.File("./public/index.html") })
 
-	// WebSocket
+	// Kubernetes probe：/healthz（存活）、/readyz（Hub 執行中且 backplane 正常）
+	health := gin.WrapH(websocket.HealthHandler(hub))
+	r.GET("/healthz", health)
+	r.GET("/readyz", health)
+
+	// WebSocket；可以先掛 gin middleware，例如 r.GET("/ws", requestid.New(), authMiddleware.MiddlewareFunc(), websocket.ServeWs(hub))，
+	// c.Set 的值由 Client.Get 取得，request ID 與語系見 Client.Meta()
 	r.GET("/ws", websocket.ServeWs(hub))
+	// 瀏覽器 SDK：<script src="/ws/client.js"></script> 後 new HubClient()
+	r.GET("/ws/client.js", websocket.ServeClientJS())
+
+	// SSE fallback（proxy 擋 WebSocket 時）：同一個 hub，只收不送
+	r.GET("/sse", websocket.ServeSSE(hub))
+	// socket.io-client：io("http://host:8080", {transports: ["websocket"]})
+	r.GET("/socket.io/", websocket.ServeSocketIO(hub))
+	// JSON-RPC 2.0：呼叫 RegisterRPC 註冊的 method，廣播以 notification 送出
+	r.GET("/jsonrpc", websocket.ServeJSONRPC(hub))
+
+	// REST API；設定 API_KEY 時需帶 Authorization: Bearer <key> 或 X-API-Key
+	api := r.Group("/api")
+	// body 上限；訊息本身另受 MaxMessageSize 限制，超過都回 413
+	api.Use(websocket.MaxBodySize(maxBodyBytes))
+	if key := os.Getenv("API_KEY"); key != "" {
+		api.Use(websocket.APIKeyAuth(websocket.APIKey{Name: "default", Key: key, Rate: 50, Burst: 100}))
+	}
+	// 稽核：設定 WithAuditLog 時記錄 POST / PUT / DELETE 的呼叫端、路由、目標房間與 body 的 SHA-256
+	api.Use(websocket.AuditMiddleware(hub))
 
-	// REST 廣播
-	r.POST("/api/broadcast", broadcastAPI(hub))
+	// REST 廣播；body 帶 "rooms":["a","b"] 時只送給這些房間，帶 "tags":"beta && mobile" 時只送給標籤符合的連線，
+	// body 為陣列 [{"message":"..","room":"a"},{"message":"..","user":"u1"}] 時整批投遞並回傳逐則結果
+	api.POST("/broadcast", broadcastAPI(hub))
 
-	log.Printf("listening on %s", addr)
-	if err := r.Run(addr); err != nil {
+	// REST 對單一房間廣播
+	api.POST("/rooms/:room/broadcast", roomBroadcastAPI(hub))
+
+	// REST 房間成員與人數（WithMemberEvents 時成員另外收到 member_joined / member_left）
+	api.GET("/rooms/:room/members", roomMembersAPI(hub))
+
+	// REST 房間歷史（需 WithHistory 或 WithHistoryStore）：?limit=50&before=<next_before> 往前翻頁
+	api.GET("/rooms/:room/history", roomHistoryAPI(hub))
+
+	// REST 依 topic 發佈（client 以 {"type":"subscribe","topic":"sensor.#"} 訂閱）
+	api.POST("/publish/:topic", publishAPI(hub))
+
+	// REST 指定 client 發送
+	api.POST("/send/:clientID", sendAPI(hub))
+
+	// REST 在線清單
+	api.GET("/presence", presenceAPI(hub))
+
+	// REST 連線統計（health check / dashboard）
+	api.GET("/stats", statsAPI(hub))
+
+	// 管理：列出、查看單一連線與強制斷線
+	admin := api.Group("/admin")
+	admin.GET("/clients", adminClientsAPI(hub))
+	admin.GET("/clients/:id", clientDebugAPI(hub))
+	admin.DELETE("/clients/:id", kickAPI(hub))
+
+	// 管理：滾動部署前停止接受新連線（新的升級回 503 + Retry-After，/readyz 回 503），現有連線照常；undrain 恢復
+	admin.POST("/drain", drainAPI(hub))
+	admin.POST("/undrain", undrainAPI(hub))
+
+	// 管理：封鎖名單（{"kind":"ip","value":"203.0.113.0/24","duration":"1h"}）
+	admin.GET("/bans", bansAPI(hub))
+	admin.POST("/bans", banAPI(hub))
+	admin.DELETE("/bans/:kind", unbanAPI(hub))
+
+	// 管理：房間 slow mode（{"interval":"10s"}，每個使用者每 10 秒只能發佈一則；"0s" 關閉）
+	admin.GET("/rooms/:room/slow-mode", slowModeAPI(hub))
+	admin.PUT("/rooms/:room/slow-mode", setSlowModeAPI(hub))
+
+	// 管理：稽核紀錄（需 WithMessageStore）：?room=&topic=&since=2024-01-01T00:00:00Z&after=<next_after>
+	admin.GET("/messages", messagesAPI(hub))
+
+	// 管理：操作稽核（需 WithAuditLog）：?actor=apikey:default&action=DELETE /api/admin/clients/:id&room=&since=&after=<next_after>
+	admin.GET("/audit", auditAPI(hub))
+
+	// gRPC 控制介面（wspb/control.proto）：設定 GRPC_ADDR（例如 127.0.0.1:9090）時啟用，API_KEY 同樣適用
+	var gs *grpc.Server
+	if grpcAddr := os.Getenv("GRPC_ADDR"); grpcAddr != "" {
+		var opts []grpc.ServerOption
+		if key := os.Getenv("API_KEY"); key != "" {
+			opts = websocket.GRPCAPIKeyAuth(websocket.APIKey{Name: "default", Key: key, Rate: 50, Burst: 100})
+		}
+		gs = grpc.NewServer(opts...)
+		websocket.RegisterControlService(gs, hub)
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			log.Fatalf("grpc listen: %v", err)
+		}
+		go func() {
+			if err := gs.Serve(lis); err != nil {
+				log.Printf("grpc server: %v", err)
+			}
+		}()
+	}
+
+	// 收到 SIGINT / SIGTERM 後先關閉 WebSocket，再關 HTTP server。
+	// wss://：設定 TLS_CERT_FILE 與 TLS_KEY_FILE，或 TLS_DOMAINS（逗號分隔，Let's Encrypt 自動申請，需公開的 :443）；
+	// TLS_REDIRECT_ADDR（例如 :80）將 HTTP 轉址到 HTTPS。ADDR 覆蓋預設的監聽位址
+	if a := os.Getenv("ADDR"); a != "" {
+		addr = a
+	}
+	tlsCfg := websocket.TLSConfig{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		RedirectAddr: os.Getenv("TLS_REDIRECT_ADDR"),
+	}
+	if domains := os.Getenv("TLS_DOMAINS"); domains != "" {
+		tlsCfg.AutocertDomains = strings.Split(domains, ",")
+	}
+	if tlsCfg.CertFile != "" || tlsCfg.KeyFile != "" || len(tlsCfg.AutocertDomains) > 0 {
+		err = websocket.ServeTLS(addr, hub, r, tlsCfg)
+	} else {
+		err = websocket.Serve(addr, hub, r)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
+	// hub 已結束，Events stream 都已返回
+	if gs != nil {
+		gs.GracefulStop()
+	}
 }
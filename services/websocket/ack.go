@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AckReport BroadcastWithAck 的結果
+type AckReport struct {
+	ID       string   `json:"id"`
+	Targeted []string `json:"targeted"` // 廣播當下在線的 client
+	Acked    []string `json:"acked"`    // 期限內回覆 ack 的 client
+	Missing  []string `json:"missing"`  // 未回覆（含中途斷線）
+}
+
+// pendingAck 等待中的 ack；由 readPump 與 BroadcastWithAck 共用，以 mu 保護
+type pendingAck struct {
+	targets map[string]bool
+	acked   map[string]bool
+	ready   bool // 所有 shard 都已登記目標；之前不可判定完成
+	done    chan struct{}
+}
+
+type ackRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*pendingAck
+}
+
+// BroadcastWithAck 廣播 {"type":"broadcast","id":...,"ack":true,"data":msg}，
+// 並等待 client 回覆 {"type":"ack","id":...}，直到全部回覆或 ctx 結束。
+// msg 為合法 JSON 時原樣放進 data，否則以字串放入。
+// 只統計本機連線（不經過 backplane）。
+func (h *Hub) BroadcastWithAck(ctx context.Context, msg []byte) (AckReport, error) {
+	id := newClientID()
+	data := json.RawMessage(msg)
+	if !json.Valid(msg) {
+		data = mustJSON(string(msg))
+	}
+	payload, err := json.Marshal(struct {
+		Type string          `json:"type"`
+		ID   string          `json:"id"`
+		Ack  bool            `json:"ack"`
+		Data json.RawMessage `json:"data"`
+	}{"broadcast", id, true, data})
+	if err != nil {
+		return AckReport{}, err
+	}
+
+	p := &pendingAck{targets: make(map[string]bool), acked: make(map[string]bool), done: make(chan struct{})}
+	h.acks.mu.Lock()
+	if h.acks.pending == nil {
+		h.acks.pending = make(map[string]*pendingAck)
+	}
+	h.acks.pending[id] = p
+	h.acks.mu.Unlock()
+	defer func() {
+		h.acks.mu.Lock()
+		delete(h.acks.pending, id)
+		h.acks.mu.Unlock()
+	}()
+
+	// 在各 shard 內決定目標並投遞，確保目標清單與實際送出一致
+	m := broadcastMsg{msgType: TextMessage, data: payload, out: newPrepared("", TextMessage, payload)}
+	if !h.callAll(func(s *shard) {
+		h.acks.mu.Lock()
+		for c := range s.clients {
+			p.targets[c.id] = true
+		}
+		h.acks.mu.Unlock()
+		s.fanout(s.clients, m)
+	}) {
+		return AckReport{}, ErrHubClosed
+	}
+	h.acks.mu.Lock()
+	p.ready = true
+	if len(p.acked) == len(p.targets) {
+		close(p.done)
+	}
+	h.acks.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+	case <-h.done:
+	}
+
+	h.acks.mu.Lock()
+	defer h.acks.mu.Unlock()
+	r := AckReport{ID: id}
+	for cid := range p.targets {
+		r.Targeted = append(r.Targeted, cid)
+		if p.acked[cid] {
+			r.Acked = append(r.Acked, cid)
+		} else {
+			r.Missing = append(r.Missing, cid)
+		}
+	}
+	sort.Strings(r.Targeted)
+	sort.Strings(r.Acked)
+	sort.Strings(r.Missing)
+	return r, nil
+}
+
+// ack 記錄 client 的回覆（在 readPump 內呼叫）
+func (h *Hub) ack(c *Client, id string) {
+	h.acks.mu.Lock()
+	defer h.acks.mu.Unlock()
+	p, ok := h.acks.pending[id]
+	if !ok || !p.targets[c.id] || p.acked[c.id] {
+		return
+	}
+	p.acked[c.id] = true
+	if p.ready && len(p.acked) == len(p.targets) {
+		close(p.done)
+	}
+}
+
+// parseAck 解析 {"type":"ack","id":"..."}
+func parseAck(b []byte) (id string, ok bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		return "", false
+	}
+	var v struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil || !strings.EqualFold(v.Type, "ack") || v.ID == "" {
+		return "", false
+	}
+	return v.ID, true
+}
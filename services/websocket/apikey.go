@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// APIKeyContextKey 驗證通過後，金鑰名稱存放在 gin.Context 的 key
+const APIKeyContextKey = "websocket.apiKey"
+
+// APIKey 一組可呼叫 REST API 的金鑰
+type APIKey struct {
+	Name  string  // 識別用（例如呼叫端服務名稱）
+	Key   string  // 金鑰內容
+	Rate  float64 // 每秒請求數，0 表示不限制
+	Burst int
+}
+
+type apiKeyEntry struct {
+	APIKey
+	limiter *rate.Limiter
+}
+
+// APIKeyAuth 保護 REST API 的 gin middleware：
+// 接受 Authorization: Bearer <key> 或 X-API-Key: <key>，以常數時間比對，並套用每把金鑰的速率限制
+func APIKeyAuth(keys ...APIKey) gin.HandlerFunc {
+	entries := newAPIKeyEntries(keys)
+	return func(c *gin.Context) {
+		match, err := checkAPIKey(entries, requestAPIKey(c))
+		switch err {
+		case errUnauthorized:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		case errAPIKeyRateLimited:
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limited"})
+			return
+		}
+		c.Set(APIKeyContextKey, match.Name)
+		c.Next()
+	}
+}
+
+var (
+	errUnauthorized      = errors.New("unauthorized")
+	errAPIKeyRateLimited = errors.New("rate limited")
+)
+
+func newAPIKeyEntries(keys []APIKey) []apiKeyEntry {
+	entries := make([]apiKeyEntry, 0, len(keys))
+	for _, k := range keys {
+		e := apiKeyEntry{APIKey: k}
+		if k.Rate > 0 {
+			burst := k.Burst
+			if burst <= 0 {
+				burst = 1
+			}
+			e.limiter = rate.NewLimiter(rate.Limit(k.Rate), burst)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// checkAPIKey 比對金鑰並套用速率限制（REST 與 gRPC 共用）
+func checkAPIKey(entries []apiKeyEntry, got string) (*apiKeyEntry, error) {
+	if got == "" {
+		return nil, errUnauthorized
+	}
+	// 逐一比對所有金鑰，避免從回應時間推測是哪一把
+	var match *apiKeyEntry
+	for i := range entries {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(entries[i].Key)) == 1 {
+			match = &entries[i]
+		}
+	}
+	if match == nil {
+		return nil, errUnauthorized
+	}
+	if match.limiter != nil && !match.limiter.Allow() {
+		return nil, errAPIKeyRateLimited
+	}
+	return match, nil
+}
+
+// requestAPIKey 從 Authorization: Bearer 或 X-API-Key 取出金鑰（不接受 query，避免出現在 log）
+func requestAPIKey(c *gin.Context) string {
+	if h := c.GetHeader("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return strings.TrimSpace(c.GetHeader("X-API-Key"))
+}
@@ -0,0 +1,288 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrAuditLogDisabled 沒有設定 AuditLog
+var ErrAuditLogDisabled = errors.New("websocket: audit log disabled")
+
+// AuditEntry 一筆稽核紀錄：誰（Actor）在何時對哪些對象做了什麼
+type AuditEntry struct {
+	ID       string    `json:"id"` // 由 AuditLog 指定，依寫入順序遞增，用於分頁
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"` // 記錄的 Hub ID
+	// Actor 呼叫端身分：AuditMiddleware 與 gRPC 控制介面為 "apikey:<金鑰名稱>"，沒有 API key 時為 "ip:<client IP>"
+	Actor string `json:"actor"`
+	// Action AuditMiddleware 為 method 與路由，例如 "POST /api/broadcast"、"DELETE /api/admin/clients/:id"；
+	// gRPC 控制介面為 "grpc <method>"，例如 "grpc Broadcast"
+	Action string `json:"action"`
+	// Target 操作的對象，例如 "id=<clientID>"、"user:bob"（見 SetAuditTarget）
+	Target string   `json:"target,omitempty"`
+	Rooms  []string `json:"rooms,omitempty"` // 目標房間
+	// PayloadHash request body 的 SHA-256（hex），不保存內容本身；可與 MessageStore 或呼叫端的紀錄比對
+	PayloadHash string `json:"payloadHash,omitempty"`
+	Size        int    `json:"size"`   // request body 的 bytes
+	Status      int    `json:"status"` // 回應的 HTTP 狀態碼；gRPC 為 status code（0 為 OK）
+}
+
+// AuditQuery Hub.AuditEntries 的查詢條件；零值欄位表示不限制
+type AuditQuery struct {
+	Actor  string
+	Action string
+	Room   string
+	Since  time.Time // 包含
+	Until  time.Time // 不包含
+	After  string    // 只取 ID 在此之後的紀錄（上一頁最後一筆的 ID）
+	Limit  int
+}
+
+// AuditLog 稽核紀錄的保存（可選）：REST 呼叫端的廣播、發佈、踢人、封鎖等操作。
+// 多個 instance 應共用同一個 log（SQLAuditLog）
+type AuditLog interface {
+	// Record 保存一筆紀錄（ID 由 log 指定，傳入時為空）
+	Record(ctx context.Context, e AuditEntry) error
+	// Query 由舊到新回傳最多 q.Limit 筆符合條件的紀錄
+	Query(ctx context.Context, q AuditQuery) ([]AuditEntry, error)
+	// Prune 刪除 before 之前的紀錄並回傳刪除的數量（保留期限，見 AuditRetention）
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+const (
+	// auditTimeout 單次存取 AuditLog 的期限
+	auditTimeout = 10 * time.Second
+	// auditPruneInterval 清除過期紀錄的最長間隔（保留期限較短時改用保留期限的 1/10）
+	auditPruneInterval = time.Hour
+	// maxAuditRooms 一筆紀錄最多記下的房間數
+	maxAuditRooms = 100
+	// AuditTargetContextKey SetAuditTarget 存放在 gin.Context 的 key
+	AuditTargetContextKey = "websocket.auditTarget"
+)
+
+// Audit 寫入一筆稽核紀錄（Time 為零值時填入現在，Instance 填入 Hub ID），
+// 供 REST 以外的管理操作（例如後台排程；gRPC 控制介面已自行記錄）使用；沒有設定 AuditLog 時回傳 ErrAuditLogDisabled
+func (h *Hub) Audit(ctx context.Context, e AuditEntry) error {
+	if h.opts.AuditLog == nil {
+		return ErrAuditLogDisabled
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Instance = h.id
+	ctx, cancel := context.WithTimeout(ctx, auditTimeout)
+	defer cancel()
+	return h.opts.AuditLog.Record(ctx, e)
+}
+
+// AuditEntries 查詢稽核紀錄，由舊到新最多 q.Limit 筆；以最後一筆的 ID 作為下一頁的 After
+func (h *Hub) AuditEntries(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	if h.opts.AuditLog == nil {
+		return nil, ErrAuditLogDisabled
+	}
+	if q.Limit <= 0 {
+		return nil, nil
+	}
+	return h.opts.AuditLog.Query(ctx, q)
+}
+
+// pruneAudit 依 AuditRetention 定期清除過期紀錄，直到 Hub 結束
+func (h *Hub) pruneAudit() {
+	retention := h.opts.AuditRetention
+	t := time.NewTicker(min(auditPruneInterval, max(retention/10, time.Second)))
+	defer t.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+		n, err := h.opts.AuditLog.Prune(ctx, time.Now().Add(-retention))
+		cancel()
+		if err != nil {
+			h.opts.Logger.Warn("audit log prune failed", "err", err)
+		} else if n > 0 {
+			h.opts.Logger.Debug("audit log pruned", "entries", n)
+		}
+		select {
+		case <-t.C:
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// SetAuditTarget 在 handler 內指定這次請求的稽核對象（例如封鎖的 "user:bob"），取代預設的路由參數
+func SetAuditTarget(c *gin.Context, target string) {
+	c.Set(AuditTargetContextKey, target)
+}
+
+// AuditMiddleware 記錄 REST API 中會變更狀態的請求（GET、HEAD、OPTIONS 以外），應放在 APIKeyAuth 與 MaxBodySize 之後。
+// 紀錄包含呼叫端身分、路由、路由參數（房間名稱另記入 Rooms）、body 中的 "room" / "rooms"、body 的 SHA-256 與狀態碼；
+// handler 拒絕的請求（例如 400）也會記錄。回應送出後才寫入，寫入失敗只記 log，不影響回應。
+// 沒有設定 AuditLog 時不做事
+func AuditMiddleware(h *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if h.opts.AuditLog == nil {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		c.Next()
+
+		e := AuditEntry{
+			Actor:  auditActor(c),
+			Action: c.Request.Method + " " + c.FullPath(),
+			Size:   len(body),
+			Status: c.Writer.Status(),
+		}
+		if len(body) > 0 {
+			sum := sha256.Sum256(body)
+			e.PayloadHash = hex.EncodeToString(sum[:])
+		}
+		var params []string
+		for _, p := range c.Params {
+			if p.Key == "room" {
+				e.Rooms = append(e.Rooms, p.Value)
+				continue
+			}
+			params = append(params, p.Key+"="+p.Value)
+		}
+		e.Target = c.GetString(AuditTargetContextKey)
+		if e.Target == "" {
+			e.Target = strings.Join(params, " ")
+		}
+		e.Rooms = auditRooms(e.Rooms, body)
+		if err := h.Audit(context.Background(), e); err != nil {
+			h.opts.Logger.Error("audit record failed", "action", e.Action, "actor", e.Actor, "err", err)
+		}
+	}
+}
+
+// errReader 讀完 body 後回傳原本讀取時的錯誤（例如 MaxBodySize 的超過上限），nil 時為 io.EOF
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+func auditActor(c *gin.Context) string {
+	if name := c.GetString(APIKeyContextKey); name != "" {
+		return "apikey:" + name
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// auditRooms 加上 body 的 "room" / "rooms"（物件或批次的陣列），去除重複並限制數量
+func auditRooms(rooms []string, body []byte) []string {
+	type target struct {
+		Room  string   `json:"room"`
+		Rooms []string `json:"rooms"`
+	}
+	var targets []target
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case len(trimmed) == 0:
+	case trimmed[0] == '[':
+		_ = json.Unmarshal(trimmed, &targets)
+	case trimmed[0] == '{':
+		var t target
+		if json.Unmarshal(trimmed, &t) == nil {
+			targets = append(targets, t)
+		}
+	}
+	for _, t := range targets {
+		if t.Room != "" {
+			rooms = append(rooms, t.Room)
+		}
+		rooms = append(rooms, t.Rooms...)
+	}
+	slices.Sort(rooms)
+	rooms = slices.Compact(rooms)
+	if len(rooms) > maxAuditRooms {
+		rooms = rooms[:maxAuditRooms]
+	}
+	return rooms
+}
+
+// matches Actor、Action、房間與時間條件（不含 After）
+func (q AuditQuery) matches(e AuditEntry) bool {
+	return (q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.Room == "" || slices.Contains(e.Rooms, q.Room)) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
+
+// MemoryAuditLog 以記憶體實作 AuditLog，適合開發與測試（重啟後消失）
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	last    uint64
+	entries []AuditEntry // 由舊到新
+}
+
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{}
+}
+
+func (l *MemoryAuditLog) Record(_ context.Context, e AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last++
+	e.ID = strconv.FormatUint(l.last, 10)
+	e.Rooms = slices.Clone(e.Rooms)
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+func (l *MemoryAuditLog) Query(_ context.Context, q AuditQuery) ([]AuditEntry, error) {
+	var after uint64
+	if q.After != "" {
+		var err error
+		if after, err = strconv.ParseUint(q.After, 10, 64); err != nil {
+			return nil, errors.New("websocket: invalid audit entry ID " + strconv.Quote(q.After))
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []AuditEntry
+	for _, e := range l.entries {
+		if len(out) >= q.Limit {
+			break
+		}
+		if id, _ := strconv.ParseUint(e.ID, 10, 64); id <= after || !q.matches(e) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (l *MemoryAuditLog) Prune(_ context.Context, before time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for n < len(l.entries) && l.entries[n].Time.Before(before) {
+		n++
+	}
+	l.entries = append(l.entries[:0], l.entries[n:]...)
+	return n, nil
+}
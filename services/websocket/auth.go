@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrMissingToken 請求中找不到 token
+var ErrMissingToken = errors.New("websocket: missing token")
+
+// ErrNoIdentity 上游 middleware 沒有在 gin.Context 設定身分（ContextAuth）
+var ErrNoIdentity = errors.New("websocket: no identity set by middleware")
+
+// ClientInfo 由 Options.Authenticate 回傳，附加在 client 上
+type ClientInfo struct {
+	ID     string         // 留空則自動產生
+	UserID string         // 使用者識別（例如 JWT sub）
+	Claims map[string]any // 其他宣告
+	Values map[string]any // 連線建立時放入 Client.Set 的初始資料
+	// ReadOnly 唯讀 client：只能接收（例如公開的 dashboard 觀看者），見 permission.go
+	ReadOnly bool
+	// Tags 連線的初始標籤（BroadcastToTags），之後可以 Client.AddTag / RemoveTag 調整
+	Tags []string
+}
+
+// BearerToken 依序從 Authorization: Bearer 標頭與 ?token= 取出 token
+// （瀏覽器的 WebSocket API 無法自訂標頭，所以也支援 query）
+func BearerToken(c *gin.Context) string {
+	if h := c.GetHeader("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return c.Query("token")
+}
+
+// JWTAuth 回傳以 HMAC 金鑰驗證 JWT 的 Authenticate 實作，sub 會成為 UserID
+func JWTAuth(secret []byte) func(c *gin.Context) (ClientInfo, error) {
+	return func(c *gin.Context) (ClientInfo, error) {
+		raw := BearerToken(c)
+		if raw == "" {
+			return ClientInfo{}, ErrMissingToken
+		}
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+			return secret, nil
+		}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+		if err != nil {
+			return ClientInfo{}, err
+		}
+		sub, _ := claims.GetSubject()
+		return ClientInfo{UserID: sub, Claims: claims, Tags: claimTags(claims["tags"])}, nil
+	}
+}
+
+// ContextAuth 回傳沿用上游 gin middleware（例如 gin-jwt）驗證結果的 Authenticate 實作：
+// userKey 的值（string 或 fmt.Stringer）成為 UserID；claimsKey 的值（map[string]any 或其具名型別，例如 gin-jwt 的 "JWT_PAYLOAD"）
+// 成為 Claims，userKey 沒有值時以 claims 的 "sub" 作為 UserID。兩者皆無時回傳 ErrNoIdentity（回 401）。
+// claimsKey 可為空
+func ContextAuth(userKey, claimsKey string) func(c *gin.Context) (ClientInfo, error) {
+	return func(c *gin.Context) (ClientInfo, error) {
+		var info ClientInfo
+		if claimsKey != "" {
+			info.Claims = claimsMap(c.Value(claimsKey))
+		}
+		switch v := c.Value(userKey).(type) {
+		case string:
+			info.UserID = v
+		case fmt.Stringer:
+			info.UserID = v.String()
+		}
+		if info.UserID == "" {
+			info.UserID, _ = info.Claims["sub"].(string)
+		}
+		if info.UserID == "" && info.Claims == nil {
+			return ClientInfo{}, ErrNoIdentity
+		}
+		info.Tags = claimTags(info.Claims["tags"])
+		return info, nil
+	}
+}
+
+var anyMapType = reflect.TypeOf(map[string]any(nil))
+
+// claimsMap 將 map[string]any 或以它為底層型別的值（jwt.MapClaims 等）轉成 map[string]any，其他型別回傳 nil
+func claimsMap(v any) map[string]any {
+	if m, ok := v.(map[string]any); ok {
+		return m
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() != reflect.Map || !rv.Type().ConvertibleTo(anyMapType) {
+		return nil
+	}
+	return rv.Convert(anyMapType).Interface().(map[string]any)
+}
+
+// claimTags 將 JWT 的 "tags" 宣告（字串陣列）轉成標籤，其他型別忽略
+func claimTags(v any) []string {
+	list, _ := v.([]any)
+	var tags []string
+	for _, t := range list {
+		if s, ok := t.(string); ok && s != "" {
+			tags = append(tags, s)
+		}
+	}
+	return tags
+}
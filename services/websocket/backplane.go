@@ -0,0 +1,56 @@
+package websocket
+
+import (
+	"context"
+)
+
+// BackplaneMessage 在 instance 之間傳遞的廣播
+type BackplaneMessage struct {
+	Origin string `json:"origin"`         // 發送端 Hub ID，用來略過自己發出的訊息
+	Room   string `json:"room,omitempty"` // 空字串代表全域廣播
+	Topic  string `json:"topic,omitempty"`
+	Binary bool   `json:"binary,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+// Backplane 讓多個 instance 的 Hub 互相轉送廣播（例如 Redis pub/sub）
+type Backplane interface {
+	// Publish 將訊息送給其他 instance
+	Publish(ctx context.Context, m BackplaneMessage) error
+	// Subscribe 開始接收訊息，fn 會在背景 goroutine 被呼叫
+	Subscribe(ctx context.Context, fn func(BackplaneMessage)) error
+	Close() error
+}
+
+// SetBackplane 設定 backplane 並開始訂閱；應在開始服務連線前呼叫
+func (h *Hub) SetBackplane(b Backplane) error {
+	err := b.Subscribe(context.Background(), func(m BackplaneMessage) {
+		if m.Origin == h.id {
+			return
+		}
+		// 只做本機投遞，不再轉發回 backplane
+		local := broadcastMsg{room: m.Room, topic: m.Topic, msgType: TextMessage, data: m.Data}
+		if m.Binary {
+			local.msgType = BinaryMessage
+		}
+		h.localBroadcast(local)
+	})
+	if err != nil {
+		return err
+	}
+	h.backplane = b
+	return nil
+}
+
+// publish 將本機廣播轉送給 backplane（未設定時不做事）
+func (h *Hub) publish(m broadcastMsg) {
+	if h.backplane == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.WriteWait)
+	defer cancel()
+	bm := BackplaneMessage{Origin: h.id, Room: m.room, Topic: m.topic, Binary: m.msgType == BinaryMessage, Data: m.data}
+	if err := h.backplane.Publish(ctx, bm); err != nil {
+		h.opts.Logger.Error("backplane publish failed", "room", m.room, "err", err)
+	}
+}
@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBanned 使用者或 IP 在封鎖名單內
+var ErrBanned = errors.New("websocket: banned")
+
+// BanKind 封鎖的對象類型
+type BanKind string
+
+const (
+	BanIP   BanKind = "ip"   // Value 為 IP 或 CIDR（例如 "203.0.113.0/24"）
+	BanUser BanKind = "user" // Value 為 userID
+)
+
+// Ban 一筆封鎖；Until 為零值表示永久
+type Ban struct {
+	Kind   BanKind   `json:"kind"`
+	Value  string    `json:"value"`
+	Until  time.Time `json:"until,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return !b.Until.IsZero() && !now.Before(b.Until)
+}
+
+// BanStore 封鎖名單的持久化（可選），讓重啟後封鎖仍有效；Ban / Unban 時同步寫入，NewHub 時載入
+type BanStore interface {
+	LoadBans(ctx context.Context) ([]Ban, error)
+	SaveBan(ctx context.Context, b Ban) error
+	DeleteBan(ctx context.Context, kind BanKind, value string) error
+}
+
+// banStoreTimeout 單次存取 BanStore 的期限
+const banStoreTimeout = 5 * time.Second
+
+// banList 目前的封鎖名單；過期的項目在查詢時移除
+type banList struct {
+	mu    sync.RWMutex
+	ips   map[netip.Prefix]Ban
+	users map[string]Ban
+}
+
+// normalizeBan 檢查並統一 Value 的格式（IP 轉成單一位址的 prefix）
+func normalizeBan(b Ban) (Ban, netip.Prefix, error) {
+	switch b.Kind {
+	case BanUser:
+		if b.Value == "" {
+			return b, netip.Prefix{}, errors.New("websocket: ban needs a userID")
+		}
+		return b, netip.Prefix{}, nil
+	case BanIP:
+		prefixes, err := parseTrustedProxies([]string{b.Value})
+		if err != nil {
+			return b, netip.Prefix{}, fmt.Errorf("websocket: invalid ban IP %q", b.Value)
+		}
+		b.Value = prefixes[0].String()
+		return b, prefixes[0], nil
+	}
+	return b, netip.Prefix{}, fmt.Errorf("websocket: unknown ban kind %q", b.Kind)
+}
+
+func (l *banList) add(b Ban, p netip.Prefix) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ips == nil {
+		l.ips = make(map[netip.Prefix]Ban)
+		l.users = make(map[string]Ban)
+	}
+	if b.Kind == BanIP {
+		l.ips[p] = b
+	} else {
+		l.users[b.Value] = b
+	}
+}
+
+func (l *banList) remove(kind BanKind, p netip.Prefix, userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if kind == BanIP {
+		delete(l.ips, p)
+	} else {
+		delete(l.users, userID)
+	}
+}
+
+// match 回傳符合 ip 或 userID 的封鎖（可在任何 goroutine 呼叫，包括 shard 內）；順便移除已過期的項目
+func (l *banList) match(ip, userID string, now time.Time) (Ban, bool) {
+	b, ok, expired := l.lookup(ip, userID, now)
+	if len(expired) > 0 {
+		l.mu.Lock()
+		for _, e := range expired {
+			if cur, still := l.users[e.Value]; e.Kind == BanUser && still && cur.expired(now) {
+				delete(l.users, e.Value)
+			} else if p, err := netip.ParsePrefix(e.Value); err == nil && e.Kind == BanIP && l.ips[p].expired(now) {
+				delete(l.ips, p)
+			}
+		}
+		l.mu.Unlock()
+	}
+	return b, ok
+}
+
+func (l *banList) lookup(ip, userID string, now time.Time) (_ Ban, _ bool, expired []Ban) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if b, ok := l.users[userID]; ok && userID != "" {
+		if !b.expired(now) {
+			return b, true, expired
+		}
+		expired = append(expired, b)
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || len(l.ips) == 0 {
+		return Ban{}, false, expired
+	}
+	addr = addr.Unmap()
+	for p, b := range l.ips {
+		if !p.Contains(addr) {
+			continue
+		}
+		if !b.expired(now) {
+			return b, true, expired
+		}
+		expired = append(expired, b)
+	}
+	return Ban{}, false, expired
+}
+
+// Ban 封鎖 IP（或 CIDR）或 userID d 時間（0 表示永久）：之後的連線回 403，目前的連線以 1008 "banned" 關閉。
+// 有 BanStore 時同步寫入；寫入失敗仍會生效並回傳 error
+func (h *Hub) Ban(kind BanKind, value string, d time.Duration, reason string) error {
+	if d < 0 {
+		return fmt.Errorf("websocket: ban duration must not be negative, got %s", d)
+	}
+	b := Ban{Kind: kind, Value: value, Reason: reason}
+	if d > 0 {
+		b.Until = time.Now().Add(d)
+	}
+	b, p, err := normalizeBan(b)
+	if err != nil {
+		return err
+	}
+	h.bans.add(b, p)
+	h.kickBanned()
+	if h.opts.BanStore != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), banStoreTimeout)
+		defer cancel()
+		if err := h.opts.BanStore.SaveBan(ctx, b); err != nil {
+			return fmt.Errorf("websocket: save ban: %w", err)
+		}
+	}
+	return nil
+}
+
+// Unban 解除封鎖；value 需與 Ban 時相同（IP 會統一格式）
+func (h *Hub) Unban(kind BanKind, value string) error {
+	b, p, err := normalizeBan(Ban{Kind: kind, Value: value})
+	if err != nil {
+		return err
+	}
+	h.bans.remove(b.Kind, p, b.Value)
+	if h.opts.BanStore != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), banStoreTimeout)
+		defer cancel()
+		if err := h.opts.BanStore.DeleteBan(ctx, b.Kind, b.Value); err != nil {
+			return fmt.Errorf("websocket: delete ban: %w", err)
+		}
+	}
+	return nil
+}
+
+// Bans 回傳目前有效的封鎖（依類型與值排序）
+func (h *Hub) Bans() []Ban {
+	now := time.Now()
+	h.bans.mu.RLock()
+	out := make([]Ban, 0, len(h.bans.ips)+len(h.bans.users))
+	for _, b := range h.bans.ips {
+		if !b.expired(now) {
+			out = append(out, b)
+		}
+	}
+	for _, b := range h.bans.users {
+		if !b.expired(now) {
+			out = append(out, b)
+		}
+	}
+	h.bans.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// loadBans 從 BanStore 載入封鎖（NewHub 時呼叫），略過已過期的項目
+func (h *Hub) loadBans() error {
+	ctx, cancel := context.WithTimeout(context.Background(), banStoreTimeout)
+	defer cancel()
+	bans, err := h.opts.BanStore.LoadBans(ctx)
+	if err != nil {
+		return fmt.Errorf("websocket: load bans: %w", err)
+	}
+	now := time.Now()
+	for _, b := range bans {
+		if b.expired(now) {
+			continue
+		}
+		b, p, err := normalizeBan(b)
+		if err != nil {
+			h.opts.Logger.Warn("skipping invalid ban", "kind", b.Kind, "value", b.Value, "err", err)
+			continue
+		}
+		h.bans.add(b, p)
+	}
+	return nil
+}
+
+// banned 連線或 BindUser 時檢查
+func (h *Hub) banned(ip, userID string) bool {
+	_, ok := h.bans.match(ip, userID, time.Now())
+	return ok
+}
+
+// kickBanned 關閉符合封鎖名單的現有連線
+func (h *Hub) kickBanned() {
+	now := time.Now()
+	h.callAll(func(s *shard) {
+		for c := range s.clients {
+			if _, ok := h.bans.match(c.ip, c.userID, now); ok {
+				s.closeClient(c, ClosePolicyViolation, "banned")
+			}
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package websocket
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrBatchTarget 批次訊息同時指定了房間與使用者
+var ErrBatchTarget = errors.New("websocket: batch message must not target both a room and a user")
+
+// BatchMessage BroadcastBatch 的一則訊息；Room 與 UserID 擇一，都空白表示全域廣播
+type BatchMessage struct {
+	Room    string
+	UserID  string
+	MsgType int // 0 視為 TextMessage
+	Data    []byte
+	// WriteWait 這則訊息的寫入期限（0 表示 WriteWait）
+	WriteWait time.Duration
+}
+
+// batchItem 通過檢查、待投遞的一則訊息
+type batchItem struct {
+	index     int
+	userID    string
+	writeWait time.Duration
+	m         broadcastMsg
+	origin    []byte // 編號前的內容，轉送 backplane 用（與 sendBroadcast 相同）
+	plain     []byte // 加密前的內容，轉送 Pipe 用
+}
+
+// BroadcastBatch 一次投遞多則訊息，回傳與 msgs 對應的結果（nil 表示成功）。
+// 每個 shard 在同一次事件迴圈呼叫內依序處理整批訊息，其他廣播不會插在批次中間；
+// 使用者沒有連線時該則回傳 ErrUserNotFound，超過 MaxMessageSize 回傳 ErrMessageTooLarge。
+// 房間與全域訊息之後也會轉送 backplane（其他 instance 逐則投遞，不保證整批一起）
+func (h *Hub) BroadcastBatch(msgs []BatchMessage) []error {
+	errs := make([]error, len(msgs))
+	items := make([]batchItem, 0, len(msgs))
+	for i, bm := range msgs {
+		switch {
+		case bm.Room != "" && bm.UserID != "":
+			errs[i] = ErrBatchTarget
+			continue
+		case len(bm.Data) > h.MaxMessageSize():
+			errs[i] = ErrMessageTooLarge
+			continue
+		}
+		msgType := bm.MsgType
+		if msgType == 0 {
+			msgType = TextMessage
+		}
+		m := broadcastMsg{room: bm.Room, msgType: msgType, data: bm.Data}
+		if err := h.sealRoom(&m); err != nil {
+			errs[i] = err
+			continue
+		}
+		items = append(items, batchItem{
+			index:     i,
+			userID:    bm.UserID,
+			writeWait: bm.WriteWait,
+			m:         m,
+			origin:    m.data,
+			plain:     bm.Data,
+		})
+	}
+	if len(items) == 0 {
+		return errs
+	}
+
+	unlock := func() {}
+	if h.opts.SequenceNumbers {
+		// 整批送進所有 shard 後才放開，序號與投遞順序一致
+		h.seq.mu.Lock()
+		unlock = h.seq.mu.Unlock
+	}
+	now := time.Now()
+	for i := range items {
+		m := &items[i].m
+		if items[i].userID == "" && h.opts.SequenceNumbers && m.sequenced() {
+			m.data = h.seq.stamp(m.room, m.data)
+			if m.room != "" {
+				h.rooms.track(m.room, now)
+			}
+		}
+		m.out = newPrepared(m.room, m.msgType, m.data)
+		m.out.writeWait = items[i].writeWait
+	}
+
+	found := make([]bool, len(items))
+	sealErrs := make([]error, len(items))
+	ok := h.callAll(func(s *shard) {
+		for i, it := range items {
+			switch {
+			case it.userID != "":
+				for c := range s.users[it.userID] {
+					if out, err := s.userOutbound(c, it.m.out); err != nil {
+						sealErrs[i] = err
+					} else {
+						s.deliver(c, out)
+					}
+					found[i] = true
+				}
+			case it.m.room != "":
+				s.fanout(s.rooms[it.m.room], it.m)
+			default:
+				s.fanout(s.clients, it.m)
+			}
+		}
+	})
+	unlock()
+	if !ok {
+		for _, it := range items {
+			errs[it.index] = ErrHubClosed
+		}
+		return errs
+	}
+
+	for i, it := range items {
+		if it.userID != "" {
+			switch {
+			case !found[i]:
+				errs[it.index] = ErrUserNotFound
+			case sealErrs[i] != nil:
+				errs[it.index] = sealErrs[i]
+			}
+			continue
+		}
+		h.stats.broadcasts.Add(1)
+		h.stats.lastBroadcast.Store(now.UnixNano())
+		m := it.m
+		m.data = it.origin
+		h.persist(m)
+		h.publish(m)
+		m.data = it.plain
+		h.pipeOut(m)
+	}
+	return errs
+}
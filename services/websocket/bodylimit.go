@@ -0,0 +1,32 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodySize 限制 REST 請求 body 的 gin middleware：Content-Length 超過 n 直接回 413，
+// 未帶長度（chunked）時讀取超過 n 會失敗，handler 可用 IsBodyTooLarge 判斷並回 413
+func MaxBodySize(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > n {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		c.Next()
+	}
+}
+
+// IsBodyTooLarge err 是否因 body 超過 MaxBodySize 的上限
+func IsBodyTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe)
+}
+
+// MaxMessageSize 回傳單則訊息上限（bytes），REST 發送前可先檢查
+func (h *Hub) MaxMessageSize() int {
+	return h.opts.MaxMessageSize
+}
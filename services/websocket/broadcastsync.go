@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BroadcastResult BroadcastSync 在本 instance 的投遞結果（backplane、Pipe 轉出的部分不計入）
+type BroadcastResult struct {
+	Targeted int `json:"targeted"` // 符合條件的連線數（不含斷線中的 session）
+	Enqueued int `json:"enqueued"` // 放入連線佇列的數目
+	// Dropped 沒有放入佇列的數目：依 SlowClient 策略丟棄（含因此斷線）或被 outbound interceptor 略過
+	Dropped int `json:"dropped"`
+	// ShuttingDown Hub 已開始關閉，部分 shard 可能沒有投遞
+	ShuttingDown bool `json:"shuttingDown"`
+}
+
+// broadcastTally 統計一則廣播在各 shard 的投遞結果；nil 表示不統計
+type broadcastTally struct {
+	targeted atomic.Int64
+	enqueued atomic.Int64
+	// pending 尚未投遞完的 shard 數，加上送出端本身的 1（送完所有 shard 才放開，避免提早歸零）
+	pending  atomic.Int64
+	finished chan struct{}
+}
+
+func newBroadcastTally() *broadcastTally {
+	t := &broadcastTally{finished: make(chan struct{})}
+	t.pending.Store(1)
+	return t
+}
+
+// add 送進一個 shard 之前呼叫
+func (t *broadcastTally) add() {
+	if t != nil {
+		t.pending.Add(1)
+	}
+}
+
+// finish 一個 shard 投遞完畢（或送出端送完）
+func (t *broadcastTally) finish() {
+	if t != nil && t.pending.Add(-1) == 0 {
+		close(t.finished)
+	}
+}
+
+// count 記錄一個對象是否放入佇列（可由 fanout worker 呼叫）
+func (t *broadcastTally) count(queued bool) {
+	if t == nil {
+		return
+	}
+	t.targeted.Add(1)
+	if queued {
+		t.enqueued.Add(1)
+	}
+}
+
+func (t *broadcastTally) result() BroadcastResult {
+	targeted, enqueued := int(t.targeted.Load()), int(t.enqueued.Load())
+	return BroadcastResult{Targeted: targeted, Enqueued: enqueued, Dropped: targeted - enqueued}
+}
+
+// BroadcastSync 同 BroadcastContext，但等到每個 shard 都投遞完才回傳結果。
+// ctx 結束時回傳目前為止的結果與 ctx.Err()；Hub 已關閉時回傳 ErrHubClosed（ShuttingDown 為 true）
+func (h *Hub) BroadcastSync(ctx context.Context, b []byte) (BroadcastResult, error) {
+	ctx, span := h.tracing.startSpan(ctx, "websocket.Broadcast", attribute.Int("websocket.message_size", len(b)))
+	defer span.End()
+	t := newBroadcastTally()
+	h.sendBroadcast(broadcastMsg{msgType: TextMessage, data: h.tracing.inject(ctx, b), trace: span.SpanContext(), tally: t})
+	t.finish()
+
+	var err error
+	select {
+	case <-t.finished:
+	case <-h.done:
+		err = ErrHubClosed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := t.result()
+	if h.closing.Load() {
+		res.ShuttingDown = true
+		if err == nil && res.Targeted == 0 {
+			err = ErrHubClosed
+		}
+	}
+	span.SetAttributes(attribute.Int("websocket.targeted", res.Targeted), attribute.Int("websocket.dropped", res.Dropped))
+	return res, err
+}
@@ -0,0 +1,514 @@
+// HubClient：本套件 envelope 協定的瀏覽器 client（由 ServeClientJS 提供，通常掛在 /ws/client.js）
+//
+//   const ws = new HubClient();                  // 預設連到本檔所在的路徑（/ws/client.js → /ws）
+//   ws.on('chat', (data, msg) => { ... });       // {"type":"chat","data":...}
+//   ws.send('chat', { text: 'hi' });
+//   ws.send('chat', { text: 'hi' }, msgId);      // 帶 id：server 開啟 WithDedup 時重送不會重複（見 dedup.go）
+//   ws.join('lobby'); ws.subscribe('sensor.#');  // 重連後自動還原
+//   ws.publish('lobby', { text: 'hi' });         // 只送給房間成員（見 permission.go）
+//   ws.subscribe('ticker.#', "symbol == 'AAPL' && price > 100"); // 只收符合 filter 的訊息（見 filter.go）
+//   const state = await ws.call('getState', {}); // RPC（見 rpc.go）
+//   ws.syncState('dashboard', { onChange: (state, version) => render(state) }); // snapshot + delta（見 statesync.go）
+//
+// - 斷線後以指數退避加 jitter 重連；server 過載或關閉中以 1013 告知 retryAfterMs 時至少等待該時間
+// - server 開啟 ResumeBuffer 時帶 resume token 與 last_seq 續接
+// - 帶 "ack":true 的訊息（BroadcastWithAck）在所有 handler 完成後自動回覆 ack
+// - server 開啟 AppHeartbeat 時自動回覆 heartbeat，latency 為 server 測得的來回時間（ms）
+// - syncState 的 delta 版本不連續時自動重新取得 snapshot；重連（含續接）後也重新取得
+// - 事件：open、close、reconnect、error、session、gap、latency、message（每則訊息）、binary（ArrayBuffer）以及各個 type
+(function (root) {
+  'use strict';
+
+  // 這些訊息不計入 session 序號（server 以 control 送出）
+  const CONTROL_TYPES = { session: true, gap: true, ping: true, pong: true };
+
+  // emit 以此標記丟出錯誤的 handler
+  const FAILED = {};
+
+  // 不重連的關閉：在別處登入（CloseLoggedInElsewhere）與被封鎖
+  function defaultShouldReconnect(ev) {
+    return ev.code !== 4001 && ev.reason !== 'banned';
+  }
+
+  // retryHint 1013 Try Again Later 的 reason {"reason":"...","retryAfterMs":7342}（見 limits.go）
+  function retryHint(ev) {
+    if (ev.code !== 1013 || !ev.reason) return 0;
+    try {
+      const ms = JSON.parse(ev.reason).retryAfterMs;
+      return typeof ms === 'number' && ms > 0 ? ms : 0;
+    } catch (e) {
+      return 0;
+    }
+  }
+
+  // 由載入本檔的 <script> 推得預設的 WebSocket 位址
+  const scriptSrc = typeof document !== 'undefined' && document.currentScript ? document.currentScript.src : '';
+  function defaultURL() {
+    const base = new URL(scriptSrc || (typeof location !== 'undefined' ? location.href : 'http://localhost/'));
+    base.protocol = base.protocol === 'https:' ? 'wss:' : 'ws:';
+    if (scriptSrc) {
+      base.pathname = base.pathname.replace(/\/client\.js$/, '') || '/ws';
+    } else {
+      base.pathname = '/ws';
+    }
+    base.search = '';
+    base.hash = '';
+    return base.toString();
+  }
+
+  class HubClient {
+    // options：
+    //   token        string 或 () => string | Promise<string>，以 ?token= 帶上（見 auth.go）
+    //   protocols    Sec-WebSocket-Protocol
+    //   minDelay     第一次重連的等待（ms，預設 500）
+    //   maxDelay     重連等待的上限（ms，預設 30000）
+    //   factor       每次失敗的倍數（預設 2）
+    //   jitter       隨機減少的比例 0–1（預設 0.5）
+    //   rpcTimeout   call 的期限（ms，預設 10000，與 server 的 RPCTimeout 相同）
+    //   queueSize    斷線期間暫存的訊息數（預設 100，超過時丟掉最舊的）
+    //   connectTimeout 等待連線建立的時間（ms，預設 10000），逾時視為失敗並重連
+    //   coalesce     'array' 或 'lines'：與 server 的 WithWriteCoalescing 格式相同時，拆開合併的 frame
+    //                （'array' 時收到的 JSON 陣列一律視為合併的訊息）
+    //   shouldReconnect(closeEvent) 回傳 false 時不再重連
+    constructor(url, options) {
+      this.url = url || defaultURL();
+      this.options = Object.assign({
+        token: null,
+        protocols: undefined,
+        minDelay: 500,
+        maxDelay: 30000,
+        factor: 2,
+        jitter: 0.5,
+        rpcTimeout: 10000,
+        queueSize: 100,
+        connectTimeout: 10000,
+        coalesce: null,
+        shouldReconnect: defaultShouldReconnect,
+      }, options);
+
+      this.ws = null;
+      this.listeners = new Map();
+      this.rooms = new Set();
+      this.topics = new Map(); // topic → filter（沒有時為空字串）
+      this.filterExpr = '';    // topic 以外廣播的 filter
+      this.states = new Map(); // 狀態名稱 → {data, version, ready, apply, onChange}
+      this.queue = [];
+      this.pending = new Map(); // RPC id → {resolve, reject, timer}
+      this.nextID = 1;
+      this.attempt = 0;
+      this.timer = null;
+      this.closed = false;
+
+      // 續接狀態：token 與最後收到的序號
+      this.session = null;
+      this.seq = 0;
+      this.awaitingSession = false;
+
+      // 最近一次 heartbeat 的來回時間（ms），尚未測得時為 null
+      this.latency = null;
+
+      this.connect();
+    }
+
+    get connected() {
+      return this.ws !== null && this.ws.readyState === WebSocket.OPEN;
+    }
+
+    // on 註冊事件或 envelope type 的 handler，回傳取消註冊的函式
+    on(event, fn) {
+      if (!this.listeners.has(event)) this.listeners.set(event, new Set());
+      this.listeners.get(event).add(fn);
+      return () => this.off(event, fn);
+    }
+
+    off(event, fn) {
+      const set = this.listeners.get(event);
+      if (set) set.delete(fn);
+    }
+
+    // send 送出 {"type":type,"data":data}（有 id 時帶上 "id"）；斷線時先暫存，連上後依序送出
+    send(type, data, id) {
+      const env = { type: type };
+      if (id !== undefined) env.id = String(id);
+      if (data !== undefined) env.data = data;
+      return this.sendRaw(JSON.stringify(env));
+    }
+
+    // sendRaw 原樣送出字串或 binary（ArrayBuffer、Blob 等）
+    sendRaw(payload) {
+      if (this.connected) {
+        this.ws.send(payload);
+        return true;
+      }
+      if (this.closed) return false;
+      this.queue.push(payload);
+      if (this.queue.length > this.options.queueSize) this.queue.shift();
+      return true;
+    }
+
+    // publish 對房間發佈 {"type":"publish","room":room,"data":data}（需先 join，server 可限制發佈者）
+    publish(room, data, id) {
+      const msg = { type: 'publish', room: room };
+      if (id !== undefined) msg.id = String(id);
+      if (data !== undefined) msg.data = data;
+      return this.sendRaw(JSON.stringify(msg));
+    }
+
+    join(room) {
+      this.rooms.add(room);
+      this.command({ type: 'join', room: room });
+    }
+
+    leave(room) {
+      this.rooms.delete(room);
+      this.command({ type: 'leave', room: room });
+    }
+
+    // subscribe 訂閱 topic；filter 為表達式時只收內容符合的訊息，再次訂閱同一個 topic 會取代 filter
+    subscribe(topic, filter) {
+      this.topics.set(topic, filter || '');
+      this.command(subscribeCmd(topic, filter));
+    }
+
+    // filter 設定全域與房間廣播的 filter；空字串或省略表示移除
+    filter(expr) {
+      this.filterExpr = expr || '';
+      this.command(this.filterExpr ? { type: 'subscribe', filter: this.filterExpr } : { type: 'unsubscribe', filter: '' });
+    }
+
+    unsubscribe(topic) {
+      this.topics.delete(topic);
+      this.command({ type: 'unsubscribe', topic: topic });
+    }
+
+    // syncState 同步 server 以 RegisterState 註冊的狀態，回傳停止同步的函式。options：
+    //   apply(state, delta) 回傳套用 delta 後的狀態（預設為 JSON Merge Patch，RFC 7386）
+    //   onChange(state, version, msg) 收到 snapshot 或套用 delta 後呼叫
+    syncState(name, options) {
+      const o = options || {};
+      this.states.set(name, {
+        data: undefined,
+        version: 0,
+        ready: false,
+        apply: o.apply || mergePatch,
+        onChange: o.onChange || null,
+      });
+      this.command({ type: 'sync', state: name });
+      return () => {
+        this.states.delete(name);
+        this.command({ type: 'unsync', state: name });
+      };
+    }
+
+    // stateOf 目前同步到的狀態 {data, version}；尚未收到 snapshot 時為 null
+    stateOf(name) {
+      const st = this.states.get(name);
+      return st && st.ready ? { data: st.data, version: st.version } : null;
+    }
+
+    // call 呼叫 RegisterRPC 註冊的 method；server 回 rpc.error 時 reject（error.code 為錯誤碼）
+    call(method, params, options) {
+      const timeout = (options && options.timeout) || this.options.rpcTimeout;
+      const id = this.nextID++;
+      return new Promise((resolve, reject) => {
+        const timer = setTimeout(() => {
+          this.pending.delete(id);
+          reject(rpcError({ code: -32000, message: 'rpc timeout' }));
+        }, timeout);
+        this.pending.set(id, { resolve: resolve, reject: reject, timer: timer });
+        const req = { type: 'rpc', id: id, method: method };
+        if (params !== undefined) req.params = params;
+        if (!this.sendRaw(JSON.stringify(req))) {
+          clearTimeout(timer);
+          this.pending.delete(id);
+          reject(new Error('HubClient: closed'));
+        }
+      });
+    }
+
+    // close 關閉連線並停止重連；尚未完成的 call 會 reject
+    close(code, reason) {
+      this.closed = true;
+      clearTimeout(this.timer);
+      this.queue = [];
+      for (const [id, p] of this.pending) {
+        clearTimeout(p.timer);
+        p.reject(new Error('HubClient: closed'));
+        this.pending.delete(id);
+      }
+      if (this.ws) this.ws.close(code || 1000, reason);
+    }
+
+    // --- 內部 ---
+
+    // 房間與訂閱指令只在連線中送出；斷線期間的變更在重連時一併還原
+    command(cmd) {
+      if (this.connected && !this.awaitingSession) this.ws.send(JSON.stringify(cmd));
+    }
+
+    async connect() {
+      const url = new URL(this.url);
+      let token = this.options.token;
+      try {
+        if (typeof token === 'function') token = await token();
+      } catch (err) {
+        this.emit('error', err);
+        if (!this.closed) this.reconnect();
+        return;
+      }
+      if (this.closed) return;
+      if (token) url.searchParams.set('token', token);
+      if (this.session) {
+        url.searchParams.set('resume', this.session);
+        url.searchParams.set('last_seq', String(this.seq));
+      }
+      const ws = new WebSocket(url.toString(), this.options.protocols);
+      ws.binaryType = 'arraybuffer';
+      this.ws = ws;
+      this.awaitingSession = this.session !== null;
+      const timer = setTimeout(() => {
+        ws.close();
+        this.dropped(ws, { code: 1006, reason: 'connect timeout' });
+      }, this.options.connectTimeout);
+
+      ws.onopen = () => {
+        clearTimeout(timer);
+        this.attempt = 0;
+        // 沒有續接時 server 端沒有房間與訂閱，立即還原；續接時等 session 訊息決定
+        if (!this.awaitingSession) this.restore();
+        this.flush();
+        this.emit('open');
+      };
+      ws.onmessage = (ev) => this.receive(ev.data);
+      ws.onclose = (ev) => {
+        clearTimeout(timer);
+        this.dropped(ws, ev);
+      };
+    }
+
+    // dropped 連線結束（或逾時）後決定是否重連；同一個 ws 只處理一次
+    dropped(ws, ev) {
+      if (this.ws !== ws) return;
+      this.ws = null;
+      this.emit('close', ev);
+      if (this.closed) return;
+      if (!this.options.shouldReconnect(ev)) {
+        this.closed = true;
+        return;
+      }
+      this.reconnect(retryHint(ev));
+    }
+
+    // reconnect minDelayMs 為 server 建議的等待（1013 close frame），沒有時為 0
+    reconnect(minDelayMs) {
+      const o = this.options;
+      const base = Math.min(o.maxDelay, o.minDelay * Math.pow(o.factor, this.attempt));
+      const delay = Math.max(minDelayMs || 0, Math.round(base * (1 - o.jitter * Math.random())));
+      this.attempt++;
+      this.emit('reconnect', { attempt: this.attempt, delay: delay });
+      this.timer = setTimeout(() => this.connect(), delay);
+    }
+
+    restore() {
+      this.awaitingSession = false;
+      for (const room of this.rooms) this.ws.send(JSON.stringify({ type: 'join', room: room }));
+      for (const [topic, filter] of this.topics) this.ws.send(JSON.stringify(subscribeCmd(topic, filter)));
+      if (this.filterExpr) this.ws.send(JSON.stringify({ type: 'subscribe', filter: this.filterExpr }));
+      this.resyncStates();
+    }
+
+    // resyncStates 重新取得所有狀態的 snapshot（server 不在續接時保留狀態同步）
+    resyncStates() {
+      for (const [name, st] of this.states) {
+        st.ready = false;
+        this.ws.send(JSON.stringify({ type: 'sync', state: name }));
+      }
+    }
+
+    // onState 套用 snapshot 或 delta；版本不連續時重新 sync，在下一個 snapshot 前忽略 delta
+    onState(msg) {
+      const st = this.states.get(msg.state);
+      if (!st || typeof msg.version !== 'number') return;
+      if (msg.type === 'state.snapshot') {
+        st.data = msg.data;
+        st.version = msg.version;
+        st.ready = true;
+      } else {
+        if (!st.ready || msg.version <= st.version) return;
+        if (msg.version !== st.version + 1) {
+          st.ready = false;
+          this.command({ type: 'sync', state: msg.state });
+          return;
+        }
+        st.data = st.apply(st.data, msg.data);
+        st.version = msg.version;
+      }
+      if (st.onChange) {
+        try {
+          st.onChange(st.data, st.version, msg);
+        } catch (err) {
+          if (typeof console !== 'undefined') console.error('HubClient state', msg.state, err);
+        }
+      }
+    }
+
+    flush() {
+      const queued = this.queue;
+      this.queue = [];
+      for (const payload of queued) this.ws.send(payload);
+    }
+
+    receive(raw) {
+      if (typeof raw !== 'string') {
+        this.count(null);
+        this.emit('binary', raw);
+        return;
+      }
+      if (this.options.coalesce === 'lines' && raw.indexOf('\n') >= 0) {
+        for (const line of raw.split('\n')) this.receive(line);
+        return;
+      }
+      let msg = null;
+      try {
+        msg = JSON.parse(raw);
+      } catch (_) {}
+      if (this.options.coalesce === 'array' && Array.isArray(msg)) {
+        for (const m of msg) this.handle(m, JSON.stringify(m));
+        return;
+      }
+      this.handle(msg, raw);
+    }
+
+    // handle 處理一則訊息；不是 envelope 時以原始字串交給 message 事件
+    handle(msg, raw) {
+      if (msg === null || typeof msg !== 'object' || Array.isArray(msg) || typeof msg.type !== 'string') {
+        this.count(null);
+        this.emit('message', raw);
+        return;
+      }
+      this.count(msg.type);
+
+      switch (msg.type) {
+        case 'session':
+          this.onSession(msg.data || {});
+          return;
+        case 'gap':
+          this.emit('gap', msg.data);
+          return;
+        case 'ping':
+          // heartbeat（見 heartbeat.go）：原樣帶回 ts，rtt 為 server 上次測得的值
+          if (msg.ts === undefined) break;
+          if (this.connected) this.ws.send(JSON.stringify({ type: 'pong', ts: msg.ts }));
+          if (typeof msg.rtt === 'number') {
+            this.latency = msg.rtt;
+            this.emit('latency', msg.rtt);
+          }
+          return;
+        case 'state.snapshot':
+        case 'state.delta':
+          this.onState(msg);
+          break;
+        case 'rpc.result':
+        case 'rpc.error':
+          if (this.settle(msg)) return;
+          break;
+      }
+      this.emit('message', msg);
+      const results = this.emit(msg.type, msg.data, msg);
+      if (msg.ack === true && msg.id !== undefined && results.indexOf(FAILED) < 0) {
+        // 所有 handler 完成（包含回傳的 Promise）後才 ack；任一失敗則不 ack
+        Promise.all(results).then(() => {
+          if (this.connected) this.ws.send(JSON.stringify({ type: 'ack', id: msg.id }));
+        }, () => {});
+      }
+    }
+
+    // count 依 session 協定累計收到的訊息序號
+    count(type) {
+      if (this.session !== null && !CONTROL_TYPES[type]) this.seq++;
+      // 續接後第一則不是 session 訊息：server 已不支援續接，改為重新加入
+      if (this.awaitingSession && type !== 'session') {
+        this.session = null;
+        this.restore();
+      }
+    }
+
+    onSession(data) {
+      this.session = data.token || null;
+      this.seq = data.seq || 0;
+      if (this.awaitingSession) {
+        if (data.resumed) {
+          this.awaitingSession = false;
+          this.resyncStates();
+        } else {
+          this.restore();
+        }
+      }
+      this.emit('session', data);
+    }
+
+    // settle 完成對應的 call；不是本 client 發出的 id 時回傳 false
+    settle(msg) {
+      const p = this.pending.get(msg.id);
+      if (!p) return false;
+      this.pending.delete(msg.id);
+      clearTimeout(p.timer);
+      if (msg.type === 'rpc.result') {
+        p.resolve(msg.result);
+      } else {
+        p.reject(rpcError(msg.error || {}));
+      }
+      return true;
+    }
+
+    // emit 呼叫 handler，回傳每個 handler 的回傳值；丟出錯誤的 handler 以 FAILED 表示
+    emit(event) {
+      const args = Array.prototype.slice.call(arguments, 1);
+      const set = this.listeners.get(event);
+      if (!set) return [];
+      const results = [];
+      for (const fn of Array.from(set)) {
+        try {
+          results.push(fn.apply(null, args));
+        } catch (err) {
+          results.push(FAILED);
+          if (typeof console !== 'undefined') console.error('HubClient handler', event, err);
+        }
+      }
+      return results;
+    }
+  }
+
+  function subscribeCmd(topic, filter) {
+    const cmd = { type: 'subscribe', topic: topic };
+    if (filter) cmd.filter = filter;
+    return cmd;
+  }
+
+  // mergePatch JSON Merge Patch（RFC 7386）：物件逐欄合併，null 刪除欄位，其他值取代
+  function mergePatch(target, patch) {
+    if (patch === null || typeof patch !== 'object' || Array.isArray(patch)) return patch;
+    const out = target !== null && typeof target === 'object' && !Array.isArray(target) ? Object.assign({}, target) : {};
+    for (const key of Object.keys(patch)) {
+      if (patch[key] === null) {
+        delete out[key];
+      } else {
+        out[key] = mergePatch(out[key], patch[key]);
+      }
+    }
+    return out;
+  }
+
+  function rpcError(e) {
+    const err = new Error(e.message || 'rpc error');
+    err.code = e.code;
+    err.data = e.data;
+    return err;
+  }
+
+  if (typeof module !== 'undefined' && module.exports) {
+    module.exports = HubClient;
+  } else {
+    root.HubClient = HubClient;
+  }
+})(typeof globalThis !== 'undefined' ? globalThis : this);
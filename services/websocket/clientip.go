@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies 解析 CIDR 或單一 IP（例如 "10.0.0.0/8"、"127.0.0.1"）
+func parseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if p, err := netip.ParsePrefix(s); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("websocket: invalid trusted proxy %q", s)
+		}
+		addr = addr.Unmap()
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+// trusted ip 是否屬於 TrustedProxies
+func (h *Hub) trusted(ip netip.Addr) bool {
+	for _, p := range h.trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 解析 client 的真實 IP：直接連線的對象在 TrustedProxies 內時，
+// 由右往左略過 X-Forwarded-For 中的受信任 proxy，取第一個不受信任的位址；
+// 沒有 X-Forwarded-For 時改用 X-Real-IP。未設定 TrustedProxies 時不採信任何標頭
+func (h *Hub) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	peer = peer.Unmap()
+	if !h.trusted(peer) {
+		return peer.String()
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		resolved := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// 格式錯誤的位址無法再往前追，停在最後一個可信的結果
+				break
+			}
+			resolved = addr.Unmap()
+			if !h.trusted(resolved) {
+				break
+			}
+		}
+		return resolved.String()
+	}
+	if xr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return xr.Unmap().String()
+	}
+	return peer.String()
+}
+
+// IP 回傳 client 的 IP（依 TrustedProxies 解析 X-Forwarded-For / X-Real-IP）
+func (c *Client) IP() string {
+	return c.ip
+}
@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	_ "embed"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientJS 瀏覽器用的 SDK（envelope 協定、自動重連、續接與 ack，說明見檔案開頭）
+//
+//go:embed client.js
+var clientJS []byte
+
+// clientJSETag 依內容產生，SDK 隨套件更新時瀏覽器會重新下載
+var clientJSETag = func() string {
+	sum := sha256.Sum256(clientJS)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}()
+
+// ServeClientJS 提供 client.js，例如 r.GET("/ws/client.js", ServeClientJS())，
+// 前端以 <script src="/ws/client.js"></script> 載入後 new HubClient()。
+// 回應帶 ETag 與 Cache-Control: no-cache，每次都會重新驗證，前端不會用到與 server 不一致的舊版
+func ServeClientJS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/javascript; charset=utf-8")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("ETag", clientJSETag)
+		http.ServeContent(c.Writer, c.Request, "client.js", time.Time{}, bytes.NewReader(clientJS))
+	}
+}
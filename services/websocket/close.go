@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseInfo 連線結束的原因；OnDisconnect 內可用 c.CloseInfo() 取得
+type CloseInfo struct {
+	Code     int    `json:"code"`
+	Reason   string `json:"reason,omitempty"`
+	ByServer bool   `json:"byServer"` // 由 server 主動關閉（踢除、Shutdown、續接、過慢等）
+}
+
+// CloseKind close code 的分類
+type CloseKind string
+
+const (
+	CloseKindNormal          CloseKind = "normal"           // 1000
+	CloseKindGoingAway       CloseKind = "going_away"       // 1001（關閉分頁、server 關機）
+	CloseKindPolicyViolation CloseKind = "policy_violation" // 1008
+	CloseKindAbnormal        CloseKind = "abnormal"         // 1006，沒有 close frame
+	CloseKindOther           CloseKind = "other"
+)
+
+// closeKinds Stats 計數的順序
+var closeKinds = [...]CloseKind{CloseKindNormal, CloseKindGoingAway, CloseKindPolicyViolation, CloseKindAbnormal, CloseKindOther}
+
+// Kind 依 close code 分類
+func (ci CloseInfo) Kind() CloseKind {
+	switch ci.Code {
+	case websocket.CloseNormalClosure:
+		return CloseKindNormal
+	case websocket.CloseGoingAway:
+		return CloseKindGoingAway
+	case websocket.ClosePolicyViolation:
+		return CloseKindPolicyViolation
+	case websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived:
+		return CloseKindAbnormal
+	}
+	return CloseKindOther
+}
+
+func (k CloseKind) index() int {
+	for i, kind := range closeKinds {
+		if kind == k {
+			return i
+		}
+	}
+	return len(closeKinds) - 1
+}
+
+// CloseInfo 回傳連線結束的原因；連線仍在時為零值
+func (c *Client) CloseInfo() CloseInfo {
+	if ci := c.closeInfo.Load(); ci != nil {
+		return *ci
+	}
+	return CloseInfo{}
+}
+
+// ErrInvalidCloseFrame Disconnect 的 close code 為保留值（1004、1005、1006、1015 等）或 reason 超過 123 bytes，
+// server 無法送出這個 close frame
+var ErrInvalidCloseFrame = errors.New("websocket: invalid close frame")
+
+// validCloseFrame 檢查 server 可以送出的 close code 與 reason（reason 最多 123 bytes）
+func validCloseFrame(code int, reason string) error {
+	switch {
+	case code == 1004, code == websocket.CloseNoStatusReceived, code == websocket.CloseAbnormalClosure,
+		code == websocket.CloseTLSHandshake, code < 1000, code > 4999, code > 1015 && code < 3000:
+		return fmt.Errorf("invalid close code %d", code)
+	case len(reason) > maxControlPayload-2:
+		return fmt.Errorf("close reason longer than %d bytes", maxControlPayload-2)
+	}
+	return nil
+}
+
+// awaitCloseReply 送出 close frame 後最多等 CloseGrace 讓 readPump 讀到 peer 的 close 回覆
+// （peer 先關閉時 readPump 已結束，不會等待；僅在 writePump 內呼叫）
+func (c *Client) awaitCloseReply() {
+	t := time.NewTimer(c.hub.opts.CloseGrace)
+	defer t.Stop()
+	select {
+	case <-c.readDone:
+	case <-t.C:
+		c.hub.opts.Logger.Debug("no close reply from peer", c.logAttrs()...)
+	}
+}
+
+// recordClose 記錄結束原因；只保留第一次（server 先關閉時，之後讀到的錯誤不會覆蓋）
+func (c *Client) recordClose(code int, reason string, byServer bool) {
+	c.closeInfo.CompareAndSwap(nil, &CloseInfo{Code: code, Reason: reason, ByServer: byServer})
+}
+
+// unexpectedClose 讀取錯誤是否需要記錄警告：peer 以 1000 / 1001 關閉或回覆 server 的 close frame 時不算
+func (c *Client) unexpectedClose(err error) bool {
+	return !c.closeSent.Load() && websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure)
+}
+
+// recordReadError 由 readPump 的讀取錯誤判斷 peer 的 close code
+func (c *Client) recordReadError(err error) {
+	var ce *websocket.CloseError
+	var ne net.Error
+	switch {
+	case errors.As(err, &ce):
+		c.recordClose(ce.Code, ce.Text, false)
+	case errors.As(err, &ne) && ne.Timeout():
+		c.recordClose(websocket.CloseAbnormalClosure, "pong timeout", false)
+	default:
+		c.recordClose(websocket.CloseAbnormalClosure, err.Error(), false)
+	}
+}
+
+// abnormalClose peer 以非 1000 / 1001 關閉或沒有 close frame 就斷線時送出 webhook（server 主動關閉不算）
+func (c *Client) abnormalClose(ci CloseInfo) {
+	if ci.ByServer || ci.Code == 0 {
+		return
+	}
+	if kind := ci.Kind(); kind == CloseKindNormal || kind == CloseKindGoingAway {
+		return
+	}
+	c.hub.webhook(WebhookAbnormalClose, c, func(e *WebhookEvent) {
+		e.Code, e.Reason = ci.Code, ci.Reason
+	})
+}
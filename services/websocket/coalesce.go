@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CoalesceFormat 合併寫出時整個 frame 的格式（見 Options.WriteCoalesce）
+type CoalesceFormat int
+
+const (
+	CoalesceArray CoalesceFormat = iota // JSON 陣列 [m1,m2,...]；只合併內容是 JSON 的訊息（預設）
+	CoalesceLines                       // 以 "\n" 分隔（NDJSON）；只合併不含換行的訊息
+)
+
+// coalescable 這則訊息能否與其他訊息併成一個 frame；只用於本套件的 envelope 協定（MQTT、Socket.IO 等有各自的 frame）
+func (c *Client) coalescable(m *outbound) bool {
+	if c.hub.opts.WriteCoalesce < 2 || m.msgType != TextMessage {
+		return false
+	}
+	if c.mqtt != nil || c.sio != nil || c.jsonrpc || c.gql != nil || c.protobuf {
+		return false
+	}
+	if c.hub.opts.CoalesceFormat == CoalesceLines {
+		return bytes.IndexByte(m.data, '\n') < 0
+	}
+	return json.Valid(m.data)
+}
+
+// drain 以不阻塞的方式從佇列再取出可合併的訊息，與 first 組成最多 WriteCoalesce 則的一批；
+// 取到不能合併的訊息時停止並以 next 回傳，佇列已關閉時 open 為 false（僅在 writePump 內呼叫）
+func (c *Client) drain(first *outbound) (batch []*outbound, next *outbound, open bool) {
+	batch = append(make([]*outbound, 0, c.hub.opts.WriteCoalesce), first)
+	for len(batch) < c.hub.opts.WriteCoalesce {
+		select {
+		case m, ok := <-c.send:
+			if !ok {
+				return batch, nil, false
+			}
+			if !c.writable(m) {
+				continue
+			}
+			if !c.coalescable(m) {
+				return batch, m, true
+			}
+			batch = append(batch, m)
+		default:
+			return batch, nil, true
+		}
+	}
+	return batch, nil, true
+}
+
+// coalesced 將一批訊息組成單一 frame 的內容
+func (c *Client) coalesced(batch []*outbound) *outbound {
+	n := len(batch) + 1
+	for _, m := range batch {
+		n += len(m.data)
+	}
+	b := make([]byte, 0, n)
+	lines := c.hub.opts.CoalesceFormat == CoalesceLines
+	if !lines {
+		b = append(b, '[')
+	}
+	for i, m := range batch {
+		switch {
+		case i == 0:
+		case lines:
+			b = append(b, '\n')
+		default:
+			b = append(b, ',')
+		}
+		b = append(b, m.data...)
+	}
+	if !lines {
+		b = append(b, ']')
+	}
+	return newOutbound(TextMessage, b)
+}
+
+// writeBatch 以一個 frame 寫出整批訊息；只有一則時照原樣寫出（僅在 writePump 內呼叫）
+func (c *Client) writeBatch(batch []*outbound) bool {
+	if len(batch) == 1 {
+		return c.writeMessage(batch[0])
+	}
+	frame := c.coalesced(batch)
+	c.throttle(frame)
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.opts.WriteWait))
+	if !c.writeGap() {
+		return false
+	}
+	var spans []trace.Span
+	for _, m := range batch {
+		if span := c.traceWrite(m); span != nil {
+			spans = append(spans, span)
+		}
+	}
+	c.compressFor(frame)
+	err := c.write(frame)
+	for _, span := range spans {
+		if err != nil {
+			fail(span, err)
+		}
+		span.End()
+	}
+	if err != nil {
+		c.hub.opts.Logger.Warn("websocket write failed", c.logAttrs("batch", len(batch), "err", err)...)
+		c.recordClose(CloseAbnormalClosure, err.Error(), false)
+		return false
+	}
+	for _, m := range batch {
+		c.sent(m)
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotProtoMessage ProtobufCodec 只能處理 proto.Message
+var ErrNotProtoMessage = errors.New("websocket: value is not a proto.Message")
+
+// Codec 訊息的編解碼方式；Hub 預設使用 Options.Codec，
+// client 可透過 subprotocol 協商改用 Options.Codecs 中的其他 codec
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// ContentType 例如 "application/json"；文字類型以 text frame 送出，其餘為 binary frame
+	ContentType() string
+}
+
+// JSONCodec encoding/json（預設）
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (JSONCodec) ContentType() string                { return "application/json" }
+
+// MsgPackCodec MessagePack，沿用 msgpack struct tag（沒有時使用欄位名稱）
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+func (MsgPackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+func (MsgPackCodec) ContentType() string                { return "application/msgpack" }
+
+// ProtobufCodec Protocol Buffers；v 必須是 proto.Message
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (ProtobufCodec) ContentType() string { return "application/x-protobuf" }
+
+// frameType 依 ContentType 決定 text 或 binary frame
+func frameType(c Codec) int {
+	ct := c.ContentType()
+	if strings.HasPrefix(ct, "text/") || strings.HasPrefix(ct, "application/json") {
+		return TextMessage
+	}
+	return BinaryMessage
+}
+
+// codecFor 依協商出的 subprotocol 取得 client 的 codec
+func (h *Hub) codecFor(subprotocol string) Codec {
+	if c, ok := h.opts.Codecs[subprotocol]; ok && subprotocol != "" {
+		return c
+	}
+	return h.opts.Codec
+}
+
+// encode 以 codec 編碼並檢查大小（與 client 端的讀取上限一致）
+func (h *Hub) encode(codec Codec, v any) ([]byte, error) {
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > h.opts.MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	return b, nil
+}
+
+// BroadcastValue 以每個 client 的 codec 編碼 v 後廣播（每種 codec 只編碼一次）。
+// 經 backplane 送到其他 instance 以及歷史紀錄的是 Options.Codec 的編碼。
+func (h *Hub) BroadcastValue(v any) error {
+	return h.broadcastValue("", v)
+}
+
+// BroadcastToRoomValue 同 BroadcastValue，只送給房間成員
+func (h *Hub) BroadcastToRoomValue(room string, v any) error {
+	return h.broadcastValue(room, v)
+}
+
+func (h *Hub) broadcastValue(room string, v any) error {
+	b, err := h.encode(h.opts.Codec, v)
+	if err != nil {
+		return err
+	}
+	m := broadcastMsg{room: room, msgType: frameType(h.opts.Codec), data: b}
+	for _, codec := range h.opts.Codecs {
+		ct := codec.ContentType()
+		if ct == h.opts.Codec.ContentType() || m.variants[ct] != nil {
+			continue
+		}
+		vb, err := h.encode(codec, v)
+		if err != nil {
+			return err
+		}
+		if m.variants == nil {
+			m.variants = make(map[string]*outbound)
+		}
+		m.variants[ct] = newPrepared(room, frameType(codec), vb)
+	}
+	h.sendBroadcast(m)
+	return nil
+}
+
+// Codec 回傳這個 client 使用的 codec
+func (c *Client) Codec() Codec {
+	return c.codec
+}
+
+// SendValue 以 client 的 codec 編碼 v 後只送給這個 client
+func (c *Client) SendValue(v any) error {
+	b, err := c.hub.encode(c.codec, v)
+	if err != nil {
+		return err
+	}
+	return c.shard.sendDirect(directMsg{client: c, msgType: frameType(c.codec), data: b})
+}
+
+// Decode 以 client 的 codec 解碼收到的訊息（例如在 OnMessage 或 handler 內）
+func (c *Client) Decode(data []byte, v any) error {
+	return c.codec.Unmarshal(data, v)
+}
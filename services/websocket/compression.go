@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"compress/flate"
+	"net/http"
+	"strings"
+)
+
+// permessage-deflate 可用的壓縮等級（與 gorilla/websocket 相同範圍）
+const (
+	minCompressionLevel = flate.HuffmanOnly // -2
+	maxCompressionLevel = flate.BestCompression
+)
+
+// deflateOffered client 是否在 Sec-WebSocket-Extensions 提出 permessage-deflate
+// （EnableCompression 時 gorilla 只要 client 提出就會接受）
+func deflateOffered(r *http.Request) bool {
+	for _, v := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setupCompression 升級後依協商結果套用壓縮等級（僅在 ServeWs 內呼叫）
+func (c *Client) setupCompression(r *http.Request) {
+	o := &c.hub.opts
+	c.compressed = o.EnableCompression && deflateOffered(r)
+	if !c.compressed {
+		return
+	}
+	if o.CompressionLevel != 0 {
+		_ = c.conn.SetCompressionLevel(o.CompressionLevel)
+	}
+}
+
+// Compressed 回傳是否協商出 permessage-deflate（SSE 一律為 false）
+func (c *Client) Compressed() bool {
+	return c.compressed
+}
+
+// compressFor 依 CompressionThreshold 決定這則訊息是否壓縮（僅在 writePump 內呼叫）
+func (c *Client) compressFor(m *outbound) {
+	if c.compressed && c.hub.opts.CompressionThreshold > 0 {
+		c.conn.EnableWriteCompression(len(m.data) >= c.hub.opts.CompressionThreshold)
+	}
+}
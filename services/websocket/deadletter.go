@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"errors"
+	"time"
+)
+
+// 預設的 dead-letter 佇列大小
+const defaultDeadLetterQueue = 1024
+
+// DeadLetter 因背壓丟棄的一則訊息（見 SlowClient）
+type DeadLetter struct {
+	ClientID string
+	UserID   string // BindUser 或 Authenticate 的 userID（可為空）
+	Room     string // 房間廣播時的房間
+	Topic    string // Publish 時的 topic
+	MsgType  int    // TextMessage 或 BinaryMessage
+	Data     []byte // 原本要寫出的內容（已經過 outbound interceptor），不可修改
+	Reason   DropReason
+	Time     time.Time
+}
+
+// DeadLetterConfig 將丟棄的訊息交給應用程式（記錄、稍後重送或改發推播）；Handler 與 Channel 擇一。
+// 丟棄發生在 shard 的事件迴圈內，因此先放進 QueueSize 的佇列再由專用 goroutine 依序交出，
+// 佇列滿時這則 dead letter 也會被丟棄（只記 log）
+type DeadLetterConfig struct {
+	// Handler 在專用 goroutine 依序呼叫，可呼叫 Hub 方法（例如 SendToUser 重送）
+	Handler func(DeadLetter)
+	// Channel 依序送進這個 channel；接收端太慢時佇列會滿
+	Channel chan<- DeadLetter
+	// QueueSize 待交出的佇列大小（預設 1024）
+	QueueSize int
+}
+
+func (d *DeadLetterConfig) validate() error {
+	if (d.Handler == nil) == (d.Channel == nil) {
+		return errors.New("websocket: DeadLetterConfig needs exactly one of Handler or Channel")
+	}
+	if d.QueueSize < 0 {
+		return errors.New("websocket: DeadLetter QueueSize must not be negative")
+	}
+	return nil
+}
+
+// deadLetters 待交出的 dead letter；nil 表示未設定
+type deadLetters struct {
+	cfg   DeadLetterConfig
+	queue chan DeadLetter
+}
+
+func newDeadLetters(cfg *DeadLetterConfig) *deadLetters {
+	if cfg == nil {
+		return nil
+	}
+	return &deadLetters{cfg: *cfg, queue: make(chan DeadLetter, cfg.QueueSize)}
+}
+
+// run 依序交出 dead letter，直到 done 關閉
+func (d *deadLetters) run(h *Hub) {
+	for {
+		select {
+		case dl := <-d.queue:
+			d.deliver(h, dl)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (d *deadLetters) deliver(h *Hub, dl DeadLetter) {
+	if d.cfg.Channel != nil {
+		select {
+		case d.cfg.Channel <- dl:
+		case <-h.done:
+		}
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			h.opts.Logger.Error("dead letter handler panic", "client", dl.ClientID, "panic", p)
+		}
+	}()
+	d.cfg.Handler(dl)
+}
+
+// deadLetter 將丟棄的訊息放進佇列（在 shard 內呼叫，不阻塞）
+func (h *Hub) deadLetter(c *Client, msg *outbound, reason DropReason) {
+	d := h.deadLetters
+	if d == nil {
+		return
+	}
+	dl := DeadLetter{
+		ClientID: c.id,
+		UserID:   c.userID,
+		Room:     msg.room,
+		Topic:    msg.topic,
+		MsgType:  msg.msgType,
+		Data:     msg.data,
+		Reason:   reason,
+		Time:     time.Now(),
+	}
+	select {
+	case d.queue <- dl:
+	default:
+		h.opts.Logger.Warn("dead letter queue full, message discarded", c.logAttrs("reason", string(reason))...)
+	}
+}
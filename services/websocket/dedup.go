@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// 去重：client 在 envelope 帶字串 id（{"type":"chat","id":"c1-42","data":...}）時，同一個發送者
+// （UserID，沒有時為這條連線）在 DedupWindow 內重送相同 id 的訊息會被靜默丟棄，斷線重連後的重送也能辨識。
+// ack 與 rpc 的 id 另有用途不列入；binary frame 不去重。只在本 instance 計算。
+// id 在訊息被接受（廣播、房間發佈或交給 handler）時才記錄：因 slow mode、解密失敗、middleware、CanPublish、
+// schema 或 handler 佇列已滿被拒絕的訊息，client 之後以相同 id 重送仍會處理
+
+// maxDedupEntries 去重表的上限，超過時提早忘記最舊的 id
+const maxDedupEntries = 100_000
+
+type dedupKey struct{ sender, id string }
+
+type dedupEntry struct {
+	key     dedupKey
+	expires time.Time
+}
+
+// dedupCache 最近看過的 id；order 依到期時間排序，檢查時順便清掉過期項目
+type dedupCache struct {
+	mu    sync.Mutex
+	seen  map[dedupKey]time.Time
+	order []dedupEntry
+}
+
+// expire 清掉過期與超過上限的項目（持有 d.mu）
+func (d *dedupCache) expire(now time.Time) {
+	for len(d.order) > 0 && (!now.Before(d.order[0].expires) || len(d.order) >= maxDedupEntries) {
+		e := d.order[0]
+		if d.seen[e.key].Equal(e.expires) {
+			delete(d.seen, e.key)
+		}
+		d.order = d.order[1:]
+	}
+}
+
+// contains window 內已記錄過 key 時回傳 true（不記錄）
+func (d *dedupCache) contains(key dedupKey, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(now)
+	expires, ok := d.seen[key]
+	return ok && now.Before(expires)
+}
+
+// forget 移除 key（order 內的項目到期時略過）
+func (d *dedupCache) forget(key dedupKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
+
+// seenBefore 記錄 key，window 內已記錄過時回傳 true
+func (d *dedupCache) seenBefore(key dedupKey, now time.Time, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(now)
+	if expires, ok := d.seen[key]; ok && now.Before(expires) {
+		return true
+	}
+	if d.seen == nil {
+		d.seen = make(map[dedupKey]time.Time)
+	}
+	expires := now.Add(window)
+	d.seen[key] = expires
+	d.order = append(d.order, dedupEntry{key: key, expires: expires})
+	return false
+}
+
+// duplicate 開啟 DedupWindow 且訊息的 id 在期限內已被接受過時回傳 true；
+// 否則記下這則訊息的 key，待 acceptDedup 記錄（在 readPump 內呼叫）
+func (c *Client) duplicate(message []byte) bool {
+	h := c.hub
+	c.dedupPending = dedupKey{}
+	if h.opts.DedupWindow <= 0 {
+		return false
+	}
+	id := envelopeID(message)
+	if id == "" {
+		return false
+	}
+	sender := c.info.UserID
+	if sender == "" {
+		sender = "client:" + c.id
+	}
+	key := dedupKey{sender, id}
+	if !h.dedup.contains(key, time.Now()) {
+		c.dedupPending = key
+		return false
+	}
+	c.droppedDuplicate(id)
+	return true
+}
+
+// acceptDedup 訊息被接受時記錄 duplicate 記下的 key；期間已由同一使用者的其他連線接受時回傳 false，
+// 呼叫端應丟棄這則訊息（在 readPump 內呼叫）
+func (c *Client) acceptDedup() bool {
+	key := c.dedupPending
+	if key.id == "" {
+		return true
+	}
+	h := c.hub
+	if !h.dedup.seenBefore(key, time.Now(), h.opts.DedupWindow) {
+		return true
+	}
+	c.droppedDuplicate(key.id)
+	return false
+}
+
+// rejectDedup 已 acceptDedup 的訊息之後仍被拒絕（例如 handler 佇列已滿）時忘記它的 key，讓重送可以處理
+func (c *Client) rejectDedup() {
+	if key := c.dedupPending; key.id != "" {
+		c.hub.dedup.forget(key)
+	}
+}
+
+func (c *Client) droppedDuplicate(id string) {
+	c.hub.stats.duplicates.Add(1)
+	c.hub.opts.Logger.Debug("duplicate message dropped", c.logAttrs("id", id)...)
+}
+
+// envelopeID 取出 envelope 的字串 id；沒有、不是字串或為 rpc / ack 時回傳 ""
+func envelopeID(b []byte) string {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' || !bytes.Contains(b, []byte(`"id"`)) {
+		return ""
+	}
+	var v struct {
+		Type string          `json:"type"`
+		ID   json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(b, &v) != nil || v.Type == "rpc" || v.Type == "ack" {
+		return ""
+	}
+	var id string
+	if json.Unmarshal(v.ID, &id) != nil {
+		return ""
+	}
+	return id
+}
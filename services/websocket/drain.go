@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// draining（滾動部署）：Drain 後不再接受新的連線要求（含 SSE 與續接），回 503 並帶 Retry-After，
+// /readyz 也回 503 讓 load balancer 把流量移到其他 instance；已連線的 client 不受影響，
+// 之後可以從容地 Shutdown，或以 Undrain 恢復。狀態只在本 instance
+
+// DrainStatus Drain / Undrain / DrainState 的回傳值
+type DrainStatus struct {
+	Draining    bool       `json:"draining"`
+	Since       *time.Time `json:"since,omitempty"` // 開始 draining 的時間
+	Connections int        `json:"connections"`     // 目前仍在線的 client
+}
+
+// Drain 停止接受新的連線要求；已經在 draining 時不變（Since 仍為第一次呼叫的時間）
+func (h *Hub) Drain() DrainStatus {
+	if h.drainSince.CompareAndSwap(0, time.Now().UnixNano()) {
+		h.opts.Logger.Info("hub draining", "connections", h.Len())
+	}
+	return h.DrainState()
+}
+
+// Undrain 恢復接受新的連線要求
+func (h *Hub) Undrain() DrainStatus {
+	if h.drainSince.Swap(0) != 0 {
+		h.opts.Logger.Info("hub undrained", "connections", h.Len())
+	}
+	return h.DrainState()
+}
+
+// DrainState 回傳目前是否在 draining
+func (h *Hub) DrainState() DrainStatus {
+	st := DrainStatus{Connections: h.Len()}
+	if n := h.drainSince.Load(); n != 0 {
+		t := time.Unix(0, n)
+		st.Draining, st.Since = true, &t
+	}
+	return st
+}
+
+// rejectDraining draining 時拒絕連線要求：WebSocket 升級也直接回 503（不升級），
+// 讓 load balancer 可以改送其他 instance；client.js 依退避重連
+func (h *Hub) rejectDraining(c *gin.Context) {
+	wait := h.retryAfter()
+	h.stats.overloaded.Add(1)
+	c.Header("Retry-After", retryAfterHeader(wait))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server draining", "retryAfterMs": wait.Milliseconds()})
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newEgressLimiter 每秒 bytesPerSec 的 token bucket，bucket 大小至少放得下一則 MaxMessageSize 的訊息；0 表示不限制
+func (o *Options) newEgressLimiter(bytesPerSec int) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), max(bytesPerSec, o.MaxMessageSize))
+}
+
+// throttle 依 EgressRate 與 GlobalEgressRate 等到可以寫出 m（在 write pump 內、設定 write deadline 前呼叫）；
+// Hub 關閉時不再等待，讓佇列能盡快送完
+func (c *Client) throttle(m *outbound) {
+	n := len(m.data)
+	if n == 0 {
+		return
+	}
+	var delay time.Duration
+	for _, l := range [...]*rate.Limiter{c.egress, c.hub.egress} {
+		if l != nil {
+			delay = max(delay, reserveBytes(l, n))
+		}
+	}
+	if delay <= 0 {
+		return
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-c.hub.quit:
+	}
+}
+
+// reserveBytes 預約 n bytes 並回傳需要等待的時間；超過 bucket 大小時分段預約
+func reserveBytes(l *rate.Limiter, n int) time.Duration {
+	now := time.Now()
+	var delay time.Duration
+	for n > 0 {
+		chunk := min(n, l.Burst())
+		delay = l.ReserveN(now, chunk).DelayFrom(now)
+		n -= chunk
+	}
+	return delay
+}
@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// payload 加密（WithEncryption）：hub 仍依 envelope 的 type / room 等欄位路由，只有 data 是密文。
+//
+//   - 房間廣播（BroadcastToRoom、房間發佈、BroadcastBatch 的房間訊息等）以 RoomKey(room) 加密一次，
+//     歷史、MessageStore 與 backplane 也只看到密文
+//   - 指定對象（SendTo、Client.Send、SendToUser、BroadcastBatch 的使用者訊息）以 ClientKey(c) 逐一加密
+//   - 全域與 topic 廣播、hub 自己的協定訊息（error、ack、presence 等）不加密
+//
+// text frame 的 envelope 改為 {"type":"chat","encrypted":true,"data":"<base64>"}，解密後即原本 data 的 JSON；
+// 不是帶 data 的 JSON 物件時整則加密為 {"type":"encrypted","encrypted":true,"data":"<base64>"}，
+// 解密後為原本整則訊息。binary frame 整個 frame 即為密文。
+// 預設密文為 nonce(12 bytes) || AES-GCM 密文與 tag（見 EncryptAESGCM）。
+//
+// client 送來帶 "encrypted":true 的 envelope 時先解密再照一般訊息處理：有 room 且 RoomKey 有金鑰時用房間金鑰，
+// 否則用 ClientKey；解密失敗時回覆 {"type":"error"} 並丟棄
+
+// EncryptionConfig 金鑰查詢與加解密函式；RoomKey 與 ClientKey 至少要有一個
+type EncryptionConfig struct {
+	// RoomKey 回傳房間的金鑰，nil 表示這個房間不加密；每則房間廣播都會呼叫，應只查快取
+	RoomKey func(room string) ([]byte, error)
+	// ClientKey 回傳 client 的金鑰，nil 表示不加密；在 shard 或 readPump 內呼叫，不可呼叫 Hub 方法
+	ClientKey func(c *Client) ([]byte, error)
+	// Encrypt / Decrypt 預設為 EncryptAESGCM / DecryptAESGCM，需同時設定
+	Encrypt func(key, plaintext []byte) ([]byte, error)
+	Decrypt func(key, ciphertext []byte) ([]byte, error)
+}
+
+func (e *EncryptionConfig) validate() error {
+	if e.RoomKey == nil && e.ClientKey == nil {
+		return errors.New("websocket: EncryptionConfig needs RoomKey or ClientKey")
+	}
+	if (e.Encrypt == nil) != (e.Decrypt == nil) {
+		return errors.New("websocket: EncryptionConfig Encrypt and Decrypt must be set together")
+	}
+	return nil
+}
+
+// errDecrypt 回覆給 client 的解密錯誤（不透露原因）
+var errDecrypt = errors.New("websocket: payload decryption failed")
+
+// EncryptAESGCM 以 AES-GCM 加密（key 為 16、24 或 32 bytes），輸出 nonce || 密文
+func EncryptAESGCM(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// DecryptAESGCM 解開 EncryptAESGCM 的輸出
+func DecryptAESGCM(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("websocket: ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealRoom 以房間金鑰加密廣播（含各 codec 的版本）；沒有設定或房間不加密時不變。
+// 失敗時不送出（避免明文外流）
+func (h *Hub) sealRoom(m *broadcastMsg) error {
+	enc := h.opts.Encryption
+	if enc == nil || enc.RoomKey == nil || m.room == "" || m.out != nil {
+		return nil
+	}
+	key, err := enc.RoomKey(m.room)
+	if err != nil || key == nil {
+		return wrapEncryptErr(err)
+	}
+	if m.data, err = h.seal(key, m.msgType, m.data); err != nil {
+		return err
+	}
+	for ct, v := range m.variants {
+		data, err := h.seal(key, v.msgType, v.data)
+		if err != nil {
+			return err
+		}
+		m.variants[ct] = newPrepared(m.room, v.msgType, data)
+	}
+	return nil
+}
+
+// sealFor 以 client 的金鑰加密指定對象的訊息（僅在 shard 內呼叫）
+func (h *Hub) sealFor(c *Client, msgType int, b []byte) ([]byte, error) {
+	enc := h.opts.Encryption
+	if enc == nil || enc.ClientKey == nil {
+		return b, nil
+	}
+	key, err := enc.ClientKey(c)
+	if err != nil || key == nil {
+		return b, wrapEncryptErr(err)
+	}
+	return h.seal(key, msgType, b)
+}
+
+func wrapEncryptErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("websocket: encrypt payload: %w", err)
+}
+
+// seal 依 frame 類型加密：binary 整個 frame，text 只加密 envelope 的 data
+func (h *Hub) seal(key []byte, msgType int, b []byte) ([]byte, error) {
+	encrypt := h.opts.Encryption.Encrypt
+	if msgType == BinaryMessage {
+		out, err := encrypt(key, b)
+		return out, wrapEncryptErr(err)
+	}
+	var env map[string]json.RawMessage
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || trimmed[0] != '{' || json.Unmarshal(trimmed, &env) != nil || env["data"] == nil {
+		env = map[string]json.RawMessage{"type": json.RawMessage(`"encrypted"`), "data": b}
+	}
+	sealed, err := encrypt(key, env["data"])
+	if err != nil {
+		return nil, wrapEncryptErr(err)
+	}
+	env["data"] = mustJSON(base64.StdEncoding.EncodeToString(sealed))
+	env["encrypted"] = json.RawMessage("true")
+	return json.Marshal(env)
+}
+
+// open 解密 client 送來帶 "encrypted":true 的 envelope；ok 為 false 時已回覆錯誤（在 readPump 內呼叫）
+func (c *Client) open(message []byte) (out []byte, ok bool) {
+	h := c.hub
+	enc := h.opts.Encryption
+	if enc == nil || !bytes.Contains(message, []byte(`"encrypted"`)) {
+		return message, true
+	}
+	var env map[string]json.RawMessage
+	if json.Unmarshal(bytes.TrimSpace(message), &env) != nil || string(env["encrypted"]) != "true" {
+		return message, true
+	}
+	plain, err := c.decrypt(env)
+	if err != nil {
+		h.opts.Logger.Warn("client payload decryption failed", c.logAttrs("err", err)...)
+		_ = h.sendToClient(c, errorEnvelope(errDecrypt))
+		return nil, false
+	}
+	if string(env["type"]) == `"encrypted"` {
+		return plain, true
+	}
+	if !json.Valid(plain) {
+		h.opts.Logger.Warn("client payload decryption failed", c.logAttrs("err", "data is not JSON")...)
+		_ = h.sendToClient(c, errorEnvelope(errDecrypt))
+		return nil, false
+	}
+	delete(env, "encrypted")
+	env["data"] = plain
+	out, _ = json.Marshal(env)
+	return out, true
+}
+
+// decrypt 依 room 或 client 選擇金鑰並解開 data
+func (c *Client) decrypt(env map[string]json.RawMessage) ([]byte, error) {
+	enc := c.hub.opts.Encryption
+	var room, data string
+	if r, ok := env["room"]; ok {
+		_ = json.Unmarshal(r, &room)
+	}
+	if err := json.Unmarshal(env["data"], &data); err != nil {
+		return nil, errors.New("data is not a base64 string")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	if room != "" && enc.RoomKey != nil {
+		if key, err = enc.RoomKey(room); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil && enc.ClientKey != nil {
+		if key, err = enc.ClientKey(c); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil {
+		return nil, errors.New("no key")
+	}
+	return enc.Decrypt(key, sealed)
+}
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Envelope 訊息外層格式：{"type":"...","data":...}
+type Envelope struct {
+	Type  string            `json:"type"`
+	Data  json.RawMessage   `json:"data,omitempty"`
+	Trace map[string]string `json:"trace,omitempty"` // W3C trace context（traceparent 等），可省略
+	Seq   uint64            `json:"seq,omitempty"`   // 廣播序號（SequenceNumbers 開啟時由 hub 填入）
+}
+
+// HandlerFunc 處理特定 type 的訊息；預設在該 client 的 readPump goroutine 執行，
+// 設定 HandlerWorkers 時改在背景 worker 執行（見 handler_pool.go）
+type HandlerFunc func(c *Client, data json.RawMessage)
+
+// handlers 以 type 對應 HandlerFunc，可在任何時候註冊
+type handlers struct {
+	mu sync.RWMutex
+	m  map[string]HandlerFunc
+}
+
+// Handle 註冊 type 的處理函式；收到該 type 的訊息時改呼叫 fn，不再廣播
+func (h *Hub) Handle(typ string, fn HandlerFunc) {
+	h.handlers.mu.Lock()
+	defer h.handlers.mu.Unlock()
+	if h.handlers.m == nil {
+		h.handlers.m = make(map[string]HandlerFunc)
+	}
+	h.handlers.m[typ] = fn
+}
+
+// dispatch 解析 envelope 並交給已註冊的 handler；沒有對應 handler 時回傳 false
+func (h *Hub) dispatch(c *Client, b []byte) bool {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		return false
+	}
+	var env Envelope
+	if err := json.Unmarshal(b, &env); err != nil || env.Type == "" {
+		return false
+	}
+	h.handlers.mu.RLock()
+	fn, ok := h.handlers.m[env.Type]
+	h.handlers.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	run := func() {
+		_, span := h.tracing.startSpan(h.tracing.extract(context.Background(), env.Trace), "websocket.handle",
+			attribute.String("websocket.type", env.Type),
+			attribute.String("websocket.client_id", c.id),
+		)
+		defer span.End()
+		fn(c, env.Data)
+	}
+	if !c.acceptDedup() {
+		return true
+	}
+	if c.handlerJobs != nil {
+		c.enqueueHandler(handlerJob{typ: env.Type, run: run})
+	} else {
+		run()
+	}
+	return true
+}
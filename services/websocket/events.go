@@ -0,0 +1,164 @@
+package websocket
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 預設的事件 channel 容量
+const defaultEventBuffer = 256
+
+// Event Hub 內部事件，以 type switch 區分：
+//
+//	for e := range hub.Events() {
+//		switch e := e.(type) {
+//		case websocket.ClientConnected:
+//		case websocket.MessageDropped:
+//		}
+//	}
+type Event interface {
+	// When 事件發生的時間
+	When() time.Time
+	hubEvent()
+}
+
+// ClientConnected client 註冊完成（OnConnect 之後）
+type ClientConnected struct {
+	Time   time.Time
+	Client *Client
+}
+
+// ClientDisconnected client 連線結束（OnDisconnect 之後）
+type ClientDisconnected struct {
+	Time   time.Time
+	Client *Client
+	Close  CloseInfo
+}
+
+// MessageDropped 因背壓丟棄一則訊息（內容見 DeadLetterConfig）
+type MessageDropped struct {
+	Time   time.Time
+	Client *Client
+	Room   string
+	Topic  string
+	Reason DropReason
+}
+
+// RoomCreated 房間有了第一個成員（跨所有 shard）
+type RoomCreated struct {
+	Time time.Time
+	Room string
+}
+
+// RoomEmptied 房間最後一個成員離開
+type RoomEmptied struct {
+	Time time.Time
+	Room string
+}
+
+// RoomJoined client 加入房間
+type RoomJoined struct {
+	Time   time.Time
+	Client *Client
+	Room   string
+}
+
+// RoomLeft client 以 LeaveRoom 或指令離開房間（斷線時不另外通知）
+type RoomLeft struct {
+	Time   time.Time
+	Client *Client
+	Room   string
+}
+
+func (e ClientConnected) When() time.Time    { return e.Time }
+func (e ClientDisconnected) When() time.Time { return e.Time }
+func (e MessageDropped) When() time.Time     { return e.Time }
+func (e RoomCreated) When() time.Time        { return e.Time }
+func (e RoomEmptied) When() time.Time        { return e.Time }
+func (e RoomJoined) When() time.Time         { return e.Time }
+func (e RoomLeft) When() time.Time           { return e.Time }
+
+func (ClientConnected) hubEvent()    {}
+func (ClientDisconnected) hubEvent() {}
+func (MessageDropped) hubEvent()     {}
+func (RoomCreated) hubEvent()        {}
+func (RoomEmptied) hubEvent()        {}
+func (RoomJoined) hubEvent()         {}
+func (RoomLeft) hubEvent()           {}
+
+// eventBus Events 回傳的 channel；第一次呼叫 Events 前不產生事件
+type eventBus struct {
+	once    sync.Once
+	ch      atomic.Pointer[chan Event]
+	dropped atomic.Uint64
+
+	// subs subscribeEvents 的訂閱者（copy-on-write，emit 不取鎖）
+	mu   sync.Mutex
+	subs atomic.Pointer[[]*eventSub]
+}
+
+// eventSub 一個內部訂閱者（例如 gRPC Events stream），與 Events() 互不影響
+type eventSub struct {
+	ch      chan Event
+	dropped atomic.Uint64
+}
+
+// Events 回傳 Hub 內部事件的 channel（每次呼叫都是同一個，需要多個消費者時請自行 fan-out）。
+// 第一次呼叫後才開始產生事件；事件以不阻塞的方式送出，channel 滿（EventBuffer）時丟棄，
+// 所以接收端應持續讀取。Hub 結束後不再有事件，但 channel 不會關閉
+func (h *Hub) Events() <-chan Event {
+	h.bus.once.Do(func() {
+		ch := make(chan Event, h.opts.EventBuffer)
+		h.bus.ch.Store(&ch)
+	})
+	return *h.bus.ch.Load()
+}
+
+// emit 送出事件（可在任何 goroutine 呼叫，不阻塞）
+func (h *Hub) emit(e Event) {
+	if subs := h.bus.subs.Load(); subs != nil {
+		for _, sub := range *subs {
+			select {
+			case sub.ch <- e:
+			default:
+				sub.dropped.Add(1)
+			}
+		}
+	}
+	p := h.bus.ch.Load()
+	if p == nil {
+		return
+	}
+	select {
+	case *p <- e:
+	default:
+		// 只在第一次記 log，避免丟棄風暴時 log 也跟著爆量
+		if h.bus.dropped.Add(1) == 1 {
+			h.opts.Logger.Warn("event channel full, events dropped", "buffer", h.opts.EventBuffer)
+		}
+	}
+}
+
+// subscribeEvents 另外訂閱一份事件（容量 EventBuffer，滿時丟棄並計數）；用完需呼叫 unsubscribe
+func (h *Hub) subscribeEvents() (sub *eventSub, unsubscribe func()) {
+	sub = &eventSub{ch: make(chan Event, h.opts.EventBuffer)}
+	h.bus.updateSubs(func(subs []*eventSub) []*eventSub { return append(subs, sub) })
+	return sub, func() {
+		h.bus.updateSubs(func(subs []*eventSub) []*eventSub {
+			return slices.DeleteFunc(subs, func(s *eventSub) bool { return s == sub })
+		})
+	}
+}
+
+func (b *eventBus) updateSubs(fn func([]*eventSub) []*eventSub) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var subs []*eventSub
+	if p := b.subs.Load(); p != nil {
+		subs = slices.Clone(*p)
+	}
+	subs = fn(subs)
+	b.subs.Store(&subs)
+}
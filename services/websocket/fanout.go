@@ -0,0 +1,106 @@
+package websocket
+
+import "sync"
+
+// minParallelFanout 對象少於此數時逐一投遞（交給 worker 的成本高於平行的好處）
+const minParallelFanout = 256
+
+// fanoutPool FanoutWorkers > 0 時所有 shard 共用的投遞 worker
+type fanoutPool struct {
+	workers int
+	jobs    chan fanoutJob
+}
+
+// fanoutJob 一則廣播中的一段對象；佇列已滿的 client 記到 slow，交回 shard 依 SlowClient 策略處理
+type fanoutJob struct {
+	h       *Hub
+	m       *broadcastMsg
+	targets []*Client
+	slow    *[]slowSend
+	wg      *sync.WaitGroup
+}
+
+type slowSend struct {
+	c   *Client
+	msg *outbound
+}
+
+func newFanoutPool(workers int) *fanoutPool {
+	if workers <= 0 {
+		return nil
+	}
+	return &fanoutPool{workers: workers, jobs: make(chan fanoutJob)}
+}
+
+// run 啟動 worker，直到 done 關閉（shard 都結束後才會關閉，不會有 shard 等不到 worker）
+func (p *fanoutPool) run(done <-chan struct{}) {
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for {
+				select {
+				case j := <-p.jobs:
+					j.run()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// run 只做 interceptor 與不阻塞的放入佇列；不修改 shard 的狀態
+func (j fanoutJob) run() {
+	defer j.wg.Done()
+	for _, c := range j.targets {
+		msg := j.h.intercept(c, j.m.outFor(c))
+		if msg == nil {
+			j.m.tally.count(false)
+			continue
+		}
+		select {
+		case c.send <- msg:
+			j.m.tally.count(true)
+		default:
+			*j.slow = append(*j.slow, slowSend{c, msg})
+		}
+	}
+}
+
+// parallelFanout 將 targets 分段交給 worker 並等待全部完成（僅在 run 內呼叫）。
+// shard 在等待期間不處理其他事件，所以同一 client 的訊息順序不變，
+// worker 也不會與 shard 同時存取 client 狀態
+func (s *shard) parallelFanout(targets map[*Client]bool, m broadcastMsg, doc *filterDoc) {
+	pool := s.hub.fanout
+	list := s.scratch[:0]
+	for c := range targets {
+		// filter 在 shard 內先算好，worker 不存取 client 的訂閱狀態
+		if c != m.except && c.accepts(&m, doc) {
+			list = append(list, c)
+		}
+	}
+	size := (len(list) + pool.workers - 1) / pool.workers
+	slow := make([][]slowSend, pool.workers)
+	var wg sync.WaitGroup
+	for i := 0; i*size < len(list); i++ {
+		wg.Add(1)
+		pool.jobs <- fanoutJob{
+			h:       s.hub,
+			m:       &m,
+			targets: list[i*size : min((i+1)*size, len(list))],
+			slow:    &slow[i],
+			wg:      &wg,
+		}
+	}
+	wg.Wait()
+	for _, part := range slow {
+		for _, p := range part {
+			if s.clients[p.c] {
+				m.tally.count(s.deliverSlow(p.c, p.msg))
+			} else {
+				m.tally.count(false)
+			}
+		}
+	}
+	clear(list)
+	s.scratch = list[:0]
+}
@@ -0,0 +1,559 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 訂閱 filter 的長度與巢狀深度上限（由 client 送來，需限制解析成本）
+const (
+	maxFilterLength = 1024
+	maxFilterDepth  = 32
+)
+
+// ErrInvalidFilter filter 語法錯誤
+var ErrInvalidFilter = errors.New("websocket: invalid filter")
+
+// Filter 訂閱 filter：對 JSON 廣播內容求值的小型表達式，例如
+//
+//	symbol == 'AAPL' && price > 100
+//	data.side in ['buy', 'sell'] || !(qty <= 0)
+//
+// 支援 == != < <= > >=、&& || !、括號、x in [..]（也可對內容中的陣列）、
+// 字串（'..' 或 ".."）、數字、true、false、null。
+// 欄位以 "." 取下一層；第一段在最外層找不到時改找 "data" 內（envelope 的內容），
+// 所以 {"type":"tick","data":{"symbol":"AAPL"}} 可直接寫 symbol。
+// 欄位不存在、型別不同或內容不是 JSON 時比較結果為 false
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// CompileFilter 解析 filter；語法錯誤時回傳包含 ErrInvalidFilter 的錯誤
+func CompileFilter(expr string) (*Filter, error) {
+	if len(expr) > maxFilterLength {
+		return nil, fmt.Errorf("%w: longer than %d bytes", ErrInvalidFilter, maxFilterLength)
+	}
+	p := &filterParser{src: expr}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// String 回傳原本的表達式
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match 對已解析的 JSON 內容（json.Unmarshal 到 any 的結果）求值
+func (f *Filter) Match(doc any) bool {
+	return f.root.eval(doc) == true
+}
+
+// MatchJSON 解析 b 後求值；不是 JSON 時回傳 false
+func (f *Filter) MatchJSON(b []byte) bool {
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return false
+	}
+	return f.Match(doc)
+}
+
+// --- 求值 ---
+
+type filterNode interface {
+	eval(doc any) any
+}
+
+type litNode struct{ v any }
+
+type pathNode struct{ segs []string }
+
+type listNode struct{ items []filterNode }
+
+type notNode struct{ x filterNode }
+
+type logicNode struct {
+	and  bool
+	l, r filterNode
+}
+
+type cmpNode struct {
+	op   string
+	l, r filterNode
+}
+
+type inNode struct{ l, r filterNode }
+
+func (n litNode) eval(any) any { return n.v }
+
+func (n pathNode) eval(doc any) any {
+	obj, _ := doc.(map[string]any)
+	v, ok := obj[n.segs[0]]
+	if !ok {
+		// envelope：{"type":"...","data":{...}}
+		data, _ := obj["data"].(map[string]any)
+		v = data[n.segs[0]]
+	}
+	for _, seg := range n.segs[1:] {
+		m, _ := v.(map[string]any)
+		v = m[seg]
+	}
+	return v
+}
+
+func (n listNode) eval(doc any) any {
+	out := make([]any, len(n.items))
+	for i, it := range n.items {
+		out[i] = it.eval(doc)
+	}
+	return out
+}
+
+func (n notNode) eval(doc any) any {
+	b, ok := n.x.eval(doc).(bool)
+	return ok && !b
+}
+
+func (n logicNode) eval(doc any) any {
+	l := n.l.eval(doc) == true
+	if n.and != l {
+		// && 左邊為 false、|| 左邊為 true 時不必再算右邊
+		return l
+	}
+	return n.r.eval(doc) == true
+}
+
+func (n cmpNode) eval(doc any) any {
+	l, r := n.l.eval(doc), n.r.eval(doc)
+	switch n.op {
+	case "==":
+		return filterEqual(l, r)
+	case "!=":
+		return !filterEqual(l, r)
+	}
+	c, ok := filterCompare(l, r)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func (n inNode) eval(doc any) any {
+	l := n.l.eval(doc)
+	list, _ := n.r.eval(doc).([]any)
+	for _, v := range list {
+		if filterEqual(l, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterEqual 只比較純量；物件與陣列一律不相等
+func filterEqual(a, b any) bool {
+	switch a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	}
+	return false
+}
+
+func filterCompare(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	}
+	return 0, false
+}
+
+// --- 解析 ---
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type filterToken struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type filterParser struct {
+	src string
+	pos int
+	tok filterToken
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at %d: %s", ErrInvalidFilter, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next 讀取下一個 token 到 p.tok
+func (p *filterParser) next() error {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	p.tok = filterToken{pos: start}
+	if p.pos >= len(p.src) {
+		return nil
+	}
+	ch := p.src[p.pos]
+	switch {
+	case ch == '_' || isFilterLetter(ch):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isFilterLetter(p.src[p.pos]) || isFilterDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok.kind = tokIdent
+	case isFilterDigit(ch) || (ch == '-' && p.pos+1 < len(p.src) && isFilterDigit(p.src[p.pos+1])):
+		p.pos++
+		for p.pos < len(p.src) && (isFilterDigit(p.src[p.pos]) || strings.IndexByte(".eE+-", p.src[p.pos]) >= 0) {
+			// 指數的正負號只能緊接在 e 之後
+			if c := p.src[p.pos]; (c == '+' || c == '-') && p.src[p.pos-1] != 'e' && p.src[p.pos-1] != 'E' {
+				break
+			}
+			p.pos++
+		}
+		p.tok.kind = tokNumber
+	case ch == '\'' || ch == '"':
+		p.pos++
+		var sb strings.Builder
+		for {
+			if p.pos >= len(p.src) {
+				return p.errorf("unterminated string")
+			}
+			c := p.src[p.pos]
+			p.pos++
+			if c == ch {
+				break
+			}
+			if c == '\\' && p.pos < len(p.src) {
+				c = p.src[p.pos]
+				p.pos++
+			}
+			sb.WriteByte(c)
+		}
+		p.tok.kind, p.tok.text = tokString, sb.String()
+		return nil
+	default:
+		for _, op := range [...]string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				p.tok.kind, p.tok.text = tokOp, op
+				return nil
+			}
+		}
+		return p.errorf("unexpected character %q", ch)
+	}
+	p.tok.text = p.src[start:p.pos]
+	return nil
+}
+
+func isFilterLetter(c byte) bool { return (c|0x20) >= 'a' && (c|0x20) <= 'z' }
+func isFilterDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+func (p *filterParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *filterParser) expect(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q", op)
+	}
+	return p.next()
+}
+
+func (p *filterParser) parseOr(depth int) (filterNode, error) {
+	if depth > maxFilterDepth {
+		return nil, p.errorf("nested too deeply")
+	}
+	l, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = logicNode{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (filterNode, error) {
+	l, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = logicNode{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (filterNode, error) {
+	if p.isOp("!") {
+		if depth > maxFilterDepth {
+			return nil, p.errorf("nested too deeply")
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return p.parseCmp(depth)
+}
+
+func (p *filterParser) parseCmp(depth int) (filterNode, error) {
+	l, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.isOp("==") || p.isOp("!=") || p.isOp("<") || p.isOp("<=") || p.isOp(">") || p.isOp(">="):
+		op := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parsePrimary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return cmpNode{op: op, l: l, r: r}, nil
+	case p.tok.kind == tokIdent && p.tok.text == "in":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parsePrimary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return inNode{l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *filterParser) parsePrimary(depth int) (filterNode, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		return litNode{f}, p.next()
+	case tok.kind == tokString:
+		return litNode{tok.text}, p.next()
+	case tok.kind == tokIdent:
+		switch tok.text {
+		case "true":
+			return litNode{true}, p.next()
+		case "false":
+			return litNode{false}, p.next()
+		case "null":
+			return litNode{nil}, p.next()
+		case "in":
+			return nil, p.errorf("unexpected \"in\"")
+		}
+		return p.parsePath()
+	case p.isOp("("):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case p.isOp("["):
+		if depth > maxFilterDepth {
+			return nil, p.errorf("nested too deeply")
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		var list listNode
+		for !p.isOp("]") {
+			if len(list.items) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			it, err := p.parsePrimary(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, it)
+		}
+		return list, p.next()
+	case tok.kind == tokEOF:
+		return nil, p.errorf("unexpected end of filter")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+func (p *filterParser) parsePath() (filterNode, error) {
+	path := pathNode{segs: []string{p.tok.text}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for p.isOp(".") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokIdent {
+			return nil, p.errorf("expected field name after \".\"")
+		}
+		path.segs = append(path.segs, p.tok.text)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return path, nil
+}
+
+// --- 訂閱 ---
+
+// SubscribeFilter 訂閱 topic pattern，並只收內容符合 expr 的訊息；expr 為空字串時移除該訂閱的 filter。
+// 同一 client 有多個 pattern 符合同一個 topic 時，任一個允許即送達
+func (h *Hub) SubscribeFilter(c *Client, pattern, expr string) error {
+	if !validPattern(pattern) {
+		return ErrInvalidTopic
+	}
+	f, err := compileOptionalFilter(expr)
+	if err != nil {
+		return err
+	}
+	if !c.shard.call(func() {
+		c.shard.subscribe(c, pattern)
+		c.shard.setFilter(c, pattern, f)
+	}) {
+		return ErrHubClosed
+	}
+	return nil
+}
+
+// SetFilter 設定 client 對 topic 以外的廣播（全域與房間）的 filter；expr 為空字串時移除
+func (h *Hub) SetFilter(c *Client, expr string) error {
+	f, err := compileOptionalFilter(expr)
+	if err != nil {
+		return err
+	}
+	if !c.shard.call(func() { c.shard.setFilter(c, "", f) }) {
+		return ErrHubClosed
+	}
+	return nil
+}
+
+func compileOptionalFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	return CompileFilter(expr)
+}
+
+// setFilter key 為 topic pattern（需已訂閱）或 ""；f 為 nil 時移除（僅在 shard 內呼叫）
+func (s *shard) setFilter(c *Client, key string, f *Filter) {
+	if !s.clients[c] || (key != "" && !c.topics[key]) {
+		return
+	}
+	if f == nil {
+		delete(c.filters, key)
+		return
+	}
+	if c.filters == nil {
+		c.filters = make(map[string]*Filter)
+	}
+	c.filters[key] = f
+}
+
+// filterDoc 一則廣播的內容；有 filter 的對象才解析，同一次 fan-out 只解析一次（僅在 shard 內使用）
+type filterDoc struct {
+	data   []byte
+	parsed bool
+	doc    any
+}
+
+// allows f 為 nil 或內容符合時回傳 true
+func (d *filterDoc) allows(f *Filter) bool {
+	if f == nil {
+		return true
+	}
+	if !d.parsed {
+		d.parsed = true
+		if json.Unmarshal(d.data, &d.doc) != nil {
+			d.doc = nil
+		}
+	}
+	return f.Match(d.doc)
+}
+
+// accepts c 的 filter 是否允許這則廣播（僅在 shard 內呼叫）
+func (c *Client) accepts(m *broadcastMsg, d *filterDoc) bool {
+	if len(c.filters) == 0 {
+		return true
+	}
+	if m.topic == "" {
+		return d.allows(c.filters[""])
+	}
+	for pattern := range c.topics {
+		if matchTopic(pattern, m.topic) && d.allows(c.filters[pattern]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,364 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// GraphQL subscription 轉接（graphql-transport-ws 協定，subprotocol "graphql-transport-ws"）：
+//
+//   - client 先送 connection_init（GraphQLConfig.OnInit 檢查 payload），server 回 connection_ack；
+//     ConnectionInitTimeout（預設 3 秒）內沒有 init 時以 4408 關閉，重複 init 以 4429 關閉
+//   - subscribe 交給 GraphQLConfig.Resolve 決定路由：回傳 Topic 時訂閱該 Hub topic pattern，
+//     之後 Publish 到符合的 topic 都會以這個 operation 的 next 送出；回傳 Result 時送出一次 next 後 complete
+//   - client 的 complete 取消 operation；Resolve 回傳 error 時送出 error 訊息
+//   - 心跳：server 每 PingPeriod 送 {"type":"ping"}，client 回 pong；client 的 ping 回 pong
+//   - 協定錯誤依規格關閉：4400（格式錯誤）、4401（尚未 ack 就 subscribe）、4403（OnInit 拒絕）、4409（id 重複）
+//   - 這類 client 只收到 topic 訊息；全域、房間廣播與 SendTo 等不會送給它
+
+// graphQLSubprotocol graphql-ws 函式庫使用的 Sec-WebSocket-Protocol
+const graphQLSubprotocol = "graphql-transport-ws"
+
+// 預設等待 connection_init 的時間（與 graphql-ws 相同）
+const defaultGraphQLInitTimeout = 3 * time.Second
+
+// graphql-transport-ws 規定的 close code
+const (
+	graphQLBadRequest         = 4400
+	graphQLUnauthorized       = 4401
+	graphQLForbidden          = 4403
+	graphQLInitTimeout        = 4408
+	graphQLSubscriberExists   = 4409
+	graphQLTooManyInitRequest = 4429
+)
+
+// GraphQLConfig GraphQL subscription 轉接的設定（協定見 graphql.go）
+type GraphQLConfig struct {
+	// OnInit 檢查 connection_init 的 payload（例如 token）；回傳的 payload 放進 connection_ack（可為 nil），
+	// 回傳 error 時以 4403 關閉。nil 表示全部接受
+	OnInit func(c *Client, payload json.RawMessage) (json.RawMessage, error)
+
+	// Resolve 決定 subscribe 的 operation 如何送出結果（必填）；ctx 衍生自 Client.Context()，在 RPCTimeout 到期或 client 斷線時取消。
+	// 回傳 GraphQLErrors 可帶多個錯誤，其他 error 以其訊息作為單一錯誤送出
+	Resolve func(ctx context.Context, c *Client, op GraphQLOperation) (GraphQLRoute, error)
+
+	// ConnectionInitTimeout 等待 connection_init 的時間（預設 3 秒）
+	ConnectionInitTimeout time.Duration
+}
+
+func (g *GraphQLConfig) validate() error {
+	if g.Resolve == nil {
+		return errors.New("websocket: GraphQLConfig.Resolve is required")
+	}
+	if g.ConnectionInitTimeout < 0 {
+		return fmt.Errorf("websocket: GraphQL ConnectionInitTimeout must not be negative, got %s", g.ConnectionInitTimeout)
+	}
+	return nil
+}
+
+// GraphQLOperation client subscribe 的 operation
+type GraphQLOperation struct {
+	ID            string          `json:"-"`
+	Query         string          `json:"query"`
+	OperationName string          `json:"operationName,omitempty"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+	Extensions    json.RawMessage `json:"extensions,omitempty"`
+}
+
+// GraphQLRoute Resolve 的結果：Topic 與 Result 擇一
+type GraphQLRoute struct {
+	// Topic 要接收的 Hub topic pattern（例如 "orders.42" 或 "orders.*"）
+	Topic string
+
+	// Result 直接送出的 ExecutionResult（query、mutation 或只有一筆的 subscription），送出後 complete
+	Result json.RawMessage
+
+	// Transform 將 Publish 的 payload 轉成這個 operation 的 ExecutionResult；回傳 nil 表示略過。
+	// 預設含 "data" 或 "errors" 欄位的 JSON 物件原樣送出，其他 JSON 包成 {"data":payload}
+	Transform func(payload []byte) (json.RawMessage, error)
+}
+
+// GraphQLError GraphQL 規格的錯誤
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLErrors Resolve 回傳時以 error 訊息送給 client
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	if len(e) == 0 {
+		return "websocket: graphql error"
+	}
+	return "websocket: graphql error: " + e[0].Message
+}
+
+// graphQLMessage graphql-transport-ws 的訊息
+type graphQLMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// graphQLConn GraphQL client 的協定狀態；ops 由 readPump 寫入、writePump 讀取
+type graphQLConn struct {
+	cfg         *GraphQLConfig
+	initialized atomic.Bool // 已收到 connection_init（init timeout 的 timer 會讀取）
+	acked       bool
+
+	mu  sync.Mutex
+	ops map[string]*graphQLOp
+}
+
+// graphQLOp 以 topic 路由的 operation
+type graphQLOp struct {
+	id        string
+	pattern   string
+	transform func(payload []byte) (json.RawMessage, error)
+}
+
+func newGraphQLConn(cfg *GraphQLConfig) *graphQLConn {
+	return &graphQLConn{cfg: cfg, ops: make(map[string]*graphQLOp)}
+}
+
+// readGraphQL 讀取並處理 graphql-transport-ws 訊息，取代 readPump 的 JSON 協定；連線結束時返回
+func (c *Client) readGraphQL() {
+	g := c.gql
+	timeout := g.cfg.ConnectionInitTimeout
+	if timeout <= 0 {
+		timeout = defaultGraphQLInitTimeout
+	}
+	timer := time.AfterFunc(timeout, func() {
+		if !g.initialized.Load() {
+			c.closeProtocol(graphQLInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer timer.Stop()
+	defer c.graphQLCompleteAll()
+
+	pongWait := c.hub.opts.PongWait
+	for {
+		msgType, b, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.unexpectedClose(err) {
+				c.hub.opts.Logger.Warn("websocket read failed", c.logAttrs("err", err)...)
+			}
+			c.recordReadError(err)
+			return
+		}
+		var m graphQLMessage
+		if msgType != websocket.TextMessage || json.Unmarshal(b, &m) != nil || m.Type == "" {
+			c.closeProtocol(graphQLBadRequest, "Invalid message received")
+			return
+		}
+		accept, keep := c.allowInbound()
+		if !keep {
+			return
+		}
+		if !accept {
+			continue
+		}
+		switch m.Type {
+		case "connection_init":
+			if !c.graphQLInit(m.Payload) {
+				return
+			}
+		case "ping":
+			if !c.graphQLSend(graphQLMessage{Type: "pong", Payload: m.Payload}) {
+				return
+			}
+		case "pong":
+			_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		case "subscribe":
+			if !c.graphQLSubscribe(m) {
+				return
+			}
+		case "complete":
+			c.graphQLComplete(m.ID)
+		default:
+			c.closeProtocol(graphQLBadRequest, "Invalid message received")
+			return
+		}
+	}
+}
+
+// graphQLInit 處理 connection_init；回傳 false 時已關閉連線
+func (c *Client) graphQLInit(payload json.RawMessage) bool {
+	g := c.gql
+	if g.initialized.Swap(true) {
+		c.closeProtocol(graphQLTooManyInitRequest, "Too many initialisation requests")
+		return false
+	}
+	var ack json.RawMessage
+	if g.cfg.OnInit != nil {
+		var err error
+		if ack, err = g.cfg.OnInit(c, payload); err != nil {
+			c.hub.opts.Logger.Warn("graphql connection rejected", c.logAttrs("err", err)...)
+			c.closeProtocol(graphQLForbidden, "Forbidden")
+			return false
+		}
+	}
+	g.acked = true
+	return c.graphQLSend(graphQLMessage{Type: "connection_ack", Payload: ack})
+}
+
+// graphQLSubscribe 交給 Resolve 並依結果訂閱 topic 或直接送出結果；回傳 false 時結束連線
+func (c *Client) graphQLSubscribe(m graphQLMessage) bool {
+	g := c.gql
+	if !g.acked {
+		c.closeProtocol(graphQLUnauthorized, "Unauthorized")
+		return false
+	}
+	var op GraphQLOperation
+	if m.ID == "" || json.Unmarshal(m.Payload, &op) != nil || op.Query == "" {
+		c.closeProtocol(graphQLBadRequest, "Invalid message received")
+		return false
+	}
+	op.ID = m.ID
+	g.mu.Lock()
+	_, exists := g.ops[op.ID]
+	g.mu.Unlock()
+	if exists {
+		c.closeProtocol(graphQLSubscriberExists, "Subscriber for "+op.ID+" already exists")
+		return false
+	}
+	c.touch()
+
+	route, err := c.graphQLResolve(op)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case err != nil:
+		var list GraphQLErrors
+		if !errors.As(err, &list) || len(list) == 0 {
+			list = GraphQLErrors{{Message: err.Error()}}
+		}
+		return c.graphQLSend(graphQLMessage{ID: op.ID, Type: "error", Payload: mustJSON(list)})
+	case route.Result != nil:
+		return c.graphQLSend(graphQLMessage{ID: op.ID, Type: "next", Payload: route.Result}) &&
+			c.graphQLSend(graphQLMessage{ID: op.ID, Type: "complete"})
+	}
+	if err := c.hub.Subscribe(c, route.Topic); err != nil {
+		return c.graphQLSend(graphQLMessage{ID: op.ID, Type: "error", Payload: mustJSON(GraphQLErrors{{Message: err.Error()}})})
+	}
+	g.mu.Lock()
+	g.ops[op.ID] = &graphQLOp{id: op.ID, pattern: route.Topic, transform: route.Transform}
+	g.mu.Unlock()
+	return true
+}
+
+// graphQLResolve 呼叫 Resolve；ctx 在 RPCTimeout 到期或 Client.Context() 取消時取消（後者回傳 context.Canceled）
+func (c *Client) graphQLResolve(op GraphQLOperation) (route GraphQLRoute, err error) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.hub.opts.RPCTimeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			c.logPanic("graphql Resolve", p)
+			route, err = GraphQLRoute{}, errors.New("internal error")
+		}
+	}()
+	route, err = c.gql.cfg.Resolve(ctx, c, op)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return GraphQLRoute{}, context.Canceled
+	}
+	return route, err
+}
+
+// graphQLComplete 取消 operation；沒有其他 operation 使用同一個 pattern 時取消訂閱
+func (c *Client) graphQLComplete(id string) {
+	g := c.gql
+	g.mu.Lock()
+	op, ok := g.ops[id]
+	if ok {
+		delete(g.ops, id)
+	}
+	shared := false
+	if ok {
+		for _, other := range g.ops {
+			shared = shared || other.pattern == op.pattern
+		}
+	}
+	g.mu.Unlock()
+	if ok && !shared {
+		c.hub.Unsubscribe(c, op.pattern)
+	}
+}
+
+// graphQLCompleteAll 斷線時清掉所有 operation（shard 移除 client 時會一併移除訂閱）
+func (c *Client) graphQLCompleteAll() {
+	g := c.gql
+	g.mu.Lock()
+	clear(g.ops)
+	g.mu.Unlock()
+}
+
+// graphQLSend 交給 writePump 寫出協定訊息
+func (c *Client) graphQLSend(m graphQLMessage) bool {
+	return c.writePacket(newOutbound(TextMessage, mustJSON(m)))
+}
+
+// writeGraphQL 將 topic 訊息以每個符合的 operation 的 next 寫出（僅在 writePump 內呼叫）
+func (c *Client) writeGraphQL(m *outbound) error {
+	g := c.gql
+	g.mu.Lock()
+	ops := make([]*graphQLOp, 0, len(g.ops))
+	for _, op := range g.ops {
+		if matchTopic(op.pattern, m.topic) {
+			ops = append(ops, op)
+		}
+	}
+	g.mu.Unlock()
+	sort.Slice(ops, func(i, j int) bool { return ops[i].id < ops[j].id })
+	for _, op := range ops {
+		result, err := graphQLResult(op, m.data)
+		if err != nil {
+			c.hub.opts.Logger.Warn("graphql result skipped", c.logAttrs("operation", op.id, "topic", m.topic, "err", err)...)
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		b := mustJSON(graphQLMessage{ID: op.id, Type: "next", Payload: result})
+		if err := c.conn.WriteMessage(websocket.TextMessage, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// graphQLResult 依 operation 的 Transform 或預設規則產生 ExecutionResult
+func graphQLResult(op *graphQLOp, payload []byte) (result json.RawMessage, err error) {
+	if op.transform != nil {
+		// 在 writePump 內執行，panic 只略過這則訊息
+		defer func() {
+			if p := recover(); p != nil {
+				result, err = nil, fmt.Errorf("transform panic: %v", p)
+			}
+		}()
+		return op.transform(payload)
+	}
+	trimmed := bytes.TrimSpace(payload)
+	if !json.Valid(trimmed) {
+		return nil, errors.New("payload is not JSON")
+	}
+	var obj map[string]json.RawMessage
+	if trimmed[0] == '{' && json.Unmarshal(trimmed, &obj) == nil {
+		_, hasData := obj["data"]
+		_, hasErrors := obj["errors"]
+		if hasData || hasErrors {
+			return trimmed, nil
+		}
+	}
+	return mustJSON(map[string]json.RawMessage{"data": trimmed}), nil
+}
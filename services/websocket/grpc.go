@@ -0,0 +1,301 @@
+package websocket
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wspb/control.proto
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"my-websocket/services/websocket/wspb"
+)
+
+// RegisterControlService 在 gRPC server 上註冊 wspb.Control（schema 見 wspb/control.proto），
+// 讓內部服務不經 HTTP/JSON 就能廣播、私訊、列出與踢除連線並訂閱事件。
+// 驗證請搭配 GRPCAPIKeyAuth 或自己的 interceptor。設定 AuditLog 時 Broadcast、SendToUser 與 Disconnect 會寫入稽核紀錄
+func RegisterControlService(s grpc.ServiceRegistrar, h *Hub) {
+	wspb.RegisterControlServer(s, &controlServer{hub: h})
+}
+
+type controlServer struct {
+	wspb.UnimplementedControlServer
+	hub *Hub
+}
+
+func (s *controlServer) Broadcast(ctx context.Context, req *wspb.BroadcastRequest) (_ *wspb.BroadcastResponse, err error) {
+	h := s.hub
+	target := ""
+	if req.Topic != "" {
+		target = "topic=" + req.Topic
+	}
+	defer func() { s.audit(ctx, "grpc Broadcast", target, req.Rooms, req.Data, err) }()
+	if len(req.Data) > h.MaxMessageSize() {
+		return nil, status.Error(codes.InvalidArgument, ErrMessageTooLarge.Error())
+	}
+	msgType := TextMessage
+	if req.Binary {
+		msgType = BinaryMessage
+	}
+	switch {
+	case req.Topic != "":
+		if len(req.Rooms) > 0 || req.Binary {
+			return nil, status.Error(codes.InvalidArgument, "topic must not be combined with rooms or binary")
+		}
+		if err := h.Publish(req.Topic, req.Data); err != nil {
+			return nil, grpcError(err)
+		}
+	case len(req.Rooms) > 0:
+		msgs := make([]BatchMessage, len(req.Rooms))
+		for i, room := range req.Rooms {
+			if room == "" {
+				return nil, status.Error(codes.InvalidArgument, "room must not be empty")
+			}
+			msgs[i] = BatchMessage{Room: room, MsgType: msgType, Data: req.Data}
+		}
+		if err := errors.Join(h.BroadcastBatch(msgs)...); err != nil {
+			return nil, grpcError(err)
+		}
+	case req.Binary:
+		h.BroadcastBinary(req.Data)
+	default:
+		// 呼叫端以 otelgrpc 等 interceptor 帶入 trace 時，span 會接到 client 寫出
+		h.BroadcastContext(ctx, req.Data)
+	}
+	return &wspb.BroadcastResponse{}, nil
+}
+
+func (s *controlServer) SendToUser(ctx context.Context, req *wspb.SendToUserRequest) (_ *wspb.SendToUserResponse, err error) {
+	h := s.hub
+	defer func() { s.audit(ctx, "grpc SendToUser", "user:"+req.UserId, nil, req.Data, err) }()
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if len(req.Data) > h.MaxMessageSize() {
+		return nil, status.Error(codes.InvalidArgument, ErrMessageTooLarge.Error())
+	}
+	msgType := TextMessage
+	if req.Binary {
+		msgType = BinaryMessage
+	}
+	errs := h.BroadcastBatch([]BatchMessage{{UserID: req.UserId, MsgType: msgType, Data: req.Data}})
+	if errs[0] != nil {
+		return nil, grpcError(errs[0])
+	}
+	return &wspb.SendToUserResponse{}, nil
+}
+
+func (s *controlServer) ListClients(_ context.Context, req *wspb.ListClientsRequest) (*wspb.ListClientsResponse, error) {
+	resp := &wspb.ListClientsResponse{}
+	for _, c := range s.hub.Clients() {
+		if (req.UserId != "" && c.UserID != req.UserId) || (req.Room != "" && !slices.Contains(c.Rooms, req.Room)) {
+			continue
+		}
+		resp.Clients = append(resp.Clients, &wspb.Client{
+			Id:          c.ID,
+			UserId:      c.UserID,
+			RemoteAddr:  c.RemoteAddr,
+			Ip:          c.IP,
+			Subprotocol: c.Subprotocol,
+			Transport:   c.Transport,
+			UserAgent:   c.UserAgent,
+			JoinedAt:    timestamppb.New(c.JoinedAt),
+			Rooms:       c.Rooms,
+			Topics:      c.Topics,
+			LatencyMs:   c.LatencyMs,
+			ReadOnly:    c.ReadOnly,
+		})
+	}
+	return resp, nil
+}
+
+func (s *controlServer) Disconnect(ctx context.Context, req *wspb.DisconnectRequest) (_ *wspb.DisconnectResponse, err error) {
+	defer func() { s.audit(ctx, "grpc Disconnect", "id="+req.ClientId, nil, nil, err) }()
+	code := int(req.Code)
+	if code == 0 {
+		code = ClosePolicyViolation
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+	if err := s.hub.Disconnect(req.ClientId, code, reason); err != nil {
+		return nil, grpcError(err)
+	}
+	return &wspb.DisconnectResponse{}, nil
+}
+
+// audit 寫入一筆稽核紀錄（沒有設定 AuditLog 時不做事）；Status 為 gRPC status code（0 為 OK），寫入失敗只記 log
+func (s *controlServer) audit(ctx context.Context, action, target string, rooms []string, data []byte, err error) {
+	h := s.hub
+	if h.opts.AuditLog == nil {
+		return
+	}
+	e := AuditEntry{
+		Actor:  grpcActor(ctx),
+		Action: action,
+		Target: target,
+		Rooms:  auditRooms(slices.Clone(rooms), nil),
+		Size:   len(data),
+		Status: int(status.Code(err)),
+	}
+	if len(data) > 0 {
+		sum := sha256.Sum256(data)
+		e.PayloadHash = hex.EncodeToString(sum[:])
+	}
+	if err := h.Audit(context.WithoutCancel(ctx), e); err != nil {
+		h.opts.Logger.Error("audit record failed", "action", e.Action, "actor", e.Actor, "err", err)
+	}
+}
+
+// grpcActor 與 AuditMiddleware 相同："apikey:<金鑰名稱>"（GRPCAPIKeyAuth 驗證過時），否則為 "ip:<peer IP>"
+func grpcActor(ctx context.Context) string {
+	if name, _ := ctx.Value(grpcAPIKeyName{}).(string); name != "" {
+		return "apikey:" + name
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// Events 每個 stream 各自訂閱一份事件，與 Hub.Events() 互不影響；接收端太慢時丟棄事件（與 Events() 相同）
+func (s *controlServer) Events(req *wspb.EventsRequest, stream wspb.Control_EventsServer) error {
+	h := s.hub
+	sub, unsubscribe := h.subscribeEvents()
+	defer unsubscribe()
+	defer func() {
+		if n := sub.dropped.Load(); n > 0 {
+			h.opts.Logger.Warn("grpc event stream too slow, events dropped", "dropped", n)
+		}
+	}()
+	for {
+		select {
+		case e := <-sub.ch:
+			ev := eventProto(e)
+			if ev == nil || (len(req.Types) > 0 && !slices.Contains(req.Types, ev.Type)) {
+				continue
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-h.done:
+			return status.Error(codes.Unavailable, ErrHubClosed.Error())
+		}
+	}
+}
+
+// eventProto 將事件轉成 wspb.Event；Event 介面之外的型別回傳 nil
+func eventProto(e Event) *wspb.Event {
+	ev := &wspb.Event{Time: timestamppb.New(e.When())}
+	client := func(c *Client) {
+		ev.ClientId = c.ID()
+	}
+	switch e := e.(type) {
+	case ClientConnected:
+		ev.Type = "client_connected"
+		client(e.Client)
+	case ClientDisconnected:
+		ev.Type = "client_disconnected"
+		client(e.Client)
+		ev.CloseCode, ev.CloseReason, ev.ClosedByServer = int32(e.Close.Code), e.Close.Reason, e.Close.ByServer
+	case MessageDropped:
+		ev.Type = "message_dropped"
+		client(e.Client)
+		ev.Room, ev.Topic, ev.DropReason = e.Room, e.Topic, string(e.Reason)
+	case RoomCreated:
+		ev.Type, ev.Room = "room_created", e.Room
+	case RoomEmptied:
+		ev.Type, ev.Room = "room_emptied", e.Room
+	case RoomJoined:
+		ev.Type, ev.Room = "room_joined", e.Room
+		client(e.Client)
+	case RoomLeft:
+		ev.Type, ev.Room = "room_left", e.Room
+		client(e.Client)
+	default:
+		return nil
+	}
+	return ev
+}
+
+// grpcError 將 hub 的 error 對應到 gRPC status code
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrClientNotFound), errors.Is(err, ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrHubClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, ErrMessageTooLarge), errors.Is(err, ErrInvalidTopic), errors.Is(err, ErrBatchTarget),
+		errors.Is(err, ErrInvalidCloseFrame):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// GRPCAPIKeyAuth 以 APIKey 保護 gRPC 服務的 server option（unary 與 stream 都套用）：
+// 接受 metadata authorization: Bearer <key> 或 x-api-key: <key>，速率限制與 APIKeyAuth 相同
+//
+//	grpc.NewServer(websocket.GRPCAPIKeyAuth(keys...)...)
+func GRPCAPIKeyAuth(keys ...APIKey) []grpc.ServerOption {
+	entries := newAPIKeyEntries(keys)
+	check := func(ctx context.Context) (string, error) {
+		match, err := checkAPIKey(entries, grpcAPIKey(ctx))
+		switch err {
+		case nil:
+			return match.Name, nil
+		case errUnauthorized:
+			return "", status.Error(codes.Unauthenticated, err.Error())
+		case errAPIKeyRateLimited:
+			return "", status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return "", err
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+			name, err := check(ctx)
+			if err != nil {
+				return nil, err
+			}
+			// 稽核紀錄的 actor（見 controlServer.audit）
+			return next(context.WithValue(ctx, grpcAPIKeyName{}, name), req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+			if _, err := check(ss.Context()); err != nil {
+				return err
+			}
+			return next(srv, ss)
+		}),
+	}
+}
+
+// grpcAPIKeyName GRPCAPIKeyAuth 驗證通過的金鑰名稱存放在 context 的 key
+type grpcAPIKeyName struct{}
+
+func grpcAPIKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) > 0 && len(v[0]) > 7 && strings.EqualFold(v[0][:7], "bearer ") {
+		return strings.TrimSpace(v[0][7:])
+	}
+	if v := md.Get("x-api-key"); len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
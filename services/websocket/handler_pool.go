@@ -0,0 +1,102 @@
+package websocket
+
+// HandlerOverflow 決定 client 待處理的 handler 訊息超過 HandlerQueue 時如何處理新訊息
+type HandlerOverflow int
+
+const (
+	HandlerReject     HandlerOverflow = iota // 丟棄新訊息並回覆送出者 {"type":"error","data":{"error":"server busy",...}}（預設）
+	HandlerDropOldest                        // 丟掉最舊一則尚未執行的訊息
+	HandlerBlock                             // readPump 等待佇列騰出空間（期間不讀 frame，只適合短暫尖峰）
+	HandlerDisconnect                        // 以 1013 try again later 斷線
+)
+
+// 未設定 HandlerQueue 時每個 client 最多的待處理訊息
+const defaultHandlerQueue = 16
+
+type handlerJob struct {
+	typ string
+	run func()
+}
+
+// enqueueHandler 將 handler 排入 client 的佇列並確保有 worker 處理（僅在 readPump 內呼叫）
+func (c *Client) enqueueHandler(j handlerJob) {
+	h := c.hub
+	select {
+	case c.handlerJobs <- j:
+		c.spawnHandler()
+		return
+	default:
+	}
+	h.stats.handlerOverflows.Add(1)
+	switch h.opts.HandlerOverflow {
+	case HandlerDropOldest:
+		select {
+		case old := <-c.handlerJobs:
+			h.opts.Logger.Warn("handler queue full, oldest message dropped", c.logAttrs("type", old.typ)...)
+		default:
+		}
+		select {
+		case c.handlerJobs <- j:
+			c.spawnHandler()
+			return
+		default:
+		}
+	case HandlerBlock:
+		select {
+		case c.handlerJobs <- j:
+			c.spawnHandler()
+		case <-c.ctx.Done():
+			c.rejectDedup()
+		}
+		return
+	case HandlerDisconnect:
+		h.opts.Logger.Warn("handler queue full, disconnecting", c.logAttrs("type", j.typ)...)
+		c.rejectDedup()
+		_ = h.Disconnect(c.id, CloseTryAgainLater, "too many pending messages")
+		return
+	}
+	c.rejectDedup()
+	_ = h.sendToClient(c, mustJSON(map[string]any{"type": "error", "data": map[string]string{
+		"error": "server busy", "messageType": j.typ,
+	}}))
+}
+
+// spawnHandler 執行中的 worker 少於 HandlerPerClient 時再啟動一個；
+// 每個 client 的 worker 只在有待處理訊息時存在，閒置連線不佔 goroutine
+func (c *Client) spawnHandler() {
+	if c.claimHandler() {
+		go c.runHandlers()
+	}
+}
+
+func (c *Client) claimHandler() bool {
+	limit := int32(c.hub.opts.HandlerPerClient)
+	for {
+		n := c.handlerRunning.Load()
+		if n >= limit {
+			return false
+		}
+		if c.handlerRunning.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// runHandlers 依序執行佇列中的 handler，每次執行前取得 hub 的名額（HandlerWorkers），佇列空了就結束
+func (c *Client) runHandlers() {
+	sem := c.hub.handlerSlots
+	for {
+		select {
+		case j := <-c.handlerJobs:
+			sem <- struct{}{}
+			c.safely("handler "+j.typ, j.run)
+			<-sem
+		default:
+			c.handlerRunning.Add(-1)
+			// enqueueHandler 可能在上面的 default 之後才放入訊息，當時 worker 數已滿所以沒有另外啟動
+			if len(c.handlerJobs) == 0 || !c.claimHandler() {
+				return
+			}
+		}
+	}
+}
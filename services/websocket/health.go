@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// readiness 檢查 backplane 的期限
+const healthCheckTimeout = 2 * time.Second
+
+// BackplanePinger 可回報連線狀態的 Backplane（RedisBackplane、NATSBackplane 皆有實作）；
+// 沒有實作的 backplane 在 /readyz 視為正常。SessionStore 有實作時也會檢查（例如 RedisSessionStore）
+type BackplanePinger interface {
+	Ping(ctx context.Context) error
+}
+
+// healthStatus /healthz 與 /readyz 的回應
+type healthStatus struct {
+	Status        string            `json:"status"` // "ok" 或 "unavailable"
+	Connections   int               `json:"connections"`
+	LastBroadcast *time.Time        `json:"lastBroadcast"` // 尚未廣播過時為 null
+	Checks        map[string]string `json:"checks,omitempty"`
+}
+
+// HealthHandler 提供 Kubernetes probe 用的 /healthz（process 存活）與 /readyz（Hub 正在執行、沒有 draining 且 backplane 連線正常，
+// 否則回 503），回應帶目前連線數與最後一次廣播的時間。gin 可用 r.GET("/healthz", gin.WrapH(handler))
+func HealthHandler(h *Hub) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, h.health(nil))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks := h.readiness(r.Context())
+		st := h.health(checks)
+		code := http.StatusOK
+		for _, v := range checks {
+			if v != "ok" {
+				st.Status, code = "unavailable", http.StatusServiceUnavailable
+			}
+		}
+		writeHealth(w, code, st)
+	})
+	return mux
+}
+
+func (h *Hub) health(checks map[string]string) healthStatus {
+	st := healthStatus{Status: "ok", Connections: h.Len(), Checks: checks}
+	if t := h.LastBroadcast(); !t.IsZero() {
+		st.LastBroadcast = &t
+	}
+	return st
+}
+
+// readiness 各項檢查的結果："ok" 或失敗原因
+func (h *Hub) readiness(ctx context.Context) map[string]string {
+	checks := map[string]string{"hub": "ok"}
+	switch {
+	case h.closing.Load():
+		checks["hub"] = "shutting down"
+	case !h.running.Load():
+		checks["hub"] = "not running"
+	case h.drainSince.Load() != 0:
+		checks["hub"] = "draining"
+	}
+	if h.backplane != nil {
+		pingCheck(ctx, checks, "backplane", h.backplane)
+	}
+	if h.sessionSync != nil {
+		pingCheck(ctx, checks, "session_store", h.sessionSync.store)
+	}
+	if h.messageLog != nil {
+		pingCheck(ctx, checks, "message_store", h.messageLog.store)
+	}
+	if h.opts.AuditLog != nil {
+		pingCheck(ctx, checks, "audit_log", h.opts.AuditLog)
+	}
+	return checks
+}
+
+// pingCheck 記錄 checks[name]：v 有實作 BackplanePinger 時以 healthCheckTimeout 為期限 Ping，否則視為正常
+func pingCheck(ctx context.Context, checks map[string]string, name string, v any) {
+	checks[name] = "ok"
+	p, ok := v.(BackplanePinger)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := p.Ping(ctx); err != nil {
+		checks[name] = err.Error()
+	}
+}
+
+func writeHealth(w http.ResponseWriter, code int, st healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// LastBroadcast 回傳最後一次廣播的時間（尚未廣播過時為零值）
+func (h *Hub) LastBroadcast() time.Time {
+	n := h.stats.lastBroadcast.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Heartbeat 協定（AppHeartbeat > 0 時，只用於本套件的 JSON envelope 協定）：
+//
+//  1. server 每 AppHeartbeat 送 {"type":"ping","ts":<unix ms>,"rtt":<上次的 RTT ms>}（尚未測得時沒有 rtt）
+//  2. client 原樣帶回 ts 回覆 {"type":"pong","ts":...}；server 以送出到收到的時間記為 RTT（Client.Latency）
+//  3. client 也可送 {"type":"ping","ts":...}，server 回 {"type":"pong","ts":...} 讓 client 自行計算
+//
+// 心跳訊息不計入 session 序號、idle 時間與訊息統計；只接受最近一次 ping 的 ts，舊的或偽造的 pong 會被忽略
+
+// latencyBuckets HubStats.Latency 分佈的上限
+var latencyBuckets = [...]time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// LatencyStats heartbeat 測得的 RTT 分佈
+type LatencyStats struct {
+	Samples uint64  `json:"samples"`
+	AvgMs   float64 `json:"avgMs"`
+	// Buckets 各區間的樣本數（不累加），key 為區間上限（例如 "50ms"），超過最大上限的為 "inf"
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+// latencyCounters Hub 層級的 RTT 統計
+type latencyCounters struct {
+	samples atomic.Uint64
+	sum     atomic.Int64 // ns
+	buckets [len(latencyBuckets) + 1]atomic.Uint64
+}
+
+func (l *latencyCounters) observe(d time.Duration) {
+	l.samples.Add(1)
+	l.sum.Add(int64(d))
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	l.buckets[i].Add(1)
+}
+
+func (l *latencyCounters) snapshot() LatencyStats {
+	st := LatencyStats{Samples: l.samples.Load(), Buckets: make(map[string]uint64, len(l.buckets))}
+	if st.Samples > 0 {
+		st.AvgMs = float64(l.sum.Load()) / float64(st.Samples) / float64(time.Millisecond)
+	}
+	for i := range l.buckets {
+		key := "inf"
+		if i < len(latencyBuckets) {
+			key = latencyBuckets[i].String()
+		}
+		st.Buckets[key] = l.buckets[i].Load()
+	}
+	return st
+}
+
+// heartbeats 這個連線是否使用 JSON heartbeat（MQTT、Socket.IO 等協定有各自的心跳）
+func (c *Client) heartbeats() bool {
+	return c.hub.opts.AppHeartbeat > 0 && c.conn != nil &&
+		c.mqtt == nil && c.sio == nil && !c.jsonrpc && c.gql == nil && !c.protobuf
+}
+
+// Latency 最近一次 heartbeat 測得的來回時間；尚未測得（或未開啟 AppHeartbeat）時為 0
+func (c *Client) Latency() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// writeHeartbeat 送出 heartbeat ping（僅在 writePump 內呼叫）
+func (c *Client) writeHeartbeat() error {
+	now := time.Now()
+	b := []byte(`{"type":"ping","ts":`)
+	b = strconv.AppendInt(b, now.UnixMilli(), 10)
+	if rtt := c.Latency(); rtt > 0 {
+		b = append(b, `,"rtt":`...)
+		b = strconv.AppendInt(b, rtt.Milliseconds(), 10)
+	}
+	b = append(b, '}')
+	c.heartbeatSent.Store(now.UnixNano())
+	return c.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// heartbeat 處理 heartbeat 的 ping / pong（由 readPump 呼叫）；不是 heartbeat 訊息時回傳 false
+func (c *Client) heartbeat(b []byte) bool {
+	if !c.heartbeats() || !bytes.Contains(b, []byte(`"ts"`)) {
+		return false
+	}
+	var v struct {
+		Type string          `json:"type"`
+		TS   json.RawMessage `json:"ts"`
+	}
+	if json.Unmarshal(b, &v) != nil || len(v.TS) == 0 {
+		return false
+	}
+	switch v.Type {
+	case "pong":
+		sent := c.heartbeatSent.Load()
+		if ts, err := strconv.ParseInt(string(v.TS), 10, 64); err == nil && sent != 0 && ts == time.Unix(0, sent).UnixMilli() {
+			// 同一個 ping 只計算一次
+			if c.heartbeatSent.CompareAndSwap(sent, 0) {
+				rtt := time.Since(time.Unix(0, sent))
+				c.rtt.Store(int64(rtt))
+				c.hub.latency.observe(rtt)
+			}
+		}
+		return true
+	case "ping":
+		pong := append(append([]byte(`{"type":"pong","ts":`), v.TS...), '}')
+		c.writePacket(&outbound{msgType: TextMessage, data: pong, control: true})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import "time"
+
+// history 固定大小的 ring buffer，保存最近 N 則廣播（僅在所屬 shard 內存取）
+type history struct {
+	buf  []*outbound
+	next int
+	full bool
+}
+
+func newHistory(n int) *history {
+	return &history{buf: make([]*outbound, n)}
+}
+
+func (r *history) add(m *outbound) {
+	r.buf[r.next] = m
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// each 由舊到新逐一呼叫 fn
+func (r *history) each(fn func(*outbound)) {
+	if r.full {
+		for _, m := range r.buf[r.next:] {
+			fn(m)
+		}
+	}
+	for _, m := range r.buf[:r.next] {
+		fn(m)
+	}
+}
+
+// record 記錄一則廣播；room 為空代表全域（僅在 shard 內呼叫）
+func (s *shard) record(room string, m *outbound) {
+	if s.history == nil {
+		return
+	}
+	if room == "" {
+		s.history.add(m)
+		return
+	}
+	r, ok := s.roomHistory[room]
+	if !ok {
+		r = newHistory(s.hub.opts.HistorySize)
+		s.roomHistory[room] = r
+		s.hub.rooms.track(room, time.Now())
+	}
+	r.add(m)
+}
+
+// replay 將歷史訊息補送給剛加入的 client（僅在 shard 內呼叫）
+func (s *shard) replay(c *Client, room string) {
+	if s.history == nil {
+		return
+	}
+	r := s.history
+	if room != "" {
+		r = s.roomHistory[room]
+	}
+	if r == nil {
+		return
+	}
+	f := c.filters[""]
+	r.each(func(m *outbound) {
+		if s.clients[c] && (f == nil || f.MatchJSON(m.data)) {
+			s.deliver(c, m)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHistoryDisabled 沒有 HistoryStore（也沒有開啟 HistorySize）
+var ErrHistoryDisabled = errors.New("websocket: room history disabled")
+
+// HistoryMessage 保存下來的一則房間廣播
+type HistoryMessage struct {
+	ID     uint64    `json:"id"` // 同一房間內遞增，用於分頁
+	Room   string    `json:"room"`
+	Binary bool      `json:"binary,omitempty"`
+	Data   []byte    `json:"data"`
+	Time   time.Time `json:"time"`
+}
+
+// HistoryStore 房間廣播的持久化（可選），供 RoomHistory 分頁查詢（例如晚加入的 client、聊天室往回捲動）。
+// 只保存本 instance 發出的房間廣播（不含 topic 與 presence 等暫時性訊息），backplane 轉來的由原 instance 保存，
+// 所以多個 instance 應共用同一個 store（RedisHistoryStore、SQLHistoryStore）
+type HistoryStore interface {
+	// Append 保存一則訊息並回傳其 ID；ID 由 store 指定，同一房間內遞增
+	Append(ctx context.Context, m HistoryMessage) (uint64, error)
+	// Query 由新到舊回傳最多 limit 則；before > 0 時只回傳 ID 小於 before 的訊息
+	Query(ctx context.Context, room string, before uint64, limit int) ([]HistoryMessage, error)
+}
+
+const (
+	// historyStoreTimeout 單次寫入 HistoryStore 的期限
+	historyStoreTimeout = 5 * time.Second
+	// historyQueueSize 待寫入的訊息上限，store 跟不上時丟棄並記 log
+	historyQueueSize = 1024
+)
+
+// historyWriter 在背景依序寫入 HistoryStore；nil 表示未設定
+type historyWriter struct {
+	store   HistoryStore
+	queue   chan HistoryMessage
+	dropped atomic.Bool // 佇列滿時只記一次 log
+}
+
+func newHistoryWriter(store HistoryStore) *historyWriter {
+	if store == nil {
+		return nil
+	}
+	return &historyWriter{store: store, queue: make(chan HistoryMessage, historyQueueSize)}
+}
+
+// run 依序寫入直到 done 關閉，關閉時寫完佇列內剩下的訊息
+func (w *historyWriter) run(h *Hub) {
+	for {
+		select {
+		case m := <-w.queue:
+			w.append(h, m)
+		case <-h.done:
+			for {
+				select {
+				case m := <-w.queue:
+					w.append(h, m)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *historyWriter) append(h *Hub, m HistoryMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), historyStoreTimeout)
+	defer cancel()
+	if _, err := w.store.Append(ctx, m); err != nil {
+		h.opts.Logger.Warn("history store append failed", "room", m.Room, "err", err)
+	}
+}
+
+// persist 將本 instance 發出的廣播排入 MessageStore 與（房間廣播）HistoryStore 的寫入佇列（不阻塞）
+func (h *Hub) persist(m broadcastMsg) {
+	if m.transient {
+		return
+	}
+	now := time.Now()
+	h.record(m, now)
+	w := h.historyLog
+	if w == nil || m.room == "" || m.topic != "" {
+		return
+	}
+	hm := HistoryMessage{Room: m.room, Binary: m.msgType == BinaryMessage, Data: m.data, Time: now}
+	select {
+	case w.queue <- hm:
+	default:
+		if !w.dropped.Swap(true) {
+			h.opts.Logger.Warn("history queue full, messages not persisted", "queue", historyQueueSize)
+		}
+	}
+}
+
+// RoomHistory 回傳房間保存的訊息，由舊到新最多 limit 則；before > 0 時只取 ID 小於 before 的訊息
+// （以上一頁第一則的 ID 往前翻頁）。寫入是在背景進行，剛送出的廣播可能稍後才查得到
+func (h *Hub) RoomHistory(ctx context.Context, room string, before uint64, limit int) ([]HistoryMessage, error) {
+	if h.historyLog == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+	msgs, err := h.historyLog.store.Query(ctx, room, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(msgs)
+	return msgs, nil
+}
+
+// MemoryHistoryStore 以記憶體實作 HistoryStore，每個房間保留最近 size 則；
+// 未設定 HistoryStore 但 HistorySize > 0 時的預設值（只有本 instance 發出的訊息）
+type MemoryHistoryStore struct {
+	size  int
+	mu    sync.Mutex
+	rooms map[string]*memoryRoomHistory
+}
+
+type memoryRoomHistory struct {
+	last uint64
+	msgs []HistoryMessage // 由舊到新
+}
+
+func NewMemoryHistoryStore(size int) *MemoryHistoryStore {
+	if size <= 0 {
+		size = 1
+	}
+	return &MemoryHistoryStore{size: size, rooms: make(map[string]*memoryRoomHistory)}
+}
+
+func (s *MemoryHistoryStore) Append(_ context.Context, m HistoryMessage) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[m.Room]
+	if !ok {
+		r = &memoryRoomHistory{}
+		s.rooms[m.Room] = r
+	}
+	r.last++
+	m.ID = r.last
+	r.msgs = append(r.msgs, m)
+	if len(r.msgs) > s.size {
+		r.msgs = slices.Delete(r.msgs, 0, len(r.msgs)-s.size)
+	}
+	return m.ID, nil
+}
+
+func (s *MemoryHistoryStore) Query(_ context.Context, room string, before uint64, limit int) ([]HistoryMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rooms[room]
+	if r == nil {
+		return nil, nil
+	}
+	end := len(r.msgs)
+	if before > 0 {
+		// ID 連續遞增，buffer 內第一則的 ID 為 last-len+1
+		first := r.last - uint64(len(r.msgs)) + 1
+		switch {
+		case before <= first:
+			return nil, nil
+		case before <= r.last:
+			end = int(before - first)
+		}
+	}
+	out := make([]HistoryMessage, 0, min(limit, end))
+	for i := end - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, r.msgs[i])
+	}
+	return out, nil
+}
+
+// forget 清掉已過期房間的歷史（見 roomlife.go）
+func (s *MemoryHistoryStore) forget(rooms []string) {
+	s.mu.Lock()
+	for _, room := range rooms {
+		delete(s.rooms, room)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 預設 idle 警告後到關閉的寬限時間
+const defaultIdleGrace = 30 * time.Second
+
+// Idle 協定：client 超過 IdleTimeout 沒有送出應用層訊息（pong 與 {"type":"ping"} 不算）時，
+// server 送出 {"type":"idle","data":{"closeIn":30}}；寬限時間內仍沒有訊息則以 1000 "idle timeout" 關閉。
+// SSE client 無法送訊息，不受此限制。
+
+// touch 記錄 client 送出應用層訊息的時間（由 readPump 呼叫）
+func (c *Client) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// idleFor 距離上次應用層訊息的時間
+func (c *Client) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.lastActive.Load()))
+}
+
+// idleCheckPeriod shard 檢查 idle 連線的間隔
+func (o *Options) idleCheckPeriod() time.Duration {
+	return min(o.IdleTimeout, o.IdleGrace) / 2
+}
+
+// checkIdle 對 idle 的 client 送出警告，警告後超過寬限時間仍無訊息則關閉（僅在 shard 內呼叫）
+func (s *shard) checkIdle(now time.Time) {
+	timeout, grace := s.hub.opts.IdleTimeout, s.hub.opts.IdleGrace
+	for c := range s.clients {
+		if c.conn == nil {
+			continue
+		}
+		if c.idleFor(now) < timeout {
+			c.idleWarned = time.Time{}
+			continue
+		}
+		if c.idleWarned.IsZero() {
+			c.idleWarned = now
+			s.deliver(c, newOutbound(TextMessage, idleWarning(grace)))
+			continue
+		}
+		if now.Sub(c.idleWarned) >= grace {
+			s.closeClient(c, CloseNormalClosure, "idle timeout")
+		}
+	}
+}
+
+func idleWarning(grace time.Duration) []byte {
+	b, _ := json.Marshal(Envelope{Type: "idle", Data: mustJSON(map[string]any{"closeIn": int((grace + time.Second - 1) / time.Second)})})
+	return b
+}
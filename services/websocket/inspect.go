@@ -0,0 +1,92 @@
+package websocket
+
+import "time"
+
+// ClientDebug 單一連線的除錯資訊（Hub.Inspect），用於追查「為什麼這個使用者沒收到訊息」
+type ClientDebug struct {
+	ClientSnapshot
+
+	// CompressionLevel 協商出 permessage-deflate 時使用的壓縮等級
+	CompressionLevel int `json:"compressionLevel,omitempty"`
+	// Filters 訂閱 filter：key 為 topic pattern（"" 為 SetFilter）
+	Filters map[string]string `json:"filters,omitempty"`
+
+	// SendQueue / SendCap 佇列中尚未寫出的訊息數與上限（SendCap）
+	SendQueue int `json:"sendQueue"`
+	SendCap   int `json:"sendCap"`
+	// PacketQueue 協定轉接或 heartbeat 的控制封包佇列
+	PacketQueue int `json:"packetQueue,omitempty"`
+	// HandlerQueue 尚未執行的 handler 訊息（HandlerWorkers > 0 時）
+	HandlerQueue int `json:"handlerQueue,omitempty"`
+
+	MessagesSent uint64 `json:"messagesSent"`
+	BytesSent    uint64 `json:"bytesSent"`
+	// Dropped 因背壓丟棄的訊息數（見 SlowClient）
+	Dropped uint64 `json:"dropped"`
+
+	// LastPong 最後一次收到 WebSocket pong 的時間（尚未收到時為 nil）
+	LastPong *time.Time `json:"lastPong,omitempty"`
+	// LastActive 最後一次收到應用層訊息的時間（沒有時為連線時間）
+	LastActive time.Time `json:"lastActive"`
+
+	// Session / SessionSeq 續接 session 的 ID（不含 secret）與最後一則訊息的序號
+	Session    string `json:"session,omitempty"`
+	SessionSeq uint64 `json:"sessionSeq,omitempty"`
+}
+
+// Inspect 回傳指定 client 的除錯資訊；不在本 instance 時回傳 ErrClientNotFound
+func (h *Hub) Inspect(clientID string) (ClientDebug, error) {
+	var (
+		d     ClientDebug
+		found bool
+	)
+	s := h.shardFor(clientID)
+	if !s.call(func() {
+		c, ok := s.byID[clientID]
+		if !ok {
+			return
+		}
+		found = true
+		d = c.debug()
+	}) {
+		return ClientDebug{}, ErrHubClosed
+	}
+	if !found {
+		return ClientDebug{}, ErrClientNotFound
+	}
+	return d, nil
+}
+
+// debug 僅在所屬 shard 內呼叫（rooms、filters 由 shard 擁有）
+func (c *Client) debug() ClientDebug {
+	d := ClientDebug{
+		ClientSnapshot: c.snapshot(),
+		SendQueue:      len(c.send),
+		SendCap:        cap(c.send),
+		PacketQueue:    len(c.packets),
+		HandlerQueue:   len(c.handlerJobs),
+		MessagesSent:   c.messagesSent.Load(),
+		BytesSent:      c.bytesSent.Load(),
+		Dropped:        c.dropped.Load(),
+		LastActive:     time.Unix(0, c.lastActive.Load()),
+	}
+	if c.compressed {
+		d.CompressionLevel = c.hub.opts.CompressionLevel
+	}
+	for key, f := range c.filters {
+		if d.Filters == nil {
+			d.Filters = make(map[string]string, len(c.filters))
+		}
+		d.Filters[key] = f.String()
+	}
+	if ns := c.lastPong.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		d.LastPong = &t
+	}
+	if sess := c.session; sess != nil {
+		sess.mu.Lock()
+		d.Session, d.SessionSeq = sess.id, sess.seq
+		sess.mu.Unlock()
+	}
+	return d
+}
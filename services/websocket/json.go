@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMessageTooLarge 編碼後超過 MaxMessageSize
+var ErrMessageTooLarge = errors.New("websocket: message exceeds MaxMessageSize")
+
+// marshal 以 JSON 編碼並檢查大小（不論 client 協商的 codec）
+func (h *Hub) marshal(v any) ([]byte, error) {
+	return h.encode(JSONCodec{}, v)
+}
+
+// BroadcastJSON 將 v 編碼成 JSON 後廣播
+func (h *Hub) BroadcastJSON(v any) error {
+	return h.BroadcastJSONContext(context.Background(), v)
+}
+
+// BroadcastJSONContext 同 BroadcastJSON，並延續 ctx 的 trace（見 BroadcastContext）
+func (h *Hub) BroadcastJSONContext(ctx context.Context, v any) error {
+	b, err := h.marshal(v)
+	if err != nil {
+		return err
+	}
+	h.BroadcastContext(ctx, b)
+	return nil
+}
+
+// BroadcastToRoomJSON 將 v 編碼成 JSON 後對房間廣播
+func (h *Hub) BroadcastToRoomJSON(room string, v any) error {
+	b, err := h.marshal(v)
+	if err != nil {
+		return err
+	}
+	h.BroadcastToRoom(room, b)
+	return nil
+}
+
+// SendJSON 將 v 編碼成 JSON 後只送給這個 client
+func (c *Client) SendJSON(v any) error {
+	b, err := c.hub.marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(b)
+}
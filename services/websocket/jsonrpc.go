@@ -0,0 +1,313 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// JSON-RPC 2.0 端點（ServeJSONRPC）：
+//
+//   - 每個 text frame 是一個 request 或一個 batch（陣列，最多 maxJSONRPCBatch 個）；
+//     method 為 RegisterRPC 註冊的名稱，錯誤碼與 RPCError 相同（另有 -32700 parse error）
+//   - 帶 id 的 request 回 {"jsonrpc":"2.0","id":...,"result":...} 或 "error"；batch 的回應合併成一個陣列，
+//     全部都是 notification 時不回應
+//   - 內建 join / leave（params {"room":"x"} 或 ["x"]）與 subscribe / unsubscribe（{"topic":"x"} 或 ["x"]），
+//     註冊同名 method 時以註冊的為準
+//   - 沒有註冊的 method 的 notification 轉成 {"type":method,"data":params}，與一般 client 的訊息走相同流程
+//     （Handle 註冊的 handler 或廣播）
+//   - 送往 client 的 {"type":T,"data":D} 變成 notification {"jsonrpc":"2.0","method":T,"params":D}
+//     （D 不是物件或陣列時包成 [D]），其他訊息的 method 為 "message"、params 為 [訊息]（binary 為 base64 字串）
+
+// maxJSONRPCBatch 一個 batch 最多的 request 數
+const maxJSONRPCBatch = 100
+
+// RPCParseError 無法解析的 JSON（JSON-RPC 2.0）
+const RPCParseError = -32700
+
+// jsonRPCMethodDefault 不是 envelope 的訊息使用的 notification method
+const jsonRPCMethodDefault = "message"
+
+// jsonRPCRequest JSON-RPC 2.0 的 request；ID 為 nil 表示 notification
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// jsonRPCResponse JSON-RPC 2.0 的 response
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// jsonRPCNotification server 送出的 notification
+type jsonRPCNotification struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// ServeJSONRPC JSON-RPC 2.0 client 連線的端點，例如 r.GET("/jsonrpc", ServeJSONRPC(hub))
+func ServeJSONRPC(h *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.serveWs(c, "websocket.ServeJSONRPC", func(cl *Client) error {
+			cl.jsonrpc = true
+			cl.packets = make(chan *outbound, protocolPacketQueue)
+			// response 與 notification 以外的 session 訊息無法表達，不使用續接
+			cl.session, cl.resuming = nil, false
+			return nil
+		})
+	}
+}
+
+// readJSONRPC 讀取並處理 JSON-RPC 訊息，取代 readPump 的 JSON 協定；連線結束時返回
+func (c *Client) readJSONRPC() {
+	for {
+		msgType, b, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.unexpectedClose(err) {
+				c.hub.opts.Logger.Warn("websocket read failed", c.logAttrs("err", err)...)
+			}
+			c.recordReadError(err)
+			return
+		}
+		accept, keep := c.allowInbound()
+		if !keep {
+			return
+		}
+		if !accept {
+			continue
+		}
+		if msgType == websocket.BinaryMessage {
+			c.jsonRPCReply(jsonRPCError(nil, &RPCError{Code: RPCParseError, Message: "binary frames are not supported"}))
+			continue
+		}
+		c.handleJSONRPC(b)
+	}
+}
+
+// handleJSONRPC 處理一個 request 或 batch；RPC method 在自己的 goroutine 執行，其餘在 readPump 內處理
+func (c *Client) handleJSONRPC(b []byte) {
+	b = bytes.TrimSpace(b)
+	if !json.Valid(b) {
+		c.jsonRPCReply(jsonRPCError(nil, &RPCError{Code: RPCParseError, Message: "parse error"}))
+		return
+	}
+	if b[0] != '[' {
+		if done := c.jsonRPCCall(b); done != nil {
+			go func() { c.jsonRPCReply(<-done) }()
+		}
+		return
+	}
+
+	var batch []json.RawMessage
+	_ = json.Unmarshal(b, &batch)
+	if len(batch) == 0 || len(batch) > maxJSONRPCBatch {
+		c.jsonRPCReply(jsonRPCError(nil, &RPCError{Code: RPCInvalidRequest, Message: "batch must contain 1 to 100 requests"}))
+		return
+	}
+	pending := make([]<-chan *jsonRPCResponse, 0, len(batch))
+	for _, raw := range batch {
+		if done := c.jsonRPCCall(raw); done != nil {
+			pending = append(pending, done)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	// 等所有呼叫完成後一次回應
+	go func() {
+		replies := make([]*jsonRPCResponse, 0, len(pending))
+		for _, done := range pending {
+			if r := <-done; r != nil {
+				replies = append(replies, r)
+			}
+		}
+		if len(replies) > 0 {
+			c.writePacket(newOutbound(TextMessage, mustJSON(replies)))
+		}
+	}()
+}
+
+// jsonRPCCall 處理一個 request；回傳的 channel 會收到 response（client 斷線時為 nil），notification 回傳 nil
+func (c *Client) jsonRPCCall(b []byte) <-chan *jsonRPCResponse {
+	var req jsonRPCRequest
+	if err := json.Unmarshal(b, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" ||
+		!validJSONRPCID(req.ID) || !validJSONRPCParams(req.Params) {
+		id := req.ID
+		if !validJSONRPCID(id) {
+			id = nil
+		}
+		return resolved(jsonRPCError(id, &RPCError{Code: RPCInvalidRequest, Message: "invalid request"}))
+	}
+	notify := req.ID == nil
+	if fn, ok := c.hub.rpcMethod(req.Method); ok {
+		if notify {
+			go func() { _, _ = c.callRPC(fn, req.Method, req.Params, nil) }()
+			return nil
+		}
+		done := make(chan *jsonRPCResponse, 1)
+		go func() {
+			result, err := c.callRPC(fn, req.Method, req.Params, nil)
+			if errors.Is(err, context.Canceled) {
+				done <- nil
+				return
+			}
+			done <- jsonRPCResponseFor(req.ID, result, err)
+		}()
+		return done
+	}
+	if arg, builtin := jsonRPCCommand(req.Method, req.Params); builtin {
+		err := c.jsonRPCBuiltin(req.Method, arg)
+		if notify {
+			return nil
+		}
+		return resolved(jsonRPCResponseFor(req.ID, true, err))
+	}
+	if !notify {
+		return resolved(jsonRPCError(req.ID, &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + req.Method}))
+	}
+	c.handle(TextMessage, mustJSON(Envelope{Type: req.Method, Data: req.Params}))
+	return nil
+}
+
+// resolved 已有結果的 response channel
+func resolved(r *jsonRPCResponse) <-chan *jsonRPCResponse {
+	done := make(chan *jsonRPCResponse, 1)
+	done <- r
+	return done
+}
+
+// jsonRPCBuiltin 執行內建的房間與 topic 指令；arg 為空表示參數不正確
+func (c *Client) jsonRPCBuiltin(method, arg string) error {
+	if arg == "" {
+		return &RPCError{Code: RPCInvalidParams, Message: method + " needs a single name parameter"}
+	}
+	c.touch()
+	switch method {
+	case "join":
+		c.hub.JoinRoom(c, arg)
+	case "leave":
+		c.hub.LeaveRoom(c, arg)
+	case "subscribe":
+		if err := c.hub.Subscribe(c, arg); err != nil {
+			return &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+		}
+	case "unsubscribe":
+		c.hub.Unsubscribe(c, arg)
+	}
+	return nil
+}
+
+// jsonRPCCommand 解析內建指令的參數：{"room":"x"} / {"topic":"x"} 或 ["x"]；builtin 為 false 表示不是內建指令
+func jsonRPCCommand(method string, params json.RawMessage) (arg string, builtin bool) {
+	key := "room"
+	switch method {
+	case "join", "leave":
+	case "subscribe", "unsubscribe":
+		key = "topic"
+	default:
+		return "", false
+	}
+	var list []string
+	if json.Unmarshal(params, &list) == nil && len(list) == 1 && list[0] != "" {
+		return list[0], true
+	}
+	var obj map[string]string
+	if json.Unmarshal(params, &obj) == nil {
+		return obj[key], true
+	}
+	return "", true
+}
+
+// validJSONRPCID id 只能是字串、數字或 null（nil 表示 notification）
+func validJSONRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v any
+	if json.Unmarshal(id, &v) != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+// validJSONRPCParams params 可省略，否則必須是物件或陣列
+func validJSONRPCParams(params json.RawMessage) bool {
+	p := bytes.TrimSpace(params)
+	return len(p) == 0 || p[0] == '{' || p[0] == '['
+}
+
+func jsonRPCResponseFor(id json.RawMessage, result any, err error) *jsonRPCResponse {
+	if err != nil {
+		return jsonRPCError(id, err)
+	}
+	return jsonRPCResult(id, result)
+}
+
+func jsonRPCResult(id json.RawMessage, result any) *jsonRPCResponse {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return jsonRPCError(id, &RPCError{Code: RPCInternalError, Message: "encode result: " + err.Error()})
+	}
+	return &jsonRPCResponse{JSONRPC: "2.0", ID: id, Result: b}
+}
+
+func jsonRPCError(id json.RawMessage, err error) *jsonRPCResponse {
+	var re *RPCError
+	if !errors.As(err, &re) {
+		re = &RPCError{Code: RPCInternalError, Message: err.Error()}
+	}
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &jsonRPCResponse{JSONRPC: "2.0", ID: id, Error: re}
+}
+
+// jsonRPCReply 交給 writePump 寫出 response（resp 為 nil 時不寫出）
+func (c *Client) jsonRPCReply(resp *jsonRPCResponse) {
+	if resp != nil {
+		c.writePacket(newOutbound(TextMessage, mustJSON(resp)))
+	}
+}
+
+// jsonRPCPayload 將 hub 的訊息轉成 notification
+func jsonRPCPayload(m *outbound) []byte {
+	n := jsonRPCNotification{JSONRPC: "2.0", Method: jsonRPCMethodDefault}
+	trimmed := bytes.TrimSpace(m.data)
+	switch {
+	case m.msgType == BinaryMessage:
+		n.Params = mustJSON([][]byte{m.data})
+	case json.Valid(trimmed):
+		var env struct {
+			Type *string         `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if trimmed[0] == '{' && json.Unmarshal(trimmed, &env) == nil && env.Type != nil && *env.Type != "" {
+			n.Method = *env.Type
+			if d := bytes.TrimSpace(env.Data); len(d) > 0 && string(d) != "null" {
+				n.Params = env.Data
+				if d[0] != '{' && d[0] != '[' {
+					n.Params = mustJSON([]json.RawMessage{env.Data})
+				}
+			}
+		} else {
+			n.Params = mustJSON([]json.RawMessage{trimmed})
+		}
+	default:
+		n.Params = mustJSON([]string{string(m.data)})
+	}
+	return mustJSON(n)
+}
@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/time/rate"
+)
+
+// KafkaBridge 消費 Kafka topic 並將每筆 record 廣播到 hub。
+// 廣播完成後才 commit offset（at-least-once，需設定 ReaderConfig.GroupID；未設定時不 commit）；
+// 以 Rate 限制廣播速度，超過的 record 留在 Kafka 裡（consumer lag）而不是堆進 client 的佇列。
+type KafkaBridge struct {
+	Logger Logger // 預設 slog.Default()
+
+	// RoomFromKey 開啟時 key 不為空的 record 只廣播到與 key 同名的房間，key 為空時全域廣播
+	RoomFromKey bool
+
+	// Transform 將 record 轉成要送出的訊息（預設原樣送出 Value）；回傳 nil 表示略過。
+	// 回傳 error 的 record 記錄 log 後略過（仍會 commit，避免卡住整個 partition）
+	Transform func(m kafka.Message) ([]byte, error)
+
+	// Rate 每秒最多廣播幾筆，Burst 可瞬間超出的筆數（預設 1）；Rate 為 0 表示不限制
+	Rate  float64
+	Burst int
+
+	hub    *Hub
+	reader *kafka.Reader
+}
+
+// NewKafkaBridge 以 reader 建立 bridge；Run 不會關閉 reader，由呼叫端負責
+func NewKafkaBridge(h *Hub, r *kafka.Reader) *KafkaBridge {
+	return &KafkaBridge{Logger: slog.Default(), hub: h, reader: r}
+}
+
+// Run 持續消費直到 ctx 結束（回傳 nil）、Hub 關閉（回傳 ErrHubClosed）或 Kafka 發生錯誤
+func (b *KafkaBridge) Run(ctx context.Context) error {
+	var limiter *rate.Limiter
+	if b.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(b.Rate), max(b.Burst, 1))
+	}
+	commit := b.reader.Config().GroupID != ""
+	for {
+		m, err := b.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("websocket: kafka fetch: %w", err)
+		}
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				return nil
+			}
+		}
+		// Hub 關閉中送不出去，不 commit，讓下一次啟動重新消費
+		if b.hub.closing.Load() {
+			return ErrHubClosed
+		}
+		b.deliver(m)
+		if !commit {
+			continue
+		}
+		if err := b.reader.CommitMessages(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("websocket: kafka commit: %w", err)
+		}
+	}
+}
+
+// deliver 轉換並廣播一筆 record；Hub 的 shard 佇列滿時會阻塞，自然形成背壓
+func (b *KafkaBridge) deliver(m kafka.Message) {
+	payload := m.Value
+	if b.Transform != nil {
+		var err error
+		if payload, err = b.Transform(m); err != nil {
+			b.Logger.Warn("kafka record skipped", "topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "err", err)
+			return
+		}
+	}
+	if payload == nil {
+		return
+	}
+	if len(payload) > b.hub.MaxMessageSize() {
+		b.Logger.Warn("kafka record skipped", "topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "err", ErrMessageTooLarge)
+		return
+	}
+	if b.RoomFromKey && len(m.Key) > 0 {
+		b.hub.BroadcastToRoom(string(m.Key), payload)
+		return
+	}
+	b.hub.Broadcast(payload)
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 未設定 RetryAfter 時建議的重連等待
+const defaultRetryAfter = 5 * time.Second
+
+// connCounter 追蹤連線數（含升級中的連線），在 ServeWs 與 readPump 結束時更新
+type connCounter struct {
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+// acquire 預留一個連線名額；超過上限時回傳對應的 HTTP status（0 表示成功）
+func (l *connCounter) acquire(ip string, max, maxPerIP int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if max > 0 && l.total >= max {
+		return http.StatusServiceUnavailable
+	}
+	if maxPerIP > 0 && l.perIP[ip] >= maxPerIP {
+		return http.StatusTooManyRequests
+	}
+	if l.perIP == nil {
+		l.perIP = make(map[string]int)
+	}
+	l.total++
+	l.perIP[ip]++
+	return 0
+}
+
+func (l *connCounter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// retryAfter 建議的重連等待：RetryAfter 到 2×RetryAfter 之間隨機
+func (h *Hub) retryAfter() time.Duration {
+	d := h.opts.RetryAfter
+	return d + rand.N(d)
+}
+
+// retryReason 1013 close frame 的 reason：{"reason":"...","retryAfterMs":7342}（不超過 close frame 的 123 bytes）
+type retryReason struct {
+	Reason       string `json:"reason"`
+	RetryAfterMs int64  `json:"retryAfterMs"`
+}
+
+// overloaded 因關閉中或 MaxConnections 拒絕連線：回 503 並帶 Retry-After 與 retryAfterMs。
+// 瀏覽器的 WebSocket 看不到 HTTP status，所以 WebSocket 升級要求會先完成升級，
+// 再以 1013 Try Again Later 的 close frame 告知等待時間（client.js 依此延後重連）
+func (h *Hub) overloaded(c *gin.Context, reason string) {
+	wait := h.retryAfter()
+	h.stats.overloaded.Add(1)
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		header := http.Header{"Retry-After": {retryAfterHeader(wait)}}
+		conn, err := h.upgrader.Upgrade(c.Writer, c.Request, header)
+		if err != nil {
+			// Upgrade 已回應 HTTP 錯誤（例如 origin 不符）
+			c.Abort()
+			return
+		}
+		writeRetryClose(conn, reason, wait)
+		conn.Close()
+		c.Abort()
+		return
+	}
+	c.Header("Retry-After", retryAfterHeader(wait))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": reason, "retryAfterMs": wait.Milliseconds()})
+}
+
+// writeRetryClose 送出帶等待時間的 1013 close frame
+func writeRetryClose(conn *websocket.Conn, reason string, wait time.Duration) {
+	b, _ := json.Marshal(retryReason{Reason: reason, RetryAfterMs: wait.Milliseconds()})
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, string(b)),
+		time.Now().Add(time.Second))
+}
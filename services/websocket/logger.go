@@ -0,0 +1,22 @@
+package websocket
+
+import "log/slog"
+
+var _ Logger = (*slog.Logger)(nil)
+
+// Logger 結構化 log 介面；*slog.Logger 可直接使用
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// logAttrs 每筆 client 相關 log 都帶的欄位
+func (c *Client) logAttrs(args ...any) []any {
+	attrs := []any{"client", c.id, "remote", c.remoteAddr, "ip", c.ip}
+	if c.meta.RequestID != "" {
+		attrs = append(attrs, "request_id", c.meta.RequestID)
+	}
+	return append(attrs, args...)
+}
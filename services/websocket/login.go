@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDuplicateLogin LoginRejectNew 時該使用者已有連線
+var ErrDuplicateLogin = errors.New("websocket: user already connected")
+
+// CloseLoggedInElsewhere LoginKickOld 踢掉舊連線時使用的 close code
+const CloseLoggedInElsewhere = 4001
+
+// LoginPolicy 同一個 userID 已有連線時如何處理新的連線（或 BindUser）
+type LoginPolicy int
+
+const (
+	// LoginAllowMultiple 允許多個連線（預設，例如多個分頁/裝置）
+	LoginAllowMultiple LoginPolicy = iota
+	// LoginRejectNew 拒絕新的連線：升級前回 409，BindUser 回傳 ErrDuplicateLogin
+	LoginRejectNew
+	// LoginKickOld 以 4001 "logged in elsewhere" 關閉舊連線，保留新的
+	LoginKickOld
+)
+
+// loginRegistry 跨 shard 的 userID 佔用狀態（同一使用者的連線可能在不同 shard）
+type loginRegistry struct {
+	mu       sync.Mutex
+	byUser   map[string]map[*Client]bool
+	byClient map[*Client]string
+}
+
+// claim 讓 c 佔用 userID；依 policy 回傳需要踢掉的舊連線，或 ErrDuplicateLogin。
+// 同一個 session 的續接不算重複登入。
+func (r *loginRegistry) claim(c *Client, userID string, policy LoginPolicy) ([]*Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byUser == nil {
+		r.byUser = make(map[string]map[*Client]bool)
+		r.byClient = make(map[*Client]string)
+	}
+	var others []*Client
+	for other := range r.byUser[userID] {
+		if other != c && (c.session == nil || other.session != c.session) {
+			others = append(others, other)
+		}
+	}
+	if len(others) > 0 && policy == LoginRejectNew {
+		return nil, ErrDuplicateLogin
+	}
+	r.releaseLocked(c)
+	conns, ok := r.byUser[userID]
+	if !ok {
+		conns = make(map[*Client]bool)
+		r.byUser[userID] = conns
+	}
+	conns[c] = true
+	r.byClient[c] = userID
+	if policy == LoginKickOld {
+		return others, nil
+	}
+	return nil, nil
+}
+
+// release 釋放 c 的佔用（可在 shard 內呼叫，不會阻塞在其他 shard）
+func (r *loginRegistry) release(c *Client) {
+	r.mu.Lock()
+	r.releaseLocked(c)
+	r.mu.Unlock()
+}
+
+func (r *loginRegistry) releaseLocked(c *Client) {
+	userID, ok := r.byClient[c]
+	if !ok {
+		return
+	}
+	delete(r.byClient, c)
+	if conns := r.byUser[userID]; conns != nil {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(r.byUser, userID)
+		}
+	}
+}
+
+// claimLogin 依 Options.DuplicateLogin 佔用 userID，並踢掉舊連線（不可在 shard 內呼叫）
+func (h *Hub) claimLogin(c *Client, userID string) error {
+	if userID == "" {
+		h.logins.release(c)
+		return nil
+	}
+	kicked, err := h.logins.claim(c, userID, h.opts.DuplicateLogin)
+	if err != nil {
+		return err
+	}
+	for _, old := range kicked {
+		s := old.shard
+		s.call(func() {
+			if s.clients[old] {
+				s.closeClient(old, CloseLoggedInElsewhere, "logged in elsewhere")
+			}
+		})
+	}
+	return nil
+}
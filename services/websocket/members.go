@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// 房間成員事件（MemberEvents）：
+//
+//	→ 成員 {"type":"member_joined","data":{"room":"lobby","member":{"id":"...","userId":"u1"},"count":3}}
+//	→ 成員 {"type":"member_left","data":{"room":"lobby","member":{...},"count":2}}
+//	← {"type":"members","data":{"room":"lobby"}}
+//	→ {"type":"members","data":{"room":"lobby","count":2,"members":[{...},{...}]}}
+//
+// member_joined 也會送給剛加入的 client。成員清單與人數只計算本 instance 的連線；
+// "members" 只回覆房間成員，其他人收到 {"type":"error"}
+
+// memberView 事件與 members 回覆中的一筆成員（不含 Claims 與 Values）
+type memberView struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+// memberInfo 僅在所屬 shard 內呼叫
+func (c *Client) memberInfo() ClientInfo {
+	return ClientInfo{
+		ID:       c.id,
+		UserID:   c.userID,
+		Claims:   c.info.Claims,
+		ReadOnly: c.ReadOnly(),
+		Tags:     c.sortedTags(),
+	}
+}
+
+func viewOf(info ClientInfo) memberView {
+	return memberView{ID: info.ID, UserID: info.UserID, ReadOnly: info.ReadOnly}
+}
+
+// RoomMembers 回傳房間在本 instance 的成員（依上線時間排序）；ID 為連線 ID、UserID 為目前綁定的使用者，
+// Claims 與 Authenticate 回傳的相同（呼叫端不可修改），不含 Values
+func (h *Hub) RoomMembers(room string) []ClientInfo {
+	type member struct {
+		info ClientInfo
+		c    *Client
+	}
+	var members []member
+	h.callAll(func(s *shard) {
+		for c := range s.rooms[room] {
+			members = append(members, member{c.memberInfo(), c})
+		}
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].c.joinedAt.Before(members[j].c.joinedAt) })
+	out := make([]ClientInfo, len(members))
+	for i, m := range members {
+		out[i] = m.info
+	}
+	return out
+}
+
+// memberEvent 記下加入 / 離開房間，由 forwardEvents 送給房間成員（在 shard 內呼叫）
+func (h *Hub) memberEvent(event string, c *Client, room string) {
+	if !h.opts.MemberEvents || h.closing.Load() {
+		return
+	}
+	b, err := json.Marshal(Envelope{Type: event, Data: mustJSON(map[string]any{
+		"room":   room,
+		"member": viewOf(c.memberInfo()),
+		"count":  h.RoomCount(room),
+	})})
+	if err != nil {
+		h.opts.Logger.Error("member event encode failed", "err", err)
+		return
+	}
+	h.events.push(broadcastMsg{room: room, msgType: TextMessage, data: b, transient: true})
+}
+
+// handleMembers 回覆請求者所在房間的成員清單
+func (h *Hub) handleMembers(c *Client, data json.RawMessage) {
+	var req struct {
+		Room string `json:"room"`
+	}
+	_ = json.Unmarshal(data, &req)
+	member := false
+	c.shard.call(func() { member = req.Room != "" && c.rooms[req.Room] })
+	if !member {
+		_ = h.sendToClient(c, mustJSON(map[string]any{"type": "error", "data": map[string]string{
+			"error": "not a member", "room": req.Room,
+		}}))
+		return
+	}
+	infos := h.RoomMembers(req.Room)
+	views := make([]memberView, len(infos))
+	for i, info := range infos {
+		views[i] = viewOf(info)
+	}
+	b, err := json.Marshal(Envelope{Type: "members", Data: mustJSON(map[string]any{
+		"room": req.Room, "count": len(views), "members": views,
+	})})
+	if err != nil {
+		h.opts.Logger.Error("member list encode failed", "err", err)
+		return
+	}
+	_ = h.sendToClient(c, b)
+}
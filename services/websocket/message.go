@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 訊息 frame 類型（與 gorilla/websocket 相同數值）
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+// 常用的 close code（與 gorilla/websocket 相同數值）
+const (
+	CloseNormalClosure     = websocket.CloseNormalClosure
+	CloseGoingAway         = websocket.CloseGoingAway
+	ClosePolicyViolation   = websocket.ClosePolicyViolation
+	CloseTryAgainLater     = websocket.CloseTryAgainLater
+	CloseInternalServerErr = websocket.CloseInternalServerErr // handler 等 panic 時
+	CloseAbnormalClosure   = websocket.CloseAbnormalClosure   // 沒有 close frame 就斷線（只會出現在 CloseInfo）
+)
+
+// outbound 放進 client 佇列的一則訊息
+type outbound struct {
+	room     string // 房間廣播的房間名稱（log 用）
+	topic    string // Publish 的 topic（MQTT client 寫出時使用）
+	msgType  int
+	data     []byte
+	prepared *websocket.PreparedMessage // 廣播時預先 frame/壓縮，所有 client 共用
+	trace    trace.SpanContext          // 有效時 writePump 會建立寫出的 span
+	control  bool                       // 協定訊息（例如 session），不計入 session 序號
+	// writeWait 這則訊息的寫入期限（0 表示依 WriteWait / ControlWriteWait）
+	writeWait time.Duration
+
+	// protobuf client 寫出的 Envelope frame：第一次需要時產生，所有 protobuf client 共用
+	pbOnce  sync.Once
+	pbFrame *websocket.PreparedMessage
+	pbErr   error
+}
+
+// newOutbound 單一對象的訊息，直接寫出
+func newOutbound(msgType int, b []byte) *outbound {
+	if msgType != BinaryMessage {
+		msgType = TextMessage
+	}
+	return &outbound{msgType: msgType, data: b}
+}
+
+// newPrepared 廣播用：只 frame/壓縮一次；失敗時退回逐一寫出（錯誤會在寫出時再出現並記錄）
+func newPrepared(room string, msgType int, b []byte) *outbound {
+	if msgType != BinaryMessage {
+		msgType = TextMessage
+	}
+	m := &outbound{room: room, msgType: msgType, data: b}
+	if pm, err := websocket.NewPreparedMessage(msgType, b); err == nil {
+		m.prepared = pm
+	}
+	return m
+}
+
+// write 將訊息寫到連線（僅在 writePump 內呼叫）
+func (m *outbound) write(conn *websocket.Conn) error {
+	if m.prepared != nil {
+		return conn.WritePreparedMessage(m.prepared)
+	}
+	return conn.WriteMessage(m.msgType, m.data)
+}
@@ -0,0 +1,240 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrMessageStoreDisabled 沒有設定 MessageStore
+var ErrMessageStoreDisabled = errors.New("websocket: message store disabled")
+
+// StoredMessage 保存下來的一則廣播（全域、房間或 topic）
+type StoredMessage struct {
+	ID       string    `json:"id"`       // 由 store 指定，依寫入順序遞增，用於分頁
+	Instance string    `json:"instance"` // 送出的 Hub ID
+	Room     string    `json:"room,omitempty"`
+	Topic    string    `json:"topic,omitempty"`
+	Binary   bool      `json:"binary,omitempty"`
+	Data     []byte    `json:"data"`
+	Time     time.Time `json:"time"`
+}
+
+// MessageQuery Hub.Messages 的查詢條件；零值欄位表示不限制
+type MessageQuery struct {
+	Room  string
+	Topic string
+	Since time.Time // 包含
+	Until time.Time // 不包含
+	After string    // 只取 ID 在此之後的訊息（上一頁最後一則的 ID）
+	Limit int
+}
+
+// MessageStore 所有廣播的持久化（可選），用於稽核紀錄與事後重播；與 HistoryStore 不同，
+// 全域廣播與 topic 也會保存。只保存本 instance 發出的廣播（不含 presence 等暫時性訊息），
+// 多個 instance 應共用同一個 store（SQLMessageStore、RedisStreamMessageStore）
+type MessageStore interface {
+	// Save 依序保存一批訊息（ID 由 store 指定，傳入時為空）；返回後 msgs 會被重複使用，不可保留
+	Save(ctx context.Context, msgs []StoredMessage) error
+	// Query 由舊到新回傳最多 q.Limit 則符合條件的訊息
+	Query(ctx context.Context, q MessageQuery) ([]StoredMessage, error)
+	// Prune 刪除 before 之前的訊息並回傳刪除的數量（保留期限，見 MessageRetention）
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+const (
+	// messageStoreTimeout 單次存取 MessageStore 的期限
+	messageStoreTimeout = 10 * time.Second
+	// messageQueueSize 待寫入的訊息上限，store 跟不上時丟棄並記 log
+	messageQueueSize = 4096
+	// messageSaveBatch 單次 Save 最多的訊息數
+	messageSaveBatch = 256
+	// messagePruneInterval 清除過期訊息的最長間隔（保留期限較短時改用保留期限的 1/10）
+	messagePruneInterval = 10 * time.Minute
+)
+
+// messageWriter 在背景分批寫入 MessageStore 並依保留期限清除；nil 表示未設定
+type messageWriter struct {
+	store     MessageStore
+	retention time.Duration
+	queue     chan StoredMessage
+	dropped   atomic.Bool // 佇列滿時只記一次 log
+	stopped   chan struct{}
+}
+
+func newMessageWriter(store MessageStore, retention time.Duration) *messageWriter {
+	if store == nil {
+		return nil
+	}
+	return &messageWriter{
+		store:     store,
+		retention: retention,
+		queue:     make(chan StoredMessage, messageQueueSize),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// run 分批寫入直到 done 關閉，關閉時寫完佇列內剩下的訊息
+func (w *messageWriter) run(h *Hub) {
+	defer close(w.stopped)
+	var prune <-chan time.Time
+	if w.retention > 0 {
+		t := time.NewTicker(min(messagePruneInterval, max(w.retention/10, time.Second)))
+		defer t.Stop()
+		prune = t.C
+		w.prune(h)
+	}
+	batch := make([]StoredMessage, 0, messageSaveBatch)
+	for {
+		select {
+		case m := <-w.queue:
+			w.save(h, w.collect(append(batch[:0], m)))
+		case <-prune:
+			w.prune(h)
+		case <-h.done:
+			for {
+				batch = w.collect(batch[:0])
+				if len(batch) == 0 {
+					return
+				}
+				w.save(h, batch)
+			}
+		}
+	}
+}
+
+// collect 不等待地取出佇列中的訊息，直到 batch 滿
+func (w *messageWriter) collect(batch []StoredMessage) []StoredMessage {
+	for len(batch) < messageSaveBatch {
+		select {
+		case m := <-w.queue:
+			batch = append(batch, m)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (w *messageWriter) save(h *Hub, batch []StoredMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), messageStoreTimeout)
+	defer cancel()
+	if err := w.store.Save(ctx, batch); err != nil {
+		h.opts.Logger.Error("message store save failed", "messages", len(batch), "err", err)
+	}
+}
+
+func (w *messageWriter) prune(h *Hub) {
+	ctx, cancel := context.WithTimeout(context.Background(), messageStoreTimeout)
+	defer cancel()
+	n, err := w.store.Prune(ctx, time.Now().Add(-w.retention))
+	if err != nil {
+		h.opts.Logger.Warn("message store prune failed", "err", err)
+		return
+	}
+	if n > 0 {
+		h.opts.Logger.Debug("message store pruned", "messages", n)
+	}
+}
+
+// record 將本 instance 發出的廣播排入 MessageStore 的寫入佇列（不阻塞）
+func (h *Hub) record(m broadcastMsg, now time.Time) {
+	w := h.messageLog
+	if w == nil {
+		return
+	}
+	sm := StoredMessage{
+		Instance: h.id,
+		Room:     m.room,
+		Topic:    m.topic,
+		Binary:   m.msgType == BinaryMessage,
+		Data:     m.data,
+		Time:     now,
+	}
+	select {
+	case w.queue <- sm:
+	default:
+		if !w.dropped.Swap(true) {
+			h.opts.Logger.Error("message store queue full, messages not persisted", "queue", messageQueueSize)
+		}
+	}
+}
+
+// Messages 查詢 MessageStore 保存的廣播，由舊到新最多 q.Limit 則；以最後一則的 ID 作為下一頁的 After。
+// 寫入是在背景分批進行，剛送出的廣播可能稍後才查得到
+func (h *Hub) Messages(ctx context.Context, q MessageQuery) ([]StoredMessage, error) {
+	if h.messageLog == nil {
+		return nil, ErrMessageStoreDisabled
+	}
+	if q.Limit <= 0 {
+		return nil, nil
+	}
+	return h.messageLog.store.Query(ctx, q)
+}
+
+// MemoryMessageStore 以記憶體實作 MessageStore，適合開發與測試（重啟後消失）
+type MemoryMessageStore struct {
+	mu   sync.Mutex
+	last uint64
+	msgs []StoredMessage // 由舊到新
+}
+
+func NewMemoryMessageStore() *MemoryMessageStore {
+	return &MemoryMessageStore{}
+}
+
+func (s *MemoryMessageStore) Save(_ context.Context, msgs []StoredMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		s.last++
+		m.ID = strconv.FormatUint(s.last, 10)
+		s.msgs = append(s.msgs, m)
+	}
+	return nil
+}
+
+func (s *MemoryMessageStore) Query(_ context.Context, q MessageQuery) ([]StoredMessage, error) {
+	var after uint64
+	if q.After != "" {
+		var err error
+		if after, err = strconv.ParseUint(q.After, 10, 64); err != nil {
+			return nil, errors.New("websocket: invalid message ID " + strconv.Quote(q.After))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []StoredMessage
+	for _, m := range s.msgs {
+		if len(out) >= q.Limit {
+			break
+		}
+		if id, _ := strconv.ParseUint(m.ID, 10, 64); id <= after || !q.matches(m) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (s *MemoryMessageStore) Prune(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(s.msgs) && s.msgs[n].Time.Before(before) {
+		n++
+	}
+	s.msgs = append(s.msgs[:0], s.msgs[n:]...)
+	return n, nil
+}
+
+// matches 房間、topic 與時間條件（不含 After）
+func (q MessageQuery) matches(m StoredMessage) bool {
+	return (q.Room == "" || m.Room == q.Room) &&
+		(q.Topic == "" || m.Topic == q.Topic) &&
+		(q.Since.IsZero() || !m.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || m.Time.Before(q.Until))
+}
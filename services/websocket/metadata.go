@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"context"
+	"maps"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMeta 升級（或 SSE 連線）當下的 HTTP 請求資訊，連線期間不變
+type RequestMeta struct {
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"userAgent,omitempty"`
+	Origin    string     `json:"origin,omitempty"`
+	Query     url.Values `json:"query,omitempty"` // 不含 token、resume 等憑證
+	// RequestID 上游 middleware（例如 gin-contrib/requestid）設定的回應標頭 X-Request-ID，沒有時取請求標頭
+	RequestID string `json:"requestId,omitempty"`
+	// Locale 上游 middleware 以 c.Set(LocaleContextKey, ...) 設定的語系，沒有時取 Accept-Language 的第一個語言
+	Locale string `json:"locale,omitempty"`
+}
+
+const (
+	// RequestIDHeader RequestMeta.RequestID 讀取的標頭
+	RequestIDHeader = "X-Request-ID"
+	// LocaleContextKey RequestMeta.Locale 讀取的 gin.Context key（值為字串）
+	LocaleContextKey = "locale"
+)
+
+// 不保留在 RequestMeta.Query 的參數（避免憑證經由 hook 或 log 外洩）
+var secretQueryParams = []string{"token", "resume"}
+
+func newRequestMeta(c *gin.Context, ip string) RequestMeta {
+	q := c.Request.URL.Query()
+	for _, k := range secretQueryParams {
+		q.Del(k)
+	}
+	if len(q) == 0 {
+		q = nil
+	}
+	requestID := c.Writer.Header().Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = c.GetHeader(RequestIDHeader)
+	}
+	return RequestMeta{
+		IP:        ip,
+		UserAgent: c.Request.UserAgent(),
+		Origin:    c.GetHeader("Origin"),
+		Query:     q,
+		RequestID: requestID,
+		Locale:    requestLocale(c),
+	}
+}
+
+// requestLocale LocaleContextKey 的值，否則為 Accept-Language 的第一個語言（不含 q 值）
+func requestLocale(c *gin.Context) string {
+	if l := c.GetString(LocaleContextKey); l != "" {
+		return l
+	}
+	first, _, _ := strings.Cut(c.GetHeader("Accept-Language"), ",")
+	first, _, _ = strings.Cut(first, ";")
+	if first = strings.TrimSpace(first); first == "*" {
+		return ""
+	}
+	return first
+}
+
+// initialValues Client.Set / Get 的初始資料：上游 gin middleware 以 c.Set 存放的值，
+// 再加上 ClientInfo.Values（同名時以後者為準）
+func initialValues(keys, info map[string]any) map[string]any {
+	if len(keys) == 0 {
+		return maps.Clone(info)
+	}
+	m := maps.Clone(keys)
+	maps.Copy(m, info)
+	return m
+}
+
+// requestContext 保留升級請求 context 的 values（request ID、auth 等）與 gin 的 c.Keys，
+// 但不隨請求結束而取消（連線 hijack 後 net/http 仍會取消 request context）
+func requestContext(c *gin.Context) context.Context {
+	ctx := context.WithoutCancel(c.Request.Context())
+	if len(c.Keys) > 0 {
+		ctx = ginKeys{Context: ctx, keys: maps.Clone(c.Keys)}
+	}
+	return ctx
+}
+
+// ginKeys 讓 ctx.Value("key") 也能取到 gin middleware 以 c.Set 存放的值
+type ginKeys struct {
+	context.Context
+	keys map[string]any
+}
+
+func (k ginKeys) Value(key any) any {
+	if s, ok := key.(string); ok {
+		if v, ok := k.keys[s]; ok {
+			return v
+		}
+	}
+	return k.Context.Value(key)
+}
+
+// Context 回傳連線的 context：values 來自升級請求（含 gin 的 c.Keys），
+// 在連線結束、Hub.Shutdown 或 Run 的 ctx 取消時取消；handler 的背景工作應以它為 parent
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+// values Client.Set / Get 的儲存空間，可由任何 goroutine 存取
+type values struct {
+	mu sync.RWMutex
+	m  map[string]any
+}
+
+// Meta 回傳連線建立時的請求資訊（Query 為共用的 map，請勿修改）；auth claims 見 Info().Claims
+func (c *Client) Meta() RequestMeta {
+	return c.meta
+}
+
+// Set 存放這個連線的自訂資料（可在 hook、handler、middleware 之間共用）
+func (c *Client) Set(key string, v any) {
+	c.values.mu.Lock()
+	defer c.values.mu.Unlock()
+	if c.values.m == nil {
+		c.values.m = make(map[string]any)
+	}
+	c.values.m[key] = v
+}
+
+// Get 取出 Set 存放的資料；連線建立時已包含上游 gin middleware 以 c.Set 存放的值（例如 gin-jwt 的 "JWT_PAYLOAD"）
+func (c *Client) Get(key string) (any, bool) {
+	c.values.mu.RLock()
+	defer c.values.mu.RUnlock()
+	v, ok := c.values.m[key]
+	return v, ok
+}
+
+// GetString 取出字串資料；不存在或型別不符時回傳空字串
+func (c *Client) GetString(key string) string {
+	v, _ := c.Get(key)
+	s, _ := v.(string)
+	return s
+}
+
+// Delete 移除 Set 存放的資料
+func (c *Client) Delete(key string) {
+	c.values.mu.Lock()
+	defer c.values.mu.Unlock()
+	delete(c.values.m, key)
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+// InboundFunc 收到 client 訊息時依序執行（在該 client 的 readPump goroutine），位於 handler 分派與廣播之前；
+// 可回傳改寫後的訊息，回傳 nil 表示靜默丟棄，回傳 error 則拒絕並回送
+// {"type":"error","data":{"error":"..."}} 給送出者
+type InboundFunc func(c *Client, msg []byte) ([]byte, error)
+
+// inboundChain 已註冊的 InboundFunc，可在任何時候新增
+type inboundChain struct {
+	mu  sync.RWMutex
+	fns []InboundFunc
+}
+
+// UseInbound 依註冊順序加入 inbound middleware（房間、訂閱、ack 等協定指令不經過）
+func (h *Hub) UseInbound(fns ...InboundFunc) {
+	h.inbound.mu.Lock()
+	defer h.inbound.mu.Unlock()
+	h.inbound.fns = append(h.inbound.fns, fns...)
+}
+
+// runInbound 執行 middleware；回傳 false 表示訊息被丟棄或拒絕
+func (c *Client) runInbound(msg []byte) ([]byte, bool) {
+	c.hub.inbound.mu.RLock()
+	fns := c.hub.inbound.fns
+	c.hub.inbound.mu.RUnlock()
+	for _, fn := range fns {
+		var err error
+		if msg, err = fn(c, msg); err != nil {
+			_ = c.hub.sendToClient(c, errorEnvelope(err))
+			return nil, false
+		}
+		if msg == nil {
+			return nil, false
+		}
+	}
+	return msg, true
+}
+
+// OutboundFunc 訊息放進 client 佇列前依序執行，可依 c 的身分（Info、ID 等）過濾或個人化；
+// 回傳 nil 表示不送給這個 client。在 shard 的事件迴圈內執行，不可呼叫 Hub 方法且應盡快返回；
+// 設定 FanoutWorkers 時會對不同 client 並行呼叫。
+// 回傳原本的 msg 時沿用共用的 prepared frame，改寫則該 client 單獨 frame
+type OutboundFunc func(c *Client, msg []byte) []byte
+
+// outboundChain 已註冊的 OutboundFunc，可在任何時候新增
+type outboundChain struct {
+	mu  sync.RWMutex
+	fns []OutboundFunc
+}
+
+// UseOutbound 依註冊順序加入 outbound interceptor（session 等協定訊息不經過）
+func (h *Hub) UseOutbound(fns ...OutboundFunc) {
+	h.outbound.mu.Lock()
+	defer h.outbound.mu.Unlock()
+	h.outbound.fns = append(h.outbound.fns, fns...)
+}
+
+// intercept 對單一 client 執行 interceptor；回傳 nil 表示不送
+func (h *Hub) intercept(c *Client, m *outbound) *outbound {
+	if m.control {
+		return m
+	}
+	h.outbound.mu.RLock()
+	fns := h.outbound.fns
+	h.outbound.mu.RUnlock()
+	if len(fns) == 0 {
+		return m
+	}
+	b := runOutbound(fns, c, m.data)
+	if b == nil {
+		return nil
+	}
+	if len(b) == len(m.data) && (len(b) == 0 || &b[0] == &m.data[0]) {
+		return m
+	}
+	return &outbound{room: m.room, topic: m.topic, msgType: m.msgType, data: b, trace: m.trace}
+}
+
+// runOutbound 依序執行 interceptor；panic 時記錄並不送給這個 client（在 shard 內執行，不能讓 panic 停掉整個 shard）
+func runOutbound(fns []OutboundFunc, c *Client, b []byte) (out []byte) {
+	defer func() {
+		if p := recover(); p != nil {
+			c.logPanic("OutboundFunc", p)
+			out = nil
+		}
+	}()
+	for _, fn := range fns {
+		if b = fn(c, b); b == nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// errorEnvelope 回送給 client 的錯誤訊息；*ValidationError 會附上 messageType 與 fields
+func errorEnvelope(err error) []byte {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return mustJSON(map[string]any{"type": "error", "data": map[string]any{
+			"error": err.Error(), "messageType": ve.Type, "fields": ve.Fields,
+		}})
+	}
+	return mustJSON(map[string]any{"type": "error", "data": map[string]string{"error": err.Error()}})
+}
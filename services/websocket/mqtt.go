@@ -0,0 +1,463 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// MQTT 相容模式（MQTT 3.1.1 over WebSocket，subprotocol "mqtt"）：
+//
+//   - 協商出 "mqtt" 的連線以 binary frame 交換 MQTT 封包，第一個封包必須是 CONNECT
+//   - SUBSCRIBE / UNSUBSCRIBE 對應 Hub.Subscribe / Unsubscribe，PUBLISH 對應 Hub.Publish，
+//     因此與 {"type":"subscribe"} 的 JSON client 共用同一個 topic 空間
+//   - topic 轉換："/" ↔ "."，"+" ↔ "*"，"#" 不變（例如 sensor/+/temp ↔ sensor.*.temp）；
+//     含 "."、"*" 或空層級的 MQTT topic 無法對應，訂閱回覆失敗（0x80）、發佈則略過
+//   - 訂閱一律以 QoS 0 授予；收到 QoS 1 / 2 的 PUBLISH 會回 PUBACK / PUBREC…PUBCOMP，但只投遞一次。
+//     不支援 retain 與持久 session（clean session 以外的請求仍視為 clean session）
+//   - 沒有送 DISCONNECT 就斷線時發佈 CONNECT 帶的 will 訊息
+//   - MQTT client 只收到 topic 訊息；全域、房間廣播與 SendTo 等不會送給它
+//   - 存活檢查沿用 WebSocket ping/pong（PongWait），PINGREQ 只回 PINGRESP
+
+// mqttSubprotocol MQTT over WebSocket 規定的 Sec-WebSocket-Protocol
+const mqttSubprotocol = "mqtt"
+
+// MQTT 3.1.1 封包類型
+const (
+	mqttConnect     = 1
+	mqttConnack     = 2
+	mqttPublish     = 3
+	mqttPuback      = 4
+	mqttPubrec      = 5
+	mqttPubrel      = 6
+	mqttPubcomp     = 7
+	mqttSubscribe   = 8
+	mqttSuback      = 9
+	mqttUnsubscribe = 10
+	mqttUnsuback    = 11
+	mqttPingreq     = 12
+	mqttPingresp    = 13
+	mqttDisconnect  = 14
+)
+
+// CONNACK 的回覆碼
+const (
+	mqttAccepted           = 0x00
+	mqttBadProtocolVersion = 0x01
+	mqttNotAuthorized      = 0x05
+)
+
+// mqttSubackFailure SUBACK 中表示訂閱失敗的回覆碼
+const mqttSubackFailure = 0x80
+
+var errMQTTProtocol = errors.New("websocket: mqtt protocol error")
+
+// MQTTConfig MQTT 相容模式的設定（協定見 mqtt.go）
+type MQTTConfig struct {
+	// Authenticate 檢查 CONNECT 帶的 client ID 與帳密；回傳 error 時回 CONNACK 0x05 並斷線。
+	// nil 表示不檢查（仍可用 Options.Authenticate 在升級前驗證）
+	Authenticate func(c *Client, clientID, username string, password []byte) error
+
+	// CanPublish 是否允許 client 發佈到 topic（Hub 格式，例如 "sensor.kitchen.temp"）；
+	// 不允許的訊息直接略過。nil 表示全部允許
+	CanPublish func(c *Client, topic string) bool
+}
+
+// mqttConn MQTT client 的協定狀態（僅由 readPump 存取）
+type mqttConn struct {
+	cfg       *MQTTConfig
+	connected bool
+	clientID  string
+	will      *mqttWill
+}
+
+// mqttWill CONNECT 帶的 will 訊息（Hub 格式的 topic）
+type mqttWill struct {
+	topic   string
+	payload []byte
+}
+
+// mqttPacket 一個 MQTT 封包：type、fixed header 的 flags 與之後的內容
+type mqttPacket struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// frameReader 把連續的 binary frame 接成一個 stream（MQTT 封包可跨 frame，也可一個 frame 多個封包）
+type frameReader struct {
+	conn *websocket.Conn
+	r    io.Reader
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for {
+		if f.r == nil {
+			typ, r, err := f.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if typ != websocket.BinaryMessage {
+				return 0, fmt.Errorf("%w: text frame", errMQTTProtocol)
+			}
+			f.r = r
+		}
+		n, err := f.r.Read(p)
+		if err == io.EOF {
+			f.r = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// readMQTTPacket 讀取一個封包；內容超過 limit bytes 時回傳 ErrMessageTooLarge
+func readMQTTPacket(r *bufio.Reader, limit int) (mqttPacket, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+	n, mul := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return mqttPacket{}, fmt.Errorf("%w: malformed remaining length", errMQTTProtocol)
+		}
+		d, err := r.ReadByte()
+		if err != nil {
+			return mqttPacket{}, err
+		}
+		n += int(d&0x7f) * mul
+		if d&0x80 == 0 {
+			break
+		}
+		mul *= 128
+	}
+	if n > limit {
+		return mqttPacket{}, ErrMessageTooLarge
+	}
+	p := mqttPacket{typ: b >> 4, flags: b & 0x0f, body: make([]byte, n)}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return mqttPacket{}, err
+	}
+	return p, nil
+}
+
+// mqttReader 依序解析封包內容
+type mqttReader struct {
+	b   []byte
+	err error
+}
+
+func (r *mqttReader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errMQTTProtocol
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *mqttReader) uint16() uint16 {
+	if r.err != nil || len(r.b) < 2 {
+		r.err = errMQTTProtocol
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *mqttReader) bytes() []byte {
+	n := int(r.uint16())
+	if r.err != nil || len(r.b) < n {
+		r.err = errMQTTProtocol
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *mqttReader) string() string {
+	b := r.bytes()
+	if r.err == nil && !utf8.Valid(b) {
+		r.err = errMQTTProtocol
+	}
+	return string(b)
+}
+
+// appendMQTTHeader 加上 fixed header（type、flags 與 remaining length）
+func appendMQTTHeader(b []byte, typ, flags byte, n int) []byte {
+	b = append(b, typ<<4|flags)
+	for {
+		d := byte(n % 128)
+		if n /= 128; n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// mqttAck 只帶 packet ID 的回覆（PUBACK、PUBREC、PUBCOMP、UNSUBACK）
+func mqttAck(typ byte, id uint16) []byte {
+	b := appendMQTTHeader(make([]byte, 0, 4), typ, 0, 2)
+	return binary.BigEndian.AppendUint16(b, id)
+}
+
+// mqttPublishPacket 以 QoS 0 送出 Hub topic 的訊息
+func mqttPublishPacket(topic string, payload []byte) []byte {
+	name := hubToMQTT(topic)
+	n := 2 + len(name) + len(payload)
+	b := appendMQTTHeader(make([]byte, 0, n+5), mqttPublish, 0, n)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(name)))
+	b = append(b, name...)
+	return append(b, payload...)
+}
+
+// mqttToHub 將 MQTT 的 topic（filter 為 true 時為訂閱的 filter）轉成 Hub 格式；無法對應時回傳 false
+func mqttToHub(topic string, filter bool) (string, bool) {
+	levels := strings.Split(topic, "/")
+	for i, l := range levels {
+		if strings.ContainsAny(l, ".*") {
+			return "", false
+		}
+		if l == "+" && filter {
+			levels[i] = "*"
+		}
+	}
+	t := strings.Join(levels, ".")
+	if filter {
+		return t, validPattern(t)
+	}
+	return t, validTopic(t)
+}
+
+// hubToMQTT 將 Hub 的 topic 轉成 MQTT 格式
+func hubToMQTT(topic string) string {
+	return strings.ReplaceAll(topic, ".", "/")
+}
+
+// readMQTT 讀取並處理 MQTT 封包，取代 readPump 的 JSON 協定；連線結束時返回
+func (c *Client) readMQTT() {
+	m := c.mqtt
+	r := bufio.NewReader(&frameReader{conn: c.conn})
+	clean := false
+	defer func() {
+		if !clean && m.will != nil {
+			c.mqttPublish(m.will.topic, m.will.payload)
+		}
+	}()
+	for {
+		p, err := readMQTTPacket(r, c.hub.opts.MaxMessageSize)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrMessageTooLarge):
+				c.closeProtocol(websocket.CloseMessageTooBig, "packet too large")
+			case errors.Is(err, errMQTTProtocol):
+				c.closeProtocol(websocket.CloseProtocolError, err.Error())
+			default:
+				if c.unexpectedClose(err) {
+					c.hub.opts.Logger.Warn("websocket read failed", c.logAttrs("err", err)...)
+				}
+				c.recordReadError(err)
+			}
+			return
+		}
+		if !m.connected && p.typ != mqttConnect {
+			c.closeProtocol(websocket.CloseProtocolError, "expected CONNECT")
+			return
+		}
+		var ok bool
+		switch p.typ {
+		case mqttConnect:
+			ok = !m.connected && c.mqttConnect(p)
+		case mqttPublish:
+			ok = c.mqttHandlePublish(p)
+		case mqttPubrel:
+			pr := &mqttReader{b: p.body}
+			id := pr.uint16()
+			ok = pr.err == nil && c.mqttPacket(mqttAck(mqttPubcomp, id))
+		case mqttPuback, mqttPubrec, mqttPubcomp:
+			// 只以 QoS 0 送出，不會有待確認的訊息
+			ok = true
+		case mqttSubscribe:
+			ok = c.mqttSubscribe(p)
+		case mqttUnsubscribe:
+			ok = c.mqttUnsubscribe(p)
+		case mqttPingreq:
+			ok = c.mqttPacket([]byte{mqttPingresp << 4, 0})
+		case mqttDisconnect:
+			clean = true
+			c.recordClose(websocket.CloseNormalClosure, "mqtt disconnect", false)
+			return
+		}
+		if !ok {
+			if c.closeInfo.Load() == nil {
+				c.closeProtocol(websocket.CloseProtocolError, fmt.Sprintf("invalid packet type %d", p.typ))
+			}
+			return
+		}
+	}
+}
+
+// mqttConnect 處理 CONNECT；失敗時已回覆 CONNACK 或關閉連線
+func (c *Client) mqttConnect(p mqttPacket) bool {
+	m := c.mqtt
+	r := &mqttReader{b: p.body}
+	name, level, flags := r.string(), r.byte(), r.byte()
+	r.uint16() // keepalive：存活檢查改用 WebSocket ping/pong
+	if r.err != nil || name != "MQTT" || flags&0x01 != 0 {
+		c.closeProtocol(websocket.CloseProtocolError, "malformed CONNECT")
+		return false
+	}
+	if level != 4 {
+		c.mqttPacket([]byte{mqttConnack << 4, 2, 0, mqttBadProtocolVersion})
+		c.closeProtocol(websocket.CloseProtocolError, "unsupported mqtt version")
+		return false
+	}
+	m.clientID = r.string()
+	var will *mqttWill
+	if flags&0x04 != 0 {
+		topic, payload := r.string(), r.bytes()
+		if t, ok := mqttToHub(topic, false); ok {
+			will = &mqttWill{topic: t, payload: payload}
+		}
+	}
+	var username string
+	var password []byte
+	if flags&0x80 != 0 {
+		username = r.string()
+	}
+	if flags&0x40 != 0 {
+		password = r.bytes()
+	}
+	if r.err != nil {
+		c.closeProtocol(websocket.CloseProtocolError, "malformed CONNECT")
+		return false
+	}
+	if m.cfg.Authenticate != nil {
+		if err := m.cfg.Authenticate(c, m.clientID, username, password); err != nil {
+			c.hub.opts.Logger.Warn("mqtt connect rejected", c.logAttrs("mqtt_client", m.clientID, "err", err)...)
+			c.mqttPacket([]byte{mqttConnack << 4, 2, 0, mqttNotAuthorized})
+			c.closeProtocol(websocket.ClosePolicyViolation, "unauthorized")
+			return false
+		}
+	}
+	m.connected, m.will = true, will
+	return c.mqttPacket([]byte{mqttConnack << 4, 2, 0, mqttAccepted})
+}
+
+// mqttHandlePublish 處理 client 送來的 PUBLISH，依 QoS 回覆
+func (c *Client) mqttHandlePublish(p mqttPacket) bool {
+	qos := (p.flags >> 1) & 0x03
+	r := &mqttReader{b: p.body}
+	topic := r.string()
+	var id uint16
+	if qos > 0 {
+		id = r.uint16()
+	}
+	if r.err != nil || qos == 3 {
+		return false
+	}
+	accept, keep := c.allowInbound()
+	if !keep {
+		return false
+	}
+	if accept {
+		c.touch()
+		if t, ok := mqttToHub(topic, false); ok {
+			c.mqttPublish(t, r.b)
+		} else {
+			c.hub.opts.Logger.Warn("mqtt publish skipped", c.logAttrs("topic", topic, "err", ErrInvalidTopic)...)
+		}
+	}
+	switch qos {
+	case 1:
+		return c.mqttPacket(mqttAck(mqttPuback, id))
+	case 2:
+		return c.mqttPacket(mqttAck(mqttPubrec, id))
+	}
+	return true
+}
+
+// mqttPublish 經 CanPublish 與 inbound middleware 後發佈到 Hub 的 topic
+func (c *Client) mqttPublish(topic string, payload []byte) {
+	if c.readOnly.Load() {
+		c.hub.opts.Logger.Warn("mqtt publish denied", c.logAttrs("topic", topic, "reason", "read-only")...)
+		return
+	}
+	if fn := c.mqtt.cfg.CanPublish; fn != nil && !fn(c, topic) {
+		c.hub.opts.Logger.Warn("mqtt publish denied", c.logAttrs("topic", topic)...)
+		return
+	}
+	payload, ok := c.runInbound(payload)
+	if !ok {
+		return
+	}
+	// 非 UTF-8 的 payload 以 binary frame 送給 JSON client（text frame 會被瀏覽器視為協定錯誤）
+	msgType := TextMessage
+	if !utf8.Valid(payload) {
+		msgType = BinaryMessage
+	}
+	c.hub.sendBroadcast(broadcastMsg{topic: topic, msgType: msgType, data: payload})
+}
+
+// mqttSubscribe 處理 SUBSCRIBE，每個 filter 各自回覆授予的 QoS（一律 0）或失敗
+func (c *Client) mqttSubscribe(p mqttPacket) bool {
+	r := &mqttReader{b: p.body}
+	id := r.uint16()
+	var codes []byte
+	for r.err == nil && len(r.b) > 0 {
+		filter := r.string()
+		r.byte() // 要求的 QoS
+		if r.err != nil {
+			break
+		}
+		code := byte(mqttSubackFailure)
+		if pattern, ok := mqttToHub(filter, true); ok && c.hub.Subscribe(c, pattern) == nil {
+			code = 0
+		}
+		codes = append(codes, code)
+	}
+	if r.err != nil || p.flags != 0x02 || len(codes) == 0 {
+		return false
+	}
+	c.touch()
+	b := appendMQTTHeader(make([]byte, 0, 6+len(codes)), mqttSuback, 0, 2+len(codes))
+	b = binary.BigEndian.AppendUint16(b, id)
+	return c.mqttPacket(append(b, codes...))
+}
+
+// mqttUnsubscribe 處理 UNSUBSCRIBE
+func (c *Client) mqttUnsubscribe(p mqttPacket) bool {
+	r := &mqttReader{b: p.body}
+	id := r.uint16()
+	for r.err == nil && len(r.b) > 0 {
+		if pattern, ok := mqttToHub(r.string(), true); ok && r.err == nil {
+			c.hub.Unsubscribe(c, pattern)
+		}
+	}
+	if r.err != nil || p.flags != 0x02 {
+		return false
+	}
+	c.touch()
+	return c.mqttPacket(mqttAck(mqttUnsuback, id))
+}
+
+// mqttPacket 交給 writePump 以 binary frame 寫出；writePump 已結束時回傳 false
+func (c *Client) mqttPacket(b []byte) bool {
+	return c.writePacket(newOutbound(BinaryMessage, b))
+}
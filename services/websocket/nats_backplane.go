@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSBackplane 以 NATS core pub/sub 實作 Backplane（at-most-once）。
+// 全域廣播送到 <prefix>.all，房間廣播送到 <prefix>.room.<room>。
+type NATSBackplane struct {
+	Logger Logger // 預設 slog.Default()
+
+	nc     *nats.Conn
+	prefix string
+	sub    *nats.Subscription
+}
+
+func NewNATSBackplane(nc *nats.Conn, prefix string) *NATSBackplane {
+	if prefix == "" {
+		prefix = "websocket"
+	}
+	return &NATSBackplane{Logger: slog.Default(), nc: nc, prefix: prefix}
+}
+
+// subject 依房間決定 subject；subject 不允許的字元以 _ 取代（訊息內仍帶原始房間名）
+func (n *NATSBackplane) subject(room string) string {
+	if room == "" {
+		return n.prefix + ".all"
+	}
+	token := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, room)
+	return n.prefix + ".room." + token
+}
+
+func (n *NATSBackplane) Publish(ctx context.Context, m BackplaneMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return n.nc.Publish(n.subject(m.Room), b)
+}
+
+func (n *NATSBackplane) Subscribe(ctx context.Context, fn func(BackplaneMessage)) error {
+	sub, err := n.nc.Subscribe(n.prefix+".>", func(msg *nats.Msg) {
+		var m BackplaneMessage
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			n.Logger.Warn("nats backplane decode failed", "subject", msg.Subject, "err", err)
+			return
+		}
+		fn(m)
+	})
+	if err != nil {
+		return err
+	}
+	n.sub = sub
+	return n.nc.Flush()
+}
+
+func (n *NATSBackplane) Close() error {
+	if n.sub == nil {
+		return nil
+	}
+	return n.sub.Unsubscribe()
+}
+
+// Ping 確認 NATS 連線正常（HealthHandler 的 /readyz 使用）
+func (n *NATSBackplane) Ping(ctx context.Context) error {
+	if !n.nc.IsConnected() {
+		return fmt.Errorf("nats %s", n.nc.Status())
+	}
+	return nil
+}
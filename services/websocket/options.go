@@ -0,0 +1,772 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxControlPayload control frame（ping/pong/close）payload 的上限（RFC 6455）
+const maxControlPayload = 125
+
+// Option 設定 Hub；輸入不合理時回傳 error，NewHub 會直接回傳該 error
+type Option func(*Options) error
+
+// WithOptions 一次套用整個 Options（方便從舊的 NewHub(&Options{...}) 遷移），之後的 Option 可再覆寫
+func WithOptions(o Options) Option {
+	return func(dst *Options) error {
+		*dst = o
+		return nil
+	}
+}
+
+// WithSendCap 每個 client 的傳送佇列大小
+func WithSendCap(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("websocket: SendCap must be positive, got %d", n)
+		}
+		o.SendCap = n
+		return nil
+	}
+}
+
+// WithMaxMessageSize 單則訊息上限（bytes），不可小於 control frame 的 125 bytes
+func WithMaxMessageSize(n int) Option {
+	return func(o *Options) error {
+		if n < maxControlPayload {
+			return fmt.Errorf("websocket: MaxMessageSize must be at least %d, got %d", maxControlPayload, n)
+		}
+		o.MaxMessageSize = n
+		return nil
+	}
+}
+
+// WithBufferSizes 每個連線的讀寫緩衝大小（bytes）
+func WithBufferSizes(read, write int) Option {
+	return func(o *Options) error {
+		if read <= 0 || write <= 0 {
+			return fmt.Errorf("websocket: buffer sizes must be positive, got %d/%d", read, write)
+		}
+		o.ReadBufferSize, o.WriteBufferSize = read, write
+		return nil
+	}
+}
+
+// WithWriteBufferPool 寫出時才向 pool 借用寫入緩衝，例如 WithWriteBufferPool(&sync.Pool{})
+func WithWriteBufferPool(pool BufferPool) Option {
+	return func(o *Options) error {
+		if pool == nil {
+			return errors.New("websocket: WriteBufferPool must not be nil")
+		}
+		o.WriteBufferPool = pool
+		return nil
+	}
+}
+
+// WithCompression 開啟 permessage-deflate
+func WithCompression() Option {
+	return func(o *Options) error {
+		o.EnableCompression = true
+		return nil
+	}
+}
+
+// WithCompressionLevel 開啟 permessage-deflate 並指定壓縮等級（-2 到 9；flate.BestSpeed 為 1）
+func WithCompressionLevel(level int) Option {
+	return func(o *Options) error {
+		if level < minCompressionLevel || level > maxCompressionLevel {
+			return fmt.Errorf("websocket: CompressionLevel must be between %d and %d, got %d", minCompressionLevel, maxCompressionLevel, level)
+		}
+		o.EnableCompression, o.CompressionLevel = true, level
+		return nil
+	}
+}
+
+// WithCompressionThreshold 開啟 permessage-deflate，但小於 n bytes 的訊息（例如心跳）不壓縮
+func WithCompressionThreshold(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("websocket: CompressionThreshold must not be negative, got %d", n)
+		}
+		o.EnableCompression, o.CompressionThreshold = true, n
+		return nil
+	}
+}
+
+// WithCheckOrigin 升級時檢查 Origin
+func WithCheckOrigin(fn func(r *http.Request) bool) Option {
+	return func(o *Options) error {
+		if fn == nil {
+			return errors.New("websocket: CheckOrigin must not be nil")
+		}
+		o.CheckOrigin = fn
+		return nil
+	}
+}
+
+// WithAllowedOrigins 只允許這些來源升級（支援 "*.example.com" 子網域萬用字元，"*" 表示全部）
+func WithAllowedOrigins(origins ...string) Option {
+	return func(o *Options) error {
+		if _, err := parseOrigins(origins); err != nil {
+			return err
+		}
+		o.AllowedOrigins = append(o.AllowedOrigins, origins...)
+		return nil
+	}
+}
+
+// WithTrustedProxies 信任這些反向 proxy 送來的 X-Forwarded-For / X-Real-IP（CIDR 或 IP）
+func WithTrustedProxies(cidrs ...string) Option {
+	return func(o *Options) error {
+		if _, err := parseTrustedProxies(cidrs); err != nil {
+			return err
+		}
+		o.TrustedProxies = append(o.TrustedProxies, cidrs...)
+		return nil
+	}
+}
+
+// WithSubprotocols 伺服器支援的 Sec-WebSocket-Protocol，依偏好排序
+func WithSubprotocols(protocols ...string) Option {
+	return func(o *Options) error {
+		for _, p := range protocols {
+			if p == "" {
+				return errors.New("websocket: subprotocol must not be empty")
+			}
+		}
+		o.Subprotocols = append(o.Subprotocols, protocols...)
+		return nil
+	}
+}
+
+// WithUpgradeRate 全部連線要求合計每秒最多 perSecond 次（burst 為 token bucket 大小），超過時回 429
+func WithUpgradeRate(perSecond float64, burst int) Option {
+	return func(o *Options) error {
+		if perSecond <= 0 || burst < 0 {
+			return fmt.Errorf("websocket: invalid upgrade rate %v/s burst %d", perSecond, burst)
+		}
+		o.UpgradeRate, o.UpgradeBurst = perSecond, burst
+		return nil
+	}
+}
+
+// WithUpgradeRatePerIP 每個 client IP 每秒最多 perSecond 次連線要求（IP 的判斷見 TrustedProxies）
+func WithUpgradeRatePerIP(perSecond float64, burst int) Option {
+	return func(o *Options) error {
+		if perSecond <= 0 || burst < 0 {
+			return fmt.Errorf("websocket: invalid per-IP upgrade rate %v/s burst %d", perSecond, burst)
+		}
+		o.UpgradeRatePerIP, o.UpgradeBurstPerIP = perSecond, burst
+		return nil
+	}
+}
+
+// WithMaxConnections 連線上限；0 表示不限制
+func WithMaxConnections(total, perIP int) Option {
+	return func(o *Options) error {
+		if total < 0 || perIP < 0 {
+			return fmt.Errorf("websocket: connection limits must not be negative, got %d / %d", total, perIP)
+		}
+		o.MaxConnections, o.MaxConnectionsPerIP = total, perIP
+		return nil
+	}
+}
+
+// WithRetryAfter 因 MaxConnections 或關閉中拒絕連線時建議的重連等待（實際為 d 到 2d 之間的隨機值）
+func WithRetryAfter(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("websocket: RetryAfter must be positive, got %s", d)
+		}
+		o.RetryAfter = d
+		return nil
+	}
+}
+
+// WithWriteWait 單次寫入期限
+func WithWriteWait(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("websocket: WriteWait must be positive, got %s", d)
+		}
+		o.WriteWait = d
+		return nil
+	}
+}
+
+// WithControlWriteWait ping、heartbeat、close frame 與協定控制封包的寫入期限（通常比 WriteWait 短）
+func WithControlWriteWait(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("websocket: ControlWriteWait must be positive, got %s", d)
+		}
+		o.ControlWriteWait = d
+		return nil
+	}
+}
+
+// WithWriteRetry 寫入逾時時最多再等 n 次寫入期限才斷線（TCP window 暫時塞住時不會馬上踢掉連線）
+func WithWriteRetry(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("websocket: WriteRetries must not be negative, got %d", n)
+		}
+		o.WriteRetries = n
+		return nil
+	}
+}
+
+// WithCloseGrace server 主動斷線時送出 close frame 後等待 peer 回覆 close 的最長時間
+func WithCloseGrace(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("websocket: CloseGrace must be positive, got %s", d)
+		}
+		o.CloseGrace = d
+		return nil
+	}
+}
+
+// WithHeartbeat 心跳：pongWait 內沒收到 pong 視為斷線，每 pingPeriod 送一次 ping；
+// pingPeriod 必須小於 pongWait，傳 0 時為 pongWait 的 9/10
+func WithHeartbeat(pongWait, pingPeriod time.Duration) Option {
+	return func(o *Options) error {
+		if pongWait <= 0 || pingPeriod < 0 {
+			return fmt.Errorf("websocket: invalid heartbeat pongWait=%s pingPeriod=%s", pongWait, pingPeriod)
+		}
+		o.PongWait, o.PingPeriod = pongWait, pingPeriod
+		return nil
+	}
+}
+
+// WithAppHeartbeat 每 interval 送一次 JSON heartbeat 測量 client 的來回時間（見 heartbeat.go）
+func WithAppHeartbeat(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			return fmt.Errorf("websocket: AppHeartbeat must be positive, got %s", interval)
+		}
+		o.AppHeartbeat = interval
+		return nil
+	}
+}
+
+// WithAuthenticate 升級前驗證；回傳 error 則回 401
+func WithAuthenticate(fn func(c *gin.Context) (ClientInfo, error)) Option {
+	return func(o *Options) error {
+		o.Authenticate = fn
+		return nil
+	}
+}
+
+// WithIDGenerator 自訂 client ID 的產生方式（例如 ULID、snowflake）
+func WithIDGenerator(fn func() string) Option {
+	return func(o *Options) error {
+		if fn == nil {
+			return errors.New("websocket: NewID must not be nil")
+		}
+		o.NewID = fn
+		return nil
+	}
+}
+
+// WithLogger 結構化 log（預設 slog.Default()）
+func WithLogger(l Logger) Option {
+	return func(o *Options) error {
+		if l == nil {
+			return errors.New("websocket: Logger must not be nil")
+		}
+		o.Logger = l
+		return nil
+	}
+}
+
+// WithOnConnect 連線註冊後呼叫
+func WithOnConnect(fn func(c *Client)) Option {
+	return func(o *Options) error {
+		o.OnConnect = fn
+		return nil
+	}
+}
+
+// WithOnDisconnect 連線結束後呼叫；c.CloseInfo() 為 close code 與原因
+func WithOnDisconnect(fn func(c *Client)) Option {
+	return func(o *Options) error {
+		o.OnDisconnect = fn
+		return nil
+	}
+}
+
+// WithOnMessage 改寫收到的訊息；回傳 nil 表示不廣播
+func WithOnMessage(fn func(c *Client, msg []byte) []byte) Option {
+	return func(o *Options) error {
+		o.OnMessage = fn
+		return nil
+	}
+}
+
+// WithRoomHooks 房間建立與清空時呼叫（任一可為 nil）
+func WithRoomHooks(created, emptied func(room string)) Option {
+	return func(o *Options) error {
+		o.OnRoomCreated, o.OnRoomEmptied = created, emptied
+		return nil
+	}
+}
+
+// WithRoomTTL 房間清空後保留狀態的時間，之後回收
+func WithRoomTTL(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("websocket: RoomTTL must be positive, got %s", d)
+		}
+		o.RoomTTL = d
+		return nil
+	}
+}
+
+// WithEchoToSender client 送出的訊息也廣播回自己
+func WithEchoToSender() Option {
+	return func(o *Options) error {
+		o.EchoToSender = true
+		return nil
+	}
+}
+
+// WithPresenceEvents 廣播上下線事件並支援 presence.list
+func WithPresenceEvents() Option {
+	return func(o *Options) error {
+		o.PresenceEvents = true
+		return nil
+	}
+}
+
+// WithMemberEvents 對房間成員送出加入 / 離開事件並支援 {"type":"members"}（見 members.go）
+func WithMemberEvents() Option {
+	return func(o *Options) error {
+		o.MemberEvents = true
+		return nil
+	}
+}
+
+// WithSequenceNumbers 廣播帶遞增序號，並在背壓丟棄訊息時通知 client {"type":"gap"}
+func WithSequenceNumbers() Option {
+	return func(o *Options) error {
+		o.SequenceNumbers = true
+		return nil
+	}
+}
+
+// WithHistory 保留最近 n 則廣播給新連線
+func WithHistory(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("websocket: HistorySize must not be negative, got %d", n)
+		}
+		o.HistorySize = n
+		return nil
+	}
+}
+
+// WithHistoryStore 將房間廣播存到 store（例如 NewRedisHistoryStore、NewSQLHistoryStore），供 Hub.RoomHistory 分頁查詢
+func WithHistoryStore(store HistoryStore) Option {
+	return func(o *Options) error {
+		if store == nil {
+			return errors.New("websocket: HistoryStore must not be nil")
+		}
+		o.HistoryStore = store
+		return nil
+	}
+}
+
+// WithMessageStore 將所有廣播存到 store（例如 NewSQLMessageStore、NewRedisStreamMessageStore）供稽核與 Hub.Messages 查詢；
+// retention > 0 時定期刪除超過保留期限的訊息
+func WithMessageStore(store MessageStore, retention time.Duration) Option {
+	return func(o *Options) error {
+		if store == nil {
+			return errors.New("websocket: MessageStore must not be nil")
+		}
+		if retention < 0 {
+			return fmt.Errorf("websocket: MessageRetention must not be negative, got %s", retention)
+		}
+		o.MessageStore, o.MessageRetention = store, retention
+		return nil
+	}
+}
+
+// WithAuditLog 記錄 REST 的廣播與管理操作（搭配 AuditMiddleware），retention 為保留期限（0 表示不刪除）
+func WithAuditLog(log AuditLog, retention time.Duration) Option {
+	return func(o *Options) error {
+		if log == nil {
+			return errors.New("websocket: AuditLog must not be nil")
+		}
+		if retention < 0 {
+			return fmt.Errorf("websocket: AuditRetention must not be negative, got %s", retention)
+		}
+		o.AuditLog, o.AuditRetention = log, retention
+		return nil
+	}
+}
+
+// WithAsyncHandlers handler 改在背景 worker 執行：整個 hub 同時最多 workers 個，每個 client 依序執行，
+// 尚未執行的訊息最多 queue 則（0 使用預設值），超過時依 overflow 處理
+func WithAsyncHandlers(workers, queue int, overflow HandlerOverflow) Option {
+	return func(o *Options) error {
+		if workers <= 0 {
+			return fmt.Errorf("websocket: HandlerWorkers must be positive, got %d", workers)
+		}
+		if queue < 0 {
+			return fmt.Errorf("websocket: HandlerQueue must not be negative, got %d", queue)
+		}
+		o.HandlerWorkers, o.HandlerQueue, o.HandlerOverflow = workers, queue, overflow
+		return nil
+	}
+}
+
+// WithHandlerPerClient 每個 client 同時最多 n 個 handler（需搭配 WithAsyncHandlers）；n > 1 時不保證執行順序
+func WithHandlerPerClient(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("websocket: HandlerPerClient must be positive, got %d", n)
+		}
+		o.HandlerPerClient = n
+		return nil
+	}
+}
+
+// WithCanPublish 限制哪些房間成員可以對房間發佈（見 permission.go）
+func WithCanPublish(fn func(c *Client, room string) bool) Option {
+	return func(o *Options) error {
+		if fn == nil {
+			return errors.New("websocket: CanPublish must not be nil")
+		}
+		o.CanPublish = fn
+		return nil
+	}
+}
+
+// WithSlowMode 房間預設的 slow mode（例如依房間名稱前綴決定）；個別房間可再以 Hub.SetSlowMode 調整
+func WithSlowMode(fn func(room string) time.Duration) Option {
+	return func(o *Options) error {
+		if fn == nil {
+			return errors.New("websocket: SlowMode must not be nil")
+		}
+		o.SlowMode = fn
+		return nil
+	}
+}
+
+// WithDedup client 以 envelope 的字串 id 重送時，window 內相同發送者與 id 的訊息只處理第一次
+func WithDedup(window time.Duration) Option {
+	return func(o *Options) error {
+		if window <= 0 {
+			return fmt.Errorf("websocket: DedupWindow must be positive, got %s", window)
+		}
+		o.DedupWindow = window
+		return nil
+	}
+}
+
+// WithDenyPolicy 唯讀 client 的訊息與未授權的房間發佈如何處理
+func WithDenyPolicy(p DenyPolicy) Option {
+	return func(o *Options) error {
+		if p < DenyReply || p > DenyDisconnect {
+			return fmt.Errorf("websocket: unknown DenyPolicy %d", p)
+		}
+		o.Denied = p
+		return nil
+	}
+}
+
+// WithSlowClient 佇列滿時的策略
+func WithSlowClient(p SlowClientPolicy) Option {
+	return func(o *Options) error {
+		o.SlowClient = p
+		return nil
+	}
+}
+
+// WithSlowClose 因背壓斷線時送出的 close code 與 reason（預設 1008 "slow consumer"）
+func WithSlowClose(code int, reason string) Option {
+	return func(o *Options) error {
+		if err := validCloseFrame(code, reason); err != nil {
+			return fmt.Errorf("websocket: SlowCloseCode: %w", err)
+		}
+		o.SlowCloseCode, o.SlowCloseReason = code, reason
+		return nil
+	}
+}
+
+// WithOnDrop 每丟棄一則訊息呼叫一次
+func WithOnDrop(fn func(c *Client, reason DropReason)) Option {
+	return func(o *Options) error {
+		o.OnDrop = fn
+		return nil
+	}
+}
+
+// WithOnSlowClient client 在短時間內一再因 DropOldest 丟訊息時呼叫 fn（門檻見 WithSlowClientThreshold）
+func WithOnSlowClient(fn func(c *Client, dropped int)) Option {
+	return func(o *Options) error {
+		o.OnSlowClient = fn
+		return nil
+	}
+}
+
+// WithSlowClientThreshold window 內丟掉 drops 則時呼叫 OnSlowClient（預設 10 則 / 10 秒）
+func WithSlowClientThreshold(drops int, window time.Duration) Option {
+	return func(o *Options) error {
+		if drops <= 0 || window <= 0 {
+			return fmt.Errorf("websocket: slow client threshold must be positive, got %d in %s", drops, window)
+		}
+		o.SlowClientDrops, o.SlowClientWindow = drops, window
+		return nil
+	}
+}
+
+// WithDeadLetter 將背壓丟棄的訊息交給 cfg.Handler 或 cfg.Channel（見 DeadLetterConfig）
+func WithDeadLetter(cfg DeadLetterConfig) Option {
+	return func(o *Options) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		o.DeadLetter = &cfg
+		return nil
+	}
+}
+
+// WithEncryption 以 cfg 的金鑰加密房間廣播與指定對象的訊息，並解密 client 送來的加密 envelope（見 encryption.go）
+func WithEncryption(cfg EncryptionConfig) Option {
+	return func(o *Options) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		o.Encryption = &cfg
+		return nil
+	}
+}
+
+// WithEventBuffer Events() channel 的容量；接收端來不及讀時超過的事件會被丟棄
+func WithEventBuffer(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("websocket: EventBuffer must be positive, got %d", n)
+		}
+		o.EventBuffer = n
+		return nil
+	}
+}
+
+// WithInboundRate 每個 client 每秒最多 perSecond 則訊息（burst 為 token bucket 大小）
+func WithInboundRate(perSecond float64, burst int, policy RatePolicy) Option {
+	return func(o *Options) error {
+		if perSecond <= 0 || burst < 0 {
+			return fmt.Errorf("websocket: invalid inbound rate %v/s burst %d", perSecond, burst)
+		}
+		o.InboundRate, o.InboundBurst, o.InboundPolicy = perSecond, burst, policy
+		return nil
+	}
+}
+
+// WithEgressRate 限制寫出頻寬（bytes/秒）：perClient 為每個連線，global 為全部連線合計；0 表示不限制
+func WithEgressRate(perClient, global int) Option {
+	return func(o *Options) error {
+		if perClient < 0 || global < 0 || (perClient == 0 && global == 0) {
+			return fmt.Errorf("websocket: invalid egress rate %d/s global %d/s", perClient, global)
+		}
+		o.EgressRate, o.GlobalEgressRate = perClient, global
+		return nil
+	}
+}
+
+// WithWriteCoalescing 寫出時最多把 n 則已在佇列中的文字訊息併成一個 frame（見 Options.WriteCoalesce）
+func WithWriteCoalescing(n int, format CoalesceFormat) Option {
+	return func(o *Options) error {
+		if n < 2 {
+			return fmt.Errorf("websocket: WriteCoalesce must be at least 2, got %d", n)
+		}
+		o.WriteCoalesce, o.CoalesceFormat = n, format
+		return nil
+	}
+}
+
+// WithShards 將 client 分散到 n 個事件迴圈
+func WithShards(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("websocket: Shards must be positive, got %d", n)
+		}
+		o.Shards = n
+		return nil
+	}
+}
+
+// WithRPCTimeout 單一 RPC 呼叫的期限
+func WithRPCTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("websocket: RPCTimeout must be positive, got %s", d)
+		}
+		o.RPCTimeout = d
+		return nil
+	}
+}
+
+// WithFanoutWorkers 以 n 個 worker 平行投遞大量對象的廣播
+func WithFanoutWorkers(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("websocket: FanoutWorkers must not be negative, got %d", n)
+		}
+		o.FanoutWorkers = n
+		return nil
+	}
+}
+
+// WithCodec 預設的編解碼
+func WithCodec(c Codec) Option {
+	return func(o *Options) error {
+		if c == nil {
+			return errors.New("websocket: Codec must not be nil")
+		}
+		o.Codec = c
+		return nil
+	}
+}
+
+// WithSubprotocolCodec 協商出 subprotocol 時改用 c（subprotocol 會自動加入支援清單）
+func WithSubprotocolCodec(subprotocol string, c Codec) Option {
+	return func(o *Options) error {
+		if subprotocol == "" || c == nil {
+			return errors.New("websocket: subprotocol codec needs a name and a codec")
+		}
+		if o.Codecs == nil {
+			o.Codecs = make(map[string]Codec)
+		}
+		o.Codecs[subprotocol] = c
+		return nil
+	}
+}
+
+// WithResume 開啟 session 續接：每個 session 保留 buffer 則訊息，斷線後保留 ttl（0 使用預設值）
+func WithResume(buffer int, ttl time.Duration) Option {
+	return func(o *Options) error {
+		if buffer <= 0 || ttl < 0 {
+			return fmt.Errorf("websocket: invalid resume buffer %d ttl %s", buffer, ttl)
+		}
+		o.ResumeBuffer, o.ResumeTTL = buffer, ttl
+		return nil
+	}
+}
+
+// WithIdleTimeout 超過 timeout 沒有應用層訊息的 client 先收到警告，grace 後關閉（grace 為 0 時使用預設 30 秒）
+func WithIdleTimeout(timeout, grace time.Duration) Option {
+	return func(o *Options) error {
+		if timeout <= 0 || grace < 0 {
+			return fmt.Errorf("websocket: invalid idle timeout %s grace %s", timeout, grace)
+		}
+		o.IdleTimeout, o.IdleGrace = timeout, grace
+		return nil
+	}
+}
+
+// WithLoginPolicy 同一個 userID 重複登入時的處理方式
+func WithLoginPolicy(p LoginPolicy) Option {
+	return func(o *Options) error {
+		if p < LoginAllowMultiple || p > LoginKickOld {
+			return fmt.Errorf("websocket: unknown LoginPolicy %d", p)
+		}
+		o.DuplicateLogin = p
+		return nil
+	}
+}
+
+// WithTracerProvider OpenTelemetry TracerProvider（預設為全域設定）
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) error {
+		o.TracerProvider = tp
+		return nil
+	}
+}
+
+// WithPropagator trace context 的傳遞格式（預設為全域設定）
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *Options) error {
+		o.Propagator = p
+		return nil
+	}
+}
+
+// WithWebhook 將 Hub 事件 POST 到 cfg.URLs（見 WebhookConfig）
+func WithWebhook(cfg WebhookConfig) Option {
+	return func(o *Options) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		o.Webhook = &cfg
+		return nil
+	}
+}
+
+// WithMQTT 讓 MQTT client 以 subprotocol "mqtt" 連線並訂閱、發佈 Hub 的 topic（見 MQTTConfig）
+func WithMQTT(cfg MQTTConfig) Option {
+	return func(o *Options) error {
+		o.MQTT = &cfg
+		return nil
+	}
+}
+
+// WithSocketIO 設定 ServeSocketIO 端點（見 SocketIOConfig）
+func WithSocketIO(cfg SocketIOConfig) Option {
+	return func(o *Options) error {
+		o.SocketIO = &cfg
+		return nil
+	}
+}
+
+// WithGraphQL 讓 GraphQL client 以 graphql-transport-ws 協定訂閱（見 GraphQLConfig）
+func WithGraphQL(cfg GraphQLConfig) Option {
+	return func(o *Options) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		o.GraphQL = &cfg
+		return nil
+	}
+}
+
+// WithProtobufEnvelope 接受以 protobuf Envelope（wspb/envelope.proto）收發的 client，
+// subprotocol 為 "envelope.v1+protobuf"
+func WithProtobufEnvelope() Option {
+	return func(o *Options) error {
+		o.ProtobufEnvelope = true
+		return nil
+	}
+}
+
+// WithBanStore 將封鎖名單存到 store，重啟後仍有效
+func WithBanStore(store BanStore) Option {
+	return func(o *Options) error {
+		if store == nil {
+			return errors.New("websocket: BanStore must not be nil")
+		}
+		o.BanStore = store
+		return nil
+	}
+}
+
+// WithSessionStore 將斷線中的 session 與使用者連線存到 store（例如 NewRedisSessionStore），
+// 讓 instance 重啟後或在其他 instance 上仍能續接（需搭配 WithResume）
+func WithSessionStore(store SessionStore) Option {
+	return func(o *Options) error {
+		if store == nil {
+			return errors.New("websocket: SessionStore must not be nil")
+		}
+		o.SessionStore = store
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originPattern AllowedOrigins 的一個項目；scheme 為空表示不限，host 以 "." 開頭表示子網域萬用字元
+type originPattern struct {
+	scheme string
+	host   string
+	any    bool // "*"：允許所有來源
+}
+
+// parseOrigins 解析 AllowedOrigins，例如 "https://example.com"、"*.example.com"、"http://localhost:3000"、"*"
+func parseOrigins(list []string) ([]originPattern, error) {
+	out := make([]originPattern, 0, len(list))
+	for _, s := range list {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "*" {
+			out = append(out, originPattern{any: true})
+			continue
+		}
+		var p originPattern
+		host := s
+		if scheme, rest, ok := strings.Cut(s, "://"); ok {
+			p.scheme, host = scheme, rest
+		}
+		if wild, ok := strings.CutPrefix(host, "*."); ok {
+			p.host = "." + wild
+			host = wild
+		} else {
+			p.host = host
+		}
+		if u, err := url.Parse("http://" + host); err != nil || host == "" || u.Host != host {
+			return nil, fmt.Errorf("websocket: invalid allowed origin %q", s)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (p originPattern) match(u *url.URL) bool {
+	if p.any {
+		return true
+	}
+	if p.scheme != "" && p.scheme != strings.ToLower(u.Scheme) {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if strings.HasPrefix(p.host, ".") {
+		return strings.HasSuffix(host, p.host) && len(host) > len(p.host)
+	}
+	return host == p.host
+}
+
+// allowOrigins 依 AllowedOrigins 檢查 Origin；沒有 Origin（非瀏覽器 client）時允許
+func allowOrigins(patterns []originPattern) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		for _, p := range patterns {
+			if p.match(u) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sameOrigin 預設的檢查：Origin 的 host 需與請求的 Host 相同；沒有 Origin 時允許
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
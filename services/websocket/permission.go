@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// DenyPolicy 決定唯讀 client 的訊息或未授權的房間發佈如何處理
+type DenyPolicy int
+
+const (
+	DenyReply      DenyPolicy = iota // 丟棄並回覆送出者一個錯誤 envelope（預設）
+	DenyDrop                         // 靜默丟棄
+	DenyDisconnect                   // 以 1008 policy violation 斷線
+)
+
+// 權限模型：
+//
+//   - 唯讀 client（ClientInfo.ReadOnly 或 SetReadOnly）仍可加入 / 離開房間、訂閱 topic 與回覆 ack，
+//     其他訊息（廣播、房間發佈、handler、RPC、binary frame、MQTT PUBLISH）依 Options.Denied 處理
+//   - 房間發佈 {"type":"publish","room":"x",...}：只有房間成員可發佈，Options.CanPublish 可再限制，
+//     slow mode（SetSlowMode）的房間另有發佈間隔；
+//     訊息經 inbound middleware 後原樣送給房間（"publish" 因此不會交給 Handle 註冊的 handler）
+
+// readOnlyMsg 回覆唯讀 client 的錯誤 envelope
+var readOnlyMsg = []byte(`{"type":"error","data":{"error":"read-only"}}`)
+
+// ReadOnly 是否為唯讀 client
+func (c *Client) ReadOnly() bool {
+	return c.readOnly.Load()
+}
+
+// SetReadOnly 變更唯讀狀態（例如權限變更時），可在任何 goroutine 呼叫
+func (c *Client) SetReadOnly(readOnly bool) {
+	c.readOnly.Store(readOnly)
+}
+
+// deny 依 Options.Denied 處理被拒絕的訊息；reply 為回覆送出者的錯誤 envelope
+func (c *Client) deny(reply []byte, reason string, args ...any) {
+	h := c.hub
+	switch h.opts.Denied {
+	case DenyDrop:
+	case DenyDisconnect:
+		h.opts.Logger.Warn("client message denied, disconnecting", c.logAttrs(append([]any{"reason", reason}, args...)...)...)
+		_ = h.Disconnect(c.id, ClosePolicyViolation, reason)
+	default:
+		_ = h.sendToClient(c, reply)
+	}
+}
+
+// denyReadOnly 唯讀 client 送出了不允許的訊息時回傳 true（在 readPump 內呼叫）
+func (c *Client) denyReadOnly() bool {
+	if !c.readOnly.Load() {
+		return false
+	}
+	c.deny(readOnlyMsg, "read-only")
+	return true
+}
+
+// parsePublishCmd 解析 {"type":"publish","room":"x",...}
+func parsePublishCmd(b []byte) (room string, ok bool) {
+	if !bytes.Contains(b, []byte(`"publish"`)) {
+		return "", false
+	}
+	var v struct {
+		Type string `json:"type"`
+		Room string `json:"room"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(b), &v) != nil || v.Type != "publish" || v.Room == "" {
+		return "", false
+	}
+	return v.Room, true
+}
+
+// publishRoom 檢查成員與 CanPublish 後對房間廣播（在 readPump 內呼叫）
+func (c *Client) publishRoom(room string, message []byte) {
+	h := c.hub
+	member := false
+	if !c.shard.call(func() { member = c.rooms[room] }) {
+		return
+	}
+	if !member || (h.opts.CanPublish != nil && !h.opts.CanPublish(c, room)) {
+		c.deny(mustJSON(map[string]any{"type": "error", "data": map[string]string{
+			"error": "publish not allowed", "room": room,
+		}}), "publish not allowed", "room", room)
+		return
+	}
+	if wait, ok := c.allowSlowMode(room, time.Now()); !ok {
+		_ = h.sendToClient(c, slowModeError(room, wait))
+		return
+	}
+	if !c.acceptDedup() {
+		return
+	}
+	m := broadcastMsg{room: room, msgType: TextMessage, data: message}
+	if !h.opts.EchoToSender {
+		m.except = c
+	}
+	h.sendBroadcast(m)
+}
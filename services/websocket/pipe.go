@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+// PipeMessage 經 Pipe 轉送的廣播（加密前的內容）
+type PipeMessage struct {
+	Room   string // 空字串代表全域廣播
+	Topic  string
+	Binary bool
+	Data   []byte
+}
+
+// hubPipes 由本 hub 轉出的 Pipe
+type hubPipes struct {
+	mu    sync.RWMutex
+	pipes []*hubPipe
+}
+
+type hubPipe struct {
+	dst    *Hub
+	filter func(PipeMessage) bool
+}
+
+// Pipe 將本 hub 的廣播（Broadcast、BroadcastToRoom、Publish、房間發佈、BroadcastBatch 的房間與全域訊息等）
+// 轉送到同一個 process 內的 dst，例如公開 hub 的部分房間轉給內部管理 hub；filter 回傳 false 的不轉送，nil 表示全部轉送。
+// 在 dst 上視為 dst 自己的廣播：依 dst 的設定加密、記入歷史、轉送 dst 的 backplane，也會再經 dst 的 Pipe 轉出，
+// 但不會轉回已經過的 hub（兩個 hub 互相 Pipe 不會無限循環）。
+// 與 backplane 相同，只轉送 Options.Codec 的編碼；從 backplane 收到的、指定對象的訊息與 presence 等事件不轉送。
+// 轉送在廣播的呼叫端同步進行，filter 應盡快回傳。回傳的 stop 停止轉送
+func (h *Hub) Pipe(dst *Hub, filter func(PipeMessage) bool) (stop func(), err error) {
+	if dst == nil || dst == h {
+		return nil, errors.New("websocket: Pipe needs a different destination hub")
+	}
+	p := &hubPipe{dst: dst, filter: filter}
+	h.pipes.mu.Lock()
+	h.pipes.pipes = append(h.pipes.pipes, p)
+	h.pipes.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.pipes.mu.Lock()
+			defer h.pipes.mu.Unlock()
+			h.pipes.pipes = slices.DeleteFunc(slices.Clone(h.pipes.pipes), func(q *hubPipe) bool { return q == p })
+		})
+	}, nil
+}
+
+// pipeOut 將本機送出的廣播轉給各 Pipe；m 為加密前的訊息
+func (h *Hub) pipeOut(m broadcastMsg) {
+	h.pipes.mu.RLock()
+	pipes := h.pipes.pipes
+	h.pipes.mu.RUnlock()
+	if len(pipes) == 0 {
+		return
+	}
+	pm := PipeMessage{Room: m.room, Topic: m.topic, Binary: m.msgType == BinaryMessage, Data: m.data}
+	via := append(slices.Clip(m.via), h)
+	for _, p := range pipes {
+		if slices.Contains(via, p.dst) || (p.filter != nil && !p.filter(pm)) {
+			continue
+		}
+		p.dst.sendBroadcast(broadcastMsg{
+			room:    m.room,
+			topic:   m.topic,
+			msgType: m.msgType,
+			data:    m.data,
+			trace:   m.trace,
+			via:     via,
+		})
+	}
+}
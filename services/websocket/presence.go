@@ -0,0 +1,139 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientSnapshot 某一時間點的 client 狀態
+type ClientSnapshot struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userId,omitempty"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	IP          string    `json:"ip"` // 依 TrustedProxies 解析後的 client IP
+	Subprotocol string    `json:"subprotocol,omitempty"`
+	Transport   string    `json:"transport"`
+	Compressed  bool      `json:"compressed,omitempty"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	JoinedAt    time.Time `json:"joinedAt"`
+	Rooms       []string  `json:"rooms"`
+	Topics      []string  `json:"topics,omitempty"`
+	LatencyMs   int64     `json:"latencyMs,omitempty"` // 最近一次 AppHeartbeat 的來回時間
+	ReadOnly    bool      `json:"readOnly,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+// snapshot 僅在所屬 shard 內呼叫（c.rooms 由 shard 擁有）
+func (c *Client) snapshot() ClientSnapshot {
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	var topics []string
+	for pattern := range c.topics {
+		topics = append(topics, pattern)
+	}
+	sort.Strings(topics)
+	return ClientSnapshot{
+		ID:          c.id,
+		UserID:      c.userID,
+		RemoteAddr:  c.remoteAddr,
+		IP:          c.ip,
+		Subprotocol: c.Subprotocol(),
+		Transport:   c.Transport(),
+		Compressed:  c.compressed,
+		UserAgent:   c.meta.UserAgent,
+		JoinedAt:    c.joinedAt,
+		Rooms:       rooms,
+		Topics:      topics,
+		LatencyMs:   c.Latency().Milliseconds(),
+		ReadOnly:    c.ReadOnly(),
+		Tags:        c.sortedTags(),
+	}
+}
+
+// Clients 回傳目前在線 client 的快照（依上線時間排序）
+func (h *Hub) Clients() []ClientSnapshot {
+	var out []ClientSnapshot
+	h.callAll(func(s *shard) {
+		for c := range s.clients {
+			out = append(out, c.snapshot())
+		}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].JoinedAt.Before(out[j].JoinedAt) })
+	return out
+}
+
+// eventQueue 待送出的事件（presence 與房間成員事件）；shard 只 append 不阻塞，避免 shard 之間互相等待
+type eventQueue struct {
+	mu      sync.Mutex
+	pending []broadcastMsg
+	signal  chan struct{} // cap 1，有新事件時通知
+}
+
+func (q *eventQueue) push(m broadcastMsg) {
+	q.mu.Lock()
+	q.pending = append(q.pending, m)
+	q.mu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) take() []broadcastMsg {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := q.pending
+	q.pending = nil
+	return out
+}
+
+// presenceEvent 記下上下線事件，由 forwardEvents 送到所有 shard（在 shard 內呼叫）
+func (h *Hub) presenceEvent(event string, c *Client) {
+	if !h.opts.PresenceEvents || h.closing.Load() {
+		return
+	}
+	b, err := json.Marshal(Envelope{Type: "presence", Data: mustJSON(map[string]any{
+		"event":  event,
+		"client": c.snapshot(),
+	})})
+	if err != nil {
+		h.opts.Logger.Error("presence encode failed", "err", err)
+		return
+	}
+	h.events.push(broadcastMsg{msgType: TextMessage, data: b, transient: true})
+}
+
+// forwardEvents 將事件廣播給所有 shard 的 client（不記錄歷史、不經 backplane），直到 Hub 結束
+func (h *Hub) forwardEvents() {
+	for {
+		select {
+		case <-h.events.signal:
+			for _, m := range h.events.take() {
+				h.localBroadcast(m)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// handlePresenceList 回覆 {"type":"presence.list","data":[...]} 給請求者
+func (h *Hub) handlePresenceList(c *Client, _ json.RawMessage) {
+	b, err := json.Marshal(Envelope{Type: "presence.list", Data: mustJSON(h.Clients())})
+	if err != nil {
+		h.opts.Logger.Error("presence encode failed", "err", err)
+		return
+	}
+	_ = h.sendToClient(c, b)
+}
+
+// mustJSON 編碼內部固定結構（不會失敗）
+func mustJSON(v any) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
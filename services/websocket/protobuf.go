@@ -0,0 +1,188 @@
+package websocket
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative wspb/envelope.proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	"my-websocket/services/websocket/wspb"
+)
+
+// protobuf envelope（wspb/envelope.proto）：以這個 subprotocol 連線的 client 雙向都以 binary frame 傳送
+// wspb.Envelope，其餘（房間、訂閱、RPC、ack、session 續接）與 JSON client 相同。
+// hub 內部仍以 JSON 處理，寫出時才轉成 Envelope（同一則廣播只轉一次），收到時轉回 JSON 再處理；
+// 省下的是欄位名稱與 framing，data 等欄位的內容仍是 JSON
+const protobufSubprotocol = "envelope.v1+protobuf"
+
+var errInvalidProtobuf = errors.New("websocket: invalid protobuf envelope")
+
+// Envelope 中以字串、JSON 原文表示的欄位
+var (
+	protobufStrings = []string{"type", "room", "topic", "filter", "method"}
+	protobufJSON    = []string{"data", "id", "params", "result", "error"}
+)
+
+// toProtobuf 將要寫出的訊息轉成 Envelope；不是 JSON 物件的 text 訊息放在 raw
+func toProtobuf(msgType int, b []byte) *wspb.Envelope {
+	if msgType == BinaryMessage {
+		return &wspb.Envelope{Binary: b}
+	}
+	var obj map[string]json.RawMessage
+	if t := bytes.TrimSpace(b); len(t) == 0 || t[0] != '{' || json.Unmarshal(t, &obj) != nil {
+		return &wspb.Envelope{Raw: b}
+	}
+	env := &wspb.Envelope{}
+	for k, v := range obj {
+		if !setProtobufField(env, k, v) {
+			// 型別不符或是零值（proto3 無法區分有無）時原樣放在 extra
+			if env.Extra == nil {
+				env.Extra = make(map[string][]byte)
+			}
+			env.Extra[k] = v
+		}
+	}
+	return env
+}
+
+func setProtobufField(env *wspb.Envelope, k string, v json.RawMessage) bool {
+	switch k {
+	case "type", "room", "topic", "filter", "method":
+		var s string
+		if json.Unmarshal(v, &s) != nil || s == "" {
+			return false
+		}
+		*protobufString(env, k) = s
+	case "data", "id", "params", "result", "error":
+		*protobufRaw(env, k) = v
+	case "trace":
+		return json.Unmarshal(v, &env.Trace) == nil && len(env.Trace) > 0
+	case "seq":
+		return json.Unmarshal(v, &env.Seq) == nil && env.Seq != 0
+	case "ack":
+		return json.Unmarshal(v, &env.Ack) == nil && env.Ack
+	default:
+		return false
+	}
+	return true
+}
+
+func protobufString(env *wspb.Envelope, k string) *string {
+	switch k {
+	case "type":
+		return &env.Type
+	case "room":
+		return &env.Room
+	case "topic":
+		return &env.Topic
+	case "filter":
+		return &env.Filter
+	}
+	return &env.Method
+}
+
+func protobufRaw(env *wspb.Envelope, k string) *[]byte {
+	switch k {
+	case "data":
+		return &env.Data
+	case "id":
+		return &env.Id
+	case "params":
+		return &env.Params
+	case "result":
+		return &env.Result
+	}
+	return &env.Error
+}
+
+// fromProtobuf 將收到的 Envelope 轉回 JSON 協定的訊息
+func fromProtobuf(env *wspb.Envelope) (msgType int, b []byte, err error) {
+	switch {
+	case len(env.Binary) > 0:
+		return BinaryMessage, env.Binary, nil
+	case len(env.Raw) > 0:
+		return TextMessage, env.Raw, nil
+	}
+	obj := make(map[string]json.RawMessage, len(env.Extra)+4)
+	for k, v := range env.Extra {
+		obj[k] = v
+	}
+	for _, k := range protobufStrings {
+		if s := *protobufString(env, k); s != "" {
+			obj[k] = mustJSON(s)
+		}
+	}
+	for _, k := range protobufJSON {
+		if v := *protobufRaw(env, k); len(v) > 0 {
+			obj[k] = v
+		}
+	}
+	if len(env.Trace) > 0 {
+		obj["trace"] = mustJSON(env.Trace)
+	}
+	if env.Seq != 0 {
+		obj["seq"] = mustJSON(env.Seq)
+	}
+	if env.Ack {
+		obj["ack"] = json.RawMessage("true")
+	}
+	for _, v := range obj {
+		if !json.Valid(v) {
+			return 0, nil, errInvalidProtobuf
+		}
+	}
+	b, err = json.Marshal(obj)
+	return TextMessage, b, err
+}
+
+// writeProtobuf 以 Envelope 寫出；同一則廣播的編碼由所有 protobuf client 共用（僅在 writePump 內呼叫）
+func (c *Client) writeProtobuf(m *outbound) error {
+	m.pbOnce.Do(func() {
+		var b []byte
+		if b, m.pbErr = proto.Marshal(toProtobuf(m.msgType, m.data)); m.pbErr == nil {
+			m.pbFrame, m.pbErr = websocket.NewPreparedMessage(websocket.BinaryMessage, b)
+		}
+	})
+	if m.pbErr != nil {
+		return m.pbErr
+	}
+	return c.conn.WritePreparedMessage(m.pbFrame)
+}
+
+// readProtobuf 讀取 Envelope 並轉回 JSON 後照一般訊息處理，取代 readPump 的 JSON 協定；連線結束時返回。
+// text frame 視為 JSON 訊息
+func (c *Client) readProtobuf() {
+	for {
+		msgType, b, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.unexpectedClose(err) {
+				c.hub.opts.Logger.Warn("websocket read failed", c.logAttrs("err", err)...)
+			}
+			c.recordReadError(err)
+			return
+		}
+		accept, keep := c.allowInbound()
+		if !keep {
+			return
+		}
+		if !accept {
+			continue
+		}
+		if msgType == websocket.BinaryMessage {
+			var env wspb.Envelope
+			if err := proto.Unmarshal(b, &env); err != nil {
+				_ = c.hub.sendToClient(c, errorEnvelope(errInvalidProtobuf))
+				continue
+			}
+			if msgType, b, err = fromProtobuf(&env); err != nil {
+				_ = c.hub.sendToClient(c, errorEnvelope(err))
+				continue
+			}
+		}
+		c.handle(msgType, b)
+	}
+}
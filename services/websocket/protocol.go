@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 協定轉接等待寫出的控制封包（CONNACK、SUBACK、JSON-RPC response…）
+const protocolPacketQueue = 16
+
+// writePacket 交給 writePump 寫出協定轉接的控制封包；writePump 已結束時回傳 false
+func (c *Client) writePacket(m *outbound) bool {
+	select {
+	case c.packets <- m:
+		return true
+	case <-c.pumpDone:
+		return false
+	}
+}
+
+// closeProtocol 由 shard 關閉連線並等 writePump 結束，佇列中的控制封包（例如拒絕的 CONNACK）會先於 close frame 寫出
+func (c *Client) closeProtocol(code int, reason string) {
+	s := c.shard
+	s.call(func() {
+		if s.clients[c] {
+			s.closeClient(c, code, reason)
+		}
+	})
+	c.recordClose(code, reason, true)
+	select {
+	case <-c.pumpDone:
+	case <-time.After(c.hub.opts.WriteWait):
+	}
+}
+
+// flushPackets 寫出尚未送出的控制封包（僅在 writePump 內呼叫）
+func (c *Client) flushPackets() {
+	for {
+		select {
+		case p := <-c.packets:
+			if err := p.write(c.conn); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// write 寫出一則訊息（僅在 writePump 內呼叫）；MQTT、Socket.IO、JSON-RPC 與 GraphQL client 改以各自的格式寫出
+func (c *Client) write(m *outbound) error {
+	switch {
+	case c.mqtt != nil:
+		return c.conn.WriteMessage(websocket.BinaryMessage, mqttPublishPacket(m.topic, m.data))
+	case c.sio != nil:
+		return c.writeSocketIO(m)
+	case c.jsonrpc:
+		return c.conn.WriteMessage(websocket.TextMessage, jsonRPCPayload(m))
+	case c.gql != nil:
+		return c.writeGraphQL(m)
+	case c.protobuf:
+		return c.writeProtobuf(m)
+	}
+	return m.write(c.conn)
+}
+
+// ping 送出心跳（僅在 writePump 內呼叫）；Socket.IO 與 GraphQL client 使用各自協定的 ping 訊息
+func (c *Client) ping() error {
+	switch {
+	case c.sio != nil:
+		return c.conn.WriteMessage(websocket.TextMessage, []byte{eioPing})
+	case c.gql != nil:
+		return c.conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`))
+	}
+	return c.conn.WriteMessage(websocket.PingMessage, nil)
+}
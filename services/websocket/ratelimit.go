@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+// RatePolicy 決定超過 InboundRate 時如何處理
+type RatePolicy int
+
+const (
+	RateDrop       RatePolicy = iota // 靜默丟棄（預設）
+	RateWarn                         // 丟棄並回覆送出者一個錯誤 envelope
+	RateDisconnect                   // 以 1008 policy violation 斷線
+)
+
+var rateLimitedMsg = []byte(`{"type":"error","data":{"error":"rate limited"}}`)
+
+// newInboundLimiter 依設定建立 token bucket；未設定 InboundRate 時回傳 nil
+func (o *Options) newInboundLimiter() *rate.Limiter {
+	if o.InboundRate <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(o.InboundRate), o.InboundBurst)
+}
+
+// allowInbound 檢查是否超過速率；accept 為是否處理此訊息，keep 為 false 時 readPump 應斷線
+func (c *Client) allowInbound() (accept, keep bool) {
+	// 已送出 close frame：繼續讀到 peer 的 close 回覆，但不再處理訊息
+	if c.closeSent.Load() {
+		return false, true
+	}
+	if c.limiter == nil || c.limiter.Allow() {
+		return true, true
+	}
+	switch c.hub.opts.InboundPolicy {
+	case RateWarn:
+		_ = c.hub.sendToClient(c, rateLimitedMsg)
+	case RateDisconnect:
+		_ = c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+			time.Now().Add(c.hub.opts.WriteWait))
+		return false, false
+	}
+	return false, true
+}
@@ -0,0 +1,30 @@
+package websocket
+
+import "runtime/debug"
+
+// logPanic 記錄 recover 到的 panic 與 stack
+func (c *Client) logPanic(where string, p any) {
+	c.hub.opts.Logger.Error("websocket panic recovered",
+		c.logAttrs("in", where, "panic", p, "stack", string(debug.Stack()))...)
+}
+
+// closeOnPanic pump 內 panic 後以 1011 關閉 client（不保留 session 供續接；不可在 shard 內呼叫）
+func (c *Client) closeOnPanic() {
+	s := c.shard
+	s.call(func() {
+		if s.clients[c] {
+			s.closeClient(c, CloseInternalServerErr, "internal error")
+		}
+	})
+	c.recordClose(CloseInternalServerErr, "internal error", true)
+}
+
+// safely 執行使用者的 hook；panic 時只記錄，不中斷呼叫端的清理流程
+func (c *Client) safely(where string, fn func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			c.logPanic(where, p)
+		}
+	}()
+	fn()
+}
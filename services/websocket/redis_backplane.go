@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackplane 以 Redis pub/sub 實作 Backplane，所有 instance 共用同一個 channel
+type RedisBackplane struct {
+	Logger Logger // 預設 slog.Default()
+
+	rdb     redis.UniversalClient
+	channel string
+	pubsub  *redis.PubSub
+}
+
+func NewRedisBackplane(rdb redis.UniversalClient, channel string) *RedisBackplane {
+	if channel == "" {
+		channel = "websocket:broadcast"
+	}
+	return &RedisBackplane{Logger: slog.Default(), rdb: rdb, channel: channel}
+}
+
+func (r *RedisBackplane) Publish(ctx context.Context, m BackplaneMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Publish(ctx, r.channel, b).Err()
+}
+
+func (r *RedisBackplane) Subscribe(ctx context.Context, fn func(BackplaneMessage)) error {
+	ps := r.rdb.Subscribe(ctx, r.channel)
+	// 等待訂閱確認，連線失敗時直接回報
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return err
+	}
+	r.pubsub = ps
+	go func() {
+		for msg := range ps.Channel() {
+			var m BackplaneMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				r.Logger.Warn("redis backplane decode failed", "channel", r.channel, "err", err)
+				continue
+			}
+			fn(m)
+		}
+	}()
+	return nil
+}
+
+func (r *RedisBackplane) Close() error {
+	if r.pubsub == nil {
+		return nil
+	}
+	return r.pubsub.Close()
+}
+
+// Ping 確認 Redis 連線正常（HealthHandler 的 /readyz 使用）
+func (r *RedisBackplane) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 預設每個房間保留的訊息數
+const defaultRedisHistorySize = 1000
+
+// RedisHistoryStore 以 Redis sorted set 實作 HistoryStore：每個房間一個 "<prefix>:history:{<room>}"（score 為 ID），
+// ID 來自同一 hash slot 的計數器，Redis Cluster 也適用
+type RedisHistoryStore struct {
+	// Size 每個房間保留最近幾則（預設 1000）
+	Size int
+	// TTL 房間沒有新訊息多久後刪除其歷史（0 表示不刪除）
+	TTL time.Duration
+
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func NewRedisHistoryStore(rdb redis.UniversalClient, prefix string) *RedisHistoryStore {
+	if prefix == "" {
+		prefix = "websocket"
+	}
+	return &RedisHistoryStore{Size: defaultRedisHistorySize, rdb: rdb, prefix: prefix}
+}
+
+func (r *RedisHistoryStore) key(room string) string {
+	return r.prefix + ":history:{" + room + "}"
+}
+
+// 成員為 "<ID> <JSON>"，內容相同的訊息也不會合併
+var redisHistoryAppend = redis.NewScript(`
+local id = redis.call('INCR', KEYS[2])
+redis.call('ZADD', KEYS[1], id, id .. ' ' .. ARGV[1])
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -tonumber(ARGV[2]) - 1)
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('PEXPIRE', KEYS[2], ARGV[3])
+end
+return id
+`)
+
+func (r *RedisHistoryStore) Append(ctx context.Context, m HistoryMessage) (uint64, error) {
+	m.ID = 0
+	b, err := json.Marshal(m)
+	if err != nil {
+		return 0, err
+	}
+	key := r.key(m.Room)
+	id, err := redisHistoryAppend.Run(ctx, r.rdb, []string{key, key + ":seq"}, b, max(r.Size, 1), r.TTL.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
+
+func (r *RedisHistoryStore) Query(ctx context.Context, room string, before uint64, limit int) ([]HistoryMessage, error) {
+	maxScore := "+inf"
+	if before > 0 {
+		maxScore = "(" + strconv.FormatUint(before, 10)
+	}
+	members, err := r.rdb.ZRevRangeByScore(ctx, r.key(room), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   maxScore,
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]HistoryMessage, 0, len(members))
+	for _, member := range members {
+		idText, body, ok := strings.Cut(member, " ")
+		if !ok {
+			continue
+		}
+		var m HistoryMessage
+		if json.Unmarshal([]byte(body), &m) != nil {
+			continue
+		}
+		if m.ID, err = strconv.ParseUint(idText, 10, 64); err != nil {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
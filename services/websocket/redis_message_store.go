@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamMessageStore 以 Redis Stream 實作 MessageStore：所有廣播寫入同一個 "<prefix>:messages"，
+// ID 為 stream entry ID（"<unix ms>-<seq>"，需要 Redis 6.2 以上）。Query 依時間範圍讀取 stream，房間與 topic 條件在讀出後過濾，
+// 大量資料的稽核查詢建議改用 SQLMessageStore
+type RedisStreamMessageStore struct {
+	// MaxLen stream 大約保留的筆數上限（XADD MAXLEN ~，0 表示只依保留期限刪除）
+	MaxLen int64
+
+	rdb redis.UniversalClient
+	key string
+}
+
+func NewRedisStreamMessageStore(rdb redis.UniversalClient, prefix string) *RedisStreamMessageStore {
+	if prefix == "" {
+		prefix = "websocket"
+	}
+	return &RedisStreamMessageStore{rdb: rdb, key: prefix + ":messages"}
+}
+
+// redisStreamScan Query 每次讀取的筆數
+const redisStreamScan = 500
+
+func (r *RedisStreamMessageStore) Save(ctx context.Context, msgs []StoredMessage) error {
+	_, err := r.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, m := range msgs {
+			p.XAdd(ctx, &redis.XAddArgs{
+				Stream: r.key,
+				MaxLen: r.MaxLen,
+				Approx: r.MaxLen > 0,
+				Values: []any{
+					"instance", m.Instance,
+					"room", m.Room,
+					"topic", m.Topic,
+					"binary", m.Binary,
+					"data", m.Data,
+					"time", m.Time.UnixNano(),
+				},
+			})
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *RedisStreamMessageStore) Query(ctx context.Context, q MessageQuery) ([]StoredMessage, error) {
+	start, stop := "-", "+"
+	switch {
+	case q.After != "":
+		start = "(" + q.After
+	case !q.Since.IsZero():
+		start = strconv.FormatInt(q.Since.UnixMilli(), 10)
+	}
+	if !q.Until.IsZero() {
+		// entry ID 只有 ms 精度，邊界由 matches 再確認
+		stop = strconv.FormatInt(q.Until.UnixMilli(), 10)
+	}
+	var out []StoredMessage
+	for len(out) < q.Limit {
+		entries, err := r.rdb.XRangeN(ctx, r.key, start, stop, redisStreamScan).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if m := redisStoredMessage(e); q.matches(m) {
+				out = append(out, m)
+				if len(out) == q.Limit {
+					break
+				}
+			}
+		}
+		if len(entries) < redisStreamScan {
+			break
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+	return out, nil
+}
+
+func redisStoredMessage(e redis.XMessage) StoredMessage {
+	str := func(k string) string {
+		s, _ := e.Values[k].(string)
+		return s
+	}
+	ns, _ := strconv.ParseInt(str("time"), 10, 64)
+	return StoredMessage{
+		ID:       e.ID,
+		Instance: str("instance"),
+		Room:     str("room"),
+		Topic:    str("topic"),
+		Binary:   str("binary") == "1",
+		Data:     []byte(str("data")),
+		Time:     time.Unix(0, ns),
+	}
+}
+
+// Prune 以 XTRIM MINID 刪除 before 之前寫入的 entry（依 entry ID 的時間）
+func (r *RedisStreamMessageStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	n, err := r.rdb.XTrimMinID(ctx, r.key, strconv.FormatInt(before.UnixMilli(), 10)).Result()
+	return int(n), err
+}
+
+// Ping 確認 Redis 連線正常（HealthHandler 的 /readyz 使用）
+func (r *RedisStreamMessageStore) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 預設使用者連線記錄的保留時間（instance 沒有正常關閉時留下的記錄會在這之後消失）
+const defaultRedisConnectionTTL = 24 * time.Hour
+
+// RedisSessionStore 以 Redis 實作 SessionStore：
+// session 存成 "<prefix>:session:<token>"（JSON，到期自動刪除），使用者連線存成 "<prefix>:user:<userID>" hash。
+// TakeSession 使用 GETDEL，需要 Redis 6.2 以上
+type RedisSessionStore struct {
+	// ConnectionTTL 使用者連線 hash 的保留時間，每次新增連線時延長（預設 24 小時）
+	ConnectionTTL time.Duration
+
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func NewRedisSessionStore(rdb redis.UniversalClient, prefix string) *RedisSessionStore {
+	if prefix == "" {
+		prefix = "websocket"
+	}
+	return &RedisSessionStore{ConnectionTTL: defaultRedisConnectionTTL, rdb: rdb, prefix: prefix}
+}
+
+func (r *RedisSessionStore) sessionKey(token string) string {
+	return r.prefix + ":session:" + token
+}
+
+func (r *RedisSessionStore) userKey(userID string) string {
+	return r.prefix + ":user:" + userID
+}
+
+func (r *RedisSessionStore) SaveSession(ctx context.Context, s SessionState, update bool) (bool, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return false, err
+	}
+	args := redis.SetArgs{ExpireAt: s.Expires}
+	if update {
+		args.Mode = "XX"
+	}
+	err = r.rdb.SetArgs(ctx, r.sessionKey(s.Token()), b, args).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *RedisSessionStore) TakeSession(ctx context.Context, token string) (*SessionState, error) {
+	b, err := r.rdb.GetDel(ctx, r.sessionKey(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s SessionState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *RedisSessionStore) DeleteSession(ctx context.Context, token string) error {
+	return r.rdb.Del(ctx, r.sessionKey(token)).Err()
+}
+
+func (r *RedisSessionStore) AddConnection(ctx context.Context, userID string, conn UserConnection) error {
+	b, err := json.Marshal(conn)
+	if err != nil {
+		return err
+	}
+	key := r.userKey(userID)
+	_, err = r.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, key, conn.ClientID, b)
+		p.Expire(ctx, key, r.ConnectionTTL)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisSessionStore) RemoveConnection(ctx context.Context, userID, clientID string) error {
+	return r.rdb.HDel(ctx, r.userKey(userID), clientID).Err()
+}
+
+func (r *RedisSessionStore) UserConnections(ctx context.Context, userID string) ([]UserConnection, error) {
+	m, err := r.rdb.HGetAll(ctx, r.userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]UserConnection, 0, len(m))
+	for _, v := range m {
+		var conn UserConnection
+		if json.Unmarshal([]byte(v), &conn) == nil {
+			out = append(out, conn)
+		}
+	}
+	return out, nil
+}
+
+// Ping 確認 Redis 連線正常（HealthHandler 的 /readyz 使用）
+func (r *RedisSessionStore) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
+}
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// roomReq 加入/離開房間的請求
+type roomReq struct {
+	client *Client
+	room   string
+}
+
+// JoinRoom 將 client 加入房間（房間不存在時自動建立）
+func (h *Hub) JoinRoom(c *Client, room string) {
+	select {
+	case c.shard.join <- roomReq{client: c, room: room}:
+	case <-c.shard.done:
+	}
+}
+
+// LeaveRoom 將 client 移出房間（房間清空時呼叫 OnRoomEmptied，RoomTTL 後回收房間歷史）
+func (h *Hub) LeaveRoom(c *Client, room string) {
+	select {
+	case c.shard.leave <- roomReq{client: c, room: room}:
+	case <-c.shard.done:
+	}
+}
+
+// BroadcastToRoom 只對房間內的 client 廣播（有 backplane 時也會送到其他 instance）
+func (h *Hub) BroadcastToRoom(room string, b []byte) {
+	h.sendBroadcast(broadcastMsg{room: room, msgType: TextMessage, data: b})
+}
+
+// joinRoom 僅在 shard 內呼叫
+func (s *shard) joinRoom(c *Client, room string) {
+	if !s.clients[c] || room == "" {
+		return
+	}
+	if !s.addMember(c, room) {
+		return
+	}
+	s.hub.webhook(WebhookRoomJoin, c, func(e *WebhookEvent) { e.Room = room })
+	s.hub.emit(RoomJoined{Time: time.Now(), Client: c, Room: room})
+	s.hub.memberEvent("member_joined", c, room)
+	s.replay(c, room)
+}
+
+// leaveRoom 僅在 shard 內呼叫
+func (s *shard) leaveRoom(c *Client, room string) {
+	if s.removeMember(c, room) {
+		s.hub.webhook(WebhookRoomLeave, c, func(e *WebhookEvent) { e.Room = room })
+		s.hub.emit(RoomLeft{Time: time.Now(), Client: c, Room: room})
+		s.hub.memberEvent("member_left", c, room)
+	}
+}
+
+// parseRoomCmd 解析 client 送來的房間指令
+func parseRoomCmd(b []byte) (op, room string, ok bool) {
+	var v struct {
+		Type string `json:"type"`
+		Room string `json:"room"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(b), &v); err != nil {
+		return "", "", false
+	}
+	op = strings.ToLower(v.Type)
+	if (op != "join" && op != "leave") || v.Room == "" {
+		return "", "", false
+	}
+	return op, v.Room, true
+}
@@ -0,0 +1,231 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// 預設清空後保留房間狀態（房間歷史）的時間
+const defaultRoomTTL = 5 * time.Minute
+
+// roomRegistry 跨 shard 的房間成員數（同一房間的成員可能在不同 shard），
+// 用來判斷房間建立、清空與何時回收
+type roomRegistry struct {
+	mu      sync.Mutex
+	members map[string]int
+	emptied map[string]time.Time // 成員數為 0、等待回收的房間
+}
+
+// join 成員數加一；房間原本不存在（或已回收）時回傳 true
+func (r *roomRegistry) join(room string) (created bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members == nil {
+		r.members = make(map[string]int)
+		r.emptied = make(map[string]time.Time)
+	}
+	_, waiting := r.emptied[room]
+	created = r.members[room] == 0 && !waiting
+	delete(r.emptied, room)
+	r.members[room]++
+	return created
+}
+
+// leave 成員數減一；降到 0 時回傳 true 並開始計算回收時間
+func (r *roomRegistry) leave(room string, now time.Time) (emptied bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members[room] <= 0 {
+		return false
+	}
+	r.members[room]--
+	if r.members[room] > 0 {
+		return false
+	}
+	delete(r.members, room)
+	r.emptied[room] = now
+	return true
+}
+
+// track 沒有成員卻有狀態的房間（例如只被 BroadcastToRoom 過）也納入回收
+func (r *roomRegistry) track(room string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members == nil {
+		r.members = make(map[string]int)
+		r.emptied = make(map[string]time.Time)
+	}
+	if _, ok := r.emptied[room]; !ok && r.members[room] == 0 {
+		r.emptied[room] = now
+	}
+}
+
+// expired 取出清空超過 ttl 的房間（取出後即不再追蹤）
+func (r *roomRegistry) expired(now time.Time, ttl time.Duration) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for room, at := range r.emptied {
+		if now.Sub(at) >= ttl {
+			out = append(out, room)
+			delete(r.emptied, room)
+		}
+	}
+	return out
+}
+
+// Rooms 回傳目前有成員的房間與其成員數（跨所有 shard）
+func (h *Hub) Rooms() map[string]int {
+	h.rooms.mu.Lock()
+	defer h.rooms.mu.Unlock()
+	out := make(map[string]int, len(h.rooms.members))
+	for room, n := range h.rooms.members {
+		out[room] = n
+	}
+	return out
+}
+
+// RoomCount 回傳房間在本 instance 的成員數
+func (h *Hub) RoomCount(room string) int {
+	h.rooms.mu.Lock()
+	defer h.rooms.mu.Unlock()
+	return h.rooms.members[room]
+}
+
+// roomHook 待呼叫的 OnRoomCreated / OnRoomEmptied
+type roomHook struct {
+	room    string
+	created bool
+}
+
+// roomHooks 依發生順序在獨立的 goroutine 呼叫 hook，shard 只 append 不阻塞
+type roomHooks struct {
+	mu      sync.Mutex
+	pending []roomHook
+	signal  chan struct{} // cap 1
+}
+
+func (q *roomHooks) push(e roomHook) {
+	q.mu.Lock()
+	q.pending = append(q.pending, e)
+	q.mu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *roomHooks) take() []roomHook {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := q.pending
+	q.pending = nil
+	return out
+}
+
+// addMember 將 c 加入房間並更新成員數（僅在 shard 內呼叫）；已在房間內時回傳 false
+func (s *shard) addMember(c *Client, room string) bool {
+	members, ok := s.rooms[room]
+	if !ok {
+		members = make(map[*Client]bool)
+		s.rooms[room] = members
+	}
+	if members[c] {
+		return false
+	}
+	members[c] = true
+	c.rooms[room] = true
+	if s.hub.rooms.join(room) {
+		s.hub.roomEvent(room, true)
+	}
+	return true
+}
+
+// removeMember 將 c 移出房間並更新成員數（僅在 shard 內呼叫）；不在房間內時回傳 false
+func (s *shard) removeMember(c *Client, room string) bool {
+	members, ok := s.rooms[room]
+	if !ok || !members[c] {
+		return false
+	}
+	delete(members, c)
+	delete(c.rooms, room)
+	if len(members) == 0 {
+		delete(s.rooms, room)
+	}
+	if s.hub.rooms.leave(room, time.Now()) {
+		s.hub.roomEvent(room, false)
+	}
+	return true
+}
+
+// roomEvent 記下房間建立或清空，送出事件並交給 runRoomHooks 呼叫（關閉中不通知）
+func (h *Hub) roomEvent(room string, created bool) {
+	if h.closing.Load() {
+		return
+	}
+	if created {
+		h.emit(RoomCreated{Time: time.Now(), Room: room})
+	} else {
+		h.emit(RoomEmptied{Time: time.Now(), Room: room})
+	}
+	if (created && h.opts.OnRoomCreated == nil) || (!created && h.opts.OnRoomEmptied == nil) {
+		return
+	}
+	h.roomHooks.push(roomHook{room: room, created: created})
+}
+
+// runRoomHooks 呼叫房間 hook 並定期回收清空超過 RoomTTL 的房間，直到 Hub 結束
+func (h *Hub) runRoomHooks() {
+	gc := time.NewTicker(h.opts.RoomTTL / 2)
+	defer gc.Stop()
+	for {
+		select {
+		case <-h.roomHooks.signal:
+			for _, e := range h.roomHooks.take() {
+				h.callRoomHook(e)
+			}
+		case now := <-gc.C:
+			h.collectRooms(now)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *Hub) callRoomHook(e roomHook) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.opts.Logger.Error("room hook panic", "room", e.room, "panic", p)
+		}
+	}()
+	if e.created {
+		h.opts.OnRoomCreated(e.room)
+	} else {
+		h.opts.OnRoomEmptied(e.room)
+	}
+}
+
+// collectRooms 刪除清空超過 RoomTTL 的房間狀態（房間歷史與廣播序號）；期間又有人加入的房間保留
+func (h *Hub) collectRooms(now time.Time) {
+	expired := h.rooms.expired(now, h.opts.RoomTTL)
+	h.pruneSlowMode(now, expired)
+	if len(expired) == 0 {
+		return
+	}
+	if h.opts.SequenceNumbers {
+		h.seq.forget(expired)
+	}
+	if m, ok := h.opts.HistoryStore.(*MemoryHistoryStore); ok {
+		m.forget(expired)
+	}
+	if h.opts.HistorySize == 0 {
+		return
+	}
+	h.callAll(func(s *shard) {
+		for _, room := range expired {
+			if len(s.rooms[room]) == 0 {
+				delete(s.roomHistory, room)
+			}
+		}
+	})
+}
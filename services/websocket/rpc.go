@@ -0,0 +1,192 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// 預設的 RPC 期限
+const defaultRPCTimeout = 10 * time.Second
+
+// RPC 錯誤碼（沿用 JSON-RPC 2.0 的定義）
+const (
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCTimeout        = -32000 // 超過 RPCTimeout
+)
+
+// RPC 協定：
+//
+//	client → {"type":"rpc","id":7,"method":"getState","params":{...}}
+//	server → {"type":"rpc.result","id":7,"result":...}
+//	       或 {"type":"rpc.error","id":7,"error":{"code":-32601,"message":"..."}}
+//
+// id 可為數字或字串，原樣帶回；每個呼叫在自己的 goroutine 執行，回應順序不一定與請求相同。
+
+// RPCHandler 處理一個 RPC method；ctx 衍生自 Client.Context()，在 RPCTimeout 到期、client 斷線或 Hub 關閉時取消。
+// 回傳的 result 以 JSON 編碼；回傳 *RPCError 可指定錯誤碼，其他 error 視為 RPCInternalError
+type RPCHandler func(ctx context.Context, c *Client, params json.RawMessage) (any, error)
+
+// RPCError 回送給 client 的錯誤
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("websocket: rpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcMethods 已註冊的 method，可在任何時候註冊
+type rpcMethods struct {
+	mu sync.RWMutex
+	m  map[string]RPCHandler
+}
+
+// RegisterRPC 註冊 method；再次註冊同一名稱會取代先前的 handler
+func (h *Hub) RegisterRPC(method string, fn RPCHandler) {
+	h.rpc.mu.Lock()
+	defer h.rpc.mu.Unlock()
+	if h.rpc.m == nil {
+		h.rpc.m = make(map[string]RPCHandler)
+	}
+	h.rpc.m[method] = fn
+}
+
+// rpcRequest client 送來的呼叫
+type rpcRequest struct {
+	Type   string            `json:"type"`
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params json.RawMessage   `json:"params"`
+	Trace  map[string]string `json:"trace,omitempty"`
+}
+
+// parseRPC 解析 {"type":"rpc",...}；ok 為 false 表示不是 RPC 訊息
+func parseRPC(b []byte) (req rpcRequest, ok bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' || !bytes.Contains(b, []byte(`"rpc"`)) {
+		return req, false
+	}
+	if err := json.Unmarshal(b, &req); err != nil || req.Type != "rpc" {
+		return req, false
+	}
+	return req, true
+}
+
+// handleRPC 在新的 goroutine 執行 method 並回送結果（由 readPump 呼叫）
+func (c *Client) handleRPC(req rpcRequest) {
+	if len(req.ID) == 0 || req.Method == "" {
+		c.rpcReply(req.ID, nil, &RPCError{Code: RPCInvalidRequest, Message: "rpc needs an id and a method"})
+		return
+	}
+	fn, ok := c.hub.rpcMethod(req.Method)
+	if !ok {
+		c.rpcReply(req.ID, nil, &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + req.Method})
+		return
+	}
+	go func() {
+		result, err := c.callRPC(fn, req.Method, req.Params, req.Trace)
+		// client 已斷線時不回送
+		if !errors.Is(err, context.Canceled) {
+			c.rpcReply(req.ID, result, err)
+		}
+	}()
+}
+
+// rpcMethod 取得已註冊的 method
+func (h *Hub) rpcMethod(method string) (RPCHandler, bool) {
+	h.rpc.mu.RLock()
+	defer h.rpc.mu.RUnlock()
+	fn, ok := h.rpc.m[method]
+	return fn, ok
+}
+
+// callRPC 執行 method 直到完成、RPCTimeout 到期（回傳 RPCTimeout 錯誤）或 client 斷線、Hub 關閉（回傳 context.Canceled）
+func (c *Client) callRPC(fn RPCHandler, method string, params json.RawMessage, trace map[string]string) (any, error) {
+	h := c.hub
+	ctx, span := h.tracing.startSpan(h.tracing.extract(c.ctx, trace), "websocket.rpc",
+		attribute.String("websocket.rpc.method", method),
+		attribute.String("websocket.client_id", c.id),
+	)
+	defer span.End()
+	// client 斷線或 Hub 關閉時經由 c.ctx 取消
+	ctx, cancel := context.WithTimeout(ctx, h.opts.RPCTimeout)
+	defer cancel()
+
+	type outcome struct {
+		result any
+		err    error
+	}
+	res := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				c.logPanic("rpc "+method, p)
+				res <- outcome{err: &RPCError{Code: RPCInternalError, Message: "internal error"}}
+			}
+		}()
+		result, err := fn(ctx, c, params)
+		res <- outcome{result, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-res:
+	case <-ctx.Done():
+		// handler 仍在執行，之後的結果會被丟棄
+		o.err = ctx.Err()
+	}
+	if o.err == nil {
+		return o.result, nil
+	}
+	fail(span, o.err)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, &RPCError{Code: RPCTimeout, Message: "rpc timed out"}
+	case ctx.Err() != nil:
+		return nil, context.Canceled
+	}
+	return nil, o.err
+}
+
+// rpcReply 回送 rpc.result 或 rpc.error
+func (c *Client) rpcReply(id json.RawMessage, result any, err error) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	var b []byte
+	if err != nil {
+		var re *RPCError
+		if !errors.As(err, &re) {
+			re = &RPCError{Code: RPCInternalError, Message: err.Error()}
+		}
+		b = mustJSON(struct {
+			Type  string          `json:"type"`
+			ID    json.RawMessage `json:"id"`
+			Error *RPCError       `json:"error"`
+		}{"rpc.error", id, re})
+	} else {
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			c.rpcReply(id, nil, fmt.Errorf("encode result: %w", merr))
+			return
+		}
+		b = mustJSON(struct {
+			Type   string          `json:"type"`
+			ID     json.RawMessage `json:"id"`
+			Result json.RawMessage `json:"result"`
+		}{"rpc.result", id, data})
+	}
+	_ = c.hub.sendToClient(c, b)
+}
@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// BroadcastAt 在 t 時廣播 b（t 已過時立即送出）；回傳的 cancel 可在送出前取消。
+// Hub 關閉（Shutdown 或 Run 的 ctx 結束）時未送出的排程會自動取消
+func (h *Hub) BroadcastAt(t time.Time, b []byte) (cancel func()) {
+	timer := time.NewTimer(time.Until(t))
+	stop, cancel := h.schedule()
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			if !h.closing.Load() {
+				h.Broadcast(b)
+			}
+		case <-stop:
+		}
+	}()
+	return cancel
+}
+
+// BroadcastEvery 每隔 d 呼叫 fn 並廣播其結果（排行榜、行情快照等），fn 回傳 nil 時略過該次；
+// 直到呼叫 cancel 或 Hub 關閉。fn 依序執行，不會重疊
+func (h *Hub) BroadcastEvery(d time.Duration, fn func() []byte) (cancel func()) {
+	if d <= 0 {
+		h.opts.Logger.Warn("BroadcastEvery ignored: interval must be positive", "interval", d)
+		return func() {}
+	}
+	ticker := time.NewTicker(d)
+	stop, cancel := h.schedule()
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if h.closing.Load() {
+					return
+				}
+				if b := h.produce(fn); b != nil {
+					h.Broadcast(b)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// schedule 建立排程的停止訊號：呼叫 cancel 或 Hub 關閉時 stop 會關閉
+func (h *Hub) schedule() (stop <-chan struct{}, cancel func()) {
+	ch := make(chan struct{})
+	var once sync.Once
+	cancel = func() { once.Do(func() { close(ch) }) }
+	go func() {
+		select {
+		case <-h.quit:
+		case <-h.done:
+		case <-ch:
+		}
+		cancel()
+	}()
+	return ch, cancel
+}
+
+// produce 呼叫 BroadcastEvery 的 fn；panic 時記錄並略過該次
+func (h *Hub) produce(fn func() []byte) (b []byte) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.opts.Logger.Error("scheduled broadcast panic", "panic", p)
+			b = nil
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 序號協定（SequenceNumbers 開啟時）：
+//
+//   - 全域廣播的 JSON 物件帶 "seq"，每個 instance 從 1 開始遞增；房間廣播的序號每個房間各自計算，
+//     房間回收（RoomTTL）後重新從 1 開始。topic、ack 與非 JSON 物件的廣播不帶序號
+//   - drop-oldest 背壓丟掉 client 的訊息後，在下一則寫出的訊息之前送出
+//     {"type":"gap","data":{"dropped":N}}，表示這裡漏了 N 則訊息，client 應重新同步狀態。
+//     gap 通知與 session 訊息一樣不計入續接的序號
+
+// seqKey 廣播序號的欄位
+const seqKey = "seq"
+
+// sequencer 廣播序號；mu 同時確保編號順序與送進 shard 的順序一致
+type sequencer struct {
+	mu     sync.Mutex
+	global uint64
+	rooms  map[string]uint64
+}
+
+// sequenced 是否要為這則廣播編號
+func (m *broadcastMsg) sequenced() bool {
+	return !m.transient && m.topic == "" && m.out == nil && m.variants == nil && m.msgType == TextMessage
+}
+
+// stamp 在 JSON 物件開頭加上下一個序號（需持有 mu）；不是 JSON 物件或已有 seq 欄位時原樣回傳且不消耗序號
+func (q *sequencer) stamp(room string, b []byte) []byte {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return b
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &obj); err != nil {
+		return b
+	}
+	if _, ok := obj[seqKey]; ok {
+		return b
+	}
+	var seq uint64
+	if room == "" {
+		q.global++
+		seq = q.global
+	} else {
+		if q.rooms == nil {
+			q.rooms = make(map[string]uint64)
+		}
+		q.rooms[room]++
+		seq = q.rooms[room]
+	}
+	// 直接插入欄位，保留原本的欄位順序
+	out := make([]byte, 0, len(trimmed)+24)
+	out = append(out, `{"`+seqKey+`":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	if len(obj) > 0 {
+		out = append(out, ',')
+	}
+	return append(out, trimmed[1:]...)
+}
+
+// forget 刪除已回收房間的序號
+func (q *sequencer) forget(rooms []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, room := range rooms {
+		delete(q.rooms, room)
+	}
+}
+
+// sequence 為廣播編號並回傳釋放鎖的函式，呼叫端在送進所有 shard 後呼叫
+func (h *Hub) sequence(m *broadcastMsg) (unlock func()) {
+	h.seq.mu.Lock()
+	m.data = h.seq.stamp(m.room, m.data)
+	if m.room != "" {
+		// 沒有成員的房間也要在 RoomTTL 後回收序號
+		h.rooms.track(m.room, time.Now())
+	}
+	return h.seq.mu.Unlock
+}
+
+// takeGap 取出上次寫出後被丟棄的訊息數並組成 gap 通知；沒有丟棄時回傳 nil（由 write pump 呼叫）
+func (c *Client) takeGap() *outbound {
+	if c.gapPending.Load() == 0 {
+		return nil
+	}
+	n := c.gapPending.Swap(0)
+	b, _ := json.Marshal(Envelope{Type: "gap", Data: mustJSON(map[string]uint64{"dropped": n})})
+	m := newOutbound(TextMessage, b)
+	m.control = true
+	return m
+}
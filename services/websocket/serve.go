@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+// Serve 在 addr 提供 HTTP 服務（通常是 gin router），直到收到 SIGINT / SIGTERM；
+// 之後先 Hub.Shutdown 關閉 WebSocket，再 http.Server.Shutdown
+func Serve(addr string, hub *Hub, handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return ServeContext(ctx, &http.Server{Addr: addr, Handler: handler}, hub)
+}
+
+// ServeContext 與 Serve 相同，但由 ctx 決定何時開始關閉
+func ServeContext(ctx context.Context, srv *http.Server, hub *Hub) error {
+	return serve(ctx, srv, hub, srv.ListenAndServe)
+}
+
+// serve 以 listen 啟動 srv 與 extra（例如 HTTP→HTTPS 轉址），ctx 結束後依序關閉
+func serve(ctx context.Context, srv *http.Server, hub *Hub, listen func() error, extra ...*http.Server) error {
+	errc := make(chan error, 1+len(extra))
+	go func() {
+		hub.opts.Logger.Info("http server listening", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+		errc <- listen()
+	}()
+	for _, s := range extra {
+		go func() {
+			hub.opts.Logger.Info("http server listening", "addr", s.Addr)
+			errc <- s.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		// 啟動失敗（例如 port 被占用、憑證讀不到）
+		for _, s := range append(extra, srv) {
+			_ = s.Close()
+		}
+		return err
+	case <-ctx.Done():
+	}
+	hub.opts.Logger.Info("shutting down", "timeout", shutdownTimeout)
+
+	// 升級後的連線已被 hijack，http.Server.Shutdown 不會等它們，所以先關 Hub
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	hubErr := hub.Shutdown(shutdownCtx)
+	if hubErr != nil {
+		hub.opts.Logger.Warn("hub shutdown incomplete", "err", hubErr)
+	}
+	srvErr := srv.Shutdown(shutdownCtx)
+	for _, s := range extra {
+		srvErr = errors.Join(srvErr, s.Shutdown(shutdownCtx))
+	}
+	for range 1 + len(extra) {
+		if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) && srvErr == nil {
+			srvErr = err
+		}
+	}
+	return errors.Join(hubErr, srvErr)
+}
@@ -0,0 +1,399 @@
+package websocket
+
+import (
+	"context"
+	"crypto/subtle"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 預設斷線後保留 session 的時間
+const defaultResumeTTL = 2 * time.Minute
+
+// Session 續接協定（ResumeBuffer > 0 時啟用）：
+//
+//  1. 連線後 server 先送 {"type":"session","data":{"token":"...","seq":N,"resumed":false}}
+//  2. 之後每則送出的訊息序號依序為 N+1、N+2…；client 只需計算收到幾則（session 訊息本身不計）
+//  3. 斷線後以 /ws?resume=<token>&last_seq=<最後收到的序號> 重連；
+//     成功時 resumed 為 true，接著補送 last_seq 之後的訊息，房間與訂閱也會還原
+//  4. 超過 ResumeTTL 或缺的訊息已不在 buffer 內時 resumed 為 false，client 應以 seq 重設計數
+//  5. 有 SessionStore 時也可在其他 instance（或重啟後）續接，這時 token 會換新，client 應改用新的 token
+type session struct {
+	id     string
+	secret string
+
+	mu     sync.Mutex
+	owner  *Client     // 目前負責寫出的連線；nil 表示已斷線、等待續接
+	seq    uint64      // 最後一則訊息的序號
+	buf    []*outbound // 最近的訊息，最後一則的序號為 seq
+	max    int
+	state  *SessionState // 斷線時的房間、訂閱等，寫入 SessionStore 用（nil 表示尚未保存）
+	stored bool          // 已寫入 SessionStore
+
+	sync *sessionSync // 有 SessionStore 時記錄變動
+
+	// 以下僅由所屬 shard 存取（斷線時保存，續接時還原）
+	client  *Client // 最後一個連線，斷線期間用來執行 outbound interceptor
+	rooms   []string
+	topics  []string
+	filters map[string]*Filter
+	userID  string
+	expires time.Time
+}
+
+func newSession(id string, max int, sync *sessionSync) *session {
+	return &session{id: id, secret: newClientID(), max: max, sync: sync}
+}
+
+// restoreSession 以 SessionStore 內的狀態重建 session（在其他 instance 斷線、或重啟前保存的）。
+// secret 會換新，原 instance 留下的副本因此無法再續接
+func restoreSession(st SessionState, max int, sync *sessionSync) *session {
+	sess := newSession(st.ID, max, sync)
+	sess.seq = st.Seq
+	msgs := st.Messages
+	if len(msgs) > max {
+		msgs = msgs[len(msgs)-max:]
+	}
+	for _, m := range msgs {
+		out := newOutbound(m.MsgType, m.Data)
+		out.room, out.topic = m.Room, m.Topic
+		sess.buf = append(sess.buf, out)
+	}
+	sess.rooms, sess.topics, sess.userID = st.Rooms, st.Topics, st.UserID
+	for key, expr := range st.Filters {
+		if f, err := CompileFilter(expr); err == nil {
+			if sess.filters == nil {
+				sess.filters = make(map[string]*Filter)
+			}
+			sess.filters[key] = f
+		}
+	}
+	return sess
+}
+
+// token 格式為 "<client ID>.<secret>"，讓續接時可以找到原本的 shard
+func (s *session) token() string {
+	return s.id + "." + s.secret
+}
+
+// push 編上下一個序號並放入 buffer（需持有 mu）
+func (s *session) push(m *outbound) {
+	s.seq++
+	s.buf = append(s.buf, m)
+	if len(s.buf) > s.max {
+		s.buf = s.buf[len(s.buf)-s.max:]
+	}
+}
+
+// written 在 write pump 寫出前呼叫並回傳訊息的序號；ok 為 false 表示 c 已不是這個 session 的連線，不應寫出。
+// 斷線後仍在佇列內的訊息改記為未送達，續接時補送。
+func (s *session) written(c *Client, m *outbound) (seq uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case m.control:
+		return 0, s.owner == c
+	case s.owner == c:
+		s.push(m)
+		return s.seq, true
+	case s.owner == nil:
+		s.push(m)
+		s.sync.changed(s)
+	}
+	return 0, false
+}
+
+// missed 記錄斷線期間的訊息（在 shard 內呼叫）
+func (s *session) missed(m *outbound) {
+	s.mu.Lock()
+	s.push(m)
+	s.sync.changed(s)
+	s.mu.Unlock()
+}
+
+// detach 解除與 c 的綁定，並把 c 佇列內尚未寫出的訊息移入 buffer（在 shard 內、close(c.send) 前呼叫）；
+// c 已不是這個 session 的連線時回傳 false
+func (s *session) detach(c *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner != c {
+		return false
+	}
+	s.owner = nil
+	s.state = nil
+	for {
+		select {
+		case m := <-c.send:
+			if !m.control {
+				s.push(m)
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// attach 將 session 綁到 c；resume 時回傳 lastSeq 之後的訊息，
+// lastSeq 不在 buffer 範圍內則 resumed 為 false。seq 為 client 應使用的起始序號。
+func (s *session) attach(c *Client, lastSeq uint64, resume bool) (missed []*outbound, seq uint64, resumed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.owner = c
+	// 續接時已從 SessionStore 取走；沒有續接（或取用失敗）時由 sessionSync 刪除
+	s.stored = false
+	s.sync.changed(s)
+	oldest := s.seq - uint64(len(s.buf)) // buffer 內第一則的序號減一
+	if !resume || lastSeq > s.seq || lastSeq < oldest {
+		return nil, s.seq, false
+	}
+	// 補送的訊息交給新的 writePump 重新編號（序號不變）
+	keep := int(lastSeq - oldest)
+	missed = append([]*outbound(nil), s.buf[keep:]...)
+	s.buf = s.buf[:keep]
+	s.seq = lastSeq
+	return missed, lastSeq, true
+}
+
+// saveState 記錄斷線時的狀態，之後由 sessionSync 寫入 SessionStore（在 detach 之後呼叫）
+func (s *session) saveState(st SessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner == nil {
+		s.state = &st
+		s.sync.changed(s)
+	}
+}
+
+// snapshot 回傳要寫入 SessionStore 的狀態；update 表示之前已寫入過。
+// 已重新連線時 detached 為 false；st 為 nil 表示狀態尚未記錄
+func (s *session) snapshot() (st *SessionState, detached, update bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owner != nil {
+		return nil, false, false
+	}
+	if s.state == nil {
+		return nil, true, false
+	}
+	cp := *s.state
+	cp.Seq = s.seq
+	cp.Messages = make([]SessionMessage, len(s.buf))
+	for i, m := range s.buf {
+		cp.Messages[i] = SessionMessage{MsgType: m.msgType, Room: m.room, Topic: m.topic, Data: m.data}
+	}
+	return &cp, true, s.stored
+}
+
+// saved sessionSync 寫入成功後呼叫
+func (s *session) saved() {
+	s.mu.Lock()
+	if s.owner == nil && s.state != nil {
+		s.stored = true
+	}
+	s.mu.Unlock()
+}
+
+// stale 斷線中、已寫入 SessionStore，但 store 內已經沒有：已被其他 instance 續接或過期
+func (s *session) stale() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owner == nil && s.stored
+}
+
+// findSession 驗證續接 token（在 shard 內呼叫）；斷線中或仍在線（舊連線尚未偵測到斷線）的 session 都可續接
+func (s *shard) findSession(id, secret, userID string) *session {
+	sess, ok := s.sessions[id]
+	if !ok {
+		if c, live := s.byID[id]; live {
+			sess = c.session
+		}
+	}
+	if sess == nil || subtle.ConstantTimeCompare([]byte(sess.secret), []byte(secret)) != 1 {
+		return nil
+	}
+	// 有 Authenticate 時只能續接同一使用者的 session
+	if userID != "" && sess.userID != userID {
+		return nil
+	}
+	return sess
+}
+
+// resumeSession 驗證 ?resume= 的 token；成功時 client 沿用 session 原本的 ID
+func (h *Hub) resumeSession(token string, info ClientInfo) *session {
+	// 自訂的 client ID（NewID）可能含 "."，secret 是 hex，所以從最後一個切開
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return nil
+	}
+	id, secret := token[:i], token[i+1:]
+	if id == "" || secret == "" || (info.ID != "" && info.ID != id) {
+		return nil
+	}
+	var sess *session
+	s := h.shardFor(id)
+	s.call(func() { sess = s.findSession(id, secret, info.UserID) })
+	if h.sessionSync == nil {
+		return sess
+	}
+
+	// 有 SessionStore 時以 store 為準：取走後其他 instance 就不能再用同一個 token 續接
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+	st, err := h.sessionSync.store.TakeSession(ctx, token)
+	switch {
+	case err != nil:
+		h.opts.Logger.Warn("session store take failed", "session", id, "err", err)
+		return sess
+	case st == nil:
+		if sess != nil && sess.stale() {
+			h.dropSession(sess)
+			return nil
+		}
+		// 尚未寫入 store，或舊連線仍在線
+		return sess
+	case sess != nil:
+		// 本地的副本包含尚未寫入 store 的訊息
+		return sess
+	case st.ID != id || (info.UserID != "" && st.UserID != info.UserID):
+		return nil
+	}
+	return restoreSession(*st, h.opts.ResumeBuffer, h.sessionSync)
+}
+
+// dropSession 移除本地已失效的斷線中 session（不可在 shard 內呼叫）
+func (h *Hub) dropSession(sess *session) {
+	s := h.shardFor(sess.id)
+	s.call(func() {
+		if s.sessions[sess.id] == sess && sess.stale() {
+			delete(s.sessions, sess.id)
+		}
+	})
+}
+
+// detachSession 連線中斷時保存 session 等待續接（在 shard 內、remove 前呼叫）
+func (s *shard) detachSession(c *Client) {
+	sess := c.session
+	// 關閉中的 Hub 只有在有 SessionStore 時才保存（由其他 instance 或重啟後續接）
+	if sess == nil || (s.hub.closing.Load() && sess.sync == nil) || !sess.detach(c) {
+		return
+	}
+	sess.rooms = sess.rooms[:0]
+	for room := range c.rooms {
+		sess.rooms = append(sess.rooms, room)
+	}
+	sess.topics = sess.topics[:0]
+	for pattern := range c.topics {
+		sess.topics = append(sess.topics, pattern)
+	}
+	sess.filters = maps.Clone(c.filters)
+	sess.userID = c.userID
+	sess.client = c
+	sess.expires = time.Now().Add(s.hub.opts.ResumeTTL)
+	s.sessions[c.id] = sess
+	if sess.sync != nil {
+		sess.saveState(sess.storedState())
+	}
+}
+
+// storedState 斷線時要寫入 SessionStore 的狀態（在 shard 內呼叫）
+func (s *session) storedState() SessionState {
+	st := SessionState{
+		ID:      s.id,
+		Secret:  s.secret,
+		UserID:  s.userID,
+		Rooms:   slices.Clone(s.rooms),
+		Topics:  slices.Clone(s.topics),
+		Expires: s.expires,
+	}
+	for key, f := range s.filters {
+		if st.Filters == nil {
+			st.Filters = make(map[string]string, len(s.filters))
+		}
+		st.Filters[key] = f.String()
+	}
+	return st
+}
+
+// attachSession 新連線註冊時綁定 session、送出 session 訊息並補送（在 shard 內呼叫）；
+// old 為註冊前使用相同 ID 的連線（可為 nil）
+func (s *shard) attachSession(c, old *Client) {
+	sess := c.session
+	// 舊連線還在（尚未偵測到斷線）時先保存其狀態再關閉
+	if old != nil && old != c && old.session == sess && s.clients[old] {
+		s.detachSession(old)
+		s.closeClient(old, CloseNormalClosure, "session resumed")
+	}
+	delete(s.sessions, c.id)
+
+	missed, seq, resumed := sess.attach(c, c.lastSeq, c.resuming)
+	if c.resuming {
+		for _, room := range sess.rooms {
+			s.addMember(c, room)
+		}
+		for _, pattern := range sess.topics {
+			s.subscribe(c, pattern)
+		}
+		for key, f := range sess.filters {
+			s.setFilter(c, key, f)
+		}
+	}
+	frame := mustJSON(map[string]any{
+		"type": "session",
+		"data": map[string]any{"token": sess.token(), "seq": seq, "resumed": resumed},
+	})
+	s.deliver(c, &outbound{msgType: TextMessage, data: frame, control: true})
+	// buffer 內的訊息已經過 outbound interceptor
+	for _, m := range missed {
+		s.enqueue(c, m)
+	}
+	if !resumed {
+		s.replay(c, "")
+	}
+}
+
+// bufferDetached 將廣播記到符合條件的斷線中 session（在 shard 內呼叫）
+func (s *shard) bufferDetached(m broadcastMsg, doc *filterDoc) {
+	for _, sess := range s.sessions {
+		if !sessionWants(sess, m, doc) {
+			continue
+		}
+		// 與即時投遞相同，依斷線前協商的 codec 選擇版本
+		if out := s.hub.intercept(sess.client, m.outFor(sess.client)); out != nil {
+			sess.missed(out)
+		}
+	}
+}
+
+func sessionWants(sess *session, m broadcastMsg, doc *filterDoc) bool {
+	switch {
+	case m.transient:
+		return false
+	case m.topic != "":
+		for _, pattern := range sess.topics {
+			if matchTopic(pattern, m.topic) && doc.allows(sess.filters[pattern]) {
+				return true
+			}
+		}
+		return false
+	case m.room != "":
+		for _, room := range sess.rooms {
+			if room == m.room {
+				return doc.allows(sess.filters[""])
+			}
+		}
+		return false
+	}
+	return doc.allows(sess.filters[""])
+}
+
+// expireSessions 清掉超過 ResumeTTL 的 session（在 shard 內呼叫）
+func (s *shard) expireSessions(now time.Time) {
+	for id, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
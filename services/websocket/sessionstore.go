@@ -0,0 +1,312 @@
+package websocket
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionState 斷線中 session 可保存的狀態（SessionStore 的內容）
+type SessionState struct {
+	ID       string            `json:"id"`
+	Secret   string            `json:"secret"`
+	UserID   string            `json:"user_id,omitempty"`
+	Seq      uint64            `json:"seq"`                // 最後一則訊息的序號
+	Messages []SessionMessage  `json:"messages,omitempty"` // 最近的訊息，最後一則的序號為 Seq
+	Rooms    []string          `json:"rooms,omitempty"`
+	Topics   []string          `json:"topics,omitempty"`
+	Filters  map[string]string `json:"filters,omitempty"` // topic pattern（"" 為 SetFilter）→ 表達式
+	Expires  time.Time         `json:"expires"`
+}
+
+// Token 續接用的 token（與 session 訊息內的相同）
+func (s SessionState) Token() string {
+	return s.ID + "." + s.Secret
+}
+
+// SessionMessage session buffer 內的一則訊息（已經過 outbound interceptor）
+type SessionMessage struct {
+	MsgType int    `json:"type"`
+	Room    string `json:"room,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Data    []byte `json:"data"`
+}
+
+// UserConnection 使用者的一個連線
+type UserConnection struct {
+	ClientID string    `json:"client_id"`
+	Instance string    `json:"instance"` // 所在 Hub 的 ID
+	Since    time.Time `json:"since"`
+}
+
+// SessionStore 續接 session 與使用者連線的共用儲存（可選），讓 client 重啟後或連到其他 instance 時仍能續接。
+// 未設定時這些狀態只在本 instance 的記憶體內（預設）；NewMemorySessionStore 可讓同一程序內的多個 Hub 共用。
+// Hub 在背景依序寫入，不會阻塞事件迴圈；只有續接時的 TakeSession 在升級請求內同步呼叫
+type SessionStore interface {
+	// SaveSession 保存斷線中的 session，到 Expires 後失效；update 為 true 時只覆寫仍存在的項目，
+	// 已被取走或過期時回傳 false
+	SaveSession(ctx context.Context, s SessionState, update bool) (bool, error)
+	// TakeSession 取出並刪除 token 對應的 session；不存在時回傳 nil, nil
+	TakeSession(ctx context.Context, token string) (*SessionState, error)
+	DeleteSession(ctx context.Context, token string) error
+
+	AddConnection(ctx context.Context, userID string, conn UserConnection) error
+	RemoveConnection(ctx context.Context, userID, clientID string) error
+	UserConnections(ctx context.Context, userID string) ([]UserConnection, error)
+}
+
+const (
+	// sessionStoreTimeout 單次存取 SessionStore 的期限
+	sessionStoreTimeout = 5 * time.Second
+	// sessionStoreQueue 待寫入的使用者連線變動上限，超過時丟棄並記 log
+	sessionStoreQueue = 4096
+)
+
+// sessionSync 在背景把 session 與使用者連線的變動寫入 SessionStore；nil 表示未設定。
+// 同一個 session 的多次變動合併成一次寫入（寫入當下的完整狀態）
+type sessionSync struct {
+	store   SessionStore
+	mu      sync.Mutex
+	dirty   map[*session]bool
+	ops     []func(ctx context.Context) error
+	dropped bool
+	wake    chan struct{}
+	stopped chan struct{}
+}
+
+func newSessionSync(store SessionStore) *sessionSync {
+	if store == nil {
+		return nil
+	}
+	return &sessionSync{
+		store:   store,
+		dirty:   make(map[*session]bool),
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// changed 標記 session 需要重新寫入（可在任何 goroutine 呼叫，不阻塞）
+func (w *sessionSync) changed(sess *session) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.dirty[sess] = true
+	w.mu.Unlock()
+	w.signal()
+}
+
+// queue 排入一個使用者連線的變動（在 shard 內呼叫，不阻塞）
+func (w *sessionSync) queue(h *Hub, op func(ctx context.Context) error) {
+	w.mu.Lock()
+	if len(w.ops) >= sessionStoreQueue {
+		dropped := w.dropped
+		w.dropped = true
+		w.mu.Unlock()
+		if !dropped {
+			h.opts.Logger.Warn("session store queue full, connection updates dropped", "queue", sessionStoreQueue)
+		}
+		return
+	}
+	w.ops = append(w.ops, op)
+	w.dropped = false
+	w.mu.Unlock()
+	w.signal()
+}
+
+func (w *sessionSync) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run 寫入變動直到 done 關閉；關閉後再寫一次，讓 Shutdown 時保存的 session 也寫進去
+func (w *sessionSync) run(h *Hub) {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.wake:
+			w.flush(h)
+		case <-h.done:
+			w.flush(h)
+			return
+		}
+	}
+}
+
+func (w *sessionSync) flush(h *Hub) {
+	for {
+		w.mu.Lock()
+		dirty, ops := w.dirty, w.ops
+		if len(dirty) == 0 && len(ops) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		w.dirty, w.ops = make(map[*session]bool), nil
+		w.mu.Unlock()
+
+		for _, op := range ops {
+			ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+			if err := op(ctx); err != nil {
+				h.opts.Logger.Warn("session store update failed", "err", err)
+			}
+			cancel()
+		}
+		for sess := range dirty {
+			w.write(h, sess)
+		}
+	}
+}
+
+// write 依 session 目前的狀態保存或刪除
+func (w *sessionSync) write(h *Hub, sess *session) {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+	st, detached, update := sess.snapshot()
+	switch {
+	case !detached:
+		// 已由本 instance 續接：store 內的舊狀態不應再被取走
+		if err := w.store.DeleteSession(ctx, sess.token()); err != nil {
+			h.opts.Logger.Warn("session store delete failed", "session", sess.id, "err", err)
+		}
+	case st == nil || time.Now().After(st.Expires):
+		// 還在斷線處理中（之後會再標記一次），或已過期（store 會自行清掉）
+	default:
+		ok, err := w.store.SaveSession(ctx, *st, update)
+		switch {
+		case err != nil:
+			h.opts.Logger.Warn("session store save failed", "session", sess.id, "err", err)
+		case ok:
+			sess.saved()
+		case update:
+			// 已被其他 instance 續接（或過期）：本地的副本不再有效
+			h.dropSession(sess)
+		}
+	}
+}
+
+// addConnection / removeConnection 在 shard 內呼叫
+func (h *Hub) addConnection(c *Client, userID string) {
+	if w := h.sessionSync; w != nil {
+		conn := UserConnection{ClientID: c.id, Instance: h.id, Since: c.joinedAt}
+		w.queue(h, func(ctx context.Context) error { return w.store.AddConnection(ctx, userID, conn) })
+	}
+}
+
+func (h *Hub) removeConnection(c *Client, userID string) {
+	if w := h.sessionSync; w != nil {
+		w.queue(h, func(ctx context.Context) error { return w.store.RemoveConnection(ctx, userID, c.id) })
+	}
+}
+
+// UserConnections 回傳使用者目前的連線（依連線時間排序）；有 SessionStore 時包含所有 instance 的連線，
+// 但寫入是在背景進行，剛連上或剛斷線的連線可能稍後才反映
+func (h *Hub) UserConnections(ctx context.Context, userID string) ([]UserConnection, error) {
+	var conns []UserConnection
+	if h.sessionSync != nil {
+		var err error
+		if conns, err = h.sessionSync.store.UserConnections(ctx, userID); err != nil {
+			return nil, err
+		}
+	} else {
+		if !h.callAll(func(s *shard) {
+			for c := range s.users[userID] {
+				conns = append(conns, UserConnection{ClientID: c.id, Instance: h.id, Since: c.joinedAt})
+			}
+		}) {
+			return nil, ErrHubClosed
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].Since.Before(conns[j].Since) })
+	return conns, nil
+}
+
+// MemorySessionStore 以記憶體實作 SessionStore，適合單一程序內多個 Hub 共用或測試
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]SessionState
+	users    map[string]map[string]UserConnection
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]SessionState),
+		users:    make(map[string]map[string]UserConnection),
+	}
+}
+
+func (m *MemorySessionStore) SaveSession(_ context.Context, s SessionState, update bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	token := s.Token()
+	if old, ok := m.sessions[token]; update && (!ok || now.After(old.Expires)) {
+		delete(m.sessions, token)
+		return false, nil
+	}
+	if !update {
+		// 新增時順便清掉過期的項目
+		for k, old := range m.sessions {
+			if now.After(old.Expires) {
+				delete(m.sessions, k)
+			}
+		}
+	}
+	m.sessions[token] = s
+	return true, nil
+}
+
+func (m *MemorySessionStore) TakeSession(_ context.Context, token string) (*SessionState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[token]
+	delete(m.sessions, token)
+	if !ok || time.Now().After(s.Expires) {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (m *MemorySessionStore) DeleteSession(_ context.Context, token string) error {
+	m.mu.Lock()
+	delete(m.sessions, token)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySessionStore) AddConnection(_ context.Context, userID string, conn UserConnection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conns, ok := m.users[userID]
+	if !ok {
+		conns = make(map[string]UserConnection)
+		m.users[userID] = conns
+	}
+	conns[conn.ClientID] = conn
+	return nil
+}
+
+func (m *MemorySessionStore) RemoveConnection(_ context.Context, userID, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if conns := m.users[userID]; conns != nil {
+		delete(conns, clientID)
+		if len(conns) == 0 {
+			delete(m.users, userID)
+		}
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) UserConnections(_ context.Context, userID string) ([]UserConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]UserConnection, 0, len(m.users[userID]))
+	for _, conn := range m.users[userID] {
+		out = append(out, conn)
+	}
+	return out, nil
+}
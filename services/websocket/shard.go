@@ -0,0 +1,276 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shard 擁有一部分 client 及其房間、使用者與歷史狀態，只由自己的事件迴圈存取
+type shard struct {
+	hub *Hub
+
+	clients map[*Client]bool
+	byID    map[string]*Client
+	users   map[string]map[*Client]bool
+	rooms   map[string]map[*Client]bool
+	topics  topicNode
+
+	// 同步中的狀態（見 statesync.go），以狀態名稱為 key；第一次 sync 時建立
+	stateSubs map[string]map[*Client]bool
+
+	// 斷線中、等待續接的 session（ResumeBuffer > 0 時），以 client ID 為 key
+	sessions map[string]*session
+
+	// 最近的廣播（HistorySize > 0 時）；每個 shard 都收到全部廣播，所以各自保有完整歷史
+	history     *history
+	roomHistory map[string]*history
+
+	broadcast     chan broadcastMsg
+	roomBroadcast chan broadcastMsg
+	register      chan *Client
+	unregister    chan *Client
+	join          chan roomReq
+	leave         chan roomReq
+	direct        chan directMsg
+	calls         chan func()
+
+	scratch []*Client // parallelFanout 重複使用的對象清單
+
+	done     chan struct{}   // run 結束後關閉
+	draining []chan struct{} // 關閉時仍在線的 client write pump（run 結束前寫入）
+}
+
+func newShard(h *Hub) *shard {
+	s := &shard{
+		hub:           h,
+		clients:       make(map[*Client]bool),
+		byID:          make(map[string]*Client),
+		users:         make(map[string]map[*Client]bool),
+		rooms:         make(map[string]map[*Client]bool),
+		sessions:      make(map[string]*session),
+		broadcast:     make(chan broadcastMsg, 256),
+		roomBroadcast: make(chan broadcastMsg, 256),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		join:          make(chan roomReq),
+		leave:         make(chan roomReq),
+		direct:        make(chan directMsg),
+		calls:         make(chan func()),
+		done:          make(chan struct{}),
+	}
+	if h.opts.HistorySize > 0 {
+		s.history = newHistory(h.opts.HistorySize)
+		s.roomHistory = make(map[string]*history)
+	}
+	return s
+}
+
+func (s *shard) run(ctx context.Context) {
+	defer close(s.done)
+	var expire <-chan time.Time
+	if s.hub.opts.ResumeBuffer > 0 {
+		t := time.NewTicker(s.hub.opts.ResumeTTL / 2)
+		defer t.Stop()
+		expire = t.C
+	}
+	var idle <-chan time.Time
+	if s.hub.opts.IdleTimeout > 0 {
+		t := time.NewTicker(s.hub.opts.idleCheckPeriod())
+		defer t.Stop()
+		idle = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			s.hub.closing.Store(true)
+			s.closeAll()
+			return
+		case <-s.hub.quit:
+			s.closeAll()
+			return
+		case c := <-s.register:
+			old := s.byID[c.id]
+			s.clients[c] = true
+			s.hub.stats.connections.Add(1)
+			// 相同 ID（例如由 Authenticate 指定）以最新連線為準
+			s.byID[c.id] = c
+			s.bindUser(c, c.info.UserID)
+			if c.session != nil {
+				s.attachSession(c, old)
+			} else {
+				s.replay(c, "")
+			}
+			s.hub.presenceEvent("join", c)
+		case c := <-s.unregister:
+			if s.clients[c] {
+				s.detachSession(c)
+				s.remove(c)
+			}
+		case r := <-s.join:
+			s.joinRoom(r.client, r.room)
+		case r := <-s.leave:
+			s.leaveRoom(r.client, r.room)
+		case m := <-s.direct:
+			c := m.client
+			if c == nil {
+				c = s.byID[m.id]
+			}
+			if sess, ok := s.sessions[m.id]; c == nil && ok {
+				out, err := s.directOutbound(sess.client, m)
+				if out != nil {
+					if out = s.hub.intercept(sess.client, out); out != nil {
+						sess.missed(out)
+					}
+				}
+				m.result <- err
+			} else if c == nil || !s.clients[c] {
+				m.result <- ErrClientNotFound
+			} else {
+				out, err := s.directOutbound(c, m)
+				if out != nil {
+					s.deliver(c, out)
+				}
+				m.result <- err
+			}
+		case m := <-s.roomBroadcast:
+			s.fanout(s.rooms[m.room], m)
+		case m := <-s.broadcast:
+			if m.topic != "" {
+				s.fanout(s.subscribers(m.topic), m)
+			} else {
+				s.fanout(s.clients, m)
+			}
+		case fn := <-s.calls:
+			fn()
+		case now := <-expire:
+			s.expireSessions(now)
+		case now := <-idle:
+			s.checkIdle(now)
+		}
+	}
+}
+
+// call 在 shard 的事件迴圈內執行 fn 並等待完成；已關閉時回傳 false
+func (s *shard) call(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case s.calls <- func() { fn(); close(done) }:
+		<-done
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// callAll 依序在每個 shard 內執行 fn；Hub 已關閉時回傳 false
+func (h *Hub) callAll(fn func(s *shard)) bool {
+	for _, s := range h.shards {
+		if !s.call(func() { fn(s) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendDirect 交給事件迴圈投遞單一 client，並等待結果
+func (s *shard) sendDirect(m directMsg) error {
+	m.result = make(chan error, 1)
+	select {
+	case s.direct <- m:
+		return <-m.result
+	case <-s.done:
+		return ErrHubClosed
+	}
+}
+
+// directOutbound 建立指定對象的訊息，seal 時以 c 的金鑰加密（僅在 run 內呼叫）
+func (s *shard) directOutbound(c *Client, m directMsg) (*outbound, error) {
+	data := m.data
+	if m.seal {
+		var err error
+		if data, err = s.hub.sealFor(c, m.msgType, data); err != nil {
+			return nil, err
+		}
+	}
+	out := newOutbound(m.msgType, data)
+	out.writeWait = m.writeWait
+	return out, nil
+}
+
+// closeAll 關閉所有 client，並記下其 write pump 供 Shutdown 等待（僅在 run 內呼叫）
+func (s *shard) closeAll() {
+	for c := range s.clients {
+		s.draining = append(s.draining, c.pumpDone)
+		s.detachSession(c)
+		s.closeClient(c, websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// fanout 投遞給 targets 並記錄歷史（僅在 run 內呼叫）
+func (s *shard) fanout(targets map[*Client]bool, m broadcastMsg) {
+	doc := &filterDoc{data: m.data}
+	if s.hub.fanout != nil && len(targets) >= minParallelFanout {
+		s.parallelFanout(targets, m, doc)
+	} else {
+		for c := range targets {
+			if c != m.except && c.accepts(&m, doc) {
+				m.tally.count(s.deliver(c, m.outFor(c)))
+			}
+		}
+	}
+	if !m.transient && m.topic == "" {
+		s.record(m.room, m.out)
+	}
+	if len(s.sessions) > 0 {
+		s.bufferDetached(m, doc)
+	}
+	m.tally.finish()
+}
+
+// deliver 經 outbound interceptor 後放入 client 佇列，回傳是否放入（僅在 run 內呼叫）
+func (s *shard) deliver(c *Client, msg *outbound) bool {
+	if msg = s.hub.intercept(c, msg); msg != nil {
+		return s.enqueue(c, msg)
+	}
+	return false
+}
+
+// enqueue 將已處理過的訊息放入 client 佇列，回傳是否放入（僅在 run 內呼叫）
+func (s *shard) enqueue(c *Client, msg *outbound) bool {
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		// 背壓：依 SlowClient 策略處理（預設丟掉最舊一筆，仍滿則斷線）
+		return s.deliverSlow(c, msg)
+	}
+}
+
+// remove 移除 client 並清理房間（僅在 run 內呼叫）
+func (s *shard) remove(c *Client) {
+	s.hub.presenceEvent("leave", c)
+	for room := range c.rooms {
+		s.leaveRoom(c, room)
+	}
+	for pattern := range c.topics {
+		s.unsubscribe(c, pattern)
+	}
+	s.unsyncAll(c)
+	s.unbindUser(c)
+	s.hub.logins.release(c)
+	delete(s.clients, c)
+	s.hub.stats.connections.Add(-1)
+	if s.byID[c.id] == c {
+		delete(s.byID, c.id)
+	}
+	close(c.send)
+}
+
+// closeClient 送出指定的 close frame 後移除 client（僅在 run 內呼叫）
+func (s *shard) closeClient(c *Client, code int, text string) {
+	c.closeFrame = websocket.FormatCloseMessage(code, text)
+	c.recordClose(code, text, true)
+	s.remove(c)
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrHubClosed Hub 已關閉
+var ErrHubClosed = errors.New("websocket: hub closed")
+
+// Shutdown 停止接受新連線，對所有 client 送出 1001 close frame，
+// 並等待 write pump 送完佇列（以 ctx 為上限）。
+// 升級後的連線已被 hijack，http.Server.Shutdown 不會等它們，所以應先呼叫本方法。
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.closing.Store(true)
+	h.quitOnce.Do(func() { close(h.quit) })
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, s := range h.shards {
+		for _, pumpDone := range s.draining {
+			select {
+			case <-pumpDone:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	if w := h.sessionSync; w != nil {
+		select {
+		case <-w.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// write pump 結束前記入 session 的訊息
+		w.flush(h)
+	}
+
+	if w := h.messageLog; w != nil {
+		// 稽核紀錄：等佇列內的廣播寫完
+		select {
+		case <-w.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if h.backplane != nil {
+		return h.backplane.Close()
+	}
+	return nil
+}
+
+// Disconnect 以指定的 close code / reason 強制斷開某個 client；
+// code 或 reason 無法放進 close frame 時回傳 ErrInvalidCloseFrame，不斷線
+func (h *Hub) Disconnect(clientID string, code int, reason string) error {
+	if err := validCloseFrame(code, reason); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCloseFrame, err)
+	}
+	err := ErrClientNotFound
+	s := h.shardFor(clientID)
+	if !s.call(func() {
+		if c, ok := s.byID[clientID]; ok {
+			s.closeClient(c, code, reason)
+			err = nil
+		}
+	}) {
+		return ErrHubClosed
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package websocket
+
+import "time"
+
+// SlowClientPolicy 決定 client 佇列已滿（SendCap）時的處理方式；零值等同 DropOldest
+type SlowClientPolicy struct {
+	kind    slowKind
+	timeout time.Duration
+}
+
+type slowKind int
+
+const (
+	slowDropOldest slowKind = iota
+	slowDropNewest
+	slowDisconnect
+	slowBlock
+)
+
+var (
+	// DropOldest 丟掉佇列中最舊的一筆再放入；仍放不進則斷線（預設）
+	DropOldest = SlowClientPolicy{kind: slowDropOldest}
+	// DropNewest 丟掉這一筆新訊息，連線保留
+	DropNewest = SlowClientPolicy{kind: slowDropNewest}
+	// DisconnectImmediately 佇列一滿就斷線
+	DisconnectImmediately = SlowClientPolicy{kind: slowDisconnect}
+)
+
+// BlockWithTimeout 最多等待 d 讓佇列騰出空間，逾時則斷線。
+// 等待期間該 client 所屬 shard 的事件迴圈會停住，d 應保持很小。
+func BlockWithTimeout(d time.Duration) SlowClientPolicy {
+	return SlowClientPolicy{kind: slowBlock, timeout: d}
+}
+
+// DropReason 訊息被丟棄的原因
+type DropReason string
+
+const (
+	DropReasonOldest     DropReason = "drop_oldest" // 為了放新訊息丟掉的舊訊息
+	DropReasonNewest     DropReason = "drop_newest"
+	DropReasonDisconnect DropReason = "disconnect" // client 因過慢被斷線
+	DropReasonTimeout    DropReason = "timeout"    // BlockWithTimeout 逾時後斷線
+)
+
+// Dropped 回傳累計因背壓丟棄的訊息數
+func (h *Hub) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+// drop 記錄一次丟棄、呼叫 OnDrop、交給 dead-letter 佇列並送出 MessageDropped（在 shard 內呼叫）
+func (h *Hub) drop(c *Client, msg *outbound, reason DropReason) {
+	h.dropped.Add(1)
+	c.dropped.Add(1)
+	h.opts.Logger.Warn("message dropped", c.logAttrs("room", msg.room, "reason", string(reason))...)
+	if h.opts.OnDrop != nil {
+		h.opts.OnDrop(c, reason)
+	}
+	h.deadLetter(c, msg, reason)
+	h.emit(MessageDropped{Time: time.Now(), Client: c, Room: msg.room, Topic: msg.topic, Reason: reason})
+}
+
+// countSlow 累計 DropOldest 的次數，window 內達到門檻時呼叫 OnSlowClient（在 shard 內呼叫）
+func (h *Hub) countSlow(c *Client) {
+	fn := h.opts.OnSlowClient
+	if fn == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(c.slowSince) > h.opts.SlowClientWindow {
+		c.slowSince, c.slowDrops = now, 0
+	}
+	c.slowDrops++
+	if c.slowDrops < h.opts.SlowClientDrops {
+		return
+	}
+	dropped := c.slowDrops
+	c.slowSince, c.slowDrops = now, 0
+	h.opts.Logger.Warn("slow client", c.logAttrs("dropped", dropped)...)
+	go c.safely("OnSlowClient", func() { fn(c, dropped) })
+}
+
+// closeSlow 以 SlowCloseCode / SlowCloseReason 斷開慢的 client（僅在 shard 內呼叫）
+func (s *shard) closeSlow(c *Client) {
+	o := &s.hub.opts
+	s.closeClient(c, o.SlowCloseCode, o.SlowCloseReason)
+}
+
+// deliverSlow client 佇列已滿時依 SlowClient 策略處理，回傳 msg 是否放入佇列（僅在 shard 內呼叫）
+func (s *shard) deliverSlow(c *Client, msg *outbound) bool {
+	h := s.hub
+	switch p := h.opts.SlowClient; p.kind {
+	case slowDropNewest:
+		h.drop(c, msg, DropReasonNewest)
+	case slowDisconnect:
+		h.drop(c, msg, DropReasonDisconnect)
+		s.closeSlow(c)
+	case slowBlock:
+		t := time.NewTimer(p.timeout)
+		defer t.Stop()
+		select {
+		case c.send <- msg:
+			return true
+		case <-t.C:
+			h.drop(c, msg, DropReasonTimeout)
+			s.closeSlow(c)
+		}
+	default:
+		select {
+		case old := <-c.send:
+			h.drop(c, old, DropReasonOldest)
+			if h.opts.SequenceNumbers {
+				c.gapPending.Add(1)
+			}
+			h.countSlow(c)
+		default:
+		}
+		select {
+		case c.send <- msg:
+			return true
+		default:
+			h.drop(c, msg, DropReasonDisconnect)
+			s.closeSlow(c)
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// slowModes 房間的 slow mode：每個使用者（沒有 UserID 時為每條連線）在同一房間每 interval 只能發佈一則
+// {"type":"publish","room":"x",...}。只在本 instance 計算，多個 instance 時各自限制
+type slowModes struct {
+	mu        sync.Mutex
+	intervals map[string]time.Duration        // SetSlowMode 設定的房間（0 表示關閉，優先於 Options.SlowMode）
+	last      map[string]map[string]time.Time // 房間 → 發佈者 → 最後一次發佈的時間
+}
+
+// SetSlowMode 設定房間的 slow mode（可在 OnRoomCreated 或任何時候呼叫）；0 表示關閉，
+// 覆蓋 Options.SlowMode 的預設。房間清空超過 RoomTTL 回收後設定隨之清除
+func (h *Hub) SetSlowMode(room string, interval time.Duration) {
+	if interval < 0 {
+		interval = 0
+	}
+	sm := &h.slowMode
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.intervals == nil {
+		sm.intervals = make(map[string]time.Duration)
+	}
+	sm.intervals[room] = interval
+}
+
+// SlowMode 回傳房間目前的 slow mode 間隔（0 表示沒有限制）
+func (h *Hub) SlowMode(room string) time.Duration {
+	sm := &h.slowMode
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return h.slowModeLocked(room)
+}
+
+func (h *Hub) slowModeLocked(room string) time.Duration {
+	if d, ok := h.slowMode.intervals[room]; ok {
+		return d
+	}
+	if h.opts.SlowMode != nil {
+		return max(h.opts.SlowMode(room), 0)
+	}
+	return 0
+}
+
+// allowSlowMode 記錄一次發佈；還在間隔內時回傳需要再等多久（在 readPump 內呼叫）
+func (c *Client) allowSlowMode(room string, now time.Time) (wait time.Duration, ok bool) {
+	h := c.hub
+	sm := &h.slowMode
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	interval := h.slowModeLocked(room)
+	if interval <= 0 {
+		return 0, true
+	}
+	key := c.info.UserID
+	if key == "" {
+		key = "client:" + c.id
+	}
+	if last, ok := sm.last[room][key]; ok && now.Sub(last) < interval {
+		return interval - now.Sub(last), false
+	}
+	if sm.last == nil {
+		sm.last = make(map[string]map[string]time.Time)
+	}
+	posters, ok := sm.last[room]
+	if !ok {
+		posters = make(map[string]time.Time)
+		sm.last[room] = posters
+	}
+	posters[key] = now
+	return 0, true
+}
+
+// pruneSlowMode 清掉已超過間隔的發佈紀錄，並忘記已回收房間的設定（由 collectRooms 呼叫）
+func (h *Hub) pruneSlowMode(now time.Time, expired []string) {
+	sm := &h.slowMode
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for _, room := range expired {
+		delete(sm.intervals, room)
+		delete(sm.last, room)
+	}
+	for room, posters := range sm.last {
+		interval := h.slowModeLocked(room)
+		for key, at := range posters {
+			if now.Sub(at) >= interval {
+				delete(posters, key)
+			}
+		}
+		if len(posters) == 0 {
+			delete(sm.last, room)
+		}
+	}
+}
+
+// slowModeError 回覆發佈太快的 client：{"type":"error","data":{"error":"rate limited","room":"x","retryAfterMs":4200}}
+func slowModeError(room string, wait time.Duration) []byte {
+	return mustJSON(map[string]any{"type": "error", "data": map[string]any{
+		"error": "rate limited", "room": room, "retryAfterMs": max(1, wait.Milliseconds()),
+	}})
+}
@@ -0,0 +1,330 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Socket.IO 相容端點（Engine.IO v4 / Socket.IO v5，socket.io-client 3.x 以上）：
+//
+//   - 只支援 WebSocket transport，client 需設定 io(url, {transports: ["websocket"]})；
+//     long-polling 的請求回 400 {"code":0,"message":"Transport unknown"}
+//   - 只有預設的 namespace "/"；CONNECT 帶的 auth 交給 SocketIOConfig.Authenticate
+//   - client 的 emit(event, arg) 轉成 {"type":event,"data":arg}（多個參數時 data 為陣列），
+//     與一般 client 的訊息走相同流程（middleware、Handle、RPC、廣播）；帶 callback 時處理後回空的 ack
+//   - emit("join", room) / emit("leave", room) 加入、離開房間；emit("subscribe", topic) / "unsubscribe" 訂閱 topic
+//   - 送往 client 的 {"type":T,"data":D} 變成事件 T（參數 D，沒有 data 時不帶參數），
+//     其他訊息以 "message" 事件送出；binary 訊息以帶一個 attachment 的 binary event 送出
+//   - client 送來的 binary event 不支援，會略過
+//   - 心跳由 server 送 Engine.IO ping（間隔 PingPeriod），PongWait 內沒有 pong 視為斷線
+
+// Engine.IO 封包類型
+const (
+	eioOpen    = '0'
+	eioClose   = '1'
+	eioPing    = '2'
+	eioPong    = '3'
+	eioMessage = '4'
+)
+
+// Socket.IO 封包類型
+const (
+	sioConnect      = 0
+	sioDisconnect   = 1
+	sioEvent        = 2
+	sioAck          = 3
+	sioConnectError = 4
+	sioBinaryEvent  = 5
+	sioBinaryAck    = 6
+)
+
+// socketIOEventDefault 不是 envelope 的訊息使用的事件名稱
+const socketIOEventDefault = "message"
+
+var errSocketIOPacket = errors.New("websocket: invalid socket.io packet")
+
+// SocketIOConfig Socket.IO 相容端點的設定（協定見 socketio.go）
+type SocketIOConfig struct {
+	// Authenticate 檢查 CONNECT 帶的 auth（client 端的 io(url, {auth: {...}})，沒有時為 nil）；
+	// 回傳 error 時回 CONNECT_ERROR 並斷線。nil 表示不檢查（仍可用 Options.Authenticate 在升級前驗證）
+	Authenticate func(c *Client, auth json.RawMessage) error
+}
+
+// socketIOConn Socket.IO client 的協定狀態（僅由 readPump 存取）
+type socketIOConn struct {
+	cfg       *SocketIOConfig
+	connected bool
+	skip      int // 要略過的 binary attachment 數
+}
+
+// socketIOPacket 解析後的 Socket.IO 封包
+type socketIOPacket struct {
+	typ         int
+	attachments int
+	nsp         string
+	id          int64 // 沒有 ack id 時為 -1
+	data        []byte
+}
+
+// ServeSocketIO Socket.IO client 連線的端點，掛在 client 的 path（預設 "/socket.io/"），
+// 例如 r.GET("/socket.io/", ServeSocketIO(hub))
+func ServeSocketIO(h *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("EIO") != "4" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": 5, "message": "Unsupported protocol version"})
+			return
+		}
+		if c.Query("transport") != "websocket" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": 0, "message": "Transport unknown"})
+			return
+		}
+		h.serveWs(c, "websocket.ServeSocketIO", h.adaptSocketIO)
+	}
+}
+
+// adaptSocketIO 升級後、註冊前送出 Engine.IO 的 open 封包（此時還沒有 writePump，可直接寫出）
+func (h *Hub) adaptSocketIO(cl *Client) error {
+	cfg := h.opts.SocketIO
+	if cfg == nil {
+		cfg = &SocketIOConfig{}
+	}
+	cl.sio = &socketIOConn{cfg: cfg}
+	cl.packets = make(chan *outbound, protocolPacketQueue)
+	// Socket.IO client 有自己的重連機制，不使用續接
+	cl.session, cl.resuming = nil, false
+	open, _ := json.Marshal(map[string]any{
+		"sid":          cl.id,
+		"upgrades":     []string{},
+		"pingInterval": h.opts.PingPeriod.Milliseconds(),
+		"pingTimeout":  (h.opts.PongWait - h.opts.PingPeriod).Milliseconds(),
+		"maxPayload":   h.opts.MaxMessageSize,
+	})
+	_ = cl.conn.SetWriteDeadline(cl.controlDeadline())
+	return cl.conn.WriteMessage(websocket.TextMessage, append([]byte{eioOpen}, open...))
+}
+
+// parseSocketIO 解析 <type>[<attachments>-][<nsp>,][<id>][<data>]
+func parseSocketIO(s string) (socketIOPacket, error) {
+	if s == "" || s[0] < '0' || s[0] > '6' {
+		return socketIOPacket{}, errSocketIOPacket
+	}
+	p := socketIOPacket{typ: int(s[0] - '0'), nsp: "/", id: -1}
+	s = s[1:]
+	if p.typ == sioBinaryEvent || p.typ == sioBinaryAck {
+		n, rest, ok := strings.Cut(s, "-")
+		var err error
+		if p.attachments, err = strconv.Atoi(n); !ok || err != nil || p.attachments < 0 {
+			return socketIOPacket{}, errSocketIOPacket
+		}
+		s = rest
+	}
+	if strings.HasPrefix(s, "/") {
+		nsp, rest, ok := strings.Cut(s, ",")
+		if !ok {
+			nsp, rest = s, ""
+		}
+		p.nsp, s = nsp, rest
+	}
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		id, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return socketIOPacket{}, errSocketIOPacket
+		}
+		p.id = id
+	}
+	p.data = []byte(s[i:])
+	return p, nil
+}
+
+// socketIOFrame engine message 封包：4 + Socket.IO 封包
+func socketIOFrame(typ int, data string) *outbound {
+	return newOutbound(TextMessage, []byte(string(eioMessage)+strconv.Itoa(typ)+data))
+}
+
+// readSocketIO 讀取並處理 Engine.IO / Socket.IO 封包，取代 readPump 的 JSON 協定；連線結束時返回
+func (c *Client) readSocketIO() {
+	pongWait := c.hub.opts.PongWait
+	for {
+		msgType, b, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.unexpectedClose(err) {
+				c.hub.opts.Logger.Warn("websocket read failed", c.logAttrs("err", err)...)
+			}
+			c.recordReadError(err)
+			return
+		}
+		if msgType == websocket.BinaryMessage {
+			if c.sio.skip > 0 {
+				c.sio.skip--
+			}
+			continue
+		}
+		if len(b) == 0 {
+			continue
+		}
+		switch b[0] {
+		case eioPong:
+			_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		case eioPing:
+			if !c.writePacket(newOutbound(TextMessage, append([]byte{eioPong}, b[1:]...))) {
+				return
+			}
+		case eioClose:
+			c.recordClose(websocket.CloseNormalClosure, "socket.io close", false)
+			return
+		case eioMessage:
+			if !c.handleSocketIO(string(b[1:])) {
+				return
+			}
+		}
+	}
+}
+
+// handleSocketIO 處理一個 Socket.IO 封包；回傳 false 時結束連線
+func (c *Client) handleSocketIO(s string) bool {
+	p, err := parseSocketIO(s)
+	if err != nil {
+		c.closeProtocol(websocket.CloseProtocolError, err.Error())
+		return false
+	}
+	switch p.typ {
+	case sioConnect:
+		return c.socketIOConnect(p)
+	case sioDisconnect:
+		c.recordClose(websocket.CloseNormalClosure, "socket.io disconnect", false)
+		return false
+	case sioEvent:
+		if !c.sio.connected {
+			return true
+		}
+		return c.socketIOEvent(p)
+	case sioBinaryEvent, sioBinaryAck:
+		c.sio.skip = p.attachments
+		c.hub.opts.Logger.Warn("socket.io binary event skipped", c.logAttrs()...)
+	}
+	// client 的 ack（server 不要求 ack）等其他封包略過
+	return true
+}
+
+// socketIOConnect 處理 namespace 的 CONNECT
+func (c *Client) socketIOConnect(p socketIOPacket) bool {
+	if p.nsp != "/" {
+		msg, _ := json.Marshal(map[string]string{"message": "Invalid namespace"})
+		return c.writePacket(socketIOFrame(sioConnectError, p.nsp+","+string(msg)))
+	}
+	if c.sio.connected {
+		return true
+	}
+	if fn := c.sio.cfg.Authenticate; fn != nil {
+		var auth json.RawMessage
+		if len(bytes.TrimSpace(p.data)) > 0 {
+			auth = p.data
+		}
+		if err := fn(c, auth); err != nil {
+			c.hub.opts.Logger.Warn("socket.io connect rejected", c.logAttrs("err", err)...)
+			msg, _ := json.Marshal(map[string]string{"message": err.Error()})
+			c.writePacket(socketIOFrame(sioConnectError, string(msg)))
+			c.closeProtocol(websocket.ClosePolicyViolation, "unauthorized")
+			return false
+		}
+	}
+	c.sio.connected = true
+	sid, _ := json.Marshal(map[string]string{"sid": c.id})
+	return c.writePacket(socketIOFrame(sioConnect, string(sid)))
+}
+
+// socketIOEvent 將 emit 的事件轉成 hub 訊息處理；帶 ack id 時回覆空的 ack
+func (c *Client) socketIOEvent(p socketIOPacket) bool {
+	var args []json.RawMessage
+	var name string
+	if err := json.Unmarshal(p.data, &args); err != nil || len(args) == 0 || json.Unmarshal(args[0], &name) != nil {
+		c.closeProtocol(websocket.CloseProtocolError, errSocketIOPacket.Error())
+		return false
+	}
+	accept, keep := c.allowInbound()
+	if !keep {
+		return false
+	}
+	if accept {
+		c.handle(TextMessage, socketIOMessage(name, args[1:]))
+	}
+	if p.id >= 0 {
+		return c.writePacket(socketIOFrame(sioAck, strconv.FormatInt(p.id, 10)+"[]"))
+	}
+	return true
+}
+
+// socketIOMessage 將事件轉成 hub 的訊息格式
+func socketIOMessage(name string, args []json.RawMessage) []byte {
+	if len(args) == 1 {
+		var arg string
+		switch strings.ToLower(name) {
+		case "join", "leave":
+			if json.Unmarshal(args[0], &arg) == nil {
+				return mustJSON(map[string]string{"type": name, "room": arg})
+			}
+		case "subscribe", "unsubscribe":
+			if json.Unmarshal(args[0], &arg) == nil {
+				return mustJSON(map[string]string{"type": name, "topic": arg})
+			}
+		}
+	}
+	env := Envelope{Type: name}
+	switch len(args) {
+	case 0:
+	case 1:
+		env.Data = args[0]
+	default:
+		env.Data = mustJSON(args)
+	}
+	return mustJSON(env)
+}
+
+// socketIOPayload 將 hub 的訊息轉成 EVENT 封包內容：envelope 對應事件名稱與 data，其他以 "message" 事件送出
+func socketIOPayload(b []byte) []byte {
+	trimmed := bytes.TrimSpace(b)
+	var args []any
+	if json.Valid(trimmed) {
+		var env struct {
+			Type *string         `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if trimmed[0] == '{' && json.Unmarshal(trimmed, &env) == nil && env.Type != nil && *env.Type != "" {
+			args = []any{*env.Type}
+			if env.Data != nil {
+				args = append(args, env.Data)
+			}
+		} else {
+			args = []any{socketIOEventDefault, json.RawMessage(trimmed)}
+		}
+	} else {
+		args = []any{socketIOEventDefault, string(b)}
+	}
+	out, _ := json.Marshal(args)
+	return out
+}
+
+// writeSocketIO 以 EVENT 封包寫出一則訊息（僅在 writePump 內呼叫）
+func (c *Client) writeSocketIO(m *outbound) error {
+	if m.msgType == BinaryMessage {
+		header := fmt.Sprintf(`%c%d1-["%s",{"_placeholder":true,"num":0}]`, eioMessage, sioBinaryEvent, socketIOEventDefault)
+		if err := c.conn.WriteMessage(websocket.TextMessage, []byte(header)); err != nil {
+			return err
+		}
+		return c.conn.WriteMessage(websocket.BinaryMessage, m.data)
+	}
+	return socketIOFrame(sioEvent, string(socketIOPayload(m.data))).write(c.conn)
+}
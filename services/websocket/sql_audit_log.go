@@ -0,0 +1,191 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLAuditLog 以 database/sql 實作 AuditLog（SQLite 或 Postgres）；資料表可用 CreateTable 建立，
+// 或自行建立相同欄位（SQLite）：
+//
+//	CREATE TABLE websocket_audit (
+//		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+//		at           TIMESTAMP NOT NULL,
+//		instance     TEXT NOT NULL,
+//		actor        TEXT NOT NULL,
+//		action       TEXT NOT NULL,
+//		target       TEXT NOT NULL,
+//		rooms        TEXT NOT NULL,
+//		payload_hash TEXT NOT NULL,
+//		size         INTEGER NOT NULL,
+//		status       INTEGER NOT NULL
+//	);
+//	CREATE INDEX websocket_audit_at ON websocket_audit (at);
+//	CREATE INDEX websocket_audit_actor_id ON websocket_audit (actor, id);
+//
+// rooms 為房間名稱的 JSON 陣列；Prune 依 at 刪除
+type SQLAuditLog struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+}
+
+// NewSQLAuditLog table 為空時使用 "websocket_audit"；table 只能是識別字（可帶 schema），否則回傳 error
+func NewSQLAuditLog(db *sql.DB, dialect SQLDialect, table string) (*SQLAuditLog, error) {
+	if table == "" {
+		table = "websocket_audit"
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("websocket: invalid audit table name %q", table)
+	}
+	if dialect != SQLPostgres && dialect != SQLSQLite {
+		return nil, fmt.Errorf("websocket: unknown SQL dialect %d", dialect)
+	}
+	return &SQLAuditLog{db: db, dialect: dialect, table: table}, nil
+}
+
+// CreateTable 建立資料表與索引（已存在時不做事）
+func (l *SQLAuditLog) CreateTable(ctx context.Context) error {
+	id, at := "BIGSERIAL PRIMARY KEY", "TIMESTAMPTZ"
+	if l.dialect == SQLSQLite {
+		id, at = "INTEGER PRIMARY KEY AUTOINCREMENT", "TIMESTAMP"
+	}
+	_, err := l.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+l.table+` (
+	id           `+id+`,
+	at           `+at+` NOT NULL,
+	instance     TEXT NOT NULL,
+	actor        TEXT NOT NULL,
+	action       TEXT NOT NULL,
+	target       TEXT NOT NULL,
+	rooms        TEXT NOT NULL,
+	payload_hash TEXT NOT NULL,
+	size         INTEGER NOT NULL,
+	status       INTEGER NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+	name := l.table[strings.LastIndexByte(l.table, '.')+1:]
+	for _, idx := range []string{
+		`CREATE INDEX IF NOT EXISTS ` + name + `_at ON ` + l.table + ` (at)`,
+		`CREATE INDEX IF NOT EXISTS ` + name + `_actor_id ON ` + l.table + ` (actor, id)`,
+	} {
+		if _, err := l.db.ExecContext(ctx, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arg 第 n 個參數的 placeholder（從 1 開始）
+func (l *SQLAuditLog) arg(n int) string {
+	if l.dialect == SQLSQLite {
+		return "?"
+	}
+	return "$" + strconv.Itoa(n)
+}
+
+func (l *SQLAuditLog) Record(ctx context.Context, e AuditEntry) error {
+	rooms := e.Rooms
+	if rooms == nil {
+		rooms = []string{}
+	}
+	rb, err := json.Marshal(rooms)
+	if err != nil {
+		return err
+	}
+	args := make([]string, 9)
+	for i := range args {
+		args[i] = l.arg(i + 1)
+	}
+	_, err = l.db.ExecContext(ctx, `INSERT INTO `+l.table+
+		` (at, instance, actor, action, target, rooms, payload_hash, size, status) VALUES (`+strings.Join(args, ", ")+`)`,
+		e.Time.UTC(), e.Instance, e.Actor, e.Action, e.Target, string(rb), e.PayloadHash, e.Size, e.Status)
+	return err
+}
+
+func (l *SQLAuditLog) Query(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+	cond := func(expr string, v any) {
+		args = append(args, v)
+		where = append(where, expr+" "+l.arg(len(args)))
+	}
+	if q.After != "" {
+		after, err := strconv.ParseInt(q.After, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("websocket: invalid audit entry ID %q", q.After)
+		}
+		cond("id >", after)
+	}
+	if q.Actor != "" {
+		cond("actor =", q.Actor)
+	}
+	if q.Action != "" {
+		cond("action =", q.Action)
+	}
+	if q.Room != "" {
+		// rooms 是 JSON 陣列，以編碼後的字串（含引號）比對；跳脫 LIKE 的萬用字元
+		b, _ := json.Marshal(q.Room)
+		pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(string(b))
+		args = append(args, "%"+pattern+"%")
+		where = append(where, `rooms LIKE `+l.arg(len(args))+` ESCAPE '\'`)
+	}
+	if !q.Since.IsZero() {
+		cond("at >=", q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		cond("at <", q.Until.UTC())
+	}
+	query := `SELECT id, at, instance, actor, action, target, rooms, payload_hash, size, status FROM ` + l.table
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, q.Limit)
+	rows, err := l.db.QueryContext(ctx, query+` ORDER BY id LIMIT `+l.arg(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AuditEntry
+	for rows.Next() {
+		var (
+			e     AuditEntry
+			id    int64
+			rooms string
+		)
+		if err := rows.Scan(&id, &e.Time, &e.Instance, &e.Actor, &e.Action, &e.Target, &rooms, &e.PayloadHash, &e.Size, &e.Status); err != nil {
+			return nil, err
+		}
+		e.ID = strconv.FormatInt(id, 10)
+		if err := json.Unmarshal([]byte(rooms), &e.Rooms); err != nil {
+			return nil, fmt.Errorf("websocket: audit entry %d: invalid rooms: %w", id, err)
+		}
+		if len(e.Rooms) == 0 {
+			e.Rooms = nil
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (l *SQLAuditLog) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := l.db.ExecContext(ctx, `DELETE FROM `+l.table+` WHERE at < `+l.arg(1), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Ping 確認資料庫連線正常（HealthHandler 的 /readyz 使用）
+func (l *SQLAuditLog) Ping(ctx context.Context) error {
+	return l.db.PingContext(ctx)
+}
@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SQLHistoryStore 以 database/sql 實作 HistoryStore（SQL 為 Postgres 語法，例如 lib/pq）；
+// 資料表可用 CreateTable 建立，或自行建立相同欄位：
+//
+//	CREATE TABLE websocket_history (
+//		id        BIGSERIAL PRIMARY KEY,
+//		room      TEXT NOT NULL,
+//		is_binary BOOLEAN NOT NULL,
+//		data      BYTEA NOT NULL,
+//		sent_at   TIMESTAMPTZ NOT NULL
+//	);
+//	CREATE INDEX ON websocket_history (room, id);
+//
+// ID 來自整張表共用的 sequence，同一房間內遞增但不連續。不會自動刪除舊訊息，請依需要定期清理
+type SQLHistoryStore struct {
+	db    *sql.DB
+	table string
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// NewSQLHistoryStore table 為空時使用 "websocket_history"；table 只能是識別字（可帶 schema），否則回傳 error
+func NewSQLHistoryStore(db *sql.DB, table string) (*SQLHistoryStore, error) {
+	if table == "" {
+		table = "websocket_history"
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("websocket: invalid history table name %q", table)
+	}
+	return &SQLHistoryStore{db: db, table: table}, nil
+}
+
+// CreateTable 建立資料表與索引（已存在時不做事）
+func (s *SQLHistoryStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+	id        BIGSERIAL PRIMARY KEY,
+	room      TEXT NOT NULL,
+	is_binary BOOLEAN NOT NULL,
+	data      BYTEA NOT NULL,
+	sent_at   TIMESTAMPTZ NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS `+indexName(s.table)+` ON `+s.table+` (room, id)`)
+	return err
+}
+
+// indexName 索引名稱不可帶 schema
+func indexName(table string) string {
+	return table[strings.LastIndexByte(table, '.')+1:] + "_room_id"
+}
+
+func (s *SQLHistoryStore) Append(ctx context.Context, m HistoryMessage) (uint64, error) {
+	var id uint64
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO `+s.table+` (room, is_binary, data, sent_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+		m.Room, m.Binary, m.Data, m.Time,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *SQLHistoryStore) Query(ctx context.Context, room string, before uint64, limit int) ([]HistoryMessage, error) {
+	q := `SELECT id, is_binary, data, sent_at FROM ` + s.table + ` WHERE room = $1`
+	args := []any{room}
+	if before > 0 {
+		q += ` AND id < $3`
+		args = append(args, limit, before)
+	} else {
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, q+` ORDER BY id DESC LIMIT $2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []HistoryMessage
+	for rows.Next() {
+		m := HistoryMessage{Room: room}
+		if err := rows.Scan(&m.ID, &m.Binary, &m.Data, &m.Time); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLDialect SQLMessageStore 使用的 SQL 語法
+type SQLDialect int
+
+const (
+	// SQLPostgres 例如 lib/pq、pgx 的 stdlib
+	SQLPostgres SQLDialect = iota
+	// SQLSQLite 例如 mattn/go-sqlite3、modernc.org/sqlite
+	SQLSQLite
+)
+
+// SQLMessageStore 以 database/sql 實作 MessageStore（Postgres 或 SQLite）；資料表可用 CreateTable 建立，
+// 或自行建立相同欄位（Postgres）：
+//
+//	CREATE TABLE websocket_messages (
+//		id        BIGSERIAL PRIMARY KEY,
+//		instance  TEXT NOT NULL,
+//		room      TEXT NOT NULL,
+//		topic     TEXT NOT NULL,
+//		is_binary BOOLEAN NOT NULL,
+//		data      BYTEA NOT NULL,
+//		sent_at   TIMESTAMPTZ NOT NULL
+//	);
+//	CREATE INDEX ON websocket_messages (sent_at);
+//	CREATE INDEX ON websocket_messages (room, id);
+//
+// ID 為自動遞增的整數；Prune 依 sent_at 刪除
+type SQLMessageStore struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+}
+
+// NewSQLMessageStore table 為空時使用 "websocket_messages"；table 只能是識別字（可帶 schema），否則回傳 error
+func NewSQLMessageStore(db *sql.DB, dialect SQLDialect, table string) (*SQLMessageStore, error) {
+	if table == "" {
+		table = "websocket_messages"
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("websocket: invalid message table name %q", table)
+	}
+	if dialect != SQLPostgres && dialect != SQLSQLite {
+		return nil, fmt.Errorf("websocket: unknown SQL dialect %d", dialect)
+	}
+	return &SQLMessageStore{db: db, dialect: dialect, table: table}, nil
+}
+
+// CreateTable 建立資料表與索引（已存在時不做事）
+func (s *SQLMessageStore) CreateTable(ctx context.Context) error {
+	id, data, sentAt := "BIGSERIAL PRIMARY KEY", "BYTEA", "TIMESTAMPTZ"
+	if s.dialect == SQLSQLite {
+		id, data, sentAt = "INTEGER PRIMARY KEY AUTOINCREMENT", "BLOB", "TIMESTAMP"
+	}
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+	id        `+id+`,
+	instance  TEXT NOT NULL,
+	room      TEXT NOT NULL,
+	topic     TEXT NOT NULL,
+	is_binary BOOLEAN NOT NULL,
+	data      `+data+` NOT NULL,
+	sent_at   `+sentAt+` NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+	name := s.table[strings.LastIndexByte(s.table, '.')+1:]
+	for _, idx := range []string{
+		`CREATE INDEX IF NOT EXISTS ` + name + `_sent_at ON ` + s.table + ` (sent_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + name + `_room_id ON ` + s.table + ` (room, id)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arg 第 n 個參數的 placeholder（從 1 開始）
+func (s *SQLMessageStore) arg(n int) string {
+	if s.dialect == SQLSQLite {
+		return "?"
+	}
+	return "$" + strconv.Itoa(n)
+}
+
+// Save 在同一個 transaction 內寫入整批訊息
+func (s *SQLMessageStore) Save(ctx context.Context, msgs []StoredMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+s.table+` (instance, room, topic, is_binary, data, sent_at) VALUES (`+
+		s.arg(1)+`, `+s.arg(2)+`, `+s.arg(3)+`, `+s.arg(4)+`, `+s.arg(5)+`, `+s.arg(6)+`)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range msgs {
+		if _, err := stmt.ExecContext(ctx, m.Instance, m.Room, m.Topic, m.Binary, m.Data, m.Time.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLMessageStore) Query(ctx context.Context, q MessageQuery) ([]StoredMessage, error) {
+	var (
+		where []string
+		args  []any
+	)
+	cond := func(expr string, v any) {
+		args = append(args, v)
+		where = append(where, expr+" "+s.arg(len(args)))
+	}
+	if q.After != "" {
+		after, err := strconv.ParseInt(q.After, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("websocket: invalid message ID %q", q.After)
+		}
+		cond("id >", after)
+	}
+	if q.Room != "" {
+		cond("room =", q.Room)
+	}
+	if q.Topic != "" {
+		cond("topic =", q.Topic)
+	}
+	if !q.Since.IsZero() {
+		cond("sent_at >=", q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		cond("sent_at <", q.Until.UTC())
+	}
+	query := `SELECT id, instance, room, topic, is_binary, data, sent_at FROM ` + s.table
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, q.Limit)
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id LIMIT `+s.arg(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []StoredMessage
+	for rows.Next() {
+		var (
+			m  StoredMessage
+			id int64
+		)
+		if err := rows.Scan(&id, &m.Instance, &m.Room, &m.Topic, &m.Binary, &m.Data, &m.Time); err != nil {
+			return nil, err
+		}
+		m.ID = strconv.FormatInt(id, 10)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLMessageStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE sent_at < `+s.arg(1), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Ping 確認資料庫連線正常（HealthHandler 的 /readyz 使用）
+func (s *SQLMessageStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
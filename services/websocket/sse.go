@@ -0,0 +1,166 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ServeSSE Server-Sent Events 連線；註冊在同一個 Hub，廣播、房間與 topic 都會送到 SSE client。
+// SSE 只能單向接收，client 應透過 REST API 送訊息。
+//
+//   - 每隔 PingPeriod 送出 ": keepalive" 註解，避免 proxy 斷線
+//   - binary 訊息以 "event: binary"、base64 編碼的 data 送出
+//   - ResumeBuffer > 0 時每則事件帶 "id: <token>/<seq>"，瀏覽器重連時的 Last-Event-ID
+//     會續接 session 並補送漏掉的訊息（也可用 ?resume=<token>&last_seq=N）
+func ServeSSE(h *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, span := h.tracing.startSpan(h.tracing.fromRequest(c.Request), "websocket.ServeSSE",
+			attribute.String("websocket.remote", c.Request.RemoteAddr))
+		defer span.End()
+
+		token, lastSeq := parseLastEventID(c.GetHeader("Last-Event-ID"))
+		if token == "" {
+			token = c.Query("resume")
+			lastSeq, _ = strconv.ParseUint(c.Query("last_seq"), 10, 64)
+		}
+		a, admitted := h.admit(c, span, token, lastSeq)
+		if !admitted {
+			return
+		}
+		if _, ok := c.Writer.(http.Flusher); !ok {
+			h.conns.release(a.ip)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "streaming unsupported"})
+			return
+		}
+
+		cl := h.newClient(a, c.Request.RemoteAddr, h.opts.Codec)
+		if err := h.claimLogin(cl, a.info.UserID); err != nil {
+			h.conns.release(a.ip)
+			cl.cancel()
+			fail(span, err)
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if !h.register(cl) {
+			h.conns.release(a.ip)
+			h.logins.release(cl)
+			cl.cancel()
+			h.overloaded(c, "server shutting down")
+			return
+		}
+		span.SetAttributes(attribute.String("websocket.client_id", cl.id))
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // nginx 不緩衝
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+		h.connected(cl)
+
+		defer func() {
+			if p := recover(); p != nil {
+				cl.logPanic("ssePump", p)
+				cl.closeOnPanic()
+			}
+			cl.unregister()
+			cl.disconnected()
+		}()
+		cl.ssePump(c.Writer, c.Request.Context().Done())
+	}
+}
+
+// ssePump 將佇列內的訊息寫成 SSE 事件，直到 client 離開或被 Hub 移除
+func (c *Client) ssePump(w gin.ResponseWriter, gone <-chan struct{}) {
+	rc := http.NewResponseController(w)
+	ticker := time.NewTicker(c.hub.opts.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.cancel()
+		close(c.pumpDone)
+	}()
+
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+		var sent *outbound
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return
+			}
+			var seq uint64
+			if c.session != nil {
+				if seq, ok = c.session.written(c, message); !ok {
+					continue
+				}
+			}
+			if gap := c.takeGap(); gap != nil {
+				writeEvent(&buf, gap, nil, 0)
+			}
+			writeEvent(&buf, message, c.session, seq)
+			sent = message
+		case <-ticker.C:
+			buf.WriteString(": keepalive\n\n")
+		case <-gone:
+			c.recordClose(CloseGoingAway, "client went away", false)
+			return
+		}
+		if sent != nil {
+			c.throttle(sent)
+		}
+		_ = rc.SetWriteDeadline(time.Now().Add(c.hub.opts.WriteWait))
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			c.hub.opts.Logger.Warn("sse write failed", c.logAttrs("err", err)...)
+			c.recordClose(CloseAbnormalClosure, err.Error(), false)
+			return
+		}
+		w.Flush()
+		if sent != nil {
+			c.sent(sent)
+		}
+	}
+}
+
+// writeEvent 依 SSE 格式寫出一則訊息；data 內的換行拆成多行 data
+func writeEvent(buf *bytes.Buffer, m *outbound, sess *session, seq uint64) {
+	switch {
+	case m.control:
+		buf.WriteString("event: session\n")
+	case sess != nil:
+		fmt.Fprintf(buf, "id: %s/%d\n", sess.token(), seq)
+	}
+	data := string(m.data)
+	if m.msgType == BinaryMessage {
+		buf.WriteString("event: binary\n")
+		data = base64.StdEncoding.EncodeToString(m.data)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(strings.TrimSuffix(line, "\r"))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+}
+
+// parseLastEventID 解析 "<token>/<seq>"
+func parseLastEventID(id string) (token string, seq uint64) {
+	i := strings.LastIndexByte(id, '/')
+	if i < 0 {
+		return "", 0
+	}
+	token, s := id[:i], id[i+1:]
+	seq, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return "", 0
+	}
+	return token, seq
+}
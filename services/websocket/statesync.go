@@ -0,0 +1,239 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 狀態同步（snapshot + delta），適合串流一份持續變動的大狀態（例如 dashboard）：
+//
+//   - client 送 {"type":"sync","state":"dashboard"}，收到 {"type":"state.snapshot","state":"dashboard","version":12,"data":{...}}，
+//     之後收到 {"type":"state.delta","state":"dashboard","version":13,"data":{...}}；{"type":"unsync","state":"dashboard"} 停止
+//   - 版本號每次 Apply 加一；client 收到的 delta 不是目前版本 + 1（例如背壓丟掉了訊息）時重送 sync 取得新的 snapshot，
+//     小於等於目前版本的 delta 直接略過（client.js 的 syncState 會自動處理）
+//   - data 的格式由應用決定；client.js 預設以 JSON Merge Patch（RFC 7386）套用 delta
+//   - 唯讀 client 也可以同步；StateConfig.Authorize 可限制
+//
+// 狀態與版本號只在本 instance：多個 instance 時各自 RegisterState 並各自 Apply 同樣的變更，
+// client 重連到別的 instance 時重新取得 snapshot。續接 session（ResumeBuffer）不保留同步，client 續接後重送 sync
+
+// StateConfig RegisterState 的設定
+type StateConfig struct {
+	// Snapshot 回傳目前完整的狀態（編碼成 JSON），在狀態的鎖內呼叫，不會與 Apply 同時執行
+	Snapshot func() (any, error)
+	// Authorize 回傳 false 的 client 不能同步（可為 nil）；在 readPump 內呼叫
+	Authorize func(c *Client) bool
+}
+
+// SyncedState RegisterState 註冊的一份狀態
+type SyncedState struct {
+	hub  *Hub
+	name string
+	cfg  StateConfig
+
+	mu      sync.Mutex // 讓 snapshot 與 delta 依版本順序放進 client 佇列
+	version uint64
+}
+
+// stateRegistry 以名稱查詢已註冊的狀態
+type stateRegistry struct {
+	mu sync.RWMutex
+	m  map[string]*SyncedState
+}
+
+var errStateNotAllowed = errors.New("state not allowed")
+
+// RegisterState 註冊名為 name 的狀態；同名已註冊時回傳 error
+func (h *Hub) RegisterState(name string, cfg StateConfig) (*SyncedState, error) {
+	if name == "" || cfg.Snapshot == nil {
+		return nil, errors.New("websocket: RegisterState needs a name and StateConfig.Snapshot")
+	}
+	r := &h.states
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.m[name]; ok {
+		return nil, fmt.Errorf("websocket: state %q already registered", name)
+	}
+	if r.m == nil {
+		r.m = make(map[string]*SyncedState)
+	}
+	st := &SyncedState{hub: h, name: name, cfg: cfg}
+	r.m[name] = st
+	return st, nil
+}
+
+func (h *Hub) state(name string) *SyncedState {
+	h.states.mu.RLock()
+	defer h.states.mu.RUnlock()
+	return h.states.m[name]
+}
+
+// Version 目前的版本號（尚未 Apply 過時為 0）
+func (st *SyncedState) Version() uint64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.version
+}
+
+// Apply 在狀態的鎖內執行 fn：fn 更新應用的狀態並回傳 delta，版本號加一後送給所有同步中的 client。
+// fn 回傳 nil 表示沒有變更（不送出、版本不變）；回傳 error 時原樣回傳。回傳新的版本號
+func (st *SyncedState) Apply(fn func() (delta any, err error)) (uint64, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delta, err := fn()
+	if err != nil || delta == nil {
+		return st.version, err
+	}
+	b, err := st.encode("state.delta", st.version+1, delta)
+	if err != nil {
+		return st.version, err
+	}
+	st.version++
+	return st.version, st.deliverAll(b)
+}
+
+// Publish 送出 delta（應用已自行更新狀態，且 Snapshot 不會看到尚未 Publish 的變更時使用；否則用 Apply）
+func (st *SyncedState) Publish(delta any) (uint64, error) {
+	return st.Apply(func() (any, error) { return delta, nil })
+}
+
+// Resync 對所有同步中的 client 重送 snapshot（例如變更太大，送 delta 不划算時）
+func (st *SyncedState) Resync() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	b, err := st.snapshot()
+	if err != nil {
+		return err
+	}
+	return st.deliverAll(b)
+}
+
+// deliverAll 在每個 shard 內放進同步中 client 的佇列（持有 st.mu）
+func (st *SyncedState) deliverAll(b []byte) error {
+	out := newPrepared("", TextMessage, b)
+	if !st.hub.callAll(func(s *shard) {
+		for c := range s.stateSubs[st.name] {
+			s.deliver(c, out)
+		}
+	}) {
+		return ErrHubClosed
+	}
+	return nil
+}
+
+func (st *SyncedState) snapshot() ([]byte, error) {
+	v, err := st.cfg.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: state %q snapshot: %w", st.name, err)
+	}
+	return st.encode("state.snapshot", st.version, v)
+}
+
+func (st *SyncedState) encode(typ string, version uint64, data any) ([]byte, error) {
+	b, err := json.Marshal(struct {
+		Type    string `json:"type"`
+		State   string `json:"state"`
+		Version uint64 `json:"version"`
+		Data    any    `json:"data"`
+	}{typ, st.name, version, data})
+	if err != nil {
+		return nil, fmt.Errorf("websocket: state %q encode: %w", st.name, err)
+	}
+	return b, nil
+}
+
+// sync 送出 snapshot 並開始同步；已在同步中時重送 snapshot（client 落後時的 resync）
+func (st *SyncedState) sync(c *Client) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	b, err := st.snapshot()
+	if err != nil {
+		return err
+	}
+	out := newOutbound(TextMessage, b)
+	s := c.shard
+	// 在同一次 shard 呼叫內加入並放進佇列：之後的 delta 一定排在 snapshot 後面
+	if !s.call(func() {
+		if !s.clients[c] {
+			return
+		}
+		if s.stateSubs == nil {
+			s.stateSubs = make(map[string]map[*Client]bool)
+		}
+		subs, ok := s.stateSubs[st.name]
+		if !ok {
+			subs = make(map[*Client]bool)
+			s.stateSubs[st.name] = subs
+		}
+		subs[c] = true
+		s.deliver(c, out)
+	}) {
+		return ErrHubClosed
+	}
+	return nil
+}
+
+// unsyncAll client 移除時停止所有同步（僅在 shard 內呼叫）
+func (s *shard) unsyncAll(c *Client) {
+	for name, subs := range s.stateSubs {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(s.stateSubs, name)
+		}
+	}
+}
+
+// parseSyncCmd 解析 {"type":"sync","state":"x"} / {"type":"unsync","state":"x"}
+func parseSyncCmd(b []byte) (op, name string, ok bool) {
+	if !bytes.Contains(b, []byte(`"state"`)) {
+		return "", "", false
+	}
+	var v struct {
+		Type  string `json:"type"`
+		State string `json:"state"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(b), &v) != nil {
+		return "", "", false
+	}
+	op = strings.ToLower(v.Type)
+	if (op != "sync" && op != "unsync") || v.State == "" {
+		return "", "", false
+	}
+	return op, v.State, true
+}
+
+// syncCmd 處理 sync / unsync（在 readPump 內呼叫）
+func (c *Client) syncCmd(op, name string) {
+	h := c.hub
+	st := h.state(name)
+	if st == nil {
+		_ = h.sendToClient(c, stateError("unknown state", name))
+		return
+	}
+	if op == "unsync" {
+		s := c.shard
+		s.call(func() {
+			if subs := s.stateSubs[name]; subs != nil {
+				delete(subs, c)
+			}
+		})
+		return
+	}
+	if st.cfg.Authorize != nil && !st.cfg.Authorize(c) {
+		c.deny(stateError(errStateNotAllowed.Error(), name), errStateNotAllowed.Error(), "state", name)
+		return
+	}
+	if err := st.sync(c); err != nil && !errors.Is(err, ErrHubClosed) {
+		h.opts.Logger.Error("state snapshot failed", c.logAttrs("state", name, "err", err)...)
+		_ = h.sendToClient(c, stateError("snapshot failed", name))
+	}
+}
+
+// stateError {"type":"error","data":{"error":"unknown state","state":"x"}}
+func stateError(msg, name string) []byte {
+	return mustJSON(map[string]any{"type": "error", "data": map[string]string{"error": msg, "state": name}})
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import "sync/atomic"
+
+// HubStats 某一時間點的統計；各欄位分別以 atomic 讀取，可在任何 goroutine 呼叫
+type HubStats struct {
+	Connections  int    `json:"connections"`  // 目前在線（已註冊）的 client
+	Broadcasts   uint64 `json:"broadcasts"`   // 累計廣播數（含房間、topic 與 backplane 轉入；不含 presence 事件）
+	Dropped      uint64 `json:"dropped"`      // 累計因背壓丟棄的訊息數
+	MessagesSent uint64 `json:"messagesSent"` // 累計寫出的訊息數
+	BytesSent    uint64 `json:"bytesSent"`    // 累計寫出的 payload bytes（不含 frame header）
+	// UpgradesLimited 累計因 UpgradeRate / UpgradeRatePerIP 回 429 的連線要求
+	UpgradesLimited uint64 `json:"upgradesLimited"`
+	// Overloaded 累計因 MaxConnections、關閉中或 draining 拒絕、並請 client 稍後重連的連線要求
+	Overloaded uint64 `json:"overloaded"`
+	// Draining 是否在 draining（見 Drain）
+	Draining bool `json:"draining"`
+	// HandlerOverflows 累計 handler 佇列已滿的次數（見 HandlerOverflow）
+	HandlerOverflows uint64 `json:"handlerOverflows"`
+	// WriteRetries 累計寫入逾時後再等一次的次數（見 WriteRetries）
+	WriteRetries uint64 `json:"writeRetries"`
+	// Duplicates 累計因 DedupWindow 丟棄的重送訊息
+	Duplicates uint64 `json:"duplicates"`
+
+	// Closes 累計斷線數，依 close code 分類（見 CloseKind）
+	Closes map[CloseKind]uint64 `json:"closes"`
+
+	// Latency AppHeartbeat 測得的來回時間分佈（未開啟時為 nil）
+	Latency *LatencyStats `json:"latency,omitempty"`
+}
+
+// counters Hub 的統計計數器
+type counters struct {
+	connections  atomic.Int64
+	broadcasts   atomic.Uint64
+	messagesSent atomic.Uint64
+	bytesSent    atomic.Uint64
+	// 最後一次廣播（unix nano），給 HealthHandler
+	lastBroadcast atomic.Int64
+	closes        [len(closeKinds)]atomic.Uint64
+	// 因速率限制拒絕的連線要求
+	upgradesLimited atomic.Uint64
+	// 因過載或關閉中拒絕的連線要求
+	overloaded atomic.Uint64
+	// handler 佇列已滿的次數
+	handlerOverflows atomic.Uint64
+	// 寫入逾時後的重試
+	writeRetries atomic.Uint64
+	// 丟棄的重送訊息
+	duplicates atomic.Uint64
+}
+
+// Len 回傳目前在線的 client 數
+func (h *Hub) Len() int {
+	return int(h.stats.connections.Load())
+}
+
+// Stats 回傳統計快照
+func (h *Hub) Stats() HubStats {
+	closes := make(map[CloseKind]uint64, len(closeKinds))
+	for i, kind := range closeKinds {
+		closes[kind] = h.stats.closes[i].Load()
+	}
+	st := HubStats{
+		Connections:      h.Len(),
+		Broadcasts:       h.stats.broadcasts.Load(),
+		Dropped:          h.dropped.Load(),
+		MessagesSent:     h.stats.messagesSent.Load(),
+		BytesSent:        h.stats.bytesSent.Load(),
+		UpgradesLimited:  h.stats.upgradesLimited.Load(),
+		Overloaded:       h.stats.overloaded.Load(),
+		HandlerOverflows: h.stats.handlerOverflows.Load(),
+		WriteRetries:     h.stats.writeRetries.Load(),
+		Duplicates:       h.stats.duplicates.Load(),
+		Draining:         h.drainSince.Load() != 0,
+		Closes:           closes,
+	}
+	if h.opts.AppHeartbeat > 0 {
+		latency := h.latency.snapshot()
+		st.Latency = &latency
+	}
+	return st
+}
+
+// sent 記錄一則成功寫出的訊息（在 write pump 內呼叫）
+func (c *Client) sent(m *outbound) {
+	c.messagesSent.Add(1)
+	c.bytesSent.Add(uint64(len(m.data)))
+	c.hub.stats.messagesSent.Add(1)
+	c.hub.stats.bytesSent.Add(uint64(len(m.data)))
+}
@@ -0,0 +1,206 @@
+package websocket
+
+import (
+	"fmt"
+	"slices"
+)
+
+// TagExpr 標籤條件，例如
+//
+//	beta && mobile
+//	(beta || staff) && !'region:cn'
+//
+// 支援 && || !、括號；標籤為識別字，含其他字元時以 '..' 或 ".." 括起來
+type TagExpr struct {
+	expr string
+	root tagNode
+}
+
+// CompileTagExpr 解析標籤條件；語法錯誤時回傳包含 ErrInvalidFilter 的錯誤
+func CompileTagExpr(expr string) (*TagExpr, error) {
+	if len(expr) > maxFilterLength {
+		return nil, fmt.Errorf("%w: longer than %d bytes", ErrInvalidFilter, maxFilterLength)
+	}
+	p := &filterParser{src: expr}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := parseTagOr(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &TagExpr{expr: expr, root: root}, nil
+}
+
+// String 回傳原本的表達式
+func (e *TagExpr) String() string {
+	return e.expr
+}
+
+// Match tags 是否符合條件
+func (e *TagExpr) Match(tags map[string]bool) bool {
+	return e.root.match(tags)
+}
+
+type tagNode interface {
+	match(tags map[string]bool) bool
+}
+
+type tagName string
+
+type tagNot struct{ x tagNode }
+
+type tagLogic struct {
+	and  bool
+	l, r tagNode
+}
+
+func (n tagName) match(tags map[string]bool) bool { return tags[string(n)] }
+func (n tagNot) match(tags map[string]bool) bool  { return !n.x.match(tags) }
+
+func (n tagLogic) match(tags map[string]bool) bool {
+	if l := n.l.match(tags); n.and != l {
+		return l
+	}
+	return n.r.match(tags)
+}
+
+// 與 filter 共用 tokenizer，文法只有 || && ! 與括號
+func parseTagOr(p *filterParser, depth int) (tagNode, error) {
+	if depth > maxFilterDepth {
+		return nil, p.errorf("nested too deeply")
+	}
+	l, err := parseTagAnd(p, depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := parseTagAnd(p, depth)
+		if err != nil {
+			return nil, err
+		}
+		l = tagLogic{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func parseTagAnd(p *filterParser, depth int) (tagNode, error) {
+	l, err := parseTagUnary(p, depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := parseTagUnary(p, depth)
+		if err != nil {
+			return nil, err
+		}
+		l = tagLogic{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func parseTagUnary(p *filterParser, depth int) (tagNode, error) {
+	switch {
+	case p.isOp("!"):
+		if depth > maxFilterDepth {
+			return nil, p.errorf("nested too deeply")
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := parseTagUnary(p, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{x}, nil
+	case p.isOp("("):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := parseTagOr(p, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case p.tok.kind == tokIdent, p.tok.kind == tokString:
+		name := tagName(p.tok.text)
+		return name, p.next()
+	case p.tok.kind == tokEOF:
+		return nil, p.errorf("unexpected end of tag expression")
+	}
+	return nil, p.errorf("unexpected %q", p.tok.text)
+}
+
+// AddTag 為連線加上標籤（BroadcastToTags 使用），可在任何 goroutine 呼叫，
+// 但不可在 BroadcastWhere 的 match 內呼叫。Authenticate 可由 ClientInfo.Tags 帶入初始標籤
+func (c *Client) AddTag(tags ...string) {
+	c.shard.call(func() { c.addTags(tags) })
+}
+
+// addTags 僅在所屬 shard 內（或註冊之前）呼叫
+func (c *Client) addTags(tags []string) {
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		if c.tags == nil {
+			c.tags = make(map[string]bool, len(tags))
+		}
+		c.tags[tag] = true
+	}
+}
+
+// RemoveTag 移除連線的標籤
+func (c *Client) RemoveTag(tags ...string) {
+	c.shard.call(func() {
+		for _, tag := range tags {
+			delete(c.tags, tag)
+		}
+	})
+}
+
+// HasTag 連線是否有此標籤
+func (c *Client) HasTag(tag string) bool {
+	var ok bool
+	c.shard.call(func() { ok = c.tags[tag] })
+	return ok
+}
+
+// Tags 回傳連線目前的標籤（已排序）
+func (c *Client) Tags() []string {
+	var out []string
+	c.shard.call(func() { out = c.sortedTags() })
+	return out
+}
+
+// sortedTags 僅在所屬 shard 內呼叫
+func (c *Client) sortedTags() []string {
+	if len(c.tags) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(c.tags))
+	for tag := range c.tags {
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// BroadcastToTags 只送給標籤符合 expr 的 client（例如 "beta && mobile"），回傳送出的 client 數；
+// 比房間輕量，適合 feature flag 式的投遞。與 BroadcastWhere 相同，只投遞到本 instance 也不記入歷史
+func (h *Hub) BroadcastToTags(expr string, b []byte) (int, error) {
+	e, err := CompileTagExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	return h.broadcastMatching(func(c *Client) bool { return e.Match(c.tags) }, b)
+}
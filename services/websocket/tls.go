@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig ServeTLS 的設定：CertFile / KeyFile 與 AutocertDomains 擇一
+type TLSConfig struct {
+	// CertFile / KeyFile PEM 憑證與私鑰的路徑（憑證可含中繼憑證鏈）
+	CertFile string
+	KeyFile  string
+
+	// AutocertDomains 以 Let's Encrypt 自動申請與更新這些網域的憑證（addr 需為可從外部連到的 :443）
+	AutocertDomains []string
+	// AutocertCacheDir 憑證快取目錄，預設 "autocert-cache"；重啟後沿用，避免撞到 Let's Encrypt 的額度限制
+	AutocertCacheDir string
+	// AutocertEmail 憑證到期等通知的聯絡信箱（可空白）
+	AutocertEmail string
+
+	// RedirectAddr 不為空時在此位址（通常是 ":80"）將 HTTP 請求轉址到 HTTPS；
+	// 使用 autocert 時同時回應 ACME http-01 challenge
+	RedirectAddr string
+}
+
+func (t *TLSConfig) validate() error {
+	files := t.CertFile != "" || t.KeyFile != ""
+	switch {
+	case files && len(t.AutocertDomains) > 0:
+		return errors.New("websocket: TLSConfig CertFile/KeyFile and AutocertDomains are mutually exclusive")
+	case files && (t.CertFile == "" || t.KeyFile == ""):
+		return errors.New("websocket: TLSConfig needs both CertFile and KeyFile")
+	case !files && len(t.AutocertDomains) == 0:
+		return errors.New("websocket: TLSConfig needs CertFile/KeyFile or AutocertDomains")
+	}
+	return nil
+}
+
+// ServeTLS 與 Serve 相同，但以 HTTPS 提供服務，client 以 wss:// 連線
+func ServeTLS(addr string, hub *Hub, handler http.Handler, cfg TLSConfig) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return ServeTLSContext(ctx, &http.Server{Addr: addr, Handler: handler}, hub, cfg)
+}
+
+// ServeTLSContext 與 ServeContext 相同，但以 HTTPS 提供服務；srv.TLSConfig 不為 nil 時以它為基礎
+func ServeTLSContext(ctx context.Context, srv *http.Server, hub *Hub, cfg TLSConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if srv.TLSConfig != nil {
+		tc = srv.TLSConfig.Clone()
+	}
+	var redirect http.Handler = redirectHTTPS(srv.Addr)
+	if len(cfg.AutocertDomains) > 0 {
+		dir := cfg.AutocertCacheDir
+		if dir == "" {
+			dir = "autocert-cache"
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(dir),
+			Email:      cfg.AutocertEmail,
+		}
+		tc.GetCertificate = m.GetCertificate
+		tc.NextProtos = append(tc.NextProtos, "h2", "http/1.1", "acme-tls/1")
+		redirect = m.HTTPHandler(redirect)
+	} else {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		tc.Certificates = append(tc.Certificates, cert)
+	}
+	srv.TLSConfig = tc
+
+	var extra []*http.Server
+	if cfg.RedirectAddr != "" {
+		extra = append(extra, &http.Server{
+			Addr:              cfg.RedirectAddr,
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+	// 憑證已放進 TLSConfig
+	return serve(ctx, srv, hub, func() error { return srv.ListenAndServeTLS("", "") }, extra...)
+}
+
+// redirectHTTPS 將請求轉到 httpsAddr 的 port 上的同一個 host 與路徑（443 時省略 port）
+func redirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// 308 保留 method 與 body
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
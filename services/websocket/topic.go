@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidTopic topic 或訂閱 pattern 格式不正確
+var ErrInvalidTopic = errors.New("websocket: invalid topic")
+
+// topic 以 "." 分段：訂閱時 "*" 比對剛好一段，"#" 只能放最後、比對零到多段；
+// 例如 "sensor.#" 與 "sensor.*.kitchen" 都會收到 Publish("sensor.temp.kitchen", ...)
+
+// validPattern 檢查訂閱 pattern
+func validPattern(p string) bool {
+	if p == "" {
+		return false
+	}
+	segs := strings.Split(p, ".")
+	for i, seg := range segs {
+		if seg == "" {
+			return false
+		}
+		if seg == "#" && i != len(segs)-1 {
+			return false
+		}
+		if seg != "*" && seg != "#" && strings.ContainsAny(seg, "*#") {
+			return false
+		}
+	}
+	return true
+}
+
+// validTopic 檢查 Publish 的 topic（不可含 wildcard）
+func validTopic(t string) bool {
+	return validPattern(t) && !strings.ContainsAny(t, "*#")
+}
+
+// topicNode 訂閱樹；每一層以 segment 為 key（僅在所屬 shard 內存取）
+type topicNode struct {
+	children map[string]*topicNode
+	subs     map[*Client]bool
+}
+
+func (n *topicNode) add(segs []string, c *Client) {
+	for _, seg := range segs {
+		if n.children == nil {
+			n.children = make(map[string]*topicNode)
+		}
+		next, ok := n.children[seg]
+		if !ok {
+			next = &topicNode{}
+			n.children[seg] = next
+		}
+		n = next
+	}
+	if n.subs == nil {
+		n.subs = make(map[*Client]bool)
+	}
+	n.subs[c] = true
+}
+
+// remove 移除訂閱，並回傳此節點是否已空（可由上層刪除）
+func (n *topicNode) remove(segs []string, c *Client) bool {
+	if len(segs) == 0 {
+		delete(n.subs, c)
+	} else if next, ok := n.children[segs[0]]; ok && next.remove(segs[1:], c) {
+		delete(n.children, segs[0])
+	}
+	return len(n.subs) == 0 && len(n.children) == 0
+}
+
+// match 收集所有符合 topic 的訂閱者到 out（同一 client 只會出現一次）
+func (n *topicNode) match(segs []string, out map[*Client]bool) {
+	if multi, ok := n.children["#"]; ok {
+		for c := range multi.subs {
+			out[c] = true
+		}
+	}
+	if len(segs) == 0 {
+		for c := range n.subs {
+			out[c] = true
+		}
+		return
+	}
+	if next, ok := n.children[segs[0]]; ok {
+		next.match(segs[1:], out)
+	}
+	if next, ok := n.children["*"]; ok {
+		next.match(segs[1:], out)
+	}
+}
+
+// matchTopic 單一 pattern 是否符合 topic（topicNode 以外的少量比對用）
+func matchTopic(pattern, topic string) bool {
+	ps, ts := strings.Split(pattern, "."), strings.Split(topic, ".")
+	for i, p := range ps {
+		if p == "#" {
+			return true
+		}
+		if i >= len(ts) || (p != "*" && p != ts[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(ts)
+}
+
+// Subscribe 讓 client 訂閱 topic pattern
+func (h *Hub) Subscribe(c *Client, pattern string) error {
+	if !validPattern(pattern) {
+		return ErrInvalidTopic
+	}
+	if !c.shard.call(func() { c.shard.subscribe(c, pattern) }) {
+		return ErrHubClosed
+	}
+	return nil
+}
+
+// Unsubscribe 取消 client 的訂閱
+func (h *Hub) Unsubscribe(c *Client, pattern string) {
+	c.shard.call(func() { c.shard.unsubscribe(c, pattern) })
+}
+
+// Publish 送給所有訂閱 pattern 符合 topic 的 client（有 backplane 時也會送到其他 instance）；
+// topic 訊息不記錄到歷史
+func (h *Hub) Publish(topic string, b []byte) error {
+	if !validTopic(topic) {
+		return ErrInvalidTopic
+	}
+	h.sendBroadcast(broadcastMsg{topic: topic, msgType: TextMessage, data: b})
+	return nil
+}
+
+// subscribe 僅在 shard 內呼叫
+func (s *shard) subscribe(c *Client, pattern string) {
+	if !s.clients[c] || c.topics[pattern] {
+		return
+	}
+	c.topics[pattern] = true
+	s.topics.add(strings.Split(pattern, "."), c)
+}
+
+// unsubscribe 僅在 shard 內呼叫
+func (s *shard) unsubscribe(c *Client, pattern string) {
+	if !c.topics[pattern] {
+		return
+	}
+	delete(c.topics, pattern)
+	delete(c.filters, pattern)
+	s.topics.remove(strings.Split(pattern, "."), c)
+}
+
+// subscribers 僅在 shard 內呼叫
+func (s *shard) subscribers(topic string) map[*Client]bool {
+	out := make(map[*Client]bool)
+	s.topics.match(strings.Split(topic, "."), out)
+	return out
+}
+
+// parseTopicCmd 解析 client 送來的訂閱指令：
+// {"type":"subscribe","topic":"sensor.#"} / {"type":"unsubscribe","topic":"sensor.#"}；
+// 可帶 "filter"（見 Filter），沒有 topic 時 filter 套用在 topic 以外的廣播
+func parseTopicCmd(b []byte) (op, topic string, filter *string, ok bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		return "", "", nil, false
+	}
+	var v struct {
+		Type   string  `json:"type"`
+		Topic  string  `json:"topic"`
+		Filter *string `json:"filter"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", "", nil, false
+	}
+	op = strings.ToLower(v.Type)
+	if (op != "subscribe" && op != "unsubscribe") || (v.Topic == "" && v.Filter == nil) {
+		return "", "", nil, false
+	}
+	return op, v.Topic, v.Filter, true
+}
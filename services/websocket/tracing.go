@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "my-websocket/services/websocket"
+
+// traceKey envelope 內放 trace context 的欄位：{"type":"...","trace":{"traceparent":"..."},...}
+const traceKey = "trace"
+
+// tracing 未設定 TracerProvider / Propagator 時使用 otel 的全域設定（預設為 noop）
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracing(o *Options) tracing {
+	tp := o.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	p := o.Propagator
+	if p == nil {
+		p = otel.GetTextMapPropagator()
+	}
+	return tracing{tracer: tp.Tracer(tracerName), propagator: p}
+}
+
+// startSpan 從 ctx 開始一個 span
+func (t tracing) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// fromRequest 取出 HTTP header 帶來的 trace context（traceparent 等）
+func (t tracing) fromRequest(r *http.Request) context.Context {
+	return t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// inject 將 ctx 的 trace context 放進 JSON 物件的 "trace" 欄位；
+// 沒有有效 span、不是 JSON 物件或已有該欄位時原樣回傳
+func (t tracing) inject(ctx context.Context, b []byte) []byte {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return b
+	}
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return b
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &obj); err != nil {
+		return b
+	}
+	if _, ok := obj[traceKey]; ok {
+		return b
+	}
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return b
+	}
+	obj[traceKey] = mustJSON(carrier)
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+// extract 由 envelope 的 "trace" 欄位還原 trace context
+func (t tracing) extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// fail 記錄錯誤並標記 span 失敗
+func fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// traceWrite 為有 trace context 的訊息建立 client 寫出的 span（在 writePump 內呼叫）
+func (c *Client) traceWrite(m *outbound) trace.Span {
+	if !m.trace.IsValid() {
+		return nil
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), m.trace)
+	_, span := c.hub.tracing.startSpan(ctx, "websocket.write",
+		attribute.String("websocket.client_id", c.id),
+		attribute.String("websocket.room", m.room),
+		attribute.Int("websocket.message_size", len(m.data)),
+	)
+	return span
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var errUpgradeRateLimited = errors.New("websocket: too many connection attempts")
+
+// 每隔這段時間清掉已回滿的 per-IP bucket
+const upgradeLimiterSweep = time.Minute
+
+// upgradeLimiter 連線要求的速率限制（UpgradeRate / UpgradeRatePerIP），在升級前檢查
+type upgradeLimiter struct {
+	global *rate.Limiter // 可為 nil
+
+	perIP rate.Limit // 0 表示不限制每個 IP
+	burst int
+
+	mu        sync.Mutex
+	ips       map[string]*ipBucket
+	lastSweep time.Time
+}
+
+type ipBucket struct {
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+// newUpgradeLimiter 依設定建立；兩種速率都未設定時回傳 nil
+func (o *Options) newUpgradeLimiter() *upgradeLimiter {
+	if o.UpgradeRate <= 0 && o.UpgradeRatePerIP <= 0 {
+		return nil
+	}
+	l := &upgradeLimiter{}
+	if o.UpgradeRate > 0 {
+		l.global = rate.NewLimiter(rate.Limit(o.UpgradeRate), o.UpgradeBurst)
+	}
+	if o.UpgradeRatePerIP > 0 {
+		l.perIP, l.burst = rate.Limit(o.UpgradeRatePerIP), o.UpgradeBurstPerIP
+		l.ips = make(map[string]*ipBucket)
+	}
+	return l
+}
+
+// allow 取用 ip 與全域各一個 token；超過時回傳 false 與建議的重試等待時間。
+// 先檢查 per-IP，讓單一來源的大量要求不會耗掉全域的額度
+func (l *upgradeLimiter) allow(ip string) (retryAfter time.Duration, ok bool) {
+	now := time.Now()
+	var r *rate.Reservation
+	if l.perIP > 0 {
+		r = l.bucket(ip, now).ReserveN(now, 1)
+		if d := r.DelayFrom(now); d > 0 {
+			r.CancelAt(now)
+			return d, false
+		}
+	}
+	if l.global != nil {
+		g := l.global.ReserveN(now, 1)
+		if d := g.DelayFrom(now); d > 0 {
+			g.CancelAt(now)
+			// 這次沒有連線，歸還 per-IP 的 token
+			if r != nil {
+				r.CancelAt(now)
+			}
+			return d, false
+		}
+	}
+	return 0, true
+}
+
+// bucket 取得 ip 的 bucket，順便回收閒置到已回滿的 bucket（與新建的等價）
+func (l *upgradeLimiter) bucket(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= upgradeLimiterSweep {
+		l.lastSweep = now
+		full := time.Duration(float64(l.burst) / float64(l.perIP) * float64(time.Second))
+		for k, b := range l.ips {
+			if now.Sub(b.last) > full {
+				delete(l.ips, k)
+			}
+		}
+	}
+	b, ok := l.ips[ip]
+	if !ok {
+		b = &ipBucket{limiter: rate.NewLimiter(l.perIP, l.burst)}
+		l.ips[ip] = b
+	}
+	b.last = now
+	return b.limiter
+}
+
+// retryAfterHeader Retry-After 的秒數（無條件進位，至少 1 秒）
+func retryAfterHeader(d time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(d.Seconds()))))
+}
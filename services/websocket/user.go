@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrUserNotFound 指定的使用者目前沒有任何連線
+var ErrUserNotFound = errors.New("websocket: user not connected")
+
+// BindUser 將 client 綁定到使用者（預設一個使用者可有多個裝置/分頁，見 Options.DuplicateLogin）；
+// Authenticate 回傳 UserID 時會自動綁定。LoginRejectNew 且該使用者已有連線時回傳 ErrDuplicateLogin，被封鎖時回傳 ErrBanned
+func (h *Hub) BindUser(c *Client, userID string) error {
+	if h.banned("", userID) {
+		return ErrBanned
+	}
+	if err := h.claimLogin(c, userID); err != nil {
+		return err
+	}
+	bound := false
+	if !c.shard.call(func() {
+		if bound = c.shard.clients[c]; bound {
+			c.shard.bindUser(c, userID)
+		}
+	}) {
+		return ErrHubClosed
+	}
+	if !bound {
+		// client 已斷線：取消剛才的佔用
+		h.logins.release(c)
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// SendToUser 送給使用者的所有連線
+func (h *Hub) SendToUser(userID string, b []byte) error {
+	// 同一使用者的連線可能分散在不同 shard
+	err := ErrUserNotFound
+	out := newOutbound(TextMessage, b)
+	var sealErr error
+	if !h.callAll(func(s *shard) {
+		if conns := s.users[userID]; len(conns) > 0 {
+			for c := range conns {
+				if perClient, serr := s.userOutbound(c, out); serr != nil {
+					sealErr = serr
+				} else {
+					s.deliver(c, perClient)
+				}
+			}
+			err = nil
+		}
+	}) {
+		return ErrHubClosed
+	}
+	if sealErr != nil {
+		return sealErr
+	}
+	return err
+}
+
+// userOutbound 有 ClientKey 時為每條連線各自加密 out（僅在 shard 內呼叫）
+func (s *shard) userOutbound(c *Client, out *outbound) (*outbound, error) {
+	if enc := s.hub.opts.Encryption; enc == nil || enc.ClientKey == nil {
+		return out, nil
+	}
+	data, err := s.hub.sealFor(c, out.msgType, out.data)
+	if err != nil {
+		return nil, err
+	}
+	return newOutbound(out.msgType, data), nil
+}
+
+// FindByUser 回傳使用者在本 instance 的所有連線（依上線時間排序，沒有時為 nil）。
+// 回傳的 *Client 在斷線後仍可安全使用：Send 等方法回傳 ErrClientNotFound，Connected 回傳 false
+func (h *Hub) FindByUser(userID string) []*Client {
+	var out []*Client
+	h.callAll(func(s *shard) {
+		for c := range s.users[userID] {
+			out = append(out, c)
+		}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].joinedAt.Before(out[j].joinedAt) })
+	return out
+}
+
+// bindUser 僅在 shard 內呼叫
+func (s *shard) bindUser(c *Client, userID string) {
+	if !s.clients[c] || c.userID == userID {
+		return
+	}
+	s.unbindUser(c)
+	if userID == "" {
+		return
+	}
+	conns, ok := s.users[userID]
+	if !ok {
+		conns = make(map[*Client]bool)
+		s.users[userID] = conns
+	}
+	conns[c] = true
+	c.userID = userID
+	s.hub.addConnection(c, userID)
+}
+
+// unbindUser 僅在 shard 內呼叫
+func (s *shard) unbindUser(c *Client) {
+	if c.userID == "" {
+		return
+	}
+	if conns := s.users[c.userID]; conns != nil {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(s.users, c.userID)
+		}
+	}
+	s.hub.removeConnection(c, c.userID)
+	c.userID = ""
+}
@@ -0,0 +1,174 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError 單一欄位的驗證失敗原因；Field 為 data 內的 JSON 路徑（例如 "items[0].name"）
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`            // 失敗的規則（validator tag，例如 "required"、"max"）
+	Param   string `json:"param,omitempty"` // 規則參數（例如 max=140 的 "140"）
+	Message string `json:"message"`
+}
+
+// ValidationError envelope 的 data 不符合註冊的 schema；
+// 回送給 client 時為 {"type":"error","data":{"error":"...","messageType":"chat","fields":[...]}}
+type ValidationError struct {
+	Type   string       `json:"messageType"`
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 1 {
+		return fmt.Sprintf("websocket: invalid %q message: %s", e.Type, e.Fields[0].Message)
+	}
+	return fmt.Sprintf("websocket: invalid %q message: %d fields failed validation", e.Type, len(e.Fields))
+}
+
+// ValidateFunc 驗證某個 type 的 envelope data；回傳 *ValidationError 時會附上欄位原因，
+// 其他 error 只回送錯誤訊息。可用來接 JSON Schema 等外部驗證器
+type ValidateFunc func(data json.RawMessage) error
+
+// validators 以 envelope type 對應 ValidateFunc，可在任何時候註冊
+type validators struct {
+	mu sync.RWMutex
+	m  map[string]ValidateFunc
+}
+
+// structValidator 共用的 validator（以 json tag 作為欄位名稱）
+var structValidator = sync.OnceValue(func() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return f.Name
+		}
+		return name
+	})
+	return v
+})
+
+// Validate 以 struct 的 `validate` tag（go-playground/validator）驗證 type 的 data，例如：
+//
+//	type chatMsg struct {
+//		Text string `json:"text" validate:"required,max=140"`
+//	}
+//	h.Validate("chat", chatMsg{})
+//
+// 驗證失敗的訊息不會分派或廣播，送出者會收到含欄位原因的 error envelope
+func (h *Hub) Validate(typ string, schema any) error {
+	t := reflect.TypeOf(schema)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("websocket: schema for %q must be a struct, got %T", typ, schema)
+	}
+	h.ValidateFunc(typ, func(data json.RawMessage) error {
+		v := reflect.New(t)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, v.Interface()); err != nil {
+				return &ValidationError{Type: typ, Fields: []FieldError{decodeFieldError(err)}}
+			}
+		}
+		err := structValidator().Struct(v.Interface())
+		var verrs validator.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return err
+		}
+		ve := &ValidationError{Type: typ}
+		for _, fe := range verrs {
+			ve.Fields = append(ve.Fields, FieldError{
+				Field:   fieldPath(fe.Namespace()),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: fieldMessage(fe),
+			})
+		}
+		return ve
+	})
+	return nil
+}
+
+// ValidateFunc 註冊 type 的自訂驗證；再次註冊同一 type 會取代先前的設定
+func (h *Hub) ValidateFunc(typ string, fn ValidateFunc) {
+	h.validators.mu.Lock()
+	defer h.validators.mu.Unlock()
+	if h.validators.m == nil {
+		h.validators.m = make(map[string]ValidateFunc)
+	}
+	h.validators.m[typ] = fn
+}
+
+// validate 檢查 envelope 是否符合註冊的 schema；非 envelope 或沒有註冊的 type 一律通過。
+// 失敗時已回送 error envelope 並回傳 false
+func (c *Client) validate(b []byte) bool {
+	h := c.hub
+	h.validators.mu.RLock()
+	n := len(h.validators.m)
+	h.validators.mu.RUnlock()
+	if n == 0 {
+		return true
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		return true
+	}
+	var env Envelope
+	if err := json.Unmarshal(b, &env); err != nil || env.Type == "" {
+		return true
+	}
+	h.validators.mu.RLock()
+	fn, ok := h.validators.m[env.Type]
+	h.validators.mu.RUnlock()
+	if !ok {
+		return true
+	}
+	if err := fn(env.Data); err != nil {
+		_ = h.sendToClient(c, errorEnvelope(err))
+		return false
+	}
+	return true
+}
+
+// fieldPath 去掉最外層的 struct 名稱："chatMsg.items[0].name" → "items[0].name"
+func fieldPath(ns string) string {
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return ns
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	field := fieldPath(fe.Namespace())
+	if fe.Param() != "" {
+		return fmt.Sprintf("%s failed %s=%s", field, fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("%s failed %s", field, fe.Tag())
+}
+
+// decodeFieldError data 無法解碼成 schema（型別不符等）
+func decodeFieldError(err error) FieldError {
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		return FieldError{
+			Field:   te.Field,
+			Rule:    "type",
+			Param:   te.Type.String(),
+			Message: fmt.Sprintf("%s must be %s, got %s", te.Field, te.Type, te.Value),
+		}
+	}
+	return FieldError{Rule: "json", Message: err.Error()}
+}
@@ -0,0 +1,226 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Webhook 事件類型
+const (
+	WebhookConnect       = "connect"
+	WebhookDisconnect    = "disconnect"
+	WebhookRoomJoin      = "room.join"
+	WebhookRoomLeave     = "room.leave"
+	WebhookAbnormalClose = "abnormal_close" // 非 1000 / 1001 的斷線（含 1006 無 close frame）
+)
+
+// 預設值
+const (
+	defaultWebhookRetries = 3
+	defaultWebhookBackoff = 500 * time.Millisecond
+	defaultWebhookTimeout = 5 * time.Second
+	defaultWebhookQueue   = 1024
+)
+
+// WebhookConfig 將 Hub 事件以 JSON POST 到外部系統。
+// Secret 不為空時帶 X-Webhook-Signature: sha256=<hex(HMAC-SHA256(Secret, body))>。
+// 失敗（連線錯誤、429、5xx）時以指數退避重試；佇列滿或 Hub 結束時未送出的事件會被丟棄。
+type WebhookConfig struct {
+	URLs       []string
+	Secret     []byte
+	Events     []string      // 只送這些事件；空表示全部
+	MaxRetries int           // 預設 3
+	Backoff    time.Duration // 第一次重試前的等待，之後每次加倍（預設 500ms）
+	Timeout    time.Duration // 單次請求期限（預設 5s）
+	QueueSize  int           // 每個 URL 的待送佇列（預設 1024）
+	Client     *http.Client  // 預設 http.DefaultClient
+}
+
+func (w *WebhookConfig) withDefaults() {
+	if w.MaxRetries <= 0 {
+		w.MaxRetries = defaultWebhookRetries
+	}
+	if w.Backoff <= 0 {
+		w.Backoff = defaultWebhookBackoff
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = defaultWebhookTimeout
+	}
+	if w.QueueSize <= 0 {
+		w.QueueSize = defaultWebhookQueue
+	}
+	if w.Client == nil {
+		w.Client = http.DefaultClient
+	}
+}
+
+func (w *WebhookConfig) validate() error {
+	if len(w.URLs) == 0 {
+		return errors.New("websocket: webhook needs at least one URL")
+	}
+	for _, raw := range w.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("websocket: invalid webhook URL %q", raw)
+		}
+	}
+	return nil
+}
+
+// WebhookEvent POST 的內容
+type WebhookEvent struct {
+	ID     string        `json:"id"`
+	Type   string        `json:"type"`
+	Time   time.Time     `json:"time"`
+	Hub    string        `json:"hub"` // 發出事件的 Hub ID（多 instance 時區分來源）
+	Client WebhookClient `json:"client"`
+	Room   string        `json:"room,omitempty"`
+	Code   int           `json:"code,omitempty"`   // abnormal_close 的 close code
+	Reason string        `json:"reason,omitempty"` // abnormal_close 的錯誤說明
+}
+
+// WebhookClient 事件中的 client 資訊
+type WebhookClient struct {
+	ID         string `json:"id"`
+	UserID     string `json:"userId,omitempty"`
+	RemoteAddr string `json:"remoteAddr"`
+	IP         string `json:"ip"`
+	Transport  string `json:"transport"`
+}
+
+// webhooks 每個 URL 一個佇列與 worker，慢的 URL 不會拖累其他 URL
+type webhooks struct {
+	cfg    WebhookConfig
+	queues []chan webhookJob
+}
+
+// webhookJob 一則待送事件（body 已編碼，重試時內容與簽章不變）
+type webhookJob struct {
+	id, typ string
+	body    []byte
+}
+
+func newWebhooks(cfg *WebhookConfig) *webhooks {
+	if cfg == nil {
+		return nil
+	}
+	w := &webhooks{cfg: *cfg}
+	for range cfg.URLs {
+		w.queues = append(w.queues, make(chan webhookJob, cfg.QueueSize))
+	}
+	return w
+}
+
+// run 啟動 worker，直到 done 關閉
+func (w *webhooks) run(h *Hub) {
+	for i, u := range w.cfg.URLs {
+		go w.worker(h, u, w.queues[i])
+	}
+}
+
+func (w *webhooks) worker(h *Hub, target string, queue <-chan webhookJob) {
+	for {
+		select {
+		case job := <-queue:
+			w.deliver(h, target, job)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// deliver 送出一則事件，失敗時依 Backoff 重試
+func (w *webhooks) deliver(h *Hub, target string, job webhookJob) {
+	wait := w.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		err := w.post(target, job)
+		if err == nil {
+			return
+		}
+		if attempt >= w.cfg.MaxRetries {
+			h.opts.Logger.Warn("webhook delivery failed", "url", target, "type", job.typ, "attempts", attempt+1, "err", err)
+			return
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-h.done:
+			t.Stop()
+			return
+		}
+		wait *= 2
+	}
+}
+
+// errStatus 需要重試的 HTTP 狀態（429、5xx）
+type errStatus int
+
+func (e errStatus) Error() string { return fmt.Sprintf("webhook: unexpected status %d", int(e)) }
+
+func (w *webhooks) post(target string, job webhookJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(job.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", job.typ)
+	req.Header.Set("X-Webhook-ID", job.id) // 重試時不變，接收端可用來去重
+	if len(w.cfg.Secret) > 0 {
+		mac := hmac.New(sha256.New, w.cfg.Secret)
+		mac.Write(job.body)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// 其他 4xx 視為接收端拒絕，重試也沒有用
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return errStatus(resp.StatusCode)
+	}
+	return nil
+}
+
+// webhook 將事件放進各 URL 的佇列，不阻塞（可在 shard 內呼叫）
+func (h *Hub) webhook(typ string, c *Client, fill func(e *WebhookEvent)) {
+	w := h.webhooks
+	if w == nil || (len(w.cfg.Events) > 0 && !slices.Contains(w.cfg.Events, typ)) {
+		return
+	}
+	e := WebhookEvent{
+		ID:   newClientID(),
+		Type: typ,
+		Time: time.Now().UTC(),
+		Hub:  h.id,
+		Client: WebhookClient{
+			ID:         c.id,
+			UserID:     c.info.UserID,
+			RemoteAddr: c.remoteAddr,
+			IP:         c.ip,
+			Transport:  c.Transport(),
+		},
+	}
+	if fill != nil {
+		fill(&e)
+	}
+	job := webhookJob{id: e.ID, typ: typ, body: mustJSON(e)}
+	for i, q := range w.queues {
+		select {
+		case q <- job:
+		default:
+			h.opts.Logger.Warn("webhook queue full, event dropped", "url", w.cfg.URLs[i], "type", typ)
+		}
+	}
+}
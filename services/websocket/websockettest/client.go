@@ -0,0 +1,249 @@
+package websockettest
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+)
+
+// Frame 收到的一個 data frame
+type Frame struct {
+	Type int // websocket.TextMessage 或 websocket.BinaryMessage
+	Data []byte
+}
+
+// JSON 將 Data 解碼到 v
+func (f Frame) JSON(v any) error {
+	return json.Unmarshal(f.Data, v)
+}
+
+// TestClient 測試用的 WebSocket client：背景持續讀取，以 Expect* 依序斷言收到的 frame；
+// 失敗時以 tb.Fatalf 結束測試，所以只能在測試 goroutine 呼叫
+type TestClient struct {
+	// Conn 底層連線；只可讀取屬性或設定 handler，讀寫請使用 TestClient 的方法
+	Conn *gws.Conn
+
+	// Timeout 每個 Expect* 的等待上限（預設 DefaultTimeout）
+	Timeout time.Duration
+
+	tb     testing.TB
+	frames chan Frame
+	done   chan struct{} // 讀取結束（連線關閉）後關閉
+	stop   chan struct{} // Close 時關閉
+	err    error         // 結束的原因，done 關閉後才可讀
+
+	wmu sync.Mutex // gorilla 同時只允許一個 writer
+
+	mu     sync.Mutex
+	resume chan struct{} // Pause 後不為 nil，Resume 時關閉
+
+	closeOnce sync.Once
+}
+
+// 讀進來但尚未被 Expect 取走的 frame 上限；滿了之後停止讀取（如同 Pause）
+const frameBuffer = 1024
+
+func newTestClient(tb testing.TB, conn *gws.Conn) *TestClient {
+	c := &TestClient{
+		Conn:    conn,
+		Timeout: DefaultTimeout,
+		tb:      tb,
+		frames:  make(chan Frame, frameBuffer),
+		done:    make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+func (c *TestClient) read() {
+	defer close(c.done)
+	for {
+		c.waitResumed()
+		typ, b, err := c.Conn.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+		select {
+		case c.frames <- Frame{Type: typ, Data: b}:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *TestClient) waitResumed() {
+	c.mu.Lock()
+	ch := c.resume
+	c.mu.Unlock()
+	if ch != nil {
+		<-ch
+	}
+}
+
+// Pause 停止讀取，模擬慢速 client：server 的寫入會被擋住，佇列逐漸堆滿（觸發 SlowClientPolicy）。
+// 正在進行的那次讀取仍會完成，所以之後最多還會收到一個 frame
+func (c *TestClient) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resume == nil {
+		c.resume = make(chan struct{})
+	}
+}
+
+// Resume 恢復讀取
+func (c *TestClient) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resume != nil {
+		close(c.resume)
+		c.resume = nil
+	}
+}
+
+// Send 送出 text frame
+func (c *TestClient) Send(b []byte) {
+	c.tb.Helper()
+	c.write(gws.TextMessage, b)
+}
+
+// SendBinary 送出 binary frame
+func (c *TestClient) SendBinary(b []byte) {
+	c.tb.Helper()
+	c.write(gws.BinaryMessage, b)
+}
+
+// SendJSON 將 v 編碼為 JSON 後以 text frame 送出
+func (c *TestClient) SendJSON(v any) {
+	c.tb.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.tb.Fatalf("websockettest: encode: %v", err)
+	}
+	c.write(gws.TextMessage, b)
+}
+
+func (c *TestClient) write(typ int, b []byte) {
+	c.tb.Helper()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	if err := c.Conn.WriteMessage(typ, b); err != nil {
+		c.tb.Fatalf("websockettest: write: %v", err)
+	}
+}
+
+// next 取下一個 frame；連線已關閉（且沒有剩下的 frame）時回傳結束原因，逾時回傳 nil frame 與 nil error
+func (c *TestClient) next(timeout time.Duration) (*Frame, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case f := <-c.frames:
+		return &f, nil
+	case <-c.done:
+		select {
+		case f := <-c.frames:
+			return &f, nil
+		default:
+			return nil, c.err
+		}
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// Expect 等待下一個 frame；逾時或連線關閉時結束測試
+func (c *TestClient) Expect() Frame {
+	c.tb.Helper()
+	f, err := c.next(c.Timeout)
+	switch {
+	case f != nil:
+		return *f
+	case err != nil:
+		c.tb.Fatalf("websockettest: connection closed while waiting for a frame: %v", err)
+	default:
+		c.tb.Fatalf("websockettest: no frame within %s", c.Timeout)
+	}
+	return Frame{}
+}
+
+// ExpectJSON 等待下一個 frame 並解碼到 v
+func (c *TestClient) ExpectJSON(v any) {
+	c.tb.Helper()
+	f := c.Expect()
+	if err := f.JSON(v); err != nil {
+		c.tb.Fatalf("websockettest: decode %q: %v", f.Data, err)
+	}
+}
+
+// ExpectType 略過其他訊息，等到 "type" 欄位為 typ 的 JSON 訊息並回傳其內容
+func (c *TestClient) ExpectType(typ string) map[string]any {
+	c.tb.Helper()
+	deadline := time.Now().Add(c.Timeout)
+	for {
+		f, err := c.next(time.Until(deadline))
+		if f == nil {
+			if err != nil {
+				c.tb.Fatalf("websockettest: connection closed while waiting for %q: %v", typ, err)
+			}
+			c.tb.Fatalf("websockettest: no %q message within %s", typ, c.Timeout)
+			return nil
+		}
+		var m map[string]any
+		if f.JSON(&m) == nil && m["type"] == typ {
+			return m
+		}
+	}
+}
+
+// ExpectNone 確認 d 內沒有收到任何 frame
+func (c *TestClient) ExpectNone(d time.Duration) {
+	c.tb.Helper()
+	if f, _ := c.next(d); f != nil {
+		c.tb.Fatalf("websockettest: unexpected frame %q", f.Data)
+	}
+}
+
+// ExpectClose 略過剩下的訊息，等待 server 關閉連線並回傳 close code 與 reason；
+// 沒有 close frame 就斷線時 code 為 1006。Pause 中會先 Resume，才讀得到 close frame
+func (c *TestClient) ExpectClose() (code int, reason string) {
+	c.tb.Helper()
+	c.Resume()
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+wait:
+	for {
+		select {
+		case <-c.frames:
+		case <-c.done:
+			break wait
+		case <-timer.C:
+			c.tb.Fatalf("websockettest: connection not closed within %s", c.Timeout)
+			return 0, ""
+		}
+	}
+	var ce *gws.CloseError
+	if errors.As(c.err, &ce) {
+		return ce.Code, ce.Text
+	}
+	return gws.CloseAbnormalClosure, ""
+}
+
+// Close 送出 1000 close frame 並關閉連線；可重複呼叫（測試結束時也會自動呼叫）
+func (c *TestClient) Close() {
+	c.closeOnce.Do(func() {
+		c.wmu.Lock()
+		_ = c.Conn.WriteControl(gws.CloseMessage,
+			gws.FormatCloseMessage(gws.CloseNormalClosure, ""), time.Now().Add(100*time.Millisecond))
+		c.wmu.Unlock()
+		close(c.stop)
+		c.Resume()
+		_ = c.Conn.Close()
+		<-c.done
+	})
+}
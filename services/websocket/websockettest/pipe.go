@@ -0,0 +1,74 @@
+package websockettest
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// pipeListener 以 net.Pipe 提供連線的 net.Listener，不佔用任何 port；
+// pipe 沒有緩衝，client 停止讀取時 server 的寫入會立刻被擋住（方便模擬慢速 client）
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+	port   atomic.Int32 // 分配給每條連線的假 port
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return serverAddr }
+
+// dial 建立一條連線；ip 為 server 看到的 client IP（空白為 127.0.0.1）
+func (l *pipeListener) dial(ctx context.Context, ip string) (net.Conn, error) {
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP(ip), Port: 10000 + int(l.port.Add(1))}
+	if remote.IP == nil {
+		return nil, &net.AddrError{Err: "invalid IP", Addr: ip + ":" + strconv.Itoa(remote.Port)}
+	}
+	client, server := net.Pipe()
+	select {
+	case l.conns <- &pipeConn{Conn: server, local: serverAddr, remote: remote}:
+		return &pipeConn{Conn: client, local: remote, remote: serverAddr}, nil
+	case <-l.closed:
+		client.Close()
+		server.Close()
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// serverAddr server 端的假位址
+var serverAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}
+
+// pipeConn 讓 RemoteAddr 回傳 IP:port（net.Pipe 預設為 "pipe"），hub 才能解析 client IP
+type pipeConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
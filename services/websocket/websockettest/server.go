@@ -0,0 +1,144 @@
+// Package websockettest 提供 Hub 的整合測試工具：在記憶體內連線（不佔用 port）的 Server，
+// 以及可斷言收到的 frame、模擬慢速 client 的 TestClient。
+//
+//	hub, _ := websocket.NewHub()
+//	srv := websockettest.NewServer(t, hub)
+//	c := srv.Dial(t)
+//	srv.WaitClients(t, 1)
+//	hub.Broadcast([]byte(`{"type":"hello"}`))
+//	c.ExpectType("hello")
+package websockettest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"my-websocket/services/websocket"
+
+	"github.com/gin-gonic/gin"
+	gws "github.com/gorilla/websocket"
+)
+
+// DefaultTimeout TestClient 等待 frame 與 Server 等待連線數的預設期限
+const DefaultTimeout = 2 * time.Second
+
+// Server 在記憶體內提供 hub 的 HTTP 服務；所有連線都經由 net.Pipe，不經過網路
+type Server struct {
+	Hub *websocket.Hub
+
+	// URL server 的位址（例如 "http://websockettest"），只能透過 Dial / Client 連線
+	URL string
+
+	ln  *pipeListener
+	srv *http.Server
+}
+
+// NewServer 啟動 hub.Run，並以預設路由提供 /ws（ServeWs）與 /sse（ServeSSE）；
+// hub 不可已在執行。測試結束時自動 Shutdown
+func NewServer(tb testing.TB, h *websocket.Hub) *Server {
+	tb.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", websocket.ServeWs(h))
+	r.GET("/sse", websocket.ServeSSE(h))
+	return NewServerWithHandler(tb, h, r)
+}
+
+// NewServerWithHandler 同 NewServer，但使用自訂的 handler（例如含 REST API 的 gin router）
+func NewServerWithHandler(tb testing.TB, h *websocket.Hub, handler http.Handler) *Server {
+	tb.Helper()
+	s := &Server{
+		Hub: h,
+		URL: "http://websockettest",
+		ln:  newPipeListener(),
+		srv: &http.Server{Handler: handler, ReadHeaderTimeout: DefaultTimeout},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go h.Run(ctx)
+	go func() { _ = s.srv.Serve(s.ln) }()
+
+	tb.Cleanup(func() {
+		shutdownCtx, done := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer done()
+		if err := h.Shutdown(shutdownCtx); err != nil {
+			tb.Logf("websockettest: hub shutdown: %v", err)
+		}
+		cancel()
+		_ = s.srv.Close()
+		_ = s.ln.Close()
+	})
+	return s
+}
+
+// DialOptions Server.DialWith 的設定；零值等同 Dial
+type DialOptions struct {
+	Path         string     // 預設 "/ws"
+	Query        url.Values // 例如 token、resume、last_seq
+	Header       http.Header
+	Subprotocols []string
+
+	// RemoteIP server 看到的 client IP（預設 127.0.0.1），用於 MaxConnectionsPerIP、封鎖名單等
+	RemoteIP string
+}
+
+// Dial 以預設設定連線到 /ws；失敗時結束測試
+func (s *Server) Dial(tb testing.TB) *TestClient {
+	tb.Helper()
+	c, resp, err := s.DialWith(tb, DialOptions{})
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		tb.Fatalf("websockettest: dial: %v (status %d)", err, status)
+	}
+	return c
+}
+
+// DialWith 依 o 連線；握手被拒絕時回傳 error 與 HTTP 回應（例如 401、403、429），方便測試拒絕的情況
+func (s *Server) DialWith(tb testing.TB, o DialOptions) (*TestClient, *http.Response, error) {
+	tb.Helper()
+	if o.Path == "" {
+		o.Path = "/ws"
+	}
+	u := url.URL{Scheme: "ws", Host: "websockettest", Path: o.Path, RawQuery: o.Query.Encode()}
+	d := gws.Dialer{
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.ln.dial(ctx, o.RemoteIP)
+		},
+		HandshakeTimeout: DefaultTimeout,
+		Subprotocols:     o.Subprotocols,
+	}
+	conn, resp, err := d.Dial(u.String(), o.Header)
+	if err != nil {
+		return nil, resp, err
+	}
+	c := newTestClient(tb, conn)
+	tb.Cleanup(c.Close)
+	return c, resp, nil
+}
+
+// Client 回傳經由記憶體連線的 http.Client，用來呼叫 REST API 或讀取 /sse
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.ln.dial(ctx, "")
+		},
+	}}
+}
+
+// WaitClients 等到 hub 上的連線數為 n（Dial 回傳時 hub 可能還沒完成註冊）
+func (s *Server) WaitClients(tb testing.TB, n int) {
+	tb.Helper()
+	deadline := time.Now().Add(DefaultTimeout)
+	for s.Hub.Len() != n {
+		if time.Now().After(deadline) {
+			tb.Fatalf("websockettest: want %d clients, hub has %d", n, s.Hub.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,45 @@
+package websockettest
+
+import (
+	"testing"
+	"time"
+
+	"my-websocket/services/websocket"
+)
+
+func TestEchoExclusion(t *testing.T) {
+	hub, err := websocket.NewHub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(t, hub)
+	a := srv.Dial(t)
+	b := srv.Dial(t)
+	srv.WaitClients(t, 2)
+
+	a.Send([]byte(`{"type":"chat","data":"hi"}`))
+	if got := b.ExpectType("chat"); got["data"] != "hi" {
+		t.Fatalf("data = %v", got["data"])
+	}
+	// 預設不回送給發送者
+	a.ExpectNone(100 * time.Millisecond)
+}
+
+func TestSlowClientDisconnect(t *testing.T) {
+	hub, err := websocket.NewHub(websocket.WithSendCap(2), websocket.WithSlowClient(websocket.DisconnectImmediately))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(t, hub)
+	c := srv.Dial(t)
+	srv.WaitClients(t, 1)
+
+	c.Pause()
+	for i := 0; i < 20; i++ {
+		hub.Broadcast([]byte(`{"type":"tick"}`))
+	}
+	if code, _ := c.ExpectClose(); code != websocket.ClosePolicyViolation {
+		t.Fatalf("close code = %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+	srv.WaitClients(t, 0)
+}
@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 寫入期限：一般訊息為 WriteWait，ping、heartbeat、close frame 與協定控制封包為 ControlWriteWait，
+// Client.SendWithin 與 BatchMessage.WriteWait 可為單則訊息另外指定。
+// WriteRetries > 0 時，TCP window 暫時塞住造成的寫入逾時不會立刻斷線（見 retryConn）
+
+// writeDeadline 一般訊息的寫入期限（僅在 writePump 內呼叫）
+func (c *Client) writeDeadline(m *outbound) time.Time {
+	if m.writeWait > 0 {
+		return time.Now().Add(m.writeWait)
+	}
+	if m.control {
+		return c.controlDeadline()
+	}
+	return time.Now().Add(c.hub.opts.WriteWait)
+}
+
+// controlDeadline ping、close frame 等控制訊息的寫入期限
+func (c *Client) controlDeadline() time.Time {
+	return time.Now().Add(c.hub.opts.ControlWriteWait)
+}
+
+// SendWithin 與 Send 相同，但這則訊息的寫入期限為 d（例如即時性高的訊息給較短的期限）
+func (c *Client) SendWithin(b []byte, d time.Duration) error {
+	return c.shard.sendDirect(directMsg{client: c, data: b, seal: true, writeWait: d})
+}
+
+// retryConn 包住升級後的連線：寫入逾時時從寫到一半處接續，再給同樣長的期限，最多 retries 次，
+// 仍失敗才交還 gorilla 視為斷線。TCP 串流本身沒有中斷，所以 frame 不會損壞。
+// gorilla 的寫入都在它自己的鎖內進行，這裡不需要另外加鎖。
+// TLS 連線寫入逾時後狀態即損壞，無法接續，不會包上 retryConn
+type retryConn struct {
+	net.Conn
+	client  *Client
+	retries int
+	window  time.Duration // 最近一次 SetWriteDeadline 的期限長度
+}
+
+func (rc *retryConn) SetWriteDeadline(t time.Time) error {
+	rc.window = 0
+	if !t.IsZero() {
+		rc.window = time.Until(t)
+	}
+	return rc.Conn.SetWriteDeadline(t)
+}
+
+func (rc *retryConn) Write(p []byte) (int, error) {
+	written := 0
+	for attempt := 0; ; attempt++ {
+		n, err := rc.Conn.Write(p[written:])
+		written += n
+		var ne net.Error
+		if err == nil || attempt >= rc.retries || rc.window <= 0 || !errors.As(err, &ne) || !ne.Timeout() {
+			return written, err
+		}
+		h := rc.client.hub
+		h.stats.writeRetries.Add(1)
+		h.opts.Logger.Debug("websocket write timed out, retrying",
+			rc.client.logAttrs("attempt", attempt+1, "written", written, "pending", len(p)-written)...)
+		if err := rc.Conn.SetWriteDeadline(time.Now().Add(rc.window)); err != nil {
+			return written, err
+		}
+	}
+}
+
+// retryWriter 讓 Upgrade hijack 到的連線包上 retryConn
+type retryWriter struct {
+	gin.ResponseWriter
+	client *Client
+}
+
+func (w retryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := conn.(*tls.Conn); ok {
+		return conn, brw, nil
+	}
+	return &retryConn{Conn: conn, client: w.client, retries: w.client.hub.opts.WriteRetries}, brw, nil
+}
+
+// upgradeWriter 開啟 WriteRetries 時回傳包上 retryWriter 的 ResponseWriter
+func (h *Hub) upgradeWriter(w gin.ResponseWriter, c *Client) gin.ResponseWriter {
+	if h.opts.WriteRetries <= 0 {
+		return w
+	}
+	return retryWriter{ResponseWriter: w, client: c}
+}
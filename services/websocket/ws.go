@@ -2,28 +2,270 @@ package websocket
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
+// 連線讀寫緩衝的預設大小
+const defaultBufferSize = 1024
+
+// 心跳與 OnSlowClient 的預設值
 const (
-	writeWait  = 10 * time.Second
-	pongWait   = 60 * time.Second
-	pingPeriod = (pongWait * 9) / 10
+	defaultWriteWait  = 10 * time.Second
+	defaultPongWait   = 60 * time.Second
+	defaultCloseGrace = time.Second
+
+	defaultSlowClientDrops  = 10
+	defaultSlowClientWindow = 10 * time.Second
 )
 
-// Options 允許調整佇列大小、最大訊息大小、壓縮與跨網域驗證
+// Options Hub 的設定；一般以 NewHub 的 With... Option 設定，也可用 WithOptions 一次帶入
 type Options struct {
 	SendCap           int
 	MaxMessageSize    int
 	EnableCompression bool
-	CheckOrigin       func(r *http.Request) bool
+
+	// ReadBufferSize / WriteBufferSize 每個連線的讀寫緩衝（bytes，預設各 1024）；訊息可大於緩衝。
+	// WriteBufferPool 不為 nil 時寫入緩衝只在寫出時向 pool 借用，上萬條大多閒置的連線可省下大部分記憶體
+	ReadBufferSize  int
+	WriteBufferSize int
+	WriteBufferPool BufferPool
+
+	// CheckOrigin 自訂升級時的 Origin 檢查（優先於 AllowedOrigins）。
+	// AllowedOrigins 允許的來源，例如 "https://example.com"、"*.example.com"（子網域）、"*"（全部）；
+	// 兩者皆未設定時只允許與請求 Host 相同的 Origin。沒有 Origin 標頭的非瀏覽器 client 一律允許
+	CheckOrigin    func(r *http.Request) bool
+	AllowedOrigins []string
+
+	// CompressionLevel permessage-deflate 的壓縮等級（-2 到 9，0 使用 gorilla 預設的 1）；
+	// CompressionThreshold 小於此 bytes 的訊息不壓縮（0 表示全部壓縮）
+	CompressionLevel     int
+	CompressionThreshold int
+
+	// TrustedProxies 可信任的反向 proxy（CIDR 或 IP）；只有來自這些位址的連線才採用
+	// X-Forwarded-For / X-Real-IP 作為 client IP（MaxConnectionsPerIP、log 等使用）。空表示不採信標頭
+	TrustedProxies []string
+
+	// Subprotocols 伺服器支援的 Sec-WebSocket-Protocol，依偏好排序
+	Subprotocols []string
+
+	// 連線上限：超過 MaxConnections 回 503（WebSocket 升級要求改以 1013 close frame 告知，見 RetryAfter），
+	// 超過 MaxConnectionsPerIP 回 429；0 表示不限制
+	MaxConnections      int
+	MaxConnectionsPerIP int
+	// RetryAfter 因 MaxConnections 或關閉中拒絕連線時建議 client 等待多久再重連（預設 5s）；
+	// 實際值在 RetryAfter 到 2×RetryAfter 之間隨機，避免被拒絕的 client 同時湧回
+	RetryAfter time.Duration
+
+	// 連線要求的速率（token bucket，每秒次數）：UpgradeRate 為全部合計，UpgradeRatePerIP 為每個 IP；
+	// 在升級與 Authenticate 之前檢查，超過時回 429 並帶 Retry-After。0 表示不限制
+	UpgradeRate       float64
+	UpgradeBurst      int
+	UpgradeRatePerIP  float64
+	UpgradeBurstPerIP int
+
+	// 心跳：WriteWait 單次寫入期限；PongWait 多久沒收到 pong 視為斷線；
+	// PingPeriod 送 ping 的間隔，必須小於 PongWait（預設 PongWait 的 9/10）
+	WriteWait  time.Duration
+	PongWait   time.Duration
+	PingPeriod time.Duration
+	// ControlWriteWait ping、heartbeat、close frame 與協定控制封包的寫入期限（預設同 WriteWait）
+	ControlWriteWait time.Duration
+	// WriteRetries 寫入逾時（例如 TCP window 暫時塞住）時再等一次 WriteWait 的次數，0 表示逾時即斷線；
+	// 只用於明文連線（TLS 在前面的 proxy 終結時適用），見 writeconn.go
+	WriteRetries int
+	// CloseGrace server 主動送出 close frame 後等待 peer 回覆 close 的時間，之後才關閉 TCP（預設 1 秒）；
+	// 期間收到的訊息一律丟棄
+	CloseGrace time.Duration
+	// AppHeartbeat 另外每隔這段時間以 JSON 訊息 {"type":"ping","ts":...} 測量每個 client 的來回時間
+	// （協定見 heartbeat.go，結果見 Client.Latency 與 HubStats.Latency）；0 表示關閉
+	AppHeartbeat time.Duration
+
+	// Authenticate 在升級前呼叫；回傳 error 則回 401 且不升級
+	Authenticate func(c *gin.Context) (ClientInfo, error)
+	// NewID 產生 client ID（例如 ULID、snowflake），ClientInfo.ID 為空時使用；需在多個 instance 間不重複。
+	// 預設為 32 字元的隨機 hex，回傳空字串時也改用預設
+	NewID func() string
+
+	// Logger 結構化 log（預設 slog.Default()）
+	Logger Logger
+
+	// 生命週期 hook（皆在 Hub.Run 之外的 goroutine 執行，可安全呼叫 Hub 方法）
+	OnConnect    func(c *Client)
+	OnDisconnect func(c *Client) // c.CloseInfo() 為斷線原因
+	// OnMessage 可改寫收到的訊息；回傳 nil 表示不廣播
+	OnMessage func(c *Client, msg []byte) []byte
+
+	// OnRoomCreated / OnRoomEmptied 房間第一個成員加入、最後一個成員離開時呼叫（跨所有 shard 計算；
+	// 在獨立 goroutine 依序呼叫，可呼叫 Hub 方法）。清空超過 RoomTTL（預設 5 分鐘）的房間會回收其歷史，
+	// 之後再加入視為新建立
+	OnRoomCreated func(room string)
+	OnRoomEmptied func(room string)
+	RoomTTL       time.Duration
+
+	// EchoToSender 為 true 時，client 送出的訊息也會廣播回自己（舊行為）
+	EchoToSender bool
+
+	// PresenceEvents 開啟後，上下線時對所有 client 廣播 {"type":"presence",...}，
+	// 並可用 {"type":"presence.list"} 取得目前在線清單
+	PresenceEvents bool
+
+	// MemberEvents 開啟後，加入 / 離開房間時對房間成員送出 {"type":"member_joined"} / {"type":"member_left"}，
+	// 並可用 {"type":"members","data":{"room":"x"}} 取得成員清單（協定見 members.go）
+	MemberEvents bool
+
+	// SequenceNumbers 開啟後廣播帶遞增的 "seq"（全域與每個房間各自計算），
+	// drop-oldest 丟掉訊息時通知 client {"type":"gap"}（協定見 sequence.go）
+	SequenceNumbers bool
+
+	// HistorySize 保留最近 N 則廣播（全域與每個房間各自保留），
+	// 新連線與剛加入房間的 client 會先收到這些訊息；0 表示關閉
+	HistorySize int
+	// HistoryStore 保存房間廣播供 Hub.RoomHistory 分頁查詢（見 history_store.go）；
+	// 未設定且 HistorySize > 0 時使用 NewMemoryHistoryStore(HistorySize)
+	HistoryStore HistoryStore
+	// MessageStore 保存所有廣播供稽核與 Hub.Messages 查詢（見 message_store.go）；
+	// MessageRetention 保留期限，過期的訊息定期刪除（0 表示不刪除）
+	MessageStore     MessageStore
+	MessageRetention time.Duration
+
+	// AuditLog REST 操作的稽核紀錄（可選，見 AuditMiddleware、Hub.Audit）
+	AuditLog AuditLog
+	// AuditRetention 稽核紀錄的保留期限，過期的定期刪除（0 表示不刪除）
+	AuditRetention time.Duration
+
+	// SlowClient 佇列滿時的策略（預設 DropOldest）
+	SlowClient SlowClientPolicy
+	// SlowCloseCode / SlowCloseReason 因背壓斷線時的 close frame（預設 1008 "slow consumer"），
+	// 例如 4000 起的自訂 code 讓 client 區分原因
+	SlowCloseCode   int
+	SlowCloseReason string
+	// OnDrop 每丟棄一則訊息呼叫一次；在 Hub.Run 內執行，不可呼叫 Hub 方法且應盡快返回
+	OnDrop func(c *Client, reason DropReason)
+	// OnSlowClient 同一個 client 在 SlowClientWindow 內因 DropOldest 丟掉 SlowClientDrops 則（預設 10 則 / 10 秒）時呼叫，
+	// dropped 為這段期間丟掉的數目；之後重新計算，仍然太慢會再呼叫。可藉此把 client 降為低頻的串流
+	// （例如離開逐筆更新的房間、改訂每秒一次的 snapshot），而不是等到佇列完全塞不進而斷線。
+	// 在另一個 goroutine 執行，可以呼叫 Hub 與 Client 的方法
+	OnSlowClient     func(c *Client, dropped int)
+	SlowClientDrops  int
+	SlowClientWindow time.Duration
+	// DeadLetter 將丟棄的訊息（含內容）交給 handler 或 channel（nil 表示關閉，見 deadletter.go）
+	DeadLetter *DeadLetterConfig
+
+	// Encryption 房間廣播與指定對象訊息的 payload 加密（nil 表示關閉，見 encryption.go）
+	Encryption *EncryptionConfig
+
+	// EventBuffer Events() channel 的容量（預設 256）
+	EventBuffer int
+
+	// 每個 client 的接收速率（token bucket）；InboundRate 為每秒訊息數，0 表示不限制
+	InboundRate   float64
+	InboundBurst  int
+	InboundPolicy RatePolicy
+
+	// 寫出頻寬上限（bytes/秒，以訊息 payload 計算）：EgressRate 為每個連線，GlobalEgressRate 為全部連線合計；
+	// 超過時 write pump 會等待，訊息留在佇列中（佇列滿時依 SlowClient 處理）。0 表示不限制
+	EgressRate       int
+	GlobalEgressRate int
+
+	// WriteCoalesce 寫出時最多把佇列中已有的 N 則文字訊息併成一個 frame（格式見 CoalesceFormat），
+	// 降低高頻推送的 syscall 與 framing 成本；client 需自行拆開（client.js 的 coalesce 選項）。0 或 1 表示不合併
+	WriteCoalesce  int
+	CoalesceFormat CoalesceFormat
+
+	// Shards 將 client 分散到 N 個事件迴圈，讓廣播 fan-out 可平行於多核（預設 1）
+	Shards int
+
+	// RPCTimeout 單一 RPC 呼叫的期限（預設 10 秒）
+	RPCTimeout time.Duration
+
+	// HandlerWorkers > 0 時 Handle 註冊的 handler 改在背景執行，整個 hub 同時最多 HandlerWorkers 個，
+	// 慢的 handler（例如寫資料庫）不會卡住 readPump 與 pong 處理。每個 client 同時最多 HandlerPerClient 個
+	// （預設 1，依收到的順序執行），尚未執行的訊息最多 HandlerQueue 則（預設 16），超過時依 HandlerOverflow 處理
+	HandlerWorkers   int
+	HandlerPerClient int
+	HandlerQueue     int
+	HandlerOverflow  HandlerOverflow
+
+	// CanPublish 房間成員是否可以 {"type":"publish","room":...} 對房間發佈（nil 表示成員都可以）；
+	// Denied 唯讀 client 的訊息與未授權的發佈如何處理（預設 DenyReply，見 permission.go）
+	CanPublish func(c *Client, room string) bool
+	Denied     DenyPolicy
+	// SlowMode 房間預設的 slow mode 間隔（每個使用者每 N 秒只能發佈一則，0 表示不限制）；
+	// Hub.SetSlowMode 的設定優先。在鎖內呼叫，應只查表
+	SlowMode func(room string) time.Duration
+	// DedupWindow client 在 envelope 帶字串 id 時，同一發送者在這段時間內重送相同 id 的訊息會被丟棄
+	// （見 dedup.go）；0 表示關閉
+	DedupWindow time.Duration
+
+	// FanoutWorkers 大量對象的廣播由 N 個 worker 平行放入 client 佇列（同一 client 的順序不變）；
+	// 0 表示由 shard 逐一投遞。開啟後 OutboundFunc 會被並行呼叫
+	FanoutWorkers int
+
+	// Codec 預設的編解碼（預設 JSONCodec）；Codecs 以 subprotocol 名稱對應 codec，
+	// 協商出該 subprotocol 的 client 改用對應的 codec（名稱會自動加入 Subprotocols）
+	Codec  Codec
+	Codecs map[string]Codec
+
+	// ResumeBuffer 每個 session 保留最近 N 則訊息，斷線後可用 ?resume=<token>&last_seq=N 續接並補送
+	// （協定見 session.go）；0 表示關閉。ResumeTTL 斷線後保留 session 的時間（預設 2 分鐘）
+	ResumeBuffer int
+	ResumeTTL    time.Duration
+	// SessionStore 斷線中的 session 與使用者連線的共用儲存（可選，見 sessionstore.go），
+	// 讓 client 在 instance 重啟後或連到其他 instance 時仍能續接；未設定時只保存在本 instance 的記憶體內
+	SessionStore SessionStore
+
+	// IdleTimeout 超過此時間沒有送出應用層訊息的 client 會收到警告，IdleGrace（預設 30 秒）後關閉
+	// （協定見 idle.go）；0 表示不限制
+	IdleTimeout time.Duration
+	IdleGrace   time.Duration
+
+	// DuplicateLogin 同一個 userID 已有連線時的處理方式（預設 LoginAllowMultiple）
+	DuplicateLogin LoginPolicy
+
+	// OpenTelemetry（預設使用 otel 的全域 TracerProvider / TextMapPropagator）
+	TracerProvider trace.TracerProvider
+	Propagator     propagation.TextMapPropagator
+
+	// Webhook 將連線、房間與異常斷線事件 POST 到外部 URL（nil 表示關閉）
+	Webhook *WebhookConfig
+
+	// BanStore 封鎖名單的持久化（可選）；NewHub 時載入，Ban / Unban 時寫入
+	BanStore BanStore
+
+	// MQTT 開啟 MQTT over WebSocket 相容模式（subprotocol "mqtt" 會自動加入 Subprotocols，協定見 mqtt.go）；nil 表示關閉
+	MQTT *MQTTConfig
+
+	// SocketIO ServeSocketIO 端點的設定（可選，協定見 socketio.go）
+	SocketIO *SocketIOConfig
+
+	// GraphQL 開啟 graphql-transport-ws 轉接（subprotocol 會自動加入 Subprotocols，協定見 graphql.go）；nil 表示關閉
+	GraphQL *GraphQLConfig
+
+	// ProtobufEnvelope 接受以 "envelope.v1+protobuf" 連線、以 protobuf Envelope 收發的 client（見 protobuf.go）
+	ProtobufEnvelope bool
 }
 
 func (o *Options) withDefaults() {
@@ -33,80 +275,794 @@ func (o *Options) withDefaults() {
 	if o.MaxMessageSize <= 0 {
 		o.MaxMessageSize = 8192
 	}
+	if o.HandlerWorkers > 0 {
+		if o.HandlerPerClient <= 0 {
+			o.HandlerPerClient = 1
+		}
+		if o.HandlerQueue <= 0 {
+			o.HandlerQueue = defaultHandlerQueue
+		}
+	}
+	if o.ReadBufferSize <= 0 {
+		o.ReadBufferSize = defaultBufferSize
+	}
+	if o.WriteBufferSize <= 0 {
+		o.WriteBufferSize = defaultBufferSize
+	}
+	if o.EventBuffer <= 0 {
+		o.EventBuffer = defaultEventBuffer
+	}
+	if o.RetryAfter <= 0 {
+		o.RetryAfter = defaultRetryAfter
+	}
 	if o.CheckOrigin == nil {
-		o.CheckOrigin = func(r *http.Request) bool { return true }
+		o.CheckOrigin = sameOrigin
+		if patterns, err := parseOrigins(o.AllowedOrigins); err == nil && len(patterns) > 0 {
+			o.CheckOrigin = allowOrigins(patterns)
+		}
+	}
+	if o.WriteWait <= 0 {
+		o.WriteWait = defaultWriteWait
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = defaultPongWait
+	}
+	if o.ControlWriteWait <= 0 {
+		o.ControlWriteWait = o.WriteWait
+	}
+	if o.SlowClientDrops <= 0 {
+		o.SlowClientDrops = defaultSlowClientDrops
+	}
+	if o.SlowClientWindow <= 0 {
+		o.SlowClientWindow = defaultSlowClientWindow
+	}
+	if o.CloseGrace <= 0 {
+		o.CloseGrace = defaultCloseGrace
+	}
+	if o.SlowCloseCode == 0 {
+		o.SlowCloseCode = ClosePolicyViolation
+	}
+	if o.SlowCloseReason == "" {
+		o.SlowCloseReason = "slow consumer"
+	}
+	if o.PingPeriod <= 0 {
+		o.PingPeriod = (o.PongWait * 9) / 10
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	if o.Shards <= 0 {
+		o.Shards = 1
+	}
+	if o.Codec == nil {
+		o.Codec = JSONCodec{}
+	}
+	if o.ResumeTTL <= 0 {
+		o.ResumeTTL = defaultResumeTTL
+	}
+	if o.RoomTTL <= 0 {
+		o.RoomTTL = defaultRoomTTL
+	}
+	if o.HistoryStore == nil && o.HistorySize > 0 {
+		o.HistoryStore = NewMemoryHistoryStore(o.HistorySize)
+	}
+	if o.RPCTimeout <= 0 {
+		o.RPCTimeout = defaultRPCTimeout
+	}
+	if o.IdleTimeout > 0 && o.IdleGrace <= 0 {
+		o.IdleGrace = defaultIdleGrace
+	}
+	if o.Webhook != nil {
+		// 複製一份，避免改到呼叫端的設定
+		w := *o.Webhook
+		w.URLs, w.Events = slices.Clone(w.URLs), slices.Clone(w.Events)
+		w.withDefaults()
+		o.Webhook = &w
+	}
+	if o.DeadLetter != nil {
+		d := *o.DeadLetter
+		if d.QueueSize <= 0 {
+			d.QueueSize = defaultDeadLetterQueue
+		}
+		o.DeadLetter = &d
+	}
+	if o.Encryption != nil {
+		e := *o.Encryption
+		if e.Encrypt == nil {
+			e.Encrypt, e.Decrypt = EncryptAESGCM, DecryptAESGCM
+		}
+		o.Encryption = &e
+	}
+	if len(o.Codecs) > 0 {
+		names := make([]string, 0, len(o.Codecs))
+		for name := range o.Codecs {
+			if name != "" && !slices.Contains(o.Subprotocols, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		o.Subprotocols = append(slices.Clone(o.Subprotocols), names...)
+	}
+	if o.MQTT != nil && !slices.Contains(o.Subprotocols, mqttSubprotocol) {
+		o.Subprotocols = append(slices.Clone(o.Subprotocols), mqttSubprotocol)
+	}
+	if o.GraphQL != nil && !slices.Contains(o.Subprotocols, graphQLSubprotocol) {
+		o.Subprotocols = append(slices.Clone(o.Subprotocols), graphQLSubprotocol)
+	}
+	if o.ProtobufEnvelope && !slices.Contains(o.Subprotocols, protobufSubprotocol) {
+		o.Subprotocols = append(slices.Clone(o.Subprotocols), protobufSubprotocol)
+	}
+	if o.InboundRate > 0 && o.InboundBurst <= 0 {
+		o.InboundBurst = 1
+	}
+	if o.UpgradeRate > 0 && o.UpgradeBurst <= 0 {
+		o.UpgradeBurst = 1
+	}
+	if o.UpgradeRatePerIP > 0 && o.UpgradeBurstPerIP <= 0 {
+		o.UpgradeBurstPerIP = 1
 	}
 }
 
-// Hub: 管理所有連線
+// BufferPool 連線共用的寫入緩衝（見 Options.WriteBufferPool），*sync.Pool 即可
+type BufferPool = websocket.BufferPool
+
+// ErrClientNotFound 指定的 client ID 不存在（或已斷線）
+var ErrClientNotFound = errors.New("websocket: client not found")
+
+// Hub: 管理所有連線；client 依 ID 分散到 Options.Shards 個 shard，各自有事件迴圈
 type Hub struct {
-	clients    map[*client]bool
-	broadcast  chan []byte
-	register   chan *client
-	unregister chan *client
+	id     string
+	shards []*shard
+
+	// 依 Options 建立一次，所有升級請求共用
+	upgrader websocket.Upgrader
+
+	// 依 envelope type 分派的 handler
+	handlers handlers
+
+	// RegisterRPC 註冊的 method
+	rpc rpcMethods
+
+	// 依 envelope type 註冊的 schema 驗證
+	validators validators
+
+	// UseInbound / UseOutbound 註冊的 middleware
+	inbound  inboundChain
+	outbound outboundChain
+
+	// BroadcastWithAck 等待中的回覆
+	acks ackRegistry
+
+	// 連線數（MaxConnections / MaxConnectionsPerIP）
+	conns connCounter
+
+	// UpgradeRate / UpgradeRatePerIP（可為 nil）
+	upgrades *upgradeLimiter
+
+	// 背壓丟棄的累計數
+	dropped atomic.Uint64
+
+	// Len / Stats 用的計數器
+	stats counters
+	// AppHeartbeat 測得的 RTT
+	latency latencyCounters
+
+	// SequenceNumbers 的廣播序號
+	seq sequencer
+
+	// 跨 shard 的房間成員數與待呼叫的房間 hook
+	rooms     roomRegistry
+	roomHooks roomHooks
+	// 房間 slow mode 的設定與最後發佈時間
+	slowMode slowModes
+	// DedupWindow 的去重表
+	dedup dedupCache
+
+	// DuplicateLogin 用的跨 shard userID 佔用狀態
+	logins loginRegistry
+
+	// 待送出的 presence 事件（由 Run 的轉送 goroutine 送到所有 shard）
+	events eventQueue
+
+	// 已解析的 Options.TrustedProxies
+	trustedProxies []netip.Prefix
+
+	// 封鎖的 IP 與 userID
+	bans banList
+
+	// 跨 instance 廣播（可選）
+	backplane Backplane
+
+	// 同一個 process 內轉送到其他 hub（Pipe）
+	pipes hubPipes
+
+	// RegisterState 註冊的狀態
+	states stateRegistry
+
+	tracing tracing
+
+	// GlobalEgressRate 的 token bucket（可為 nil）
+	egress *rate.Limiter
+
+	// FanoutWorkers > 0 時的投遞 worker
+	fanout *fanoutPool
+
+	// 事件 webhook（可選）
+	webhooks *webhooks
+
+	// 丟棄訊息的 dead-letter 佇列（可選）
+	deadLetters *deadLetters
+
+	// 寫入 Options.SessionStore（可為 nil）
+	sessionSync *sessionSync
+
+	// 寫入 Options.HistoryStore（可為 nil）
+	historyLog *historyWriter
+
+	// 寫入 Options.MessageStore（可為 nil）
+	messageLog *messageWriter
+
+	// HandlerWorkers 個名額，所有 client 的 handler worker 共用（nil 表示同步執行）
+	handlerSlots chan struct{}
+
+	// Events() 的事件
+	bus eventBus
+
+	// 所有 client context 的 parent；Shutdown 或 Run 的 ctx 取消時取消
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// 關閉流程；running 在 Run 執行期間為 true
+	running atomic.Bool
+	closing atomic.Bool
+	// Drain 開始的時間（unix nano），0 表示沒有在 draining
+	drainSince atomic.Int64
+	quit       chan struct{}
+	quitOnce   sync.Once
+	done       chan struct{} // 所有 shard 結束後關閉
 
 	// 設定
 	opts Options
 }
 
-func NewHub(opts *Options) *Hub {
-	o := Options{}
-	if opts != nil {
-		o = *opts
+// validate 檢查補上預設值後仍不合理的設定（包含 WithOptions 直接帶入的值）
+func (o *Options) validate() error {
+	if o.MaxMessageSize < maxControlPayload {
+		return fmt.Errorf("websocket: MaxMessageSize must be at least %d, got %d", maxControlPayload, o.MaxMessageSize)
+	}
+	if o.PingPeriod >= o.PongWait {
+		return fmt.Errorf("websocket: PingPeriod (%s) must be less than PongWait (%s)", o.PingPeriod, o.PongWait)
+	}
+	if err := validCloseFrame(o.SlowCloseCode, o.SlowCloseReason); err != nil {
+		return fmt.Errorf("websocket: SlowCloseCode: %w", err)
+	}
+	if o.Denied < DenyReply || o.Denied > DenyDisconnect {
+		return fmt.Errorf("websocket: unknown DenyPolicy %d", o.Denied)
+	}
+	if o.WriteRetries < 0 {
+		return fmt.Errorf("websocket: WriteRetries must not be negative, got %d", o.WriteRetries)
+	}
+	if o.DedupWindow < 0 {
+		return fmt.Errorf("websocket: DedupWindow must not be negative, got %s", o.DedupWindow)
+	}
+	if o.HandlerWorkers < 0 {
+		return fmt.Errorf("websocket: HandlerWorkers must not be negative, got %d", o.HandlerWorkers)
+	}
+	if o.HandlerOverflow < HandlerReject || o.HandlerOverflow > HandlerDisconnect {
+		return fmt.Errorf("websocket: unknown HandlerOverflow %d", o.HandlerOverflow)
+	}
+	if o.AuditRetention < 0 {
+		return fmt.Errorf("websocket: AuditRetention must not be negative, got %s", o.AuditRetention)
+	}
+	if o.MessageRetention < 0 {
+		return fmt.Errorf("websocket: MessageRetention must not be negative, got %s", o.MessageRetention)
+	}
+	if o.AppHeartbeat < 0 {
+		return fmt.Errorf("websocket: AppHeartbeat must not be negative, got %s", o.AppHeartbeat)
+	}
+	if o.CompressionLevel < minCompressionLevel || o.CompressionLevel > maxCompressionLevel {
+		return fmt.Errorf("websocket: CompressionLevel must be between %d and %d, got %d", minCompressionLevel, maxCompressionLevel, o.CompressionLevel)
+	}
+	if o.MaxConnections > 0 && o.MaxConnectionsPerIP > o.MaxConnections {
+		return fmt.Errorf("websocket: MaxConnectionsPerIP (%d) exceeds MaxConnections (%d)", o.MaxConnectionsPerIP, o.MaxConnections)
+	}
+	if o.UpgradeRate < 0 || o.UpgradeRatePerIP < 0 {
+		return fmt.Errorf("websocket: upgrade rates must not be negative, got %v and %v", o.UpgradeRate, o.UpgradeRatePerIP)
+	}
+	if o.EgressRate < 0 || o.GlobalEgressRate < 0 {
+		return fmt.Errorf("websocket: egress rates must not be negative, got %d and %d", o.EgressRate, o.GlobalEgressRate)
+	}
+	if o.WriteCoalesce < 0 || o.CoalesceFormat < CoalesceArray || o.CoalesceFormat > CoalesceLines {
+		return fmt.Errorf("websocket: invalid write coalescing %d (format %d)", o.WriteCoalesce, o.CoalesceFormat)
+	}
+	if o.IdleTimeout < 0 {
+		return fmt.Errorf("websocket: IdleTimeout must not be negative, got %s", o.IdleTimeout)
+	}
+	if _, err := parseTrustedProxies(o.TrustedProxies); err != nil {
+		return err
+	}
+	if _, err := parseOrigins(o.AllowedOrigins); err != nil {
+		return err
+	}
+	if o.GraphQL != nil {
+		if err := o.GraphQL.validate(); err != nil {
+			return err
+		}
+	}
+	if o.DeadLetter != nil {
+		if err := o.DeadLetter.validate(); err != nil {
+			return err
+		}
+	}
+	if o.Encryption != nil {
+		if err := o.Encryption.validate(); err != nil {
+			return err
+		}
+	}
+	if o.Webhook != nil {
+		return o.Webhook.validate()
+	}
+	return nil
+}
+
+// NewHub 依 Option 建立 Hub，例如 NewHub(WithSendCap(256), WithCompression())；
+// 任一 Option 或整體設定不合理時回傳 error
+func NewHub(opts ...Option) (*Hub, error) {
+	var o Options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
 	}
 	o.withDefaults()
-	return &Hub{
-		clients:    make(map[*client]bool),
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *client),
-		unregister: make(chan *client),
-		opts:       o,
+	if err := o.validate(); err != nil {
+		return nil, err
 	}
+	h := &Hub{
+		id:        newClientID(),
+		events:    eventQueue{signal: make(chan struct{}, 1)},
+		roomHooks: roomHooks{signal: make(chan struct{}, 1)},
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+		opts:      o,
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:    o.ReadBufferSize,
+		WriteBufferSize:   o.WriteBufferSize,
+		WriteBufferPool:   o.WriteBufferPool,
+		EnableCompression: o.EnableCompression,
+		CheckOrigin:       o.CheckOrigin,
+		Subprotocols:      o.Subprotocols,
+	}
+	h.tracing = newTracing(&o)
+	h.trustedProxies, _ = parseTrustedProxies(o.TrustedProxies)
+	h.webhooks = newWebhooks(o.Webhook)
+	h.deadLetters = newDeadLetters(o.DeadLetter)
+	h.sessionSync = newSessionSync(o.SessionStore)
+	h.historyLog = newHistoryWriter(o.HistoryStore)
+	h.messageLog = newMessageWriter(o.MessageStore, o.MessageRetention)
+	if o.HandlerWorkers > 0 {
+		h.handlerSlots = make(chan struct{}, o.HandlerWorkers)
+	}
+	h.fanout = newFanoutPool(o.FanoutWorkers)
+	h.egress = o.newEgressLimiter(o.GlobalEgressRate)
+	h.upgrades = o.newUpgradeLimiter()
+	if o.BanStore != nil {
+		if err := h.loadBans(); err != nil {
+			return nil, err
+		}
+	}
+	h.shards = make([]*shard, o.Shards)
+	for i := range h.shards {
+		h.shards[i] = newShard(h)
+	}
+	if o.PresenceEvents {
+		h.Handle("presence.list", h.handlePresenceList)
+	}
+	if o.MemberEvents {
+		h.Handle("members", h.handleMembers)
+	}
+	return h, nil
 }
 
-func (h *Hub) Run() {
-	for {
+// Run 執行所有 shard 的事件迴圈，直到 ctx 取消或呼叫 Shutdown；
+// 結束時會對所有 client 送出 close frame 並關閉連線
+func (h *Hub) Run(ctx context.Context) {
+	h.running.Store(true)
+	defer h.running.Store(false)
+	defer close(h.done)
+	defer h.cancel()
+	// 開始關閉時就取消所有 client 的 context，不等 shard 結束
+	go func() {
 		select {
-		case c := <-h.register:
-			h.clients[c] = true
-		case c := <-h.unregister:
-			if h.clients[c] {
-				delete(h.clients, c)
-				close(c.send)
+		case <-ctx.Done():
+		case <-h.quit:
+		case <-h.done:
+		}
+		h.cancel()
+	}()
+	go h.forwardEvents()
+	go h.runRoomHooks()
+	if h.webhooks != nil {
+		h.webhooks.run(h)
+	}
+	if h.deadLetters != nil {
+		go h.deadLetters.run(h)
+	}
+	if h.sessionSync != nil {
+		go h.sessionSync.run(h)
+	}
+	if h.historyLog != nil {
+		go h.historyLog.run(h)
+	}
+	if h.messageLog != nil {
+		go h.messageLog.run(h)
+	}
+	if h.opts.AuditLog != nil && h.opts.AuditRetention > 0 {
+		go h.pruneAudit()
+	}
+	if h.fanout != nil {
+		h.fanout.run(h.done)
+	}
+	var wg sync.WaitGroup
+	for _, s := range h.shards {
+		wg.Add(1)
+		go func(s *shard) {
+			defer wg.Done()
+			s.run(ctx)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// RunForever 為舊版 Run() 的相容入口，等同 Run(context.Background())
+//
+// Deprecated: 請改用 Run(ctx)
+func (h *Hub) RunForever() {
+	h.Run(context.Background())
+}
+
+// shardFor 依 client ID 決定所屬 shard
+func (h *Hub) shardFor(id string) *shard {
+	if len(h.shards) == 1 {
+		return h.shards[0]
+	}
+	f := fnv.New32a()
+	_, _ = f.Write([]byte(id))
+	return h.shards[f.Sum32()%uint32(len(h.shards))]
+}
+
+// broadcastMsg 廣播請求；room 與 topic 皆為空代表全域，except 不會收到（可為 nil）
+type broadcastMsg struct {
+	room      string
+	topic     string // Publish 的 topic，送給符合的訂閱者
+	msgType   int
+	data      []byte
+	except    *Client
+	out       *outbound // 由送出端預先 frame，所有 shard 共用
+	transient bool      // 不記錄到歷史（例如 presence 事件）
+
+	// 依 codec ContentType 預先編碼的版本（BroadcastValue）；沒有對應時使用 out
+	variants map[string]*outbound
+
+	trace trace.SpanContext // 送出端的 span，用於 client 寫出時的 span
+
+	via []*Hub // 經 Pipe 轉送時已經過的 hub
+
+	tally *broadcastTally // BroadcastSync 的投遞統計（可為 nil）
+}
+
+// outFor 取得要投遞給 c 的版本
+func (m *broadcastMsg) outFor(c *Client) *outbound {
+	if v, ok := m.variants[c.codec.ContentType()]; ok {
+		return v
+	}
+	return m.out
+}
+
+// 對外提供安全的廣播入口（有 backplane 時也會送到其他 instance）
+func (h *Hub) Broadcast(b []byte) {
+	h.BroadcastContext(context.Background(), b)
+}
+
+// BroadcastContext 同 Broadcast，並以 ctx 為 parent 建立 span；
+// b 為 JSON 物件時會把 trace context 放進 "trace" 欄位，讓 client 端延續同一條 trace
+func (h *Hub) BroadcastContext(ctx context.Context, b []byte) {
+	ctx, span := h.tracing.startSpan(ctx, "websocket.Broadcast", attribute.Int("websocket.message_size", len(b)))
+	defer span.End()
+	h.sendBroadcast(broadcastMsg{msgType: TextMessage, data: h.tracing.inject(ctx, b), trace: span.SpanContext()})
+}
+
+// BroadcastBinary 以 binary frame 廣播（protobuf、telemetry 等）
+func (h *Hub) BroadcastBinary(b []byte) {
+	h.BroadcastType(BinaryMessage, b)
+}
+
+// BroadcastType 以指定 frame 類型（TextMessage / BinaryMessage）廣播
+func (h *Hub) BroadcastType(msgType int, b []byte) {
+	h.sendBroadcast(broadcastMsg{msgType: msgType, data: b})
+}
+
+// BroadcastExcept 廣播給 sender 以外的所有 client
+func (h *Hub) BroadcastExcept(sender *Client, b []byte) {
+	h.sendBroadcast(broadcastMsg{msgType: TextMessage, data: b, except: sender})
+}
+
+// BroadcastWhere 只送給 match 回傳 true 的 client（例如 c.GetString("role") == "admin"），回傳送出的 client 數。
+// match 在各 shard 的事件迴圈內執行，不會與連線的加入、移除互相競爭；不可呼叫 Hub 方法且應盡快返回，panic 時視為不符合。
+// 只投遞到本 instance（不轉送 backplane）也不記入歷史；斷線中的 session 以最後的連線判斷是否補送
+func (h *Hub) BroadcastWhere(match func(c *Client) bool, b []byte) (int, error) {
+	return h.broadcastMatching(func(c *Client) bool { return c.matches(match) }, b)
+}
+
+// broadcastMatching 送給 match 回傳 true 的本機 client 與斷線中的 session（match 在 shard 內執行）
+func (h *Hub) broadcastMatching(match func(c *Client) bool, b []byte) (int, error) {
+	out := newPrepared("", TextMessage, b)
+	n := 0
+	if !h.callAll(func(s *shard) {
+		for c := range s.clients {
+			if match(c) {
+				s.deliver(c, out)
+				n++
 			}
-		case msg := <-h.broadcast:
-			for c := range h.clients {
-				select {
-				case c.send <- msg:
-				default:
-					// 背壓：丟掉最舊一筆再試；仍滿則視為過慢，斷線
-					select {
-					case <-c.send:
-					default:
-					}
-					select {
-					case c.send <- msg:
-					default:
-						close(c.send)
-						delete(h.clients, c)
-					}
+		}
+		for _, sess := range s.sessions {
+			if match(sess.client) {
+				if m := h.intercept(sess.client, out); m != nil {
+					sess.missed(m)
 				}
 			}
 		}
+	}) {
+		return 0, ErrHubClosed
 	}
+	return n, nil
 }
 
-// 對外提供安全的廣播入口
-func (h *Hub) Broadcast(b []byte) {
-	h.broadcast <- b
+// matches 執行 BroadcastWhere 的條件（在 shard 內呼叫）
+func (c *Client) matches(match func(c *Client) bool) (ok bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			c.logPanic("BroadcastWhere", p)
+			ok = false
+		}
+	}()
+	return match(c)
+}
+
+// sendBroadcast 交給各 shard 做本機投遞，再轉送 backplane 與 Pipe
+func (h *Hub) sendBroadcast(m broadcastMsg) {
+	plain := m
+	if err := h.sealRoom(&m); err != nil {
+		h.opts.Logger.Error("room broadcast dropped", "room", m.room, "err", err)
+		return
+	}
+	if h.localBroadcast(m) {
+		h.persist(m)
+		h.publish(m)
+		h.pipeOut(plain)
+	}
+}
+
+// localBroadcast 將廣播送進每個 shard；Hub 已關閉時回傳 false
+func (h *Hub) localBroadcast(m broadcastMsg) bool {
+	if h.opts.SequenceNumbers && m.sequenced() {
+		// 編號到送進所有 shard 之間持有鎖，client 收到的序號才會依序遞增
+		unlock := h.sequence(&m)
+		defer unlock()
+	}
+	if m.out == nil {
+		m.out = newPrepared(m.room, m.msgType, m.data)
+		m.out.topic = m.topic
+		m.out.trace = m.trace
+	}
+	if !m.transient {
+		h.stats.broadcasts.Add(1)
+		h.stats.lastBroadcast.Store(time.Now().UnixNano())
+	}
+	for _, s := range h.shards {
+		ch := s.broadcast
+		if m.room != "" {
+			ch = s.roomBroadcast
+		}
+		m.tally.add()
+		select {
+		case ch <- m:
+		case <-s.done:
+			m.tally.finish()
+			return false
+		}
+	}
+	return true
+}
+
+// directMsg 指定 client 的訊息（以 client 或 id 指定），result 回報是否送達佇列
+type directMsg struct {
+	id      string
+	client  *Client
+	msgType int // 0 視為 TextMessage
+	data    []byte
+	seal    bool // 以 ClientKey 加密（SendTo、Client.Send；hub 自己的回覆不加密）
+	// writeWait 這則訊息的寫入期限（0 表示 WriteWait）
+	writeWait time.Duration
+	result    chan error
+}
+
+// SendTo 只送給指定 ID 的 client
+func (h *Hub) SendTo(clientID string, b []byte) error {
+	return h.shardFor(clientID).sendDirect(directMsg{id: clientID, data: b, seal: true})
+}
+
+// sendToClient 經由 client 所屬 shard 送給指定 client
+func (h *Hub) sendToClient(c *Client, b []byte) error {
+	return c.shard.sendDirect(directMsg{client: c, data: b})
 }
 
-// --- client ---
+// --- Client ---
+
+type Client struct {
+	id    string
+	info  ClientInfo
+	hub   *Hub
+	shard *shard          // 依 id 決定，房間與使用者狀態由它擁有
+	conn  *websocket.Conn // SSE client 為 nil
+	codec Codec           // 依協商的 subprotocol 決定
+	send  chan *outbound
+
+	compressed bool // 協商出 permessage-deflate
+
+	// hub 主動斷線時送出的 close frame（close(send) 前設定）
+	closeFrame []byte
+	closeInfo  atomic.Pointer[CloseInfo] // 連線結束的原因（第一次記錄為準）
+	pumpDone   chan struct{}             // writePump 結束後關閉
+	readDone   chan struct{}             // readPump 讀到錯誤（含 peer 的 close 回覆）後關閉
+	closeSent  atomic.Bool               // 已寫出 close frame，之後讀到的訊息一律丟棄
+
+	// Context() 的 context；cancel 可重複呼叫
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	limiter *rate.Limiter // 接收速率限制（可為 nil）
+	egress  *rate.Limiter // 寫出頻寬限制（可為 nil）
+
+	remoteAddr string
+	ip         string // 計算 MaxConnectionsPerIP 用
+	joinedAt   time.Time
+	meta       RequestMeta
+
+	// 最後一次應用層訊息（unix nano）；idleWarned 送出 idle 警告的時間（僅由所屬 shard 存取）
+	lastActive atomic.Int64
+	idleWarned time.Time
+
+	// heartbeat：最後一次 ping 的時間（unix nano，收到 pong 後歸零）與測得的 RTT（ns）
+	heartbeatSent atomic.Int64
+	rtt           atomic.Int64
+
+	// 唯讀 client（見 permission.go）
+	readOnly atomic.Bool
+
+	// 處理中訊息的去重 key，被接受時才記錄（見 dedup.go，僅在 readPump 內存取）
+	dedupPending dedupKey
+
+	// HandlerWorkers > 0 時待執行的 handler 與執行中的 worker 數（見 handler_pool.go）；其餘為 nil
+	handlerJobs    chan handlerJob
+	handlerRunning atomic.Int32
+
+	// 這個連線寫出與因背壓丟棄的訊息數、最後一次收到 pong 的時間（unix nano），見 Hub.Inspect
+	messagesSent atomic.Uint64
+	bytesSent    atomic.Uint64
+	dropped      atomic.Uint64
+	lastPong     atomic.Int64
+
+	// 已丟棄但尚未以 gap 通知告知 client 的訊息數（shard 累加，write pump 取出）
+	gapPending atomic.Uint64
+
+	// OnSlowClient 的計數：slowSince 起 DropOldest 丟掉的數目（僅在 shard 內存取）
+	slowDrops int
+	slowSince time.Time
+
+	// 協商出 "mqtt" 的連線（其餘為 nil）
+	mqtt *mqttConn
+
+	// 由 ServeSocketIO 連線（其餘為 nil）
+	sio *socketIOConn
+
+	// 由 ServeJSONRPC 連線
+	jsonrpc bool
+
+	// 協商出 "graphql-transport-ws" 的連線（其餘為 nil）
+	gql *graphQLConn
+
+	// 協商出 "envelope.v1+protobuf" 的連線
+	protobuf bool
+
+	// 協定轉接（MQTT、Socket.IO、JSON-RPC、GraphQL）自己的控制封包，由 writePump 寫出；一般連線為 nil
+	packets chan *outbound
+
+	// Set / Get 的自訂資料（自帶鎖，任何 goroutine 都可存取）
+	values values
+
+	// 所屬房間與綁定的使用者（僅由所屬 shard 存取）
+	rooms  map[string]bool
+	topics map[string]bool // 訂閱的 pattern
+	userID string
+	tags   map[string]bool // BroadcastToTags 的標籤
+
+	// 訂閱 filter：key 為 topic pattern，"" 為 topic 以外的廣播（僅由所屬 shard 存取）
+	filters map[string]*Filter
 
-type client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	// 續接（ResumeBuffer > 0 時）；session 建立後不變，其內部狀態以自己的 mu 保護
+	session  *session
+	resuming bool   // 以 ?resume= 連線
+	lastSeq  uint64 // client 回報最後收到的序號
+}
+
+// ID 回傳 client 的唯一識別碼（升級時產生）
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Connected 連線是否仍在（斷線或 Hub 結束後為 false）
+func (c *Client) Connected() bool {
+	return c.ctx.Err() == nil
+}
+
+// Send 只送給這個 client；已離線時回傳 ErrClientNotFound
+func (c *Client) Send(b []byte) error {
+	return c.shard.sendDirect(directMsg{client: c, data: b, seal: true})
+}
+
+// Subprotocol 回傳協商出的 subprotocol（未協商時為空字串）
+func (c *Client) Subprotocol() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.Subprotocol()
+}
+
+// Transport 回傳連線方式："websocket"、"mqtt"、"socket.io"、"jsonrpc"、"graphql-ws" 或 "sse"
+func (c *Client) Transport() string {
+	switch {
+	case c.conn == nil:
+		return "sse"
+	case c.mqtt != nil:
+		return "mqtt"
+	case c.sio != nil:
+		return "socket.io"
+	case c.jsonrpc:
+		return "jsonrpc"
+	case c.gql != nil:
+		return "graphql-ws"
+	case c.protobuf:
+		return "protobuf"
+	}
+	return "websocket"
+}
+
+// Info 回傳 Authenticate 取得的身分資訊
+func (c *Client) Info() ClientInfo {
+	return c.info
+}
+
+// newID 依 Options.NewID 產生 client ID
+func (h *Hub) newID() string {
+	if h.opts.NewID != nil {
+		if id := h.opts.NewID(); id != "" {
+			return id
+		}
+	}
+	return newClientID()
+}
+
+// newClientID 產生隨機的 client ID
+func newClientID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand 失敗極少見，退回時間戳
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(b)
 }
 
 // isAppPing 回傳是否為應用層 ping 訊息
@@ -127,86 +1083,588 @@ func isAppPing(b []byte) bool {
 }
 
 // 接收 client 訊息
-func (c *client) readPump() {
+func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		// handler、middleware 或 gorilla 內部 panic 時仍要移除 client，避免留下註冊卻沒有 pump 的連線
+		if p := recover(); p != nil {
+			c.logPanic("readPump", p)
+			c.closeOnPanic()
+		}
+		close(c.readDone)
+		c.unregister()
 		c.conn.Close()
+		c.disconnected()
 	}()
 
 	c.conn.SetReadLimit(int64(c.hub.opts.MaxMessageSize))
+	pongWait := c.hub.opts.PongWait
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
+		c.lastPong.Store(time.Now().UnixNano())
 		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
+	switch {
+	case c.mqtt != nil:
+		c.readMQTT()
+		return
+	case c.sio != nil:
+		c.readSocketIO()
+		return
+	case c.jsonrpc:
+		c.readJSONRPC()
+		return
+	case c.gql != nil:
+		c.readGraphQL()
+		return
+	case c.protobuf:
+		c.readProtobuf()
+		return
+	}
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		msgType, message, err := c.conn.ReadMessage()
 		if err != nil {
+			if c.unexpectedClose(err) {
+				c.hub.opts.Logger.Warn("websocket read failed", c.logAttrs("err", err)...)
+			}
+			c.recordReadError(err)
 			break
 		}
-		// 忽略應用層 ping，不做廣播
-		if isAppPing(message) {
-			// （可選）只回覆送出者一個 pong
-			// c.send <- []byte(`{"type":"pong"}`)
-			continue
+		accept, keep := c.allowInbound()
+		if !keep {
+			break
+		}
+		if accept {
+			c.handle(msgType, message)
+		}
+	}
+}
+
+// handle 處理一則 client 訊息：指令、middleware、RPC、handler，最後廣播（在 readPump goroutine 執行）
+func (c *Client) handle(msgType int, message []byte) {
+	c.dedupPending = dedupKey{}
+	// binary frame 不解析指令與 envelope，保留原 frame 類型轉送
+	if msgType == websocket.BinaryMessage {
+		c.touch()
+		if c.denyReadOnly() {
+			return
+		}
+		if message, ok := c.runInbound(message); ok {
+			c.forward(msgType, message)
+		}
+		return
+	}
+	if c.heartbeat(message) {
+		return
+	}
+	// 忽略應用層 ping，不做廣播
+	if isAppPing(message) {
+		// （可選）只回覆送出者一個 pong
+		// c.send <- []byte(`{"type":"pong"}`)
+		return
+	}
+	c.touch()
+	// 房間指令：{"type":"join","room":"x"} / {"type":"leave","room":"x"}
+	if op, room, ok := parseRoomCmd(message); ok {
+		if op == "join" {
+			c.hub.JoinRoom(c, room)
+		} else {
+			c.hub.LeaveRoom(c, room)
+		}
+		return
+	}
+	// 訂閱指令：{"type":"subscribe","topic":"sensor.#","filter":"price > 100"} / {"type":"unsubscribe",...}
+	if op, topic, filter, ok := parseTopicCmd(message); ok {
+		c.topicCmd(op, topic, filter)
+		return
+	}
+	// 狀態同步：{"type":"sync","state":"dashboard"} / {"type":"unsync",...}（見 statesync.go）
+	if op, name, ok := parseSyncCmd(message); ok {
+		c.syncCmd(op, name)
+		return
+	}
+	// BroadcastWithAck 的回覆：{"type":"ack","id":"..."}
+	if id, ok := parseAck(message); ok {
+		c.hub.ack(c, id)
+		return
+	}
+	// 唯讀 client 只能執行上面的指令
+	if c.denyReadOnly() {
+		return
+	}
+	// 帶相同 id 的重送（見 dedup.go）
+	if c.duplicate(message) {
+		return
+	}
+	// "encrypted":true 的 envelope 先解密（見 encryption.go）
+	message, ok := c.open(message)
+	if !ok {
+		return
+	}
+	// inbound middleware：驗證、過濾、改寫或拒絕
+	message, ok = c.runInbound(message)
+	if !ok {
+		return
+	}
+	// 房間發佈：{"type":"publish","room":"x",...}，需為房間成員且通過 CanPublish
+	if room, ok := parsePublishCmd(message); ok {
+		c.publishRoom(room, message)
+		return
+	}
+	// RPC：{"type":"rpc","id":7,"method":"...","params":...}，回應只送給呼叫者
+	if req, ok := parseRPC(message); ok {
+		c.handleRPC(req)
+		return
+	}
+	// 註冊了 schema 的 type 先驗證，失敗時回送欄位原因
+	if !c.validate(message) {
+		return
+	}
+	// 有註冊 handler 的 envelope 交給 handler，不廣播
+	if c.hub.dispatch(c, message) {
+		return
+	}
+	c.forward(msgType, message)
+}
+
+// topicCmd 執行訂閱指令；subscribe 以這次的 filter 取代該訂閱原本的 filter（沒帶表示不過濾），
+// 沒有 topic 時設定或移除（unsubscribe）topic 以外廣播的 filter
+func (c *Client) topicCmd(op, topic string, filter *string) {
+	expr := ""
+	if filter != nil && op == "subscribe" {
+		expr = *filter
+	}
+	var err error
+	switch {
+	case topic == "":
+		err = c.hub.SetFilter(c, expr)
+	case op == "unsubscribe":
+		c.hub.Unsubscribe(c, topic)
+	default:
+		err = c.hub.SubscribeFilter(c, topic, expr)
+	}
+	if err == nil {
+		return
+	}
+	c.hub.opts.Logger.Warn("websocket subscribe failed", c.logAttrs("topic", topic, "err", err)...)
+	if errors.Is(err, ErrInvalidFilter) {
+		_ = c.hub.sendToClient(c, errorEnvelope(err))
+	}
+}
+
+// forward 經 OnMessage 後把 client 訊息廣播出去
+func (c *Client) forward(msgType int, message []byte) {
+	if c.hub.opts.OnMessage != nil {
+		if message = c.hub.opts.OnMessage(c, message); message == nil {
+			return
 		}
-		c.hub.broadcast <- message
 	}
+	if !c.acceptDedup() {
+		return
+	}
+	m := broadcastMsg{msgType: msgType, data: message}
+	if !c.hub.opts.EchoToSender {
+		m.except = c
+	}
+	c.hub.sendBroadcast(m)
 }
 
 // 發送訊息 to client
-func (c *client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.opts.PingPeriod)
+	var heartbeat <-chan time.Time
+	if c.heartbeats() {
+		t := time.NewTicker(c.hub.opts.AppHeartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
 	defer func() {
+		// 關閉連線後 readPump 會讀到錯誤並移除 client
+		if p := recover(); p != nil {
+			c.logPanic("writePump", p)
+			c.recordClose(CloseInternalServerErr, "internal error", true)
+		}
 		ticker.Stop()
 		c.conn.Close()
+		c.cancel()
+		close(c.pumpDone)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.send:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.writeClose()
+				c.awaitCloseReply()
+				return
+			}
+			if !c.writable(message) {
+				continue
+			}
+			if c.coalescable(message) {
+				batch, next, open := c.drain(message)
+				if !c.writeBatch(batch) {
+					return
+				}
+				if !open {
+					c.writeClose()
+					c.awaitCloseReply()
+					return
+				}
+				if next == nil {
+					continue
+				}
+				message = next
+			}
+			if !c.writeMessage(message) {
 				return
 			}
-			// 一則訊息一個 frame，避免越併越大
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		case p := <-c.packets:
+			_ = c.conn.SetWriteDeadline(c.controlDeadline())
+			if err := p.write(c.conn); err != nil {
+				c.recordClose(CloseAbnormalClosure, err.Error(), false)
 				return
 			}
 		case <-ticker.C:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			_ = c.conn.SetWriteDeadline(c.controlDeadline())
+			if err := c.ping(); err != nil {
+				c.recordClose(CloseAbnormalClosure, err.Error(), false)
+				return
+			}
+		case <-heartbeat:
+			_ = c.conn.SetWriteDeadline(c.controlDeadline())
+			if err := c.writeHeartbeat(); err != nil {
+				c.recordClose(CloseAbnormalClosure, err.Error(), false)
 				return
 			}
 		}
 	}
 }
 
+// writable 這則訊息是否要寫出到這個連線（僅在 writePump 內呼叫）
+func (c *Client) writable(m *outbound) bool {
+	// MQTT 與 GraphQL client 只收 topic 訊息
+	if (c.mqtt != nil || c.gql != nil) && m.topic == "" {
+		return false
+	}
+	// session 已由新連線續接時不再寫出（訊息仍留在 session buffer）
+	if c.session != nil {
+		if _, ok := c.session.written(c, m); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeClose 佇列已關閉：送出剩下的協定封包與 close frame（僅在 writePump 內呼叫）
+func (c *Client) writeClose() {
+	_ = c.conn.SetWriteDeadline(c.controlDeadline())
+	c.flushPackets()
+	c.closeSent.Store(true)
+	_ = c.conn.WriteMessage(websocket.CloseMessage, c.closeFrame)
+}
+
+// writeGap 先告知前面漏掉的訊息；寫出失敗時回傳 false（僅在 writePump 內呼叫）
+func (c *Client) writeGap() bool {
+	if gap := c.takeGap(); gap != nil && c.mqtt == nil && c.gql == nil {
+		var err error
+		if c.protobuf {
+			err = c.writeProtobuf(gap)
+		} else {
+			err = gap.write(c.conn)
+		}
+		if err != nil {
+			c.recordClose(CloseAbnormalClosure, err.Error(), false)
+			return false
+		}
+	}
+	return true
+}
+
+// writeMessage 寫出一則訊息；失敗時記錄原因並回傳 false（僅在 writePump 內呼叫）
+func (c *Client) writeMessage(m *outbound) bool {
+	c.throttle(m)
+	_ = c.conn.SetWriteDeadline(c.writeDeadline(m))
+	if !c.writeGap() {
+		return false
+	}
+	// 未開啟 WriteCoalesce 時一則訊息一個 frame，避免越併越大
+	span := c.traceWrite(m)
+	c.compressFor(m)
+	err := c.write(m)
+	if span != nil {
+		if err != nil {
+			fail(span, err)
+		}
+		span.End()
+	}
+	if err != nil {
+		c.hub.opts.Logger.Warn("websocket write failed", c.logAttrs("room", m.room, "err", err)...)
+		c.recordClose(CloseAbnormalClosure, err.Error(), false)
+		return false
+	}
+	c.sent(m)
+	return true
+}
+
 // --- WebSocket handler ---
 
+// ServeWs 升級為 WebSocket 的 handler。可以掛在一般的 gin middleware（驗證、request ID、語系等）之後：
+//
+//   - middleware 以 c.Abort / c.AbortWithStatus 拒絕時不會升級
+//   - c.Set 存放的值可由 Client.Get 取得，也在 Client.Context() 的 Value 內；request ID 與語系見 Client.Meta()
+//   - 已由 middleware 驗證過身分時，以 WithAuthenticate(ContextAuth(key, claimsKey)) 沿用，不必再驗一次
+//   - 會包裝 c.Writer 的 middleware（gzip、timeout 等）必須保留 http.Hijacker，否則升級失敗；請勿掛在 WebSocket 路由上
+//   - 升級後 middleware 在 c.Next() 之後的程式（存取 log 等）會立即執行，不會等連線結束
 func ServeWs(h *Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		upgrader := websocket.Upgrader{
-			ReadBufferSize:    1024,
-			WriteBufferSize:   1024,
-			EnableCompression: h.opts.EnableCompression,
-			CheckOrigin:       h.opts.CheckOrigin,
+		h.serveWs(c, "websocket.ServeWs", nil)
+	}
+}
+
+// serveWs 檢查、升級並註冊連線；adapt 不為 nil 時在註冊前設定協定轉接（例如 Socket.IO），回傳 error 則放棄連線
+func (h *Hub) serveWs(c *gin.Context, spanName string, adapt func(cl *Client) error) {
+	_, span := h.tracing.startSpan(h.tracing.fromRequest(c.Request), spanName,
+		attribute.String("websocket.remote", c.Request.RemoteAddr))
+	defer span.End()
+
+	lastSeq, _ := strconv.ParseUint(c.Query("last_seq"), 10, 64)
+	a, admitted := h.admit(c, span, c.Query("resume"), lastSeq)
+	if !admitted {
+		return
+	}
+	cl := h.newClient(a, c.Request.RemoteAddr, h.opts.Codec)
+	ok := false
+	defer func() {
+		// 升級或註冊失敗時歸還名額與 userID；成功時由 readPump 結束時歸還
+		if !ok {
+			h.conns.release(a.ip)
+			h.logins.release(cl)
+			cl.cancel()
 		}
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-		if err != nil {
-			log.Printf("upgrade error: %v", err)
+	}()
+	if err := h.claimLogin(cl, a.info.UserID); err != nil {
+		fail(span, err)
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(h.upgradeWriter(c.Writer, cl), c.Request, nil)
+	if err != nil {
+		fail(span, err)
+		h.opts.Logger.Warn("websocket upgrade failed", "remote", c.Request.RemoteAddr, "err", err)
+		return
+	}
+	cl.conn = conn
+	cl.remoteAddr = conn.RemoteAddr().String()
+	cl.codec = h.codecFor(conn.Subprotocol())
+	switch {
+	case h.opts.MQTT != nil && conn.Subprotocol() == mqttSubprotocol:
+		// MQTT 沒有續接協定；session 訊息也無法以 MQTT 封包送出
+		cl.mqtt = &mqttConn{cfg: h.opts.MQTT}
+		cl.packets = make(chan *outbound, protocolPacketQueue)
+		cl.session, cl.resuming = nil, false
+	case h.opts.GraphQL != nil && conn.Subprotocol() == graphQLSubprotocol:
+		cl.gql = newGraphQLConn(h.opts.GraphQL)
+		cl.packets = make(chan *outbound, protocolPacketQueue)
+		cl.session, cl.resuming = nil, false
+	case h.opts.ProtobufEnvelope && conn.Subprotocol() == protobufSubprotocol:
+		cl.protobuf = true
+	}
+	cl.setupCompression(c.Request)
+	cl.limiter = h.opts.newInboundLimiter()
+	if adapt != nil {
+		if err := adapt(cl); err != nil {
+			fail(span, err)
+			h.opts.Logger.Warn("websocket handshake failed", cl.logAttrs("err", err)...)
+			conn.Close()
 			return
 		}
-		cl := &client{
-			hub:  h,
-			conn: conn,
-			send: make(chan []byte, h.opts.SendCap),
+	}
+	if cl.packets == nil && cl.heartbeats() {
+		// 回覆 client 的 heartbeat ping
+		cl.packets = make(chan *outbound, protocolPacketQueue)
+	}
+	if !h.register(cl) {
+		writeRetryClose(conn, "server shutting down", h.retryAfter())
+		conn.Close()
+		return
+	}
+	ok = true
+	span.SetAttributes(attribute.String("websocket.client_id", cl.id))
+	h.connected(cl)
+
+	go cl.writePump()
+	go cl.readPump()
+}
+
+// admission 通過 admit 的連線要求（ServeWs 與 ServeSSE 共用）
+type admission struct {
+	ctx      context.Context // requestContext
+	info     ClientInfo
+	ip       string
+	session  *session
+	resuming bool
+	lastSeq  uint64
+	sendCap  int
+	meta     RequestMeta
+	keys     map[string]any // 升級請求的 gin c.Keys
+}
+
+// admit 依序檢查關閉中、封鎖名單、連線要求速率、連線上限、Authenticate 與續接 token；失敗時已回應 HTTP 錯誤並回傳 false。
+// 成功時已預留連線名額，之後失敗需由呼叫端 h.conns.release(a.ip)
+func (h *Hub) admit(c *gin.Context, span trace.Span, resumeToken string, lastSeq uint64) (admission, bool) {
+	if h.closing.Load() {
+		h.overloaded(c, "server shutting down")
+		return admission{}, false
+	}
+	if h.drainSince.Load() != 0 {
+		h.rejectDraining(c)
+		return admission{}, false
+	}
+
+	a := admission{ctx: requestContext(c), ip: h.clientIP(c.Request), sendCap: h.opts.SendCap, keys: c.Keys}
+	a.meta = newRequestMeta(c, a.ip)
+	if h.banned(a.ip, "") {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "banned"})
+		return admission{}, false
+	}
+	if h.upgrades != nil {
+		if wait, ok := h.upgrades.allow(a.ip); !ok {
+			h.stats.upgradesLimited.Add(1)
+			fail(span, errUpgradeRateLimited)
+			c.Header("Retry-After", retryAfterHeader(wait))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many connection attempts"})
+			return admission{}, false
+		}
+	}
+	switch h.conns.acquire(a.ip, h.opts.MaxConnections, h.opts.MaxConnectionsPerIP) {
+	case 0:
+	case http.StatusServiceUnavailable:
+		h.overloaded(c, "too many connections")
+		return admission{}, false
+	default:
+		// 單一 IP 超過上限：仍回 429，但同樣告知何時再試
+		c.Header("Retry-After", retryAfterHeader(h.retryAfter()))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many connections"})
+		return admission{}, false
+	}
+
+	if h.opts.Authenticate != nil {
+		var err error
+		if a.info, err = h.opts.Authenticate(c); err != nil {
+			h.conns.release(a.ip)
+			fail(span, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return admission{}, false
 		}
-		h.register <- cl
+		if h.banned("", a.info.UserID) {
+			h.conns.release(a.ip)
+			fail(span, ErrBanned)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "banned"})
+			return admission{}, false
+		}
+	}
+	// 續接：token 正確時沿用 session 的 ID（所以會落在同一個 shard）
+	if h.opts.ResumeBuffer > 0 && resumeToken != "" {
+		if a.session = h.resumeSession(resumeToken, a.info); a.session != nil {
+			a.info.ID = a.session.id
+			a.resuming = true
+			a.lastSeq = lastSeq
+			// 補送的訊息也要放得進佇列
+			a.sendCap += h.opts.ResumeBuffer
+		}
+	}
+	if a.info.ID == "" {
+		a.info.ID = h.newID()
+	}
+	if h.opts.ResumeBuffer > 0 && a.session == nil {
+		a.session = newSession(a.info.ID, h.opts.ResumeBuffer, h.sessionSync)
+	}
+	return a, true
+}
+
+// newClient 依 admission 建立尚未註冊的 client
+func (h *Hub) newClient(a admission, remoteAddr string, codec Codec) *Client {
+	c := &Client{
+		id:         a.info.ID,
+		info:       a.info,
+		hub:        h,
+		shard:      h.shardFor(a.info.ID),
+		codec:      codec,
+		send:       make(chan *outbound, a.sendCap),
+		rooms:      make(map[string]bool),
+		topics:     make(map[string]bool),
+		pumpDone:   make(chan struct{}),
+		readDone:   make(chan struct{}),
+		remoteAddr: remoteAddr,
+		ip:         a.ip,
+		joinedAt:   time.Now(),
+		meta:       a.meta,
+		values:     values{m: initialValues(a.keys, a.info.Values)},
+		session:    a.session,
+		resuming:   a.resuming,
+		lastSeq:    a.lastSeq,
+		egress:     h.opts.newEgressLimiter(h.opts.EgressRate),
+	}
+	if h.handlerSlots != nil {
+		c.handlerJobs = make(chan handlerJob, h.opts.HandlerQueue)
+	}
+	c.lastActive.Store(c.joinedAt.UnixNano())
+	c.readOnly.Store(a.info.ReadOnly)
+	c.addTags(a.info.Tags)
+	ctx, cancel := context.WithCancel(a.ctx)
+	stop := context.AfterFunc(h.ctx, cancel)
+	c.ctx, c.cancel = ctx, func() {
+		stop()
+		cancel()
+	}
+	return c
+}
+
+// register 交給所屬 shard；Hub 已關閉時回傳 false
+func (h *Hub) register(cl *Client) bool {
+	select {
+	case cl.shard.register <- cl:
+		return true
+	case <-cl.shard.done:
+		return false
+	}
+}
+
+// connected 註冊成功後記錄並呼叫 OnConnect
+func (h *Hub) connected(cl *Client) {
+	h.opts.Logger.Info("client connected", cl.logAttrs("user", cl.info.UserID)...)
+	if h.opts.OnConnect != nil {
+		cl.safely("OnConnect", func() { h.opts.OnConnect(cl) })
+	}
+	h.webhook(WebhookConnect, cl, nil)
+	h.emit(ClientConnected{Time: time.Now(), Client: cl})
+}
+
+// disconnected 連線結束時取消 Context、歸還名額、記錄並呼叫 OnDisconnect（在 unregister 之後呼叫）
+func (c *Client) disconnected() {
+	c.cancel()
+	c.hub.conns.release(c.ip)
+	ci := c.CloseInfo()
+	c.hub.stats.closes[ci.Kind().index()].Add(1)
+	c.hub.opts.Logger.Info("client disconnected",
+		c.logAttrs("code", ci.Code, "reason", ci.Reason, "by_server", ci.ByServer)...)
+	if c.hub.opts.OnDisconnect != nil {
+		c.safely("OnDisconnect", func() { c.hub.opts.OnDisconnect(c) })
+	}
+	c.hub.webhook(WebhookDisconnect, c, func(e *WebhookEvent) {
+		e.Code, e.Reason = ci.Code, ci.Reason
+	})
+	c.abnormalClose(ci)
+	c.hub.emit(ClientDisconnected{Time: time.Now(), Client: c, Close: ci})
+}
 
-		go cl.writePump()
-		go cl.readPump()
+// unregister 通知所屬 shard 移除 client
+func (c *Client) unregister() {
+	select {
+	case c.shard.unregister <- c:
+	case <-c.shard.done:
 	}
 }